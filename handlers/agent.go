@@ -671,8 +671,19 @@ func CreateAgent(c *gin.Context) {
 				log.Printf("⚠️  [Agent %d] Sin integración de Google - las citas no se guardarán en Sheets/Calendar", agent.ID)
 			}
 
+			// Cargar sucursal vinculada al agente (catálogo, fotos y menú)
+			var branch *models.MyBusinessInfo
+			if agent.BranchID > 0 {
+				var b models.MyBusinessInfo
+				if err := config.DB.First(&b, agent.BranchID).Error; err == nil {
+					branch = &b
+				} else {
+					log.Printf("⚠️  [Agent %d] No se pudo cargar sucursal %d: %v", agent.ID, agent.BranchID, err)
+				}
+			}
+
 			// Desplegar OrbitalBot
-			if err := orbitalService.DeployOrbitalBot(&agent, geminiAPIKey, googleCredentials); err != nil {
+			if err := orbitalService.DeployOrbitalBot(&agent, branch, geminiAPIKey, googleCredentials); err != nil {
 				log.Printf("❌ [Agent %d] Error desplegando OrbitalBot: %v", agent.ID, err)
 				agent.DeployStatus = "error"
 				config.DB.Save(&agent)
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +10,7 @@ import (
 	"attomos/config"
 	"attomos/models"
 	"attomos/services"
+	"attomos/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -32,12 +32,13 @@ type AppointmentResponse struct {
 	SheetCell string `json:"sheetCell"` // Celda en el sheet (ej: "B5")
 	SheetURL  string `json:"sheetUrl"`  // URL del sheet
 	Source    string `json:"source"`    // "manual", "sheets", "agent"
+	SeriesID  uint   `json:"seriesId"`  // Serie de citas recurrentes (0 = cita única)
+	Resources string `json:"resources"` // Recursos que ocupa (sillas, cabinas...), separados por coma
 }
 
-// GetAppointments obtiene todas las citas del usuario:
-// 1. Lee citas desde Google Sheets de cada agente conectado
-// 2. Sincroniza/guarda en la BD las nuevas (evitando duplicados)
-// 3. Devuelve las citas de la BD (fuente de verdad unificada)
+// GetAppointments devuelve las citas del usuario desde la BD (fuente de verdad
+// unificada). Las hojas de Google se sincronizan en segundo plano
+// (services.StartSheetsSync); aquí solo se pide adelantar esa sincronización.
 func GetAppointments(c *gin.Context) {
 	userInterface, exists := c.Get("user")
 	if !exists {
@@ -47,26 +48,11 @@ func GetAppointments(c *gin.Context) {
 
 	user := userInterface.(*models.User)
 
-	// ============================================
-	// PASO 1: Sincronizar citas desde Google Sheets
-	// ============================================
-	var agents []models.Agent
-	if err := config.DB.Where("user_id = ? AND google_connected = ?", user.ID, true).Find(&agents).Error; err != nil {
-		log.Printf("❌ [User %d] Error obteniendo agentes: %v", user.ID, err)
-	}
-
-	if len(agents) > 0 {
-		sheetsService := &services.GoogleSheetsService{
-			ClientID:     getGoogleClientID(),
-			ClientSecret: getGoogleClientSecret(),
-			RedirectURL:  getGoogleRedirectURL(),
-		}
-		ctx := context.Background()
-		syncAppointmentsFromSheets(ctx, sheetsService, agents, user.ID)
-	}
+	// Adelantar la sincronización con Sheets (no bloquea la respuesta)
+	services.RequestSheetsSync(user.ID)
 
 	// ============================================
-	// PASO 2: Leer todas las citas del usuario desde BD
+	// PASO 1: Leer todas las citas del usuario desde BD
 	// ============================================
 	var appointments []models.Appointment
 	if err := config.DB.
@@ -79,23 +65,17 @@ func GetAppointments(c *gin.Context) {
 	}
 
 	// ============================================
-	// PASO 3: Construir mapa de agentID → agentName
+	// PASO 2: Construir mapa de agentID → agentName
 	// ============================================
+	var agents []models.Agent
+	config.DB.Where("user_id = ?", user.ID).Select("id, name").Find(&agents)
 	agentNames := map[uint]string{}
 	for _, a := range agents {
 		agentNames[a.ID] = a.Name
 	}
-	// Completar con agentes sin Google (para citas manuales)
-	var allAgents []models.Agent
-	config.DB.Where("user_id = ?", user.ID).Select("id, name").Find(&allAgents)
-	for _, a := range allAgents {
-		if _, ok := agentNames[a.ID]; !ok {
-			agentNames[a.ID] = a.Name
-		}
-	}
 
 	// ============================================
-	// PASO 4: Convertir a AppointmentResponse
+	// PASO 3: Convertir a AppointmentResponse
 	// ============================================
 	response := make([]AppointmentResponse, 0, len(appointments))
 	for _, appt := range appointments {
@@ -122,6 +102,8 @@ func GetAppointments(c *gin.Context) {
 			SheetCell: appt.SheetRowID,
 			SheetURL:  sheetURL,
 			Source:    string(appt.Source),
+			SeriesID:  appt.SeriesID,
+			Resources: appt.Resources,
 		})
 	}
 
@@ -174,9 +156,22 @@ func CreateManualAppointment(c *gin.Context) {
 		status = models.AppointmentStatus(req.Status)
 	}
 
+	// Las citas manuales no se bloquean por disponibilidad (el dueño puede
+	// sobreagendar), pero sí ocupan el horario para los bots
+	var branchID uint
+	var resources []string
+	duration := models.DefaultServiceDuration
+	if branch := services.BranchForAgent(req.AgentID); branch != nil {
+		branchID = branch.ID
+		duration = services.ServiceDuration(branch, req.Service)
+		resources = services.ServiceResources(branch, req.Service)
+	}
+
 	appointment := models.Appointment{
 		UserID:          user.ID,
 		AgentID:         req.AgentID,
+		BranchID:        branchID,
+		DurationMinutes: duration,
 		ClientFirstName: req.ClientFirstName,
 		ClientLastName:  req.ClientLastName,
 		ClientPhone:     req.ClientPhone,
@@ -187,6 +182,7 @@ func CreateManualAppointment(c *gin.Context) {
 		Status:          status,
 		Source:          models.AppointmentSourceManual,
 	}
+	appointment.SetResources(resources)
 
 	if err := config.DB.Create(&appointment).Error; err != nil {
 		log.Printf("❌ [User %d] Error creando cita manual: %v", user.ID, err)
@@ -216,13 +212,34 @@ func UpdateAppointmentStatus(c *gin.Context) {
 
 	var req struct {
 		Status string `json:"status" binding:"required"`
+		Scope  string `json:"scope"` // En citas de una serie: "this" (por defecto) o "following"
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || !validSeriesScope(req.Scope) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido"})
 		return
 	}
 
+	// "Esta y las siguientes": se cancelan y la serie deja de generar citas
+	if req.Scope == seriesScopeFollowing && models.AppointmentStatus(req.Status) == models.AppointmentStatusCancelled {
+		var appointment models.Appointment
+		if err := config.DB.Where("id = ? AND user_id = ?", appointmentID, user.ID).First(&appointment).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+			return
+		}
+		if appointment.IsRecurring() {
+			series, cancelled, err := services.CancelSeriesFrom(&appointment)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("✅ [User %d] Cita %s y siguientes canceladas (serie %d)", user.ID, appointmentID, series.ID)
+			go services.PropagateSeriesCancel(series, cancelled)
+			c.JSON(http.StatusOK, gin.H{"success": true, "cancelled": len(cancelled)})
+			return
+		}
+	}
+
 	result := config.DB.Model(&models.Appointment{}).
 		Where("id = ? AND user_id = ?", appointmentID, user.ID).
 		Update("status", req.Status)
@@ -238,6 +255,19 @@ func UpdateAppointmentStatus(c *gin.Context) {
 	}
 
 	log.Printf("✅ [User %d] Cita %s actualizada a estado: %s", user.ID, appointmentID, req.Status)
+
+	// El horario liberado se ofrece a la lista de espera
+	if models.AppointmentStatus(req.Status) == models.AppointmentStatusCancelled {
+		var appointment models.Appointment
+		if config.DB.Where("id = ? AND user_id = ?", appointmentID, user.ID).First(&appointment).Error == nil {
+			services.OfferFreedSlot(&appointment)
+			// La ocurrencia seguiría en el evento recurrente de Calendar
+			if appointment.IsRecurring() {
+				go deleteOccurrenceEvent(appointment)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -252,8 +282,13 @@ func DeleteAppointment(c *gin.Context) {
 	user := userInterface.(*models.User)
 	appointmentID := c.Param("id")
 
-	result := config.DB.Where("id = ? AND user_id = ?", appointmentID, user.ID).
-		Delete(&models.Appointment{})
+	var appointment models.Appointment
+	if err := config.DB.Where("id = ? AND user_id = ?", appointmentID, user.ID).First(&appointment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return
+	}
+
+	result := config.DB.Delete(&appointment)
 
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error eliminando cita"})
@@ -266,6 +301,12 @@ func DeleteAppointment(c *gin.Context) {
 	}
 
 	log.Printf("✅ [User %d] Cita %s eliminada", user.ID, appointmentID)
+	if !appointment.IsCancelled() {
+		services.OfferFreedSlot(&appointment)
+		if appointment.IsRecurring() {
+			go deleteOccurrenceEvent(appointment)
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -326,21 +367,56 @@ func CreateBotAppointment(c *gin.Context) {
 		return
 	}
 
-	firstName, lastName := splitClientName(req.ClientName)
+	// Validar contra el motor de disponibilidad: dos mensajes simultáneos
+	// pueden haber visto el mismo horario libre
+	var branchID uint
+	var deposit services.DepositRequirement
+	var resources []string
+	duration := models.DefaultServiceDuration
+	if branch := services.BranchForAgent(req.AgentID); branch != nil {
+		unlock := services.LockBranch(branch.ID)
+		defer unlock()
+
+		slot, err := services.CheckSlot(branch, req.Service, req.Worker, parsedDate, 0)
+		if err != nil {
+			log.Printf("⚠️  [BotAppointment] Horario rechazado %s %s: %v", req.Date, req.Time, err)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		req.Worker = slot.Worker
+		resources = slot.Resources
+		branchID = branch.ID
+		duration = services.ServiceDuration(branch, req.Service)
+		// Clientes con inasistencias repetidas dejan anticipo para agendar
+		deposit = services.DepositRequiredFor(branch, req.Phone)
+	}
+
+	status := models.AppointmentStatusConfirmed
+	if deposit.Required {
+		// Queda pendiente hasta que el webhook confirme el pago del anticipo
+		status = models.AppointmentStatusPending
+		note := fmt.Sprintf("Anticipo requerido: $%.0f MXN (%d inasistencias)", deposit.Amount, deposit.NoShows)
+		req.Notes = strings.TrimSpace(req.Notes + "\n" + note)
+	}
+
+	firstName, lastName := utils.SplitFullName(req.ClientName)
 
 	appointment := models.Appointment{
 		UserID:          req.UserID,
 		AgentID:         req.AgentID,
+		BranchID:        branchID,
 		ClientFirstName: firstName,
 		ClientLastName:  lastName,
 		ClientPhone:     req.Phone,
 		Service:         req.Service,
 		Worker:          req.Worker,
 		Date:            parsedDate,
+		DurationMinutes: duration,
 		Notes:           req.Notes,
-		Status:          models.AppointmentStatusConfirmed,
+		Status:          status,
 		Source:          models.AppointmentSourceAgent,
 	}
+	appointment.SetResources(resources)
 
 	if err := config.DB.Create(&appointment).Error; err != nil {
 		log.Printf("❌ [BotAppointment] Error guardando cita: %v", err)
@@ -351,230 +427,104 @@ func CreateBotAppointment(c *gin.Context) {
 	log.Printf("✅ [BotAppointment] Cita creada ID=%d | %s | %s | %s %s",
 		appointment.ID, req.ClientName, req.Service, req.Date, req.Time)
 
+	// Enlace .ics para que el cliente agregue la cita a su calendario
+	icsURL, err := services.AppointmentInviteURL(&appointment)
+	if err != nil {
+		log.Printf("⚠️  [BotAppointment] No se pudo generar el enlace .ics de la cita %d: %v", appointment.ID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"id":      appointment.ID,
-		"message": "Cita guardada correctamente",
+		"success":         true,
+		"id":              appointment.ID,
+		"worker":          appointment.Worker,
+		"icsUrl":          icsURL,
+		"depositRequired": deposit.Required,
+		"depositAmount":   deposit.Amount,
+		"noShows":         deposit.NoShows,
+		"message":         "Cita guardada correctamente",
 	})
 }
 
-// ============================================
-// SINCRONIZACIÓN INTERNA (Sheets → BD)
-// ============================================
-
-// syncAppointmentsFromSheets lee los Sheets de cada agente y guarda citas nuevas en BD
-func syncAppointmentsFromSheets(ctx context.Context, sheetsService *services.GoogleSheetsService, agents []models.Agent, userID uint) {
-	for _, agent := range agents {
-		if agent.GoogleSheetID == "" {
-			continue
-		}
-
-		rawAppointments, err := readAppointmentsFromSheet(ctx, sheetsService, agent.GoogleToken, agent.GoogleSheetID, agent.ID, agent.Name)
-		if err != nil {
-			log.Printf("⚠️  [Agent %d] Error leyendo Sheet: %v", agent.ID, err)
-			continue
-		}
-
-		saved := 0
-		for _, raw := range rawAppointments {
-			// Evitar duplicados: SheetRowID único por agente
-			sheetRowID := fmt.Sprintf("agent_%d_%s", agent.ID, raw.SheetCell)
-
-			var existing models.Appointment
-			err := config.DB.Where("sheet_row_id = ? AND agent_id = ?", sheetRowID, agent.ID).
-				First(&existing).Error
-
-			if err == nil {
-				// Ya existe → actualizar estado si cambió en Sheets
-				if string(existing.Status) != raw.Status {
-					config.DB.Model(&existing).Update("status", raw.Status)
-					log.Printf("🔄 [Agent %d] Cita %s actualizada a estado: %s", agent.ID, sheetRowID, raw.Status)
-				}
-				continue
-			}
-
-			// Parsear fecha + hora
-			dateTimeStr := fmt.Sprintf("%s %s:00", raw.Date, raw.Time)
-			parsedDate, err := time.ParseInLocation("2006-01-02 15:04:05", dateTimeStr, time.Local)
-			if err != nil {
-				log.Printf("⚠️  [Agent %d] Fecha inválida en celda %s: %v", agent.ID, raw.SheetCell, err)
-				continue
-			}
-
-			// Separar nombre completo en nombre + apellido
-			firstName, lastName := splitClientName(raw.Client)
-
-			now := time.Now()
-			appt := models.Appointment{
-				UserID:          userID,
-				AgentID:         agent.ID,
-				ClientFirstName: firstName,
-				ClientLastName:  lastName,
-				ClientPhone:     raw.Phone,
-				Service:         raw.Service,
-				Worker:          raw.Worker,
-				Date:            parsedDate,
-				Status:          models.AppointmentStatus(raw.Status),
-				Source:          models.AppointmentSourceSheets,
-				SheetRowID:      sheetRowID,
-				SheetID:         agent.GoogleSheetID,
-				LastSyncedAt:    &now,
-			}
-
-			if err := config.DB.Create(&appt).Error; err != nil {
-				log.Printf("⚠️  [Agent %d] Error guardando cita %s: %v", agent.ID, sheetRowID, err)
-				continue
-			}
-			saved++
-		}
-
-		if saved > 0 {
-			log.Printf("✅ [Agent %d] %d citas nuevas sincronizadas desde Sheets", agent.ID, saved)
-		}
+// LinkBotAppointmentEvent — POST /api/bot/appointments/:id/calendar-event
+// El bot crea el evento de Calendar después de guardar la cita; con esto lo
+// liga a la cita para que reprogramarla mueva el mismo evento.
+func LinkBotAppointmentEvent(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
 	}
-}
 
-// splitClientName separa un nombre completo en nombre y apellido
-func splitClientName(fullName string) (string, string) {
-	fullName = strings.TrimSpace(fullName)
-	parts := strings.Fields(fullName)
-	if len(parts) == 0 {
-		return "", ""
-	}
-	if len(parts) == 1 {
-		return parts[0], ""
+	var req struct {
+		AgentID uint   `json:"agentId" binding:"required"`
+		EventID string `json:"eventId" binding:"required"`
 	}
-	return parts[0], strings.Join(parts[1:], " ")
-}
-
-// ============================================
-// LECTURA DESDE SHEETS (lógica original)
-// ============================================
-
-func readAppointmentsFromSheet(ctx context.Context, sheetsService *services.GoogleSheetsService, tokenJSON, sheetID string, agentID uint, agentName string) ([]AppointmentResponse, error) {
-	service, err := sheetsService.CreateSheetsService(ctx, tokenJSON)
-	if err != nil {
-		return nil, fmt.Errorf("error creando servicio: %w", err)
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
 	}
 
-	resp, err := service.Spreadsheets.Values.Get(sheetID, "Calendario!B2:H12").Do()
-	if err != nil {
-		return nil, fmt.Errorf("error leyendo sheet: %w", err)
+	result := config.DB.Model(&models.Appointment{}).
+		Where("id = ? AND agent_id = ? AND (calendar_event_id = '' OR calendar_event_id IS NULL)", c.Param("id"), req.AgentID).
+		Update("calendar_event_id", req.EventID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error ligando el evento"})
+		return
 	}
-
-	appointments := []AppointmentResponse{}
-	columns := []string{"B", "C", "D", "E", "F", "G", "H"}
-	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
-
-	for rowIdx, row := range resp.Values {
-		hour := 9 + rowIdx
-		for colIdx, cell := range row {
-			if cell == nil || cell == "" {
-				continue
-			}
-			cellContent := fmt.Sprintf("%v", cell)
-			if strings.TrimSpace(cellContent) == "" {
-				continue
-			}
-			appointment := parseAppointmentFromCell(cellContent, weekdays[colIdx], hour, columns[colIdx], rowIdx+2)
-			if appointment == nil {
-				continue
-			}
-			appointment.AgentID = agentID
-			appointment.AgentName = agentName
-			appointment.SheetURL = fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit", sheetID)
-			appointments = append(appointments, *appointment)
-		}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada o ya tiene evento"})
+		return
 	}
 
-	return appointments, nil
+	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-func parseAppointmentFromCell(content string, weekday time.Weekday, hour int, column string, row int) *AppointmentResponse {
-	lines := strings.Split(content, "\n")
-	if len(lines) < 3 {
-		return nil
-	}
-
-	appointment := &AppointmentResponse{
-		Duration: 60,
-		Status:   "confirmed",
+// GetAppointmentsSyncStatus — GET /api/appointments/sync-status
+// Estado de la sincronización en segundo plano de las hojas de cada agente.
+// La página de citas lo consulta para recargar cuando llegan cambios.
+func GetAppointmentsSyncStatus(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
 	}
+	user := userInterface.(*models.User)
 
-	contentLower := strings.ToLower(content)
-	if strings.Contains(content, "❌") ||
-		strings.Contains(contentLower, "cancelada") ||
-		strings.Contains(contentLower, "cancelado") {
-		appointment.Status = "cancelled"
+	var agents []models.Agent
+	config.DB.Where("user_id = ?", user.ID).Select("id, name").Find(&agents)
+	agentNames := map[uint]string{}
+	for _, a := range agents {
+		agentNames[a.ID] = a.Name
 	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.Contains(line, "👤") {
-			appointment.Client = strings.TrimSpace(strings.ReplaceAll(line, "👤", ""))
-		}
-		if strings.Contains(line, "📞") {
-			appointment.Phone = strings.TrimSpace(strings.ReplaceAll(line, "📞", ""))
+	syncing := false
+	var lastSuccessAt *time.Time
+	items := []gin.H{}
+	for _, state := range services.GetSheetSyncStates(user.ID) {
+		if state.Status == models.SheetSyncStatusSyncing || state.Status == models.SheetSyncStatusPending {
+			syncing = true
 		}
-		if strings.Contains(line, "✂️") || strings.Contains(line, "✂") {
-			appointment.Service = strings.TrimSpace(strings.ReplaceAll(strings.ReplaceAll(line, "✂️", ""), "✂", ""))
+		if state.LastSuccessAt != nil && (lastSuccessAt == nil || state.LastSuccessAt.After(*lastSuccessAt)) {
+			lastSuccessAt = state.LastSuccessAt
 		}
-		if strings.Contains(line, "👨‍💼") || strings.Contains(line, "👨") {
-			appointment.Worker = strings.TrimSpace(strings.ReplaceAll(strings.ReplaceAll(line, "👨‍💼", ""), "👨", ""))
-		}
-		if strings.Contains(line, "📅") {
-			dateStr := strings.TrimSpace(strings.ReplaceAll(line, "📅", ""))
-			if parsedDate, err := time.Parse("02/01/2006", dateStr); err == nil {
-				appointment.Date = parsedDate.Format("2006-01-02")
-			}
-		}
-	}
-
-	if appointment.Date == "" {
-		appointment.Date = getNextDateForWeekday(weekday)
-	}
-
-	appointment.Time = fmt.Sprintf("%02d:00", hour)
-	appointment.ID = fmt.Sprintf("%s%d", column, row)
-	appointment.SheetCell = fmt.Sprintf("%s%d", column, row)
-
-	if appointment.Client == "" || appointment.Service == "" {
-		return nil
-	}
-
-	return appointment
-}
-
-func getNextDateForWeekday(targetWeekday time.Weekday) string {
-	now := time.Now()
-	currentWeekday := now.Weekday()
-	daysUntil := int(targetWeekday - currentWeekday)
-	if daysUntil <= 0 {
-		daysUntil += 7
-	}
-	return now.AddDate(0, 0, daysUntil).Format("2006-01-02")
-}
-
-func getGoogleClientID() string {
-	clientID := config.GetEnv("GOOGLE_INTEGRATION_CLIENT_ID")
-	if clientID == "" {
-		clientID = config.GetEnv("GOOGLE_CLIENT_ID")
-	}
-	return clientID
-}
-
-func getGoogleClientSecret() string {
-	clientSecret := config.GetEnv("GOOGLE_INTEGRATION_CLIENT_SECRET")
-	if clientSecret == "" {
-		clientSecret = config.GetEnv("GOOGLE_CLIENT_SECRET")
+		items = append(items, gin.H{
+			"agentId":       state.AgentID,
+			"agentName":     agentNames[state.AgentID],
+			"status":        state.Status,
+			"lastSyncAt":    state.LastSyncAt,
+			"lastSuccessAt": state.LastSuccessAt,
+			"nextSyncAt":    state.NextSyncAt,
+			"failures":      state.Failures,
+			"lastError":     state.LastError,
+			"imported":      state.Imported,
+			"updated":       state.Updated,
+			"conflicts":     state.Conflicts,
+		})
 	}
-	return clientSecret
-}
 
-func getGoogleRedirectURL() string {
-	redirectURL := config.GetEnv("GOOGLE_INTEGRATION_REDIRECT_URL")
-	if redirectURL == "" {
-		redirectURL = config.GetEnv("GOOGLE_REDIRECT_URL")
-	}
-	return redirectURL
+	c.JSON(http.StatusOK, gin.H{
+		"syncing":       syncing,
+		"lastSuccessAt": lastSuccessAt,
+		"agents":        items,
+	})
 }
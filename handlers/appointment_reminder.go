@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+	"attomos/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReminderReplyRequest respuesta de un cliente a un recordatorio de cita
+type ReminderReplyRequest struct {
+	AgentID uint   `json:"agentId" binding:"required"`
+	Phone   string `json:"phone" binding:"required"`
+	Action  string `json:"action" binding:"required"` // confirmar | cancelar
+}
+
+// HandleBotReminderReply — POST /api/bot/appointments/reminder-reply
+// El bot lo llama cuando un cliente responde "confirmar" o "cancelar".
+// Solo aplica si el cliente tiene un recordatorio enviado sin responder para
+// una cita futura; si no, responde handled=false y el bot sigue su flujo normal.
+func HandleBotReminderReply(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
+	}
+
+	var req ReminderReplyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action != "confirmar" && action != "cancelar" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Acción inválida, usa confirmar o cancelar"})
+		return
+	}
+
+	phone := utils.PhoneKey(req.Phone)
+	if phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Teléfono inválido"})
+		return
+	}
+
+	var reminders []models.AppointmentReminder
+	config.DB.Preload("Appointment").
+		Where("agent_id = ? AND status = ? AND responded_at IS NULL", req.AgentID, models.ReminderStatusSent).
+		Order("sent_at DESC").
+		Limit(50).
+		Find(&reminders)
+
+	now := time.Now()
+	var reminder *models.AppointmentReminder
+	for i := range reminders {
+		r := &reminders[i]
+		if utils.PhoneKey(r.ClientPhone) != phone {
+			continue
+		}
+		apt := &r.Appointment
+		if apt.ID == 0 || apt.Date.Before(now) || apt.IsCancelled() || apt.IsCompleted() {
+			continue
+		}
+		reminder = r
+		break
+	}
+
+	if reminder == nil {
+		c.JSON(http.StatusOK, gin.H{"handled": false})
+		return
+	}
+
+	apt := &reminder.Appointment
+	var message string
+	if action == "confirmar" {
+		apt.Confirm()
+		message = "✅ ¡Gracias! Tu cita quedó confirmada. Te esperamos."
+	} else {
+		apt.Cancel()
+		message = "❌ Tu cita fue cancelada. Si deseas agendar otra fecha, escríbenos."
+	}
+
+	respondedAt := time.Now()
+	tx := config.DB.Begin()
+	if err := tx.Model(apt).Update("status", apt.Status).Error; err != nil {
+		tx.Rollback()
+		log.Printf("❌ [Reminders] Error actualizando cita %d: %v", apt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando la cita"})
+		return
+	}
+	// Una respuesta aplica a todos los recordatorios pendientes de la misma cita
+	if err := tx.Model(&models.AppointmentReminder{}).
+		Where("appointment_id = ? AND responded_at IS NULL", apt.ID).
+		Updates(map[string]interface{}{"response": action, "responded_at": &respondedAt}).Error; err != nil {
+		tx.Rollback()
+		log.Printf("❌ [Reminders] Error guardando respuesta de cita %d: %v", apt.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la respuesta"})
+		return
+	}
+	tx.Commit()
+
+	log.Printf("✅ [Reminders] Cita %d → %s por respuesta del cliente", apt.ID, apt.Status)
+	if apt.IsCancelled() {
+		// Liberar el horario también en Calendar y en la hoja
+		go func(apt models.Appointment) {
+			if err := services.DeleteAppointmentCalendarEvent(&apt); err != nil {
+				log.Printf("⚠️  [Reminders] No se pudo eliminar el evento de la cita %d: %v", apt.ID, err)
+			}
+			services.ClearAppointmentFromSheets(&apt)
+		}(*apt)
+		services.OfferFreedSlot(apt)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"handled":    true,
+		"action":     action,
+		"message":    message,
+		"clientName": strings.TrimSpace(apt.GetClientFullName()),
+		"date":       apt.Date.Format("2006-01-02"),
+		"time":       apt.Date.Format("15:04"),
+		"service":    apt.Service,
+		"worker":     apt.Worker,
+	})
+}
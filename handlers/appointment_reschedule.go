@@ -0,0 +1,280 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+	"attomos/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RescheduleRequest nuevo horario de una cita (panel y bots)
+type RescheduleRequest struct {
+	Date    string `json:"date" binding:"required"` // YYYY-MM-DD
+	Time    string `json:"time" binding:"required"` // HH:MM
+	Service string `json:"service"`
+	Worker  string `json:"worker"`
+}
+
+// RescheduleAppointment — PATCH /api/appointments/:id
+// Cambia fecha, hora, servicio o trabajador de una cita desde el panel.
+// Responde 409 si el horario está ocupado, salvo que venga force=true.
+func RescheduleAppointment(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var req struct {
+		RescheduleRequest
+		Force        bool   `json:"force"`
+		NotifyClient bool   `json:"notifyClient"`
+		Scope        string `json:"scope"` // En citas de una serie: "this" (por defecto) o "following"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", req.Date+" "+req.Time, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha/hora inválido. Use YYYY-MM-DD y HH:MM"})
+		return
+	}
+
+	var appointment models.Appointment
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&appointment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita no encontrada"})
+		return
+	}
+
+	if !validSeriesScope(req.Scope) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Alcance inválido, usa this o following"})
+		return
+	}
+
+	change := services.RescheduleChange{
+		Start:   start,
+		Service: req.Service,
+		Worker:  req.Worker,
+		Force:   req.Force,
+	}
+
+	// "Esta y las siguientes": la serie se divide en una nueva con este horario
+	if req.Scope == seriesScopeFollowing && appointment.IsRecurring() {
+		split, err := services.RescheduleSeriesFrom(&appointment, change)
+		if err != nil {
+			respondRescheduleError(c, err)
+			return
+		}
+
+		log.Printf("✅ [User %d] Cita %d y siguientes reprogramadas desde el panel (serie %d)", user.ID, appointment.ID, split.Series.ID)
+
+		moved := appointment
+		go func() {
+			services.PropagateSeriesSplit(split)
+			if req.NotifyClient {
+				notifyReschedule(&moved)
+			}
+		}()
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"appointment": appointment,
+			"seriesId":    split.Series.ID,
+			"moved":       len(split.Moved),
+			"cancelled":   len(split.Cancelled),
+			"conflicts":   seriesConflictsResponse(split.Conflicts),
+		})
+		return
+	}
+
+	oldDate, err := services.RescheduleAppointment(&appointment, change)
+	if err != nil {
+		respondRescheduleError(c, err)
+		return
+	}
+
+	log.Printf("✅ [User %d] Cita %d reprogramada desde el panel", user.ID, appointment.ID)
+
+	moved := appointment
+	go func() {
+		services.PropagateReschedule(&moved, oldDate)
+		if req.NotifyClient {
+			notifyReschedule(&moved)
+		}
+	}()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"appointment": appointment,
+	})
+}
+
+// ============================================
+// BOTS
+// ============================================
+
+// GetBotUpcomingAppointment — GET /api/bot/appointments/upcoming?agentId=&phone=
+// Próxima cita activa del cliente, para que el bot confirme cuál reprogramar.
+// Autenticado con BOT_API_TOKEN (Bearer token interno).
+func GetBotUpcomingAppointment(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
+	}
+
+	var agentID uint
+	fmt.Sscanf(c.Query("agentId"), "%d", &agentID)
+	phone := utils.PhoneKey(c.Query("phone"))
+	if agentID == 0 || phone == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agentId y phone son requeridos"})
+		return
+	}
+
+	appointment := findUpcomingClientAppointment(agentID, phone)
+	if appointment == nil {
+		c.JSON(http.StatusOK, gin.H{"found": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"found":       true,
+		"appointment": botAppointmentSummary(appointment),
+	})
+}
+
+// RescheduleBotAppointment — POST /api/bot/appointments/reschedule
+// El bot mueve la próxima cita del cliente al horario que pidió. El backend
+// propaga el cambio a Sheets y al evento de Calendar ligado a la cita.
+func RescheduleBotAppointment(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
+	}
+
+	var req struct {
+		RescheduleRequest
+		AgentID       uint   `json:"agentId" binding:"required"`
+		Phone         string `json:"phone" binding:"required"`
+		AppointmentID uint   `json:"appointmentId"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", req.Date+" "+req.Time, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha/hora inválido"})
+		return
+	}
+
+	appointment := findUpcomingClientAppointment(req.AgentID, utils.PhoneKey(req.Phone))
+	if appointment == nil || (req.AppointmentID > 0 && appointment.ID != req.AppointmentID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "El cliente no tiene una cita próxima"})
+		return
+	}
+
+	oldDate, err := services.RescheduleAppointment(appointment, services.RescheduleChange{
+		Start:   start,
+		Service: req.Service,
+		Worker:  req.Worker,
+	})
+	if err != nil {
+		log.Printf("⚠️  [BotAppointment] Reprogramación rechazada (cita %d): %v", appointment.ID, err)
+		respondRescheduleError(c, err)
+		return
+	}
+
+	services.PropagateReschedule(appointment, oldDate)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"previous":    gin.H{"date": oldDate.Format("2006-01-02"), "time": oldDate.Format("15:04")},
+		"appointment": botAppointmentSummary(appointment),
+	})
+}
+
+// findUpcomingClientAppointment próxima cita pendiente o confirmada del
+// teléfono en el agente (o en su sucursal, p. ej. reservas de Ninda)
+func findUpcomingClientAppointment(agentID uint, phone string) *models.Appointment {
+	var agent models.Agent
+	if err := config.DB.Select("id", "user_id", "branch_id").First(&agent, agentID).Error; err != nil {
+		return nil
+	}
+
+	query := config.DB.
+		Where("user_id = ? AND date > ? AND client_phone <> ''", agent.UserID, time.Now()).
+		Where("status IN ?", []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed})
+	if agent.BranchID > 0 {
+		query = query.Where("(agent_id = ? OR branch_id = ?)", agent.ID, agent.BranchID)
+	} else {
+		query = query.Where("agent_id = ?", agent.ID)
+	}
+
+	var appointments []models.Appointment
+	query.Order("date ASC").Limit(200).Find(&appointments)
+
+	for i := range appointments {
+		if utils.PhoneKey(appointments[i].ClientPhone) == phone {
+			return &appointments[i]
+		}
+	}
+	return nil
+}
+
+// botAppointmentSummary datos de la cita que el bot le muestra al cliente
+func botAppointmentSummary(appt *models.Appointment) gin.H {
+	return gin.H{
+		"id":         appt.ID,
+		"clientName": strings.TrimSpace(appt.GetClientFullName()),
+		"date":       appt.Date.Format("2006-01-02"),
+		"time":       appt.Date.Format("15:04"),
+		"service":    appt.Service,
+		"worker":     appt.Worker,
+	}
+}
+
+// respondRescheduleError 409 si el horario está ocupado, 400 en otro caso
+func respondRescheduleError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrSlotUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// notifyReschedule avisa al cliente por WhatsApp del nuevo horario
+func notifyReschedule(appt *models.Appointment) {
+	if appt.AgentID == 0 || appt.ClientPhone == "" {
+		return
+	}
+	var agent models.Agent
+	if err := config.DB.First(&agent, appt.AgentID).Error; err != nil || !agent.IsActive {
+		return
+	}
+
+	msg := fmt.Sprintf("📅 *Tu cita fue reprogramada*\n\n✂️ %s\n🗓️ %s a las %s",
+		appt.Service, appt.Date.Format("02/01/2006"), appt.Date.Format("15:04"))
+	if appt.Worker != "" {
+		msg += fmt.Sprintf("\n💈 Con: %s", appt.Worker)
+	}
+	msg += "\n\nSi no te acomoda, respóndenos por aquí. 😊"
+
+	if err := services.SendWhatsAppViaAgent(&agent, appt.ClientPhone, msg, models.TemplatePurposeAppointment); err != nil {
+		log.Printf("⚠️  [Reschedule] No se pudo avisar al cliente de la cita %d: %v", appt.ID, err)
+	}
+}
@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Alcance de un cambio a una cita de una serie
+const (
+	seriesScopeThis      = "this"      // Solo esta ocurrencia (por defecto)
+	seriesScopeFollowing = "following" // Esta y las siguientes
+)
+
+// validSeriesScope alcance vacío (= "this") o uno de los soportados
+func validSeriesScope(scope string) bool {
+	return scope == "" || scope == seriesScopeThis || scope == seriesScopeFollowing
+}
+
+// CreateSeriesRequest body de POST /api/appointment-series
+type CreateSeriesRequest struct {
+	AgentID         uint   `json:"agentId" binding:"required"`
+	ClientFirstName string `json:"clientFirstName" binding:"required"`
+	ClientLastName  string `json:"clientLastName" binding:"required"`
+	ClientPhone     string `json:"clientPhone"`
+	Service         string `json:"service"`
+	Worker          string `json:"worker"`
+	Date            string `json:"date" binding:"required"` // YYYY-MM-DD, primera cita
+	Time            string `json:"time" binding:"required"` // HH:MM
+	Notes           string `json:"notes"`
+	Frequency       string `json:"frequency" binding:"required"` // weekly, biweekly, monthly
+	Count           int    `json:"count"`                        // Número de citas (0 = sin límite)
+	Until           string `json:"until"`                        // YYYY-MM-DD, último día (opcional)
+}
+
+// CreateAppointmentSeries — POST /api/appointment-series
+// Crea una serie de citas recurrentes desde el panel. Las ocurrencias que
+// caen en día festivo de la sucursal se saltan; los empalmes con otras citas
+// no bloquean (como en las citas manuales) pero se reportan.
+func CreateAppointmentSeries(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var req CreateSeriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos", "details": err.Error()})
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", req.Date+" "+req.Time, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha/hora inválido. Use YYYY-MM-DD y HH:MM"})
+		return
+	}
+
+	var until *time.Time
+	if req.Until != "" {
+		t, err := time.ParseInLocation("2006-01-02", req.Until, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha de fin inválido, usa YYYY-MM-DD"})
+			return
+		}
+		until = &t
+	}
+
+	var agent models.Agent
+	if err := config.DB.Where("id = ? AND user_id = ?", req.AgentID, user.ID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agente no encontrado"})
+		return
+	}
+
+	series := models.AppointmentSeries{
+		UserID:          user.ID,
+		AgentID:         agent.ID,
+		ClientFirstName: strings.TrimSpace(req.ClientFirstName),
+		ClientLastName:  strings.TrimSpace(req.ClientLastName),
+		ClientPhone:     req.ClientPhone,
+		Service:         strings.TrimSpace(req.Service),
+		Worker:          strings.TrimSpace(req.Worker),
+		Notes:           req.Notes,
+		Frequency:       models.RecurrenceFrequency(req.Frequency),
+		StartDate:       start,
+		Until:           until,
+		Count:           req.Count,
+	}
+
+	result, err := services.CreateSeries(&series)
+	if err != nil {
+		log.Printf("⚠️  [User %d] No se pudo crear la serie: %v", user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("✅ [User %d] Serie %d creada con %d cita(s)", user.ID, series.ID, len(result.Created))
+
+	synced := series
+	go func() {
+		if err := services.SyncSeriesCalendar(&synced); err != nil {
+			log.Printf("⚠️  [Series] Calendar de la serie %d: %v", synced.ID, err)
+		}
+	}()
+
+	holidays := make([]string, 0, len(result.Holidays))
+	for _, d := range result.Holidays {
+		holidays = append(holidays, d.Format("2006-01-02"))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"series":    seriesResponse(&series),
+		"created":   len(result.Created),
+		"holidays":  holidays,
+		"conflicts": seriesConflictsResponse(result.Conflicts),
+	})
+}
+
+// GetAppointmentSeries — GET /api/appointment-series/:id
+// Regla de la serie y sus citas
+func GetAppointmentSeries(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var series models.AppointmentSeries
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&series).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Serie no encontrada"})
+		return
+	}
+
+	var appointments []models.Appointment
+	config.DB.Where("series_id = ?", series.ID).Order("series_index ASC").Find(&appointments)
+
+	occurrences := make([]gin.H, 0, len(appointments))
+	for _, appt := range appointments {
+		occurrences = append(occurrences, gin.H{
+			"id":     appt.ID,
+			"index":  appt.SeriesIndex,
+			"date":   appt.Date.Format("2006-01-02"),
+			"time":   appt.Date.Format("15:04"),
+			"worker": appt.Worker,
+			"status": appt.Status,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series":       seriesResponse(&series),
+		"appointments": occurrences,
+	})
+}
+
+func seriesResponse(series *models.AppointmentSeries) gin.H {
+	until := ""
+	if series.Until != nil {
+		until = series.Until.Format("2006-01-02")
+	}
+	return gin.H{
+		"id":        series.ID,
+		"client":    strings.TrimSpace(series.ClientFirstName + " " + series.ClientLastName),
+		"service":   series.Service,
+		"worker":    series.Worker,
+		"frequency": series.Frequency,
+		"startDate": series.StartDate.Format("2006-01-02"),
+		"time":      series.StartDate.Format("15:04"),
+		"count":     series.Count,
+		"until":     until,
+		"generated": series.Generated,
+		"status":    series.Status,
+		"rrule":     series.RRule(),
+	}
+}
+
+// seriesConflictsResponse ocurrencias que quedaron empalmadas con otra cita
+func seriesConflictsResponse(conflicts []services.SeriesConflict) []gin.H {
+	response := make([]gin.H, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		response = append(response, gin.H{
+			"date":   conflict.Date.Format("2006-01-02"),
+			"time":   conflict.Date.Format("15:04"),
+			"reason": conflict.Reason,
+		})
+	}
+	return response
+}
+
+// deleteOccurrenceEvent quita del evento recurrente la ocurrencia de una cita
+// cancelada o eliminada ("solo esta")
+func deleteOccurrenceEvent(appt models.Appointment) {
+	if err := services.DeleteAppointmentCalendarEvent(&appt); err != nil {
+		log.Printf("⚠️  [Series] Calendar de la cita %d: %v", appt.ID, err)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// GET /api/bot/availability?agentId=&service=&worker=&date=YYYY-MM-DD
+// Horarios libres de la sucursal del agente. Lo usan los bots en lugar de
+// la cuadrícula "Calendario" de Sheets.
+// Autenticado con BOT_API_TOKEN (Bearer token interno)
+// ============================================
+func GetBotAvailability(c *gin.Context) {
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+		return
+	}
+
+	agentID, _ := strconv.ParseUint(c.Query("agentId"), 10, 64)
+	if agentID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agentId es requerido"})
+		return
+	}
+
+	branch := services.BranchForAgent(uint(agentID))
+	if branch == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "El agente no tiene sucursal asignada"})
+		return
+	}
+
+	respondAvailability(c, branch)
+}
+
+// ============================================
+// GET /api/availability/:branch_id?service=&worker=&date=YYYY-MM-DD
+// Misma consulta desde el panel, para el dueño de la sucursal
+// ============================================
+func GetBranchAvailability(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("branch_id"), user.ID).First(&branch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sucursal no encontrada"})
+		return
+	}
+
+	respondAvailability(c, &branch)
+}
+
+func respondAvailability(c *gin.Context, branch *models.MyBusinessInfo) {
+	date, err := time.ParseInLocation("2006-01-02", c.Query("date"), time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date inválida, use YYYY-MM-DD"})
+		return
+	}
+
+	result, err := services.GetAvailability(branch, c.Query("service"), c.Query("worker"), date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ============================================================
@@ -118,19 +119,29 @@ func SaveMyBusiness(c *gin.Context) {
 		}
 	}
 
-	// Mapear datos del request al modelo
-	mapRequestToBranch(&branch, req, user)
+	if branch.ID == 0 {
+		// Mapear datos del request al modelo
+		mapRequestToBranch(&branch, req, user)
 
-	// Auto-generar nombre desde dirección
-	branch.UpdateBranchName()
+		// Auto-generar nombre desde dirección
+		branch.UpdateBranchName()
 
-	if branch.ID == 0 {
 		if err := config.DB.Create(&branch).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al crear sucursal: " + err.Error()})
 			return
 		}
 	} else {
-		if err := config.DB.Save(&branch).Error; err != nil {
+		// Mismo bloqueo que toman los pedidos al descontar existencias: las
+		// que el dueño no editó se conservan con su valor vigente
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&branch, branch.ID).Error; err != nil {
+				return err
+			}
+			mapRequestToBranch(&branch, req, user)
+			branch.UpdateBranchName()
+			return tx.Save(&branch).Error
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al guardar sucursal: " + err.Error()})
 			return
 		}
@@ -293,6 +304,8 @@ func mapRequestToBranch(branch *models.MyBusinessInfo, req BranchRequest, user *
 		State:          req.Location.State,
 		Country:        req.Location.Country,
 		PostalCode:     req.Location.PostalCode,
+		Latitude:       req.Location.Latitude,
+		Longitude:      req.Location.Longitude,
 	}
 
 	branch.SocialMedia = models.BusinessSocialMedia{
@@ -340,6 +353,26 @@ func mapRequestToBranch(branch *models.MyBusinessInfo, req BranchRequest, user *
 			PromoDateStart:  s.PromoDateStart,
 			PromoDateEnd:    s.PromoDateEnd,
 			InStock:         s.InStock,
+			DurationMinutes: s.DurationMinutes,
+			TrackStock:      s.TrackStock,
+			Stock:           s.Stock,
+			LowStockAlert:   s.LowStockAlert,
+			Modifiers:       normalizeModifierGroups(s.Modifiers),
+		}
+		// Con inventario la disponibilidad sigue a las existencias: sin
+		// existencias se agota y al reabastecer vuelve a venderse solo
+		if s.TrackStock {
+			prev, _ := branch.FindService(s.Title)
+			// Si el dueño no tocó las existencias se conservan las guardadas,
+			// que los pedidos pudieron descontar mientras editaba
+			if prev.TrackStock && s.StockLoaded != nil && s.Stock == *s.StockLoaded {
+				branchServices[i].Stock = prev.Stock
+			}
+			if branchServices[i].Stock <= 0 {
+				branchServices[i].InStock = false
+			} else if !prev.TrackStock || prev.Stock <= 0 {
+				branchServices[i].InStock = true
+			}
 		}
 	}
 	branch.Services = branchServices
@@ -351,9 +384,84 @@ func mapRequestToBranch(branch *models.MyBusinessInfo, req BranchRequest, user *
 			StartTime: w.StartTime,
 			EndTime:   w.EndTime,
 			Days:      w.Days,
+			Services:  w.Services,
 		}
 	}
 	branch.Workers = workers
+
+	resources := make(models.BranchResources, 0, len(req.Resources))
+	for _, r := range req.Resources {
+		if strings.TrimSpace(r.Name) == "" {
+			continue
+		}
+		resources = append(resources, models.BranchResource{
+			Name:     strings.TrimSpace(r.Name),
+			Capacity: r.Capacity,
+			Services: r.Services,
+		})
+	}
+	branch.Resources = resources
+
+	zones := make(models.BranchDeliveryZones, 0, len(req.DeliveryZones))
+	for _, z := range req.DeliveryZones {
+		zone := models.DeliveryZone{
+			Name:       strings.TrimSpace(z.Name),
+			Type:       z.Type,
+			Fee:        z.Fee,
+			MinOrder:   z.MinOrder,
+			ETAMinutes: z.ETAMinutes,
+		}
+		switch z.Type {
+		case models.DeliveryZonePostalCodes:
+			for _, pc := range z.PostalCodes {
+				if pc = strings.TrimSpace(pc); pc != "" {
+					zone.PostalCodes = append(zone.PostalCodes, pc)
+				}
+			}
+			if len(zone.PostalCodes) == 0 {
+				continue
+			}
+		case models.DeliveryZoneRadius:
+			if z.RadiusKm <= 0 {
+				continue
+			}
+			zone.RadiusKm = z.RadiusKm
+		case models.DeliveryZonePolygon:
+			if len(z.Polygon) < 3 {
+				continue
+			}
+			zone.Polygon = z.Polygon
+		default:
+			continue
+		}
+		if zone.Name == "" {
+			zone.Name = fmt.Sprintf("Zona %d", len(zones)+1)
+		}
+		zones = append(zones, zone)
+	}
+	branch.DeliveryZones = zones
+}
+
+// normalizeModifierGroups descarta grupos sin nombre u opciones y opciones
+// sin nombre del editor de variantes y extras
+func normalizeModifierGroups(groups []models.ModifierGroup) []models.ModifierGroup {
+	clean := make([]models.ModifierGroup, 0, len(groups))
+	for _, g := range groups {
+		g.Name = strings.TrimSpace(g.Name)
+		options := make([]models.ModifierOption, 0, len(g.Options))
+		for _, o := range g.Options {
+			o.Name = strings.TrimSpace(o.Name)
+			if o.Name != "" {
+				options = append(options, o)
+			}
+		}
+		if g.Name == "" || len(options) == 0 {
+			continue
+		}
+		g.Options = options
+		clean = append(clean, g)
+	}
+	return clean
 }
 
 func buildBranchResponse(b *models.MyBusinessInfo) gin.H {
@@ -380,12 +488,27 @@ func buildBranchResponse(b *models.MyBusinessInfo) gin.H {
 			"promoDateStart":  s.PromoDateStart,
 			"promoDateEnd":    s.PromoDateEnd,
 			"inStock":         s.InStock,
+			"durationMinutes": s.DurationMinutes,
+			"trackStock":      s.TrackStock,
+			"stock":           s.Stock,
+			"lowStockAlert":   s.LowStockAlert,
+			"modifiers":       s.Modifiers,
 		}
 	}
 
 	workers := make([]gin.H, len(b.Workers))
 	for i, w := range b.Workers {
-		workers[i] = gin.H{"name": w.Name, "startTime": w.StartTime, "endTime": w.EndTime, "days": w.Days}
+		workers[i] = gin.H{"name": w.Name, "startTime": w.StartTime, "endTime": w.EndTime, "days": w.Days, "services": w.Services}
+	}
+
+	resources := make([]gin.H, len(b.Resources))
+	for i, r := range b.Resources {
+		resources[i] = gin.H{"name": r.Name, "capacity": r.Units(), "services": r.Services}
+	}
+
+	deliveryZones := b.DeliveryZones
+	if deliveryZones == nil {
+		deliveryZones = models.BranchDeliveryZones{}
 	}
 
 	return gin.H{
@@ -411,13 +534,16 @@ func buildBranchResponse(b *models.MyBusinessInfo) gin.H {
 			"number": b.Location.Number, "neighborhood": b.Location.Neighborhood,
 			"city": b.Location.City, "state": b.Location.State,
 			"country": b.Location.Country, "postalCode": b.Location.PostalCode,
+			"latitude": b.Location.Latitude, "longitude": b.Location.Longitude,
 		},
 		"social": gin.H{
 			"facebook": b.SocialMedia.Facebook, "instagram": b.SocialMedia.Instagram,
 			"twitter": b.SocialMedia.Twitter, "linkedin": b.SocialMedia.LinkedIn,
 		},
-		"services": svcList,
-		"workers":  workers,
+		"services":      svcList,
+		"workers":       workers,
+		"resources":     resources,
+		"deliveryZones": deliveryZones,
 	}
 }
 
@@ -436,7 +562,8 @@ func buildEmptyBranchResponse(user *models.User, num int) gin.H {
 			"thursday": defaultDay, "friday": defaultDay, "saturday": defaultDay,
 			"sunday": gin.H{"isOpen": false, "open": "09:00", "close": "20:00"},
 		},
-		"holidays": []gin.H{}, "services": []gin.H{}, "workers": []gin.H{},
+		"holidays": []gin.H{}, "services": []gin.H{}, "workers": []gin.H{}, "resources": []gin.H{},
+		"deliveryZones": []gin.H{},
 		"location": gin.H{
 			"address": "", "betweenStreets": "", "number": "", "neighborhood": "",
 			"city": "", "state": "", "country": "", "postalCode": "",
@@ -475,15 +602,18 @@ func getTypeName(code string) string {
 // ============================================================
 
 type BranchRequest struct {
-	BranchID    uint          `json:"branchId"`
-	PhoneNumber string        `json:"phoneNumber"`
-	Business    BusinessInfo  `json:"business"`
-	Schedule    ScheduleInfo  `json:"schedule"`
-	Holidays    []HolidayInfo `json:"holidays"`
-	Location    LocationInfo  `json:"location"`
-	Social      SocialInfo    `json:"social"`
-	Services    []ServiceInfo `json:"services"`
-	Workers     []WorkerInfo  `json:"workers"`
+	BranchID    uint           `json:"branchId"`
+	PhoneNumber string         `json:"phoneNumber"`
+	Business    BusinessInfo   `json:"business"`
+	Schedule    ScheduleInfo   `json:"schedule"`
+	Holidays    []HolidayInfo  `json:"holidays"`
+	Location    LocationInfo   `json:"location"`
+	Social      SocialInfo     `json:"social"`
+	Services    []ServiceInfo  `json:"services"`
+	Workers     []WorkerInfo   `json:"workers"`
+	Resources   []ResourceInfo `json:"resources"`
+
+	DeliveryZones []models.DeliveryZone `json:"deliveryZones"`
 }
 
 type ProfileRequest struct {
@@ -529,14 +659,16 @@ type HolidayInfo struct {
 }
 
 type LocationInfo struct {
-	Address        string `json:"address"`
-	BetweenStreets string `json:"betweenStreets"`
-	Number         string `json:"number"`
-	Neighborhood   string `json:"neighborhood"`
-	City           string `json:"city"`
-	State          string `json:"state"`
-	Country        string `json:"country"`
-	PostalCode     string `json:"postalCode"`
+	Address        string  `json:"address"`
+	BetweenStreets string  `json:"betweenStreets"`
+	Number         string  `json:"number"`
+	Neighborhood   string  `json:"neighborhood"`
+	City           string  `json:"city"`
+	State          string  `json:"state"`
+	Country        string  `json:"country"`
+	PostalCode     string  `json:"postalCode"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
 }
 
 type SocialInfo struct {
@@ -561,6 +693,13 @@ type ServiceInfo struct {
 	PromoDateStart  string   `json:"promoDateStart"`  // "2025-01-15"
 	PromoDateEnd    string   `json:"promoDateEnd"`    // "2025-02-28"
 	InStock         bool     `json:"inStock"`
+	DurationMinutes int      `json:"durationMinutes"`
+	TrackStock      bool     `json:"trackStock"`
+	Stock           int      `json:"stock"`
+	StockLoaded     *int     `json:"stockLoaded"` // existencias que mostraba el formulario
+	LowStockAlert   int      `json:"lowStockAlert"`
+
+	Modifiers []models.ModifierGroup `json:"modifiers"`
 }
 
 type WorkerInfo struct {
@@ -568,6 +707,14 @@ type WorkerInfo struct {
 	StartTime string   `json:"startTime"`
 	EndTime   string   `json:"endTime"`
 	Days      []string `json:"days"`
+	Services  []string `json:"services"`
+}
+
+// ResourceInfo sillas, cabinas, canchas... de la sucursal
+type ResourceInfo struct {
+	Name     string   `json:"name"`
+	Capacity int      `json:"capacity"`
+	Services []string `json:"services"` // vacío = todos los servicios
 }
 
 // Para evitar "declared but not used"
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCalendarFeeds — GET /api/calendar-feeds
+// URLs secretas de suscripción ICS de cada sucursal y de cada trabajador.
+// Los feeds se crean la primera vez que se consultan.
+func GetCalendarFeeds(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var branches []models.MyBusinessInfo
+	if err := config.DB.Where("user_id = ?", user.ID).Order("branch_number asc").Find(&branches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error obteniendo sucursales"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(branches))
+	for _, branch := range branches {
+		workers := []string{""}
+		for _, w := range branch.Workers {
+			if name := strings.TrimSpace(w.Name); name != "" {
+				workers = append(workers, name)
+			}
+		}
+
+		feeds := make([]gin.H, 0, len(workers))
+		for _, worker := range workers {
+			feed, err := services.EnsureCalendarFeed(user.ID, branch.ID, worker)
+			if err != nil {
+				log.Printf("⚠️  [User %d] Error creando feed ICS (sucursal %d, %q): %v", user.ID, branch.ID, worker, err)
+				continue
+			}
+			feeds = append(feeds, calendarFeedResponse(feed))
+		}
+
+		result = append(result, gin.H{
+			"branchId":   branch.ID,
+			"branchName": branch.BranchName,
+			"feeds":      feeds,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"branches": result})
+}
+
+// RotateCalendarFeed — POST /api/calendar-feeds/:id/rotate
+// Genera una URL nueva; la anterior deja de funcionar (p. ej. si se compartió
+// con alguien que ya no trabaja en la sucursal).
+func RotateCalendarFeed(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var feed models.CalendarFeed
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&feed).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Calendario no encontrado"})
+		return
+	}
+
+	if err := services.RotateCalendarFeed(&feed); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generando la nueva URL"})
+		return
+	}
+
+	log.Printf("🔑 [User %d] URL del feed ICS %d regenerada", user.ID, feed.ID)
+	c.JSON(http.StatusOK, gin.H{"success": true, "feed": calendarFeedResponse(&feed)})
+}
+
+func calendarFeedResponse(feed *models.CalendarFeed) gin.H {
+	return gin.H{
+		"id":     feed.ID,
+		"worker": feed.Worker,
+		"url":    services.CalendarFeedURL(feed),
+	}
+}
+
+// ============================================
+// PÚBLICO (el token es la autenticación)
+// ============================================
+
+// ServeCalendarFeed — GET /ics/feeds/:token
+// Feed de suscripción para Apple Calendar, Outlook, Thunderbird, etc.
+func ServeCalendarFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	var feed models.CalendarFeed
+	if token == "" || config.DB.Where("token = ?", token).First(&feed).Error != nil {
+		c.String(http.StatusNotFound, "Calendario no encontrado")
+		return
+	}
+
+	ics, err := services.CalendarFeedICS(&feed)
+	if err != nil {
+		c.String(http.StatusNotFound, "Calendario no encontrado")
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Content-Disposition", `inline; filename="citas.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(ics))
+}
+
+// ServeAppointmentInvite — GET /ics/citas/:token
+// Invitación .ics de una cita; es el enlace que recibe el cliente en la
+// confirmación del bot.
+func ServeAppointmentInvite(c *gin.Context) {
+	ics, err := services.AppointmentInviteICS(strings.TrimSuffix(c.Param("token"), ".ics"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Cita no encontrada")
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Content-Disposition", `attachment; filename="cita.ics"`)
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(ics))
+}
@@ -10,6 +10,8 @@ import (
 
 	"attomos/config"
 	"attomos/models"
+	"attomos/services"
+	"attomos/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -26,21 +28,23 @@ type HistorialResponse struct {
 	Worker        string `json:"worker"`
 	Date          string `json:"date"`      // YYYY-MM-DD
 	Time          string `json:"time"`      // HH:MM
-	EntryType     string `json:"entryType"` // visita | cancelada | cita
+	EntryType     string `json:"entryType"` // visita | cancelada | inasistencia | cita
 	Source        string `json:"source"`    // sheets | agent | manual
 	AgentID       uint   `json:"agentId"`
 	AgentName     string `json:"agentName"`
 	SheetURL      string `json:"sheetUrl"`
 	Notes         string `json:"notes"`
 	CreatedAt     string `json:"createdAt"`
+	ClientNoShows int64  `json:"clientNoShows"` // Inasistencias acumuladas del cliente
 }
 
 // HistorialStatsResponse estadísticas del historial
 type HistorialStatsResponse struct {
-	TotalVisitas    int64 `json:"totalVisitas"`
-	TotalClientes   int64 `json:"totalClientes"`
-	TotalCanceladas int64 `json:"totalCanceladas"`
-	VisitasMes      int64 `json:"visitasMes"`
+	TotalVisitas       int64 `json:"totalVisitas"`
+	TotalClientes      int64 `json:"totalClientes"`
+	TotalCanceladas    int64 `json:"totalCanceladas"`
+	TotalInasistencias int64 `json:"totalInasistencias"`
+	VisitasMes         int64 `json:"visitasMes"`
 }
 
 // GetHistorial obtiene el historial del usuario
@@ -57,7 +61,7 @@ func GetHistorial(c *gin.Context) {
 
 	// ── Parámetros de filtro ──────────────────────────────────────
 	search := strings.TrimSpace(c.Query("search"))
-	entryType := c.Query("type")  // visita | cancelada | all
+	entryType := c.Query("type")  // visita | cancelada | inasistencia | all
 	agentID := c.Query("agentId") // número o "all"
 	dateRange := c.Query("range") // week | month | year | all
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -84,10 +88,12 @@ func GetHistorial(c *gin.Context) {
 		db = db.Where("status = ?", "completed")
 	case "cancelada":
 		db = db.Where("status = ?", "cancelled")
+	case "inasistencia":
+		db = db.Where("status = ?", "no_show")
 	default:
-		// Todos: completadas + canceladas + (citas pasadas de sheets)
+		// Todos: completadas + canceladas + inasistencias + (citas pasadas de sheets)
 		db = db.Where("status IN ? OR (source IN ? AND date < ?)",
-			[]string{"completed", "cancelled"},
+			[]string{"completed", "cancelled", "no_show"},
 			[]string{"sheets", "agent"},
 			time.Now(),
 		)
@@ -143,6 +149,9 @@ func GetHistorial(c *gin.Context) {
 		agentNames[a.ID] = a.Name
 	}
 
+	// Inasistencias por cliente para el contador de cada fila
+	noShows := services.NoShowCountsByPhone(user.ID)
+
 	// ── Construir respuesta ───────────────────────────────────────
 	response := make([]HistorialResponse, 0, len(appointments))
 	for _, appt := range appointments {
@@ -153,12 +162,7 @@ func GetHistorial(c *gin.Context) {
 			sheetURL = fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit", appt.SheetID)
 		}
 
-		entryT := "visita"
-		if appt.Status == models.AppointmentStatusCancelled {
-			entryT = "cancelada"
-		} else if appt.Status == models.AppointmentStatusPending || appt.Status == models.AppointmentStatusConfirmed {
-			entryT = "cita"
-		}
+		entryT := historialEntryType(&appt)
 
 		response = append(response, HistorialResponse{
 			AppointmentID: appt.ID,
@@ -177,11 +181,12 @@ func GetHistorial(c *gin.Context) {
 			SheetURL:      sheetURL,
 			Notes:         appt.Notes,
 			CreatedAt:     appt.CreatedAt.Format("2006-01-02"),
+			ClientNoShows: noShows[utils.PhoneKey(appt.ClientPhone)],
 		})
 	}
 
 	// ── Estadísticas ──────────────────────────────────────────────
-	var totalVisitas, totalCanceladas, visitasMes, totalClientes int64
+	var totalVisitas, totalCanceladas, totalInasistencias, visitasMes, totalClientes int64
 
 	config.DB.Model(&models.Appointment{}).
 		Where("user_id = ? AND status = ?", user.ID, "completed").
@@ -191,6 +196,10 @@ func GetHistorial(c *gin.Context) {
 		Where("user_id = ? AND status = ?", user.ID, "cancelled").
 		Count(&totalCanceladas)
 
+	config.DB.Model(&models.Appointment{}).
+		Where("user_id = ? AND status = ?", user.ID, "no_show").
+		Count(&totalInasistencias)
+
 	config.DB.Model(&models.Appointment{}).
 		Where("user_id = ? AND status = ? AND date >= ?", user.ID, "completed", now.AddDate(0, -1, 0)).
 		Count(&visitasMes)
@@ -208,10 +217,11 @@ func GetHistorial(c *gin.Context) {
 		"page":      page,
 		"limit":     limit,
 		"stats": HistorialStatsResponse{
-			TotalVisitas:    totalVisitas,
-			TotalClientes:   totalClientes,
-			TotalCanceladas: totalCanceladas,
-			VisitasMes:      visitasMes,
+			TotalVisitas:       totalVisitas,
+			TotalClientes:      totalClientes,
+			TotalCanceladas:    totalCanceladas,
+			TotalInasistencias: totalInasistencias,
+			VisitasMes:         visitasMes,
 		},
 	})
 }
@@ -247,6 +257,8 @@ func GetHistorialCliente(c *gin.Context) {
 		agentNames[a.ID] = a.Name
 	}
 
+	noShows := services.CountNoShows(user.ID, phone)
+
 	response := make([]HistorialResponse, 0, len(appointments))
 	for _, appt := range appointments {
 		agName := agentNames[appt.AgentID]
@@ -254,12 +266,7 @@ func GetHistorialCliente(c *gin.Context) {
 		if appt.SheetID != "" {
 			sheetURL = fmt.Sprintf("https://docs.google.com/spreadsheets/d/%s/edit", appt.SheetID)
 		}
-		entryT := "visita"
-		if appt.Status == models.AppointmentStatusCancelled {
-			entryT = "cancelada"
-		} else if appt.Status == models.AppointmentStatusPending || appt.Status == models.AppointmentStatusConfirmed {
-			entryT = "cita"
-		}
+		entryT := historialEntryType(&appt)
 		response = append(response, HistorialResponse{
 			AppointmentID: appt.ID,
 			Client:        appt.GetClientFullName(),
@@ -275,6 +282,7 @@ func GetHistorialCliente(c *gin.Context) {
 			SheetURL:      sheetURL,
 			Notes:         appt.Notes,
 			CreatedAt:     appt.CreatedAt.Format("2006-01-02"),
+			ClientNoShows: noShows,
 		})
 	}
 
@@ -282,5 +290,19 @@ func GetHistorialCliente(c *gin.Context) {
 		"historial": response,
 		"total":     len(response),
 		"client":    phone,
+		"noShows":   noShows,
 	})
 }
+
+// historialEntryType tipo de entrada del historial según el estado de la cita
+func historialEntryType(appt *models.Appointment) string {
+	switch appt.Status {
+	case models.AppointmentStatusCancelled:
+		return "cancelada"
+	case models.AppointmentStatusNoShow:
+		return "inasistencia"
+	case models.AppointmentStatusPending, models.AppointmentStatusConfirmed:
+		return "cita"
+	}
+	return "visita"
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============================================
+// POST /api/bot/conversations/messages
+// Los bots reportan cada mensaje entrante y cada respuesta enviada para que
+// el dueño pueda revisar las conversaciones desde el dashboard.
+// Autenticado con BOT_API_TOKEN (Bearer token interno)
+// ============================================
+
+type BotMessageRequest struct {
+	AgentID     uint   `json:"agentId" binding:"required"`
+	Phone       string `json:"phone" binding:"required"`
+	Name        string `json:"name"`
+	Direction   string `json:"direction" binding:"required"` // inbound | outbound
+	MessageType string `json:"messageType"`
+	Body        string `json:"body"`
+}
+
+func RecordBotMessage(c *gin.Context) {
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+		return
+	}
+
+	var req BotMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	if req.Direction != models.MessageDirectionInbound && req.Direction != models.MessageDirectionOutbound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "direction debe ser inbound u outbound"})
+		return
+	}
+
+	phoneKey := utils.PhoneKey(req.Phone)
+	if phoneKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Teléfono inválido"})
+		return
+	}
+
+	var agent models.Agent
+	if err := config.DB.First(&agent, req.AgentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agente no encontrado"})
+		return
+	}
+
+	if req.MessageType == "" {
+		req.MessageType = "text"
+	}
+	now := time.Now()
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Upsert del hilo por (agente, teléfono)
+		conv := models.Conversation{
+			UserID:        agent.UserID,
+			AgentID:       agent.ID,
+			PhoneKey:      phoneKey,
+			CustomerPhone: req.Phone,
+			CustomerName:  strings.TrimSpace(req.Name),
+			LastMessageAt: now,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&conv).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("agent_id = ? AND phone_key = ?", agent.ID, phoneKey).First(&conv).Error; err != nil {
+			return err
+		}
+
+		msg := models.Message{
+			ConversationID: conv.ID,
+			Direction:      req.Direction,
+			MessageType:    req.MessageType,
+			Body:           req.Body,
+			CreatedAt:      now,
+		}
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"last_message_at":      now,
+			"last_message_preview": truncatePreview(req.Body, 255),
+			"last_direction":       req.Direction,
+			"message_count":        gorm.Expr("message_count + 1"),
+		}
+		// El nombre del perfil solo llega en mensajes entrantes
+		if name := strings.TrimSpace(req.Name); name != "" && req.Direction == models.MessageDirectionInbound {
+			updates["customer_name"] = name
+		}
+		return tx.Model(&conv).Updates(updates).Error
+	})
+	if err != nil {
+		log.Printf("❌ [Conversations] Error guardando mensaje de agente %d: %v", agent.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando mensaje"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ============================================
+// GET /api/conversations
+// Lista paginada de hilos del usuario (más recientes primero)
+// ============================================
+
+func GetConversations(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	search := strings.TrimSpace(c.Query("search"))
+	agentID := c.Query("agentId")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	db := config.DB.Model(&models.Conversation{}).Where("user_id = ?", user.ID)
+
+	if agentID != "" && agentID != "all" {
+		if aid, err := strconv.ParseUint(agentID, 10, 64); err == nil {
+			db = db.Where("agent_id = ?", uint(aid))
+		}
+	}
+
+	if search != "" {
+		like := "%" + strings.ToLower(search) + "%"
+		db = db.Where("LOWER(customer_name) LIKE ? OR customer_phone LIKE ? OR LOWER(last_message_preview) LIKE ?",
+			like, like, like)
+	}
+
+	var total int64
+	db.Count(&total)
+
+	var conversations []models.Conversation
+	if err := db.Order("last_message_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&conversations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error obteniendo conversaciones"})
+		return
+	}
+
+	// Nombres de agente para la lista
+	agentNames := make(map[uint]string)
+	var agents []models.Agent
+	config.DB.Select("id", "name").Where("user_id = ?", user.ID).Find(&agents)
+	for _, a := range agents {
+		agentNames[a.ID] = a.Name
+	}
+
+	result := make([]gin.H, 0, len(conversations))
+	for _, conv := range conversations {
+		result = append(result, gin.H{
+			"id":                 conv.ID,
+			"agentId":            conv.AgentID,
+			"agentName":          agentNames[conv.AgentID],
+			"customerPhone":      conv.CustomerPhone,
+			"customerName":       conv.CustomerName,
+			"lastMessageAt":      conv.LastMessageAt,
+			"lastMessagePreview": conv.LastMessagePreview,
+			"lastDirection":      conv.LastDirection,
+			"messageCount":       conv.MessageCount,
+		})
+	}
+
+	retentionDays := 7
+	var sub models.Subscription
+	if config.DB.Where("user_id = ?", user.ID).First(&sub).Error == nil {
+		retentionDays = sub.TranscriptRetentionDays()
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversations": result,
+		"total":         total,
+		"page":          page,
+		"limit":         limit,
+		"retentionDays": retentionDays,
+	})
+}
+
+// ============================================
+// GET /api/conversations/:id/messages
+// Mensajes de un hilo, paginados del más reciente hacia atrás.
+// Cada página se devuelve en orden cronológico.
+// ============================================
+
+func GetConversationMessages(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var conv models.Conversation
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&conv).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversación no encontrada"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	var total int64
+	config.DB.Model(&models.Message{}).Where("conversation_id = ?", conv.ID).Count(&total)
+
+	var messages []models.Message
+	if err := config.DB.Where("conversation_id = ?", conv.ID).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error obteniendo mensajes"})
+		return
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversation": conv,
+		"messages":     messages,
+		"total":        total,
+		"page":         page,
+		"limit":        limit,
+		"hasMore":      int64(page*limit) < total,
+	})
+}
+
+// truncatePreview recorta el texto a max caracteres sin partir runas
+func truncatePreview(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	r := []rune(text)
+	if len(r) <= max {
+		return text
+	}
+	return string(r[:max-3]) + "..."
+}
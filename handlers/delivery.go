@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeliveryQuoteRequest dirección de entrega a validar contra las zonas
+type DeliveryQuoteRequest struct {
+	AgentID    uint    `json:"agentId"`  // bots
+	BranchID   uint    `json:"branchId"` // Ninda
+	Address    string  `json:"address"`
+	PostalCode string  `json:"postalCode"`
+	Location   string  `json:"location"` // "lat,lng" si el cliente compartió su ubicación
+	Subtotal   float64 `json:"subtotal"` // total de productos, sin envío
+}
+
+func (r DeliveryQuoteRequest) deliveryAddress() services.DeliveryAddress {
+	return services.DeliveryAddress{
+		Text:       r.Address,
+		PostalCode: r.PostalCode,
+		Location:   services.ParseGeoPoint(r.Location),
+	}
+}
+
+// ============================================
+// POST /api/bot/delivery/quote
+// Zona, costo de envío y tiempo estimado para la dirección del cliente.
+// Autenticado con BOT_API_TOKEN (Bearer token interno)
+// ============================================
+func QuoteBotDelivery(c *gin.Context) {
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+		return
+	}
+
+	var req DeliveryQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.AgentID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agentId es requerido"})
+		return
+	}
+
+	branch := services.BranchForAgent(req.AgentID)
+	if branch == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "El agente no tiene sucursal asignada"})
+		return
+	}
+
+	respondDeliveryQuote(c, branch, req)
+}
+
+// ============================================
+// POST /api/ninda/delivery/quote
+// Misma consulta desde la tienda pública de Ninda
+// ============================================
+func QuoteNindaDelivery(c *gin.Context) {
+	var req DeliveryQuoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.BranchID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "branchId es requerido"})
+		return
+	}
+
+	// Sin coordenadas la dirección se geocodifica con Google Maps: se
+	// limita por IP y sucursal para que no se abuse de la API key
+	if services.ParseGeoPoint(req.Location) == nil && !allowNindaQuote(c.ClientIP(), req.BranchID) {
+		log.Printf("🚫 [Delivery] Demasiadas cotizaciones de %s para la sucursal %d", c.ClientIP(), req.BranchID)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Demasiadas consultas, intenta de nuevo en unos minutos"})
+		return
+	}
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, req.BranchID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Negocio no encontrado"})
+		return
+	}
+
+	respondDeliveryQuote(c, &branch, req)
+}
+
+// Cotizaciones públicas por IP y sucursal dentro de la ventana
+const (
+	nindaQuoteLimit  = 20
+	nindaQuoteWindow = 10 * time.Minute
+)
+
+type quoteWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	nindaQuoteWindows      = make(map[string]*quoteWindow)
+	nindaQuoteWindowsMutex sync.Mutex
+)
+
+// allowNindaQuote cuenta la cotización y dice si aún está dentro del límite
+func allowNindaQuote(ip string, branchID uint) bool {
+	now := time.Now()
+	key := fmt.Sprintf("%s|%d", ip, branchID)
+
+	nindaQuoteWindowsMutex.Lock()
+	defer nindaQuoteWindowsMutex.Unlock()
+
+	w, ok := nindaQuoteWindows[key]
+	if !ok || now.Sub(w.start) > nindaQuoteWindow {
+		// Limpiar ventanas vencidas para que el mapa no crezca sin límite
+		if !ok && len(nindaQuoteWindows) >= 10000 {
+			for k, old := range nindaQuoteWindows {
+				if now.Sub(old.start) > nindaQuoteWindow {
+					delete(nindaQuoteWindows, k)
+				}
+			}
+		}
+		nindaQuoteWindows[key] = &quoteWindow{start: now, count: 1}
+		return true
+	}
+	if w.count >= nindaQuoteLimit {
+		return false
+	}
+	w.count++
+	return true
+}
+
+func respondDeliveryQuote(c *gin.Context, branch *models.MyBusinessInfo, req DeliveryQuoteRequest) {
+	quote, err := services.QuoteDelivery(branch, req.deliveryAddress(), req.Subtotal)
+	if err != nil {
+		respondDeliveryRejected(c, quote, err)
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+// respondDeliveryRejected 422 con el motivo; code permite a los bots y a
+// Ninda distinguir "fuera de zona" de "no alcanza el mínimo"
+func respondDeliveryRejected(c *gin.Context, quote *services.DeliveryQuote, err error) {
+	code := "outside_zone"
+	if errors.Is(err, services.ErrBelowMinimumOrder) {
+		code = "below_minimum"
+	}
+	body := gin.H{"error": err.Error(), "code": code}
+	if quote != nil {
+		body["zone"] = quote.Zone
+		body["minOrder"] = quote.MinOrder
+	}
+	c.JSON(http.StatusUnprocessableEntity, body)
+}
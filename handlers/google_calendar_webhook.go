@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GoogleCalendarWebhook — POST /webhook/google/calendar
+// Google avisa que cambió el calendario de un agente (evento movido o
+// eliminado). El aviso no trae el cambio: solo dispara la sincronización
+// incremental con el sync token. Público: se valida con el token del canal.
+func GoogleCalendarWebhook(c *gin.Context) {
+	channelID := c.GetHeader("X-Goog-Channel-ID")
+	resourceState := c.GetHeader("X-Goog-Resource-State")
+
+	err := services.HandleCalendarNotification(channelID, c.GetHeader("X-Goog-Channel-Token"), resourceState)
+	switch {
+	case errors.Is(err, services.ErrUnknownCalendarChannel):
+		// Canal viejo o de un agente desconectado: Google deja de avisar al vencer
+		c.Status(http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidChannelToken):
+		log.Printf("⚠️  [CalendarSync] Token inválido en aviso del canal %s", channelID)
+		c.Status(http.StatusUnauthorized)
+	default:
+		c.Status(http.StatusOK)
+	}
+}
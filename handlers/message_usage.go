@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"attomos/config"
+	"attomos/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============================================
+// POST /api/bot/messages/usage
+// Llamado por los bots (AtomicBot y OrbitalBot) al recibir un mensaje
+// (checkOnly: solo verifica que quede cuota) y después de enviar cada
+// respuesta al cliente, que descuenta un mensaje de la cuota del plan.
+// Autenticado con BOT_API_TOKEN (Bearer token interno)
+// ============================================
+
+type MessageUsageRequest struct {
+	AgentID   uint `json:"agentId" binding:"required"`
+	CheckOnly bool `json:"checkOnly"`
+}
+
+func ReportBotMessageUsage(c *gin.Context) {
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
+		return
+	}
+
+	var req MessageUsageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agentId requerido"})
+		return
+	}
+
+	var agent models.Agent
+	if err := config.DB.First(&agent, req.AgentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agente no encontrado"})
+		return
+	}
+
+	var sub models.Subscription
+	if err := config.DB.Where("user_id = ?", agent.UserID).First(&sub).Error; err != nil {
+		log.Printf("⚠️  [Usage] Agente %d sin suscripción (usuario %d)", agent.ID, agent.UserID)
+		c.JSON(http.StatusForbidden, gin.H{
+			"allowed": false,
+			"error":   "Sin suscripción activa",
+		})
+		return
+	}
+
+	// Reset del contador al cruzar el límite del período de facturación
+	if sub.ResetMessageUsageIfDue() {
+		if err := config.DB.Model(&sub).Updates(map[string]interface{}{
+			"used_messages":     0,
+			"reset_messages_at": sub.ResetMessagesAt,
+		}).Error; err != nil {
+			log.Printf("❌ [Usage] Error reseteando contador de suscripción %d: %v", sub.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error registrando uso"})
+			return
+		}
+		log.Printf("🔄 [Usage] Contador de mensajes reseteado para suscripción %d (plan %s)", sub.ID, sub.Plan)
+	}
+
+	if !sub.CanSendMessage() {
+		log.Printf("🚫 [Usage] Cuota agotada agente=%d plan=%s (%d/%d)", agent.ID, sub.Plan, sub.UsedMessages, sub.MaxMessages)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"allowed":      false,
+			"error":        "Límite de mensajes del plan alcanzado",
+			"usedMessages": sub.UsedMessages,
+			"maxMessages":  sub.MaxMessages,
+		})
+		return
+	}
+
+	if req.CheckOnly {
+		c.JSON(http.StatusOK, gin.H{
+			"allowed":      true,
+			"usedMessages": sub.UsedMessages,
+			"maxMessages":  sub.MaxMessages,
+		})
+		return
+	}
+
+	// Incremento atómico: varias respuestas simultáneas del mismo usuario
+	// no deben poder rebasar el límite
+	query := config.DB.Model(&models.Subscription{}).Where("id = ?", sub.ID)
+	if !sub.HasUnlimitedMessages() {
+		query = query.Where("used_messages < max_messages")
+	}
+	result := query.UpdateColumn("used_messages", gorm.Expr("used_messages + ?", 1))
+	if result.Error != nil {
+		log.Printf("❌ [Usage] Error incrementando uso de suscripción %d: %v", sub.ID, result.Error)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error registrando uso"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"allowed":      false,
+			"error":        "Límite de mensajes del plan alcanzado",
+			"usedMessages": sub.MaxMessages,
+			"maxMessages":  sub.MaxMessages,
+		})
+		return
+	}
+	sub.IncrementMessageUsage()
+
+	c.JSON(http.StatusOK, gin.H{
+		"allowed":      true,
+		"usedMessages": sub.UsedMessages,
+		"maxMessages":  sub.MaxMessages,
+	})
+}
@@ -0,0 +1,469 @@
+package handlers
+
+import (
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+	"attomos/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	stripe "github.com/stripe/stripe-go/v78"
+	"github.com/stripe/stripe-go/v78/checkout/session"
+)
+
+// nindaBookingSource metadata.source de los Checkout Sessions de reservas
+const nindaBookingSource = "ninda_booking"
+
+// ─── Página pública ──────────────────────────────────────────────────────────
+
+// GetNindaBooking - GET /ninda/:branch_id/reservar
+// Página pública para reservar una cita en la sucursal
+func GetNindaBooking(c *gin.Context) {
+	c.HTML(http.StatusOK, "ninda-booking.html", gin.H{})
+}
+
+// ─── API: Opciones y horarios ───────────────────────────────────────────────
+
+// loadBookableBranch sucursal del parámetro :branch_id
+func loadBookableBranch(c *gin.Context) (*models.MyBusinessInfo, bool) {
+	branchID, err := strconv.ParseUint(c.Param("branch_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return nil, false
+	}
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, branchID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Negocio no encontrado"})
+		return nil, false
+	}
+	return &branch, true
+}
+
+// bookableServices servicios que se pueden reservar: los que tienen
+// duración configurada (pizzas o artículos de tienda no la tienen)
+func bookableServices(branch *models.MyBusinessInfo) []models.BranchService {
+	var list []models.BranchService
+	for _, svc := range branch.Services {
+		if svc.IsBookable() {
+			list = append(list, svc)
+		}
+	}
+	return list
+}
+
+// bookingRequiresPayment indica si la sucursal cobra la reserva por adelantado
+func bookingRequiresPayment(branchID uint) (*models.PaymentConfig, bool) {
+	var cfg models.PaymentConfig
+	if config.DB.Where("branch_id = ?", branchID).First(&cfg).Error != nil {
+		return nil, false
+	}
+	return &cfg, cfg.PaymentRequiredForBooking && cfg.StripeChargesEnabled && cfg.StripeAccountID != ""
+}
+
+// APIGetBookingOptions - GET /api/ninda/stores/:branch_id/booking
+// Servicios reservables, trabajadores y si se exige pago por adelantado
+func APIGetBookingOptions(c *gin.Context) {
+	branch, ok := loadBookableBranch(c)
+	if !ok {
+		return
+	}
+
+	services := make([]gin.H, 0)
+	for _, svc := range bookableServices(branch) {
+		services = append(services, gin.H{
+			"title":           svc.Title,
+			"description":     svc.Description,
+			"durationMinutes": svc.Duration(),
+			"price":           svc.EffectivePrice(),
+		})
+	}
+
+	workers := make([]gin.H, 0, len(branch.Workers))
+	for _, w := range branch.Workers {
+		workers = append(workers, gin.H{
+			"name":     w.Name,
+			"services": w.Services,
+		})
+	}
+
+	_, requiresPayment := bookingRequiresPayment(branch.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"branchId":        branch.ID,
+		"name":            branch.BusinessName,
+		"logoUrl":         branch.LogoURL,
+		"services":        services,
+		"workers":         workers,
+		"requiresPayment": requiresPayment,
+	})
+}
+
+// APIGetBookingSlots - GET /api/ninda/stores/:branch_id/slots?service=&worker=&date=YYYY-MM-DD
+// Horarios libres calculados por el motor de disponibilidad
+func APIGetBookingSlots(c *gin.Context) {
+	branch, ok := loadBookableBranch(c)
+	if !ok {
+		return
+	}
+	respondAvailability(c, branch)
+}
+
+// ─── API: Crear reserva ─────────────────────────────────────────────────────
+
+// NindaBookingRequest datos de la reserva enviados por la página pública
+type NindaBookingRequest struct {
+	BranchID      uint   `json:"branchId" binding:"required"`
+	Service       string `json:"service" binding:"required"`
+	Worker        string `json:"worker"`
+	Date          string `json:"date" binding:"required"` // YYYY-MM-DD
+	Time          string `json:"time" binding:"required"` // HH:MM
+	CustomerName  string `json:"customerName" binding:"required"`
+	CustomerPhone string `json:"customerPhone" binding:"required"`
+	CustomerEmail string `json:"customerEmail"`
+	Notes         string `json:"notes"`
+}
+
+// APICreateBooking - POST /api/ninda/bookings
+// Valida el horario y crea la cita. Si la sucursal exige pago, la cita queda
+// pendiente y se devuelve el Checkout de Stripe; el webhook la confirma.
+func APICreateBooking(c *gin.Context) {
+	var req NindaBookingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	if utils.PhoneKey(req.CustomerPhone) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Teléfono inválido"})
+		return
+	}
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, req.BranchID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Negocio no encontrado"})
+		return
+	}
+
+	svc, found := branch.FindService(req.Service)
+	if !found || !svc.IsBookable() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Este servicio no se puede reservar en línea"})
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", req.Date+" "+req.Time, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha/hora inválido. Use YYYY-MM-DD y HH:MM"})
+		return
+	}
+	if start.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El horario ya pasó"})
+		return
+	}
+
+	cfg, requiresPayment := bookingRequiresPayment(branch.ID)
+	price := svc.EffectivePrice()
+	requiresPayment = requiresPayment && price > 0
+
+	// El agente activo de la sucursal atiende la cita (recordatorios, avisos)
+	var agent models.Agent
+	hasAgent := config.DB.Where("branch_id = ? AND is_active = ?", branch.ID, true).First(&agent).Error == nil
+
+	unlock := services.LockBranch(branch.ID)
+	slot, err := services.CheckSlot(&branch, svc.Title, req.Worker, start, 0)
+	if err != nil {
+		unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	firstName, lastName := utils.SplitFullName(req.CustomerName)
+	appointment := models.Appointment{
+		UserID:          branch.UserID,
+		BranchID:        branch.ID,
+		ClientFirstName: firstName,
+		ClientLastName:  lastName,
+		ClientPhone:     req.CustomerPhone,
+		Service:         svc.Title,
+		Worker:          slot.Worker,
+		Date:            start,
+		DurationMinutes: svc.Duration(),
+		Notes:           req.Notes,
+		Status:          models.AppointmentStatusConfirmed,
+		Source:          models.AppointmentSourceNinda,
+	}
+	appointment.SetResources(slot.Resources)
+	if hasAgent {
+		appointment.AgentID = agent.ID
+	}
+	if requiresPayment {
+		// Aparta el horario mientras el cliente paga
+		appointment.Status = models.AppointmentStatusPending
+	}
+
+	err = config.DB.Create(&appointment).Error
+	unlock()
+	if err != nil {
+		log.Printf("❌ [Ninda] Error guardando reserva: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la reserva"})
+		return
+	}
+
+	if !requiresPayment {
+		log.Printf("✅ [Ninda] Reserva creada ID=%d | %s | %s %s", appointment.ID, branch.BusinessName, req.Date, req.Time)
+		go finalizeNindaBooking(&branch, &appointment, req.CustomerEmail)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":     true,
+			"appointment": nindaBookingSummary(&appointment),
+		})
+		return
+	}
+
+	checkoutURL, err := createNindaBookingCheckout(&branch, cfg, &appointment, price, req.CustomerEmail)
+	if err != nil {
+		log.Printf("❌ [Ninda] Error creando pago de reserva %d: %v", appointment.ID, err)
+		config.DB.Delete(&appointment)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al iniciar el pago: " + err.Error()})
+		return
+	}
+
+	log.Printf("💳 [Ninda] Reserva %d pendiente de pago | %s | $%.2f MXN", appointment.ID, branch.BusinessName, price)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"checkoutUrl": checkoutURL,
+	})
+}
+
+// createNindaBookingCheckout crea el Checkout Session del anticipo en la
+// cuenta conectada de la sucursal y lo liga a la cita
+func createNindaBookingCheckout(branch *models.MyBusinessInfo, cfg *models.PaymentConfig, appt *models.Appointment, price float64, email string) (string, error) {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	label := fmt.Sprintf("%s · %s", appt.Service, appt.Date.Format("02/01/2006 15:04"))
+	params := &stripe.CheckoutSessionParams{
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency:   stripe.String("mxn"),
+				UnitAmount: stripe.Int64(int64(price * 100)),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(label),
+				},
+			},
+			Quantity: stripe.Int64(1),
+		}},
+		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL: stripe.String(fmt.Sprintf("%s/ninda/%d/reservar?payment=success&session_id={CHECKOUT_SESSION_ID}", baseURL, branch.ID)),
+		CancelURL:  stripe.String(fmt.Sprintf("%s/ninda/%d/reservar?payment=cancelled", baseURL, branch.ID)),
+		ExpiresAt:  stripe.Int64(time.Now().Add(models.PaymentHold).Unix()),
+		Metadata: map[string]string{
+			"source":         nindaBookingSource,
+			"branch_id":      fmt.Sprintf("%d", branch.ID),
+			"appointment_id": fmt.Sprintf("%d", appt.ID),
+			"customer_email": email,
+		},
+	}
+	params.SetStripeAccount(cfg.StripeAccountID)
+	if email != "" {
+		params.CustomerEmail = stripe.String(email)
+	}
+
+	sess, err := session.New(params)
+	if err != nil {
+		return "", err
+	}
+
+	if err := config.DB.Model(appt).Update("stripe_session_id", sess.ID).Error; err != nil {
+		return "", fmt.Errorf("error ligando el pago a la cita: %w", err)
+	}
+	return sess.URL, nil
+}
+
+// APIConfirmBooking - POST /api/ninda/bookings/confirm
+// Al regresar de Stripe: confirma la reserva si el pago ya se completó
+// (idempotente con el webhook) y devuelve el resumen para la página
+func APIConfirmBooking(c *gin.Context) {
+	var req struct {
+		SessionID string `json:"sessionId" binding:"required"`
+		BranchID  uint   `json:"branchId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	var cfg models.PaymentConfig
+	if err := config.DB.Where("branch_id = ?", req.BranchID).First(&cfg).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Negocio no encontrado"})
+		return
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	params := &stripe.CheckoutSessionParams{}
+	params.SetStripeAccount(cfg.StripeAccountID)
+	sess, err := session.Get(req.SessionID, params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sesión no encontrada"})
+		return
+	}
+
+	if sess.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El pago no está completado"})
+		return
+	}
+
+	if err := handleNindaBookingPaid(sess, cfg.StripeAccountID); err != nil {
+		log.Printf("❌ [Ninda] Error confirmando reserva de la sesión %s: %v", sess.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error confirmando la reserva"})
+		return
+	}
+
+	var appointment models.Appointment
+	if err := config.DB.Where("stripe_session_id = ?", sess.ID).First(&appointment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reserva no encontrada"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"appointment": nindaBookingSummary(&appointment),
+	})
+}
+
+// ─── Webhook: pago y expiración ─────────────────────────────────────────────
+
+// handleNindaBookingPaid confirma la cita pendiente de un Checkout pagado.
+// Solo el primero que la pasa de pending a confirmed crea el evento y avisa.
+func handleNindaBookingPaid(sess *stripe.CheckoutSession, connectedAccountID string) error {
+	var appointment models.Appointment
+	if err := config.DB.Where("stripe_session_id = ?", sess.ID).First(&appointment).Error; err != nil {
+		log.Printf("⚠️  [Ninda] Pago de reserva sin cita ligada (sesión %s)", sess.ID)
+		return nil
+	}
+
+	var cfg models.PaymentConfig
+	if err := config.DB.Where("branch_id = ?", appointment.BranchID).First(&cfg).Error; err != nil || cfg.StripeAccountID != connectedAccountID {
+		log.Printf("⚠️  [Ninda] Sesión %s: cuenta %s no corresponde a la sucursal %d", sess.ID, connectedAccountID, appointment.BranchID)
+		return nil
+	}
+
+	paid := float64(sess.AmountTotal) / 100
+	result := config.DB.Model(&models.Appointment{}).
+		Where("id = ? AND status = ?", appointment.ID, models.AppointmentStatusPending).
+		Updates(map[string]interface{}{"status": models.AppointmentStatusConfirmed, "paid_amount": paid})
+	if result.Error != nil {
+		return fmt.Errorf("error confirmando cita %d: %w", appointment.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	appointment.Status = models.AppointmentStatusConfirmed
+	appointment.PaidAmount = paid
+	log.Printf("✅ [Ninda] Reserva %d pagada ($%.2f MXN) y confirmada", appointment.ID, paid)
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, appointment.BranchID).Error; err != nil {
+		return nil
+	}
+	go finalizeNindaBooking(&branch, &appointment, sess.Metadata["customer_email"])
+	return nil
+}
+
+// handleNindaBookingExpired libera el horario de una reserva que no se pagó
+func handleNindaBookingExpired(sess *stripe.CheckoutSession) {
+	var appointment models.Appointment
+	if err := config.DB.Where("stripe_session_id = ? AND status = ?", sess.ID, models.AppointmentStatusPending).
+		First(&appointment).Error; err != nil {
+		return
+	}
+	if releaseHeldAppointment(&appointment) {
+		log.Printf("⌛ [Ninda] Reserva sin pagar liberada (sesión %s)", sess.ID)
+	}
+}
+
+// releaseHeldAppointment cancela una cita que seguía pendiente de pago y
+// libera su horario. Devuelve false si ya no estaba pendiente.
+func releaseHeldAppointment(appointment *models.Appointment) bool {
+	result := config.DB.Model(appointment).
+		Where("status = ?", models.AppointmentStatusPending).
+		Update("status", models.AppointmentStatusCancelled)
+	if result.RowsAffected == 0 {
+		return false
+	}
+	// Las citas del bot ya tienen evento en Calendar y celda en Sheets
+	if err := services.DeleteAppointmentCalendarEvent(appointment); err != nil {
+		log.Printf("⚠️  [Ninda] No se pudo eliminar el evento de la cita %d: %v", appointment.ID, err)
+	}
+	services.ClearAppointmentFromSheets(appointment)
+	services.OfferFreedSlot(appointment)
+	return true
+}
+
+// ─── Helpers ─────────────────────────────────────────────────────────────────
+
+// finalizeNindaBooking crea el evento de Calendar y avisa al cliente por
+// WhatsApp desde el agente de la sucursal
+func finalizeNindaBooking(branch *models.MyBusinessInfo, appt *models.Appointment, email string) {
+	if err := services.CreateAppointmentCalendarEvent(appt, email); err != nil {
+		log.Printf("⚠️  [Ninda] No se pudo crear el evento de la reserva %d: %v", appt.ID, err)
+	}
+
+	if appt.AgentID == 0 || appt.ClientPhone == "" {
+		return
+	}
+	var agent models.Agent
+	if err := config.DB.First(&agent, appt.AgentID).Error; err != nil {
+		return
+	}
+
+	msg := buildNindaBookingNotification(branch.BusinessName, appt)
+	if err := services.SendWhatsAppViaAgent(&agent, appt.ClientPhone, msg, models.TemplatePurposeAppointment); err != nil {
+		log.Printf("⚠️  [Ninda] No se pudo notificar la reserva %d vía agente %d: %v", appt.ID, agent.ID, err)
+	}
+}
+
+// buildNindaBookingNotification mensaje de WhatsApp con la reserva confirmada
+func buildNindaBookingNotification(branchName string, appt *models.Appointment) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ *¡Tu cita en %s está confirmada!*\n\n", branchName))
+	sb.WriteString(fmt.Sprintf("✂️ %s\n", appt.Service))
+	if appt.Worker != "" {
+		sb.WriteString(fmt.Sprintf("💈 Con: %s\n", appt.Worker))
+	}
+	sb.WriteString(fmt.Sprintf("📅 %s a las %s\n", appt.Date.Format("02/01/2006"), appt.Date.Format("15:04")))
+	if appt.PaidAmount > 0 {
+		sb.WriteString(fmt.Sprintf("💰 Pagado: $%.0f MXN\n", appt.PaidAmount))
+	}
+	sb.WriteString("\n¡Te esperamos! 😊")
+	return sb.String()
+}
+
+// nindaBookingSummary datos públicos de la reserva para la página
+func nindaBookingSummary(appt *models.Appointment) gin.H {
+	return gin.H{
+		"id":              appt.ID,
+		"service":         appt.Service,
+		"worker":          appt.Worker,
+		"date":            appt.Date.Format("2006-01-02"),
+		"time":            appt.Date.Format("15:04"),
+		"durationMinutes": appt.DurationMinutes,
+		"customerName":    appt.GetClientFullName(),
+		"paidAmount":      appt.PaidAmount,
+		"status":          appt.Status,
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"testing"
+
+	"attomos/models"
+)
+
+func TestBookableServices(t *testing.T) {
+	tests := []struct {
+		name     string
+		services models.BranchServices
+		want     []string
+	}{
+		{"producto sin duración", models.BranchServices{{Title: "Pizza Hawaiana", Price: 180}}, nil},
+		{"servicio con duración", models.BranchServices{{Title: "Corte", DurationMinutes: 30}}, []string{"Corte"}},
+		{"catálogo mixto", models.BranchServices{
+			{Title: "Corte", DurationMinutes: 30},
+			{Title: "Cera para cabello", Price: 120},
+			{Title: "Tinte", DurationMinutes: 90},
+		}, []string{"Corte", "Tinte"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			branch := &models.MyBusinessInfo{Services: tt.services}
+			got := bookableServices(branch)
+			if len(got) != len(tt.want) {
+				t.Fatalf("bookableServices() = %d servicio(s), se esperaban %d", len(got), len(tt.want))
+			}
+			for i, svc := range got {
+				if svc.Title != tt.want[i] {
+					t.Errorf("bookableServices()[%d] = %q, se esperaba %q", i, svc.Title, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -3,8 +3,11 @@ package handlers
 import (
 	"attomos/config"
 	"attomos/models"
+	"attomos/services"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
@@ -169,21 +172,24 @@ func APIGetStore(c *gin.Context) {
 		if len(imgs) == 0 && svc.ImageURL != "" {
 			imgs = []string{svc.ImageURL}
 		}
-		price := svc.Price
-		if svc.PriceType == "promotion" && svc.PromoPrice > 0 {
-			price = svc.PromoPrice
-		}
-		services = append(services, gin.H{
+		item := gin.H{
 			"index":         i,
 			"title":         svc.Title,
 			"description":   svc.Description,
-			"price":         price,
+			"price":         svc.EffectivePrice(),
 			"originalPrice": svc.OriginalPrice,
 			"promoPrice":    svc.PromoPrice,
 			"priceType":     svc.PriceType,
 			"images":        imgs,
 			"promoDays":     svc.PromoDays,
-		})
+			"inStock":       svc.InStock,
+			"modifiers":     svc.Modifiers,
+		}
+		// Solo con inventario: tope de unidades que se pueden agregar al carrito
+		if svc.TrackStock {
+			item["stock"] = max(svc.Stock, 0)
+		}
+		services = append(services, item)
 	}
 
 	response := gin.H{
@@ -206,7 +212,9 @@ func APIGetStore(c *gin.Context) {
 			"instagram": branch.SocialMedia.Instagram,
 			"facebook":  branch.SocialMedia.Facebook,
 		},
-		"services": services,
+		"services":       services,
+		"bookingEnabled": len(bookableServices(&branch)) > 0,
+		"delivery":       nindaDeliveryInfo(&branch),
 		"payments": gin.H{
 			"hasStripe":   hasCfg && cfg.StripeChargesEnabled,
 			"hasSPEI":     hasCfg && cfg.SPEIEnabled,
@@ -232,13 +240,19 @@ type NindaCheckoutRequest struct {
 	// Source: "ninda" = directo, "bot" = viene desde WhatsApp via ?item=
 	Source  string `json:"source"`
 	BotItem string `json:"botItem"`
+	// Entrega: "pickup" (default) o "delivery" con la dirección del cliente
+	OrderType          string `json:"orderType"`
+	DeliveryAddress    string `json:"deliveryAddress"`
+	DeliveryPostalCode string `json:"deliveryPostalCode"`
+	DeliveryLocation   string `json:"deliveryLocation"` // "lat,lng"
 }
 
 type NindaCartItem struct {
-	ServiceIndex int     `json:"serviceIndex"`
-	Title        string  `json:"title"`
-	Price        float64 `json:"price"`
-	Quantity     int     `json:"quantity"`
+	ServiceIndex int                      `json:"serviceIndex"`
+	Title        string                   `json:"title"`
+	Price        float64                  `json:"price"` // informativo; se recalcula con el catálogo
+	Quantity     int                      `json:"quantity"`
+	Options      []models.OrderItemOption `json:"options"` // variantes y extras elegidos
 }
 
 // APICreateCheckout - POST /api/ninda/checkout
@@ -268,40 +282,115 @@ func APICreateCheckout(c *gin.Context) {
 		return
 	}
 
+	// Precios desde el catálogo (base + variantes y extras), nunca del navegador
+	cartItems := make(models.OrderItems, 0, len(req.Items))
+	catalogIndexes := make([]int, 0, len(req.Items))
+	for _, item := range req.Items {
+		idx := branch.ServiceIndex(item.Title)
+		if idx < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Producto no disponible: " + item.Title})
+			return
+		}
+		priced, err := services.PriceCatalogItem(branch.Services[idx], models.OrderItem{Name: item.Title, Quantity: item.Quantity, Options: item.Options})
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "invalid_options"})
+			return
+		}
+		cartItems = append(cartItems, priced)
+		catalogIndexes = append(catalogIndexes, idx)
+	}
+
+	// No cobrar productos agotados o sin existencias suficientes
+	if err := services.CheckStock(&branch, cartItems); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
 	// Construir line items de Stripe
-	lineItems := make([]*stripe.CheckoutSessionLineItemParams, 0, len(req.Items))
+	lineItems := make([]*stripe.CheckoutSessionLineItemParams, 0, len(cartItems))
 	totalAmount := int64(0)
 
-	for _, item := range req.Items {
-		if item.Quantity <= 0 {
-			item.Quantity = 1
-		}
-		amountCents := int64(item.Price * 100)
+	for i, item := range cartItems {
+		amountCents := int64(math.Round(item.Price * 100))
 		totalAmount += amountCents * int64(item.Quantity)
 
 		// Usar price_data inline — no requiere crear producto/precio previos
 		// y funciona directamente en la cuenta conectada del negocio
+		productData := &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+			Name: stripe.String(item.Label()),
+		}
+		// El webhook recupera producto y opciones desde la metadata. La
+		// posición en el catálogo y el nombre van siempre (con ellos se
+		// descuentan existencias); las opciones solo si caben en el límite
+		// de Stripe
+		productData.AddMetadata(nindaItemIndexKey, strconv.Itoa(catalogIndexes[i]))
+		productData.AddMetadata(nindaItemNameKey, truncateMetadata(item.Name))
+		if len(item.Options) > 0 {
+			if raw, err := json.Marshal(item.Options); err == nil && len(raw) <= 500 {
+				productData.AddMetadata(nindaItemOptionsKey, string(raw))
+			} else {
+				log.Printf("⚠️  [Ninda] Opciones de %s no caben en la metadata de Stripe", item.Name)
+			}
+		}
 		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
 			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency:   stripe.String("mxn"),
-				UnitAmount: stripe.Int64(amountCents),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name: stripe.String(item.Title),
-				},
+				Currency:    stripe.String("mxn"),
+				UnitAmount:  stripe.Int64(amountCents),
+				ProductData: productData,
 			},
 			Quantity: stripe.Int64(int64(item.Quantity)),
 		})
 	}
 
+	// Envío a domicilio: validar la dirección contra las zonas de la
+	// sucursal y cobrar el envío como una línea más
+	var deliveryQuote *services.DeliveryQuote
+	if req.OrderType == string(models.OrderTypeDelivery) {
+		if strings.TrimSpace(req.DeliveryAddress) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Indica la dirección de entrega"})
+			return
+		}
+		if len(branch.DeliveryZones) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Este negocio no tiene entrega a domicilio"})
+			return
+		}
+		addr := services.DeliveryAddress{
+			Text:       req.DeliveryAddress,
+			PostalCode: req.DeliveryPostalCode,
+			Location:   services.ParseGeoPoint(req.DeliveryLocation),
+		}
+		quote, err := services.QuoteDelivery(&branch, addr, float64(totalAmount)/100)
+		if err != nil {
+			respondDeliveryRejected(c, quote, err)
+			return
+		}
+		deliveryQuote = quote
+		if quote.Fee > 0 {
+			feeItem := services.DeliveryFeeItem(quote)
+			feeCents := int64(math.Round(quote.Fee * 100))
+			totalAmount += feeCents
+			lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
+				PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+					Currency:   stripe.String("mxn"),
+					UnitAmount: stripe.Int64(feeCents),
+					ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+						Name: stripe.String(feeItem.Name),
+					},
+				},
+				Quantity: stripe.Int64(1),
+			})
+		}
+	}
+
 	baseURL := os.Getenv("BASE_URL")
 	if baseURL == "" {
 		baseURL = "http://localhost:8080"
 	}
 
 	// Metadata para el webhook
-	itemsSummary := buildItemsSummary(req.Items)
+	itemsSummary := buildItemsSummary(cartItems)
 
 	// Determinar source: bot (viene de WhatsApp via ?item=) o ninda (directo)
 	source := req.Source
@@ -325,6 +414,12 @@ func APICreateCheckout(c *gin.Context) {
 	if req.BotItem != "" {
 		metadata["bot_item"] = req.BotItem
 	}
+	if deliveryQuote != nil {
+		metadata["order_type"] = string(models.OrderTypeDelivery)
+		metadata["delivery_address"] = truncateMetadata(req.DeliveryAddress)
+		metadata["delivery_zone"] = deliveryQuote.Zone
+		metadata["delivery_eta"] = strconv.Itoa(deliveryQuote.ETAMinutes)
+	}
 
 	// Crear Checkout Session en la cuenta conectada del negocio
 	params := &stripe.CheckoutSessionParams{
@@ -424,8 +519,17 @@ func APIConfirmOrder(c *gin.Context) {
 		}
 	}
 
+	// El webhook checkout.session.completed registra el pedido; si ya llegó,
+	// devolver su ID para mostrarlo en la página de confirmación
+	var orderID uint
+	var order models.Order
+	if config.DB.Where("stripe_session_id = ?", sess.ID).First(&order).Error == nil {
+		orderID = order.ID
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success":       true,
+		"orderId":       orderID,
 		"orderSummary":  itemsSummary,
 		"total":         total,
 		"customerName":  customerName,
@@ -435,14 +539,263 @@ func APIConfirmOrder(c *gin.Context) {
 	})
 }
 
+// ─── Webhook: checkout completado ───────────────────────────────────────────
+
+// handleNindaCheckoutCompleted convierte un Checkout Session pagado en la
+// cuenta conectada de una sucursal en un models.Order con source "ninda".
+// Es idempotente: el ID de la sesión es único en orders.stripe_session_id,
+// así que los reintentos de Stripe no duplican pedidos.
+func handleNindaCheckoutCompleted(sess *stripe.CheckoutSession, connectedAccountID string) error {
+	if sess.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid {
+		log.Printf("ℹ️  [Ninda] Sesión %s completada sin pago (%s) — se ignora", sess.ID, sess.PaymentStatus)
+		return nil
+	}
+
+	branchID, err := strconv.ParseUint(sess.Metadata["branch_id"], 10, 64)
+	if err != nil || branchID == 0 {
+		log.Printf("ℹ️  [Ninda] Sesión %s sin branch_id en metadata — se ignora", sess.ID)
+		return nil
+	}
+
+	// Reservas desde la página pública: confirman la cita apartada
+	if sess.Metadata["source"] == nindaBookingSource {
+		return handleNindaBookingPaid(sess, connectedAccountID)
+	}
+
+	// Anticipos de citas agendadas por el bot: confirman la cita
+	if sess.Metadata["source"] == botDepositSource {
+		return handleBotDepositPaid(sess, connectedAccountID)
+	}
+
+	// Pagos de citas originados por el bot no son pedidos
+	if sess.Metadata["source"] == "bot" {
+		log.Printf("ℹ️  [Ninda] Sesión %s es pago de cita (source=bot) — no se crea pedido", sess.ID)
+		return nil
+	}
+
+	var existing models.Order
+	if config.DB.Where("stripe_session_id = ?", sess.ID).First(&existing).Error == nil {
+		log.Printf("ℹ️  [Ninda] Pedido ya registrado para sesión %s (ID=%d)", sess.ID, existing.ID)
+		return nil
+	}
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, branchID).Error; err != nil {
+		return fmt.Errorf("sucursal %d no encontrada: %w", branchID, err)
+	}
+
+	// La sesión debe venir de la cuenta conectada de esa sucursal
+	var cfg models.PaymentConfig
+	if err := config.DB.Where("branch_id = ?", branch.ID).First(&cfg).Error; err != nil || cfg.StripeAccountID != connectedAccountID {
+		log.Printf("⚠️  [Ninda] Sesión %s: cuenta %s no corresponde a la sucursal %d", sess.ID, connectedAccountID, branch.ID)
+		return nil
+	}
+
+	items, err := getNindaSessionItems(&branch, sess.ID, connectedAccountID)
+	if err != nil {
+		return err
+	}
+
+	customerName := sess.Metadata["customer_name"]
+	customerPhone := sess.Metadata["customer_phone"]
+	if sess.CustomerDetails != nil {
+		if customerName == "" {
+			customerName = sess.CustomerDetails.Name
+		}
+		if customerPhone == "" {
+			customerPhone = sess.CustomerDetails.Phone
+		}
+	}
+	if customerName == "" {
+		customerName = "Cliente Ninda"
+	}
+
+	sessionID := sess.ID
+	order := models.Order{
+		UserID:          branch.UserID,
+		ClientName:      customerName,
+		ClientPhone:     customerPhone,
+		Items:           items,
+		Total:           float64(sess.AmountTotal) / 100,
+		Notes:           sess.Metadata["notes"],
+		OrderType:       models.OrderTypePickup,
+		Status:          models.OrderStatusConfirmed,
+		Source:          models.OrderSourceNinda,
+		EstimatedTime:   30,
+		PaymentMethod:   "card",
+		StripeSessionID: &sessionID,
+	}
+	if sess.Metadata["order_type"] == string(models.OrderTypeDelivery) {
+		order.OrderType = models.OrderTypeDelivery
+		order.DeliveryAddress = sess.Metadata["delivery_address"]
+		if eta, _ := strconv.Atoi(sess.Metadata["delivery_eta"]); eta > 0 {
+			order.EstimatedTime = eta
+		}
+	}
+
+	// Asignar al agente activo de la sucursal para que lo atienda
+	var agent models.Agent
+	hasAgent := config.DB.Where("branch_id = ? AND is_active = ?", branch.ID, true).First(&agent).Error == nil
+	if hasAgent {
+		order.AgentID = &agent.ID
+	}
+
+	if err := config.DB.Create(&order).Error; err != nil {
+		// Otro reintento pudo haberlo creado en paralelo
+		if config.DB.Where("stripe_session_id = ?", sess.ID).First(&existing).Error == nil {
+			return nil
+		}
+		return fmt.Errorf("error guardando pedido: %w", err)
+	}
+
+	services.RecordOrderCreated(&order, models.OrderEventActorNinda)
+
+	log.Printf("✅ [Ninda] Pedido creado ID=%d | Sucursal: %s | Total: $%.2f MXN | Sesión: %s",
+		order.ID, branch.BusinessName, order.Total, sess.ID)
+
+	if hasAgent && customerPhone != "" {
+		go func() {
+			msg := buildNindaOrderNotification(branch.BusinessName, &order)
+			if err := services.SendWhatsAppViaAgent(&agent, customerPhone, msg, models.TemplatePurposePaymentNotif); err != nil {
+				log.Printf("⚠️  [Ninda] No se pudo notificar al cliente vía agente %d: %v", agent.ID, err)
+			} else {
+				log.Printf("📲 [Ninda] Cliente notificado vía agente %d", agent.ID)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// nindaDeliveryInfo zonas de entrega que la tienda muestra al cliente
+func nindaDeliveryInfo(branch *models.MyBusinessInfo) gin.H {
+	zones := make([]gin.H, 0, len(branch.DeliveryZones))
+	for _, z := range branch.DeliveryZones {
+		zones = append(zones, gin.H{
+			"name":       z.Name,
+			"fee":        z.Fee,
+			"minOrder":   z.MinOrder,
+			"etaMinutes": z.ETAMinutes,
+		})
+	}
+	return gin.H{"enabled": len(zones) > 0, "zones": zones}
+}
+
+// truncateMetadata Stripe limita cada valor de metadata a 500 caracteres
+func truncateMetadata(value string) string {
+	if r := []rune(value); len(r) > 500 {
+		return string(r[:500])
+	}
+	return value
+}
+
+// Metadata del producto de Stripe: posición y nombre en el catálogo y
+// opciones elegidas (el nombre visible las lleva en texto)
+const (
+	nindaItemIndexKey   = "attomos_index"
+	nindaItemNameKey    = "attomos_name"
+	nindaItemOptionsKey = "attomos_options"
+
+	// nindaLegacyItemKey formato anterior {"name","options"} en una sola
+	// clave; se sigue leyendo durante una versión para los Checkouts
+	// creados antes del cambio
+	nindaLegacyItemKey = "attomos_item"
+)
+
+type nindaLegacyItemMeta struct {
+	Name    string                   `json:"name"`
+	Options []models.OrderItemOption `json:"options"`
+}
+
+// getNindaSessionItems lee los line items de la sesión en la cuenta conectada
+func getNindaSessionItems(branch *models.MyBusinessInfo, sessionID, connectedAccountID string) (models.OrderItems, error) {
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	params := &stripe.CheckoutSessionListLineItemsParams{
+		Session: stripe.String(sessionID),
+	}
+	params.AddExpand("data.price.product")
+	params.SetStripeAccount(connectedAccountID)
+
+	items := models.OrderItems{}
+	iter := session.ListLineItems(params)
+	for iter.Next() {
+		li := iter.LineItem()
+		qty := int(li.Quantity)
+		if qty <= 0 {
+			qty = 1
+		}
+		unitPrice := float64(li.AmountTotal) / 100 / float64(qty)
+		if li.Price != nil && li.Price.UnitAmount > 0 {
+			unitPrice = float64(li.Price.UnitAmount) / 100
+		}
+		item := models.OrderItem{
+			Name:     li.Description,
+			Quantity: qty,
+			Price:    unitPrice,
+		}
+		if li.Price != nil && li.Price.Product != nil {
+			applyNindaItemMetadata(branch, &item, li.Price.Product.Metadata)
+		}
+		items = append(items, item)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error leyendo line items: %w", err)
+	}
+	return items, nil
+}
+
+// applyNindaItemMetadata completa producto y opciones del line item. El
+// nombre sale del catálogo por su posición (la metadata lo guarda truncado)
+// mientras esa posición siga siendo el mismo producto
+func applyNindaItemMetadata(branch *models.MyBusinessInfo, item *models.OrderItem, meta map[string]string) {
+	if raw := meta[nindaLegacyItemKey]; raw != "" {
+		var legacy nindaLegacyItemMeta
+		if json.Unmarshal([]byte(raw), &legacy) == nil {
+			item.Name = legacy.Name
+			item.Options = legacy.Options
+		}
+		return
+	}
+
+	name := meta[nindaItemNameKey]
+	if idx, err := strconv.Atoi(meta[nindaItemIndexKey]); err == nil && idx >= 0 && idx < len(branch.Services) &&
+		strings.EqualFold(truncateMetadata(branch.Services[idx].Title), name) {
+		name = branch.Services[idx].Title
+	}
+	if name != "" {
+		item.Name = name
+	}
+	if raw := meta[nindaItemOptionsKey]; raw != "" {
+		var options []models.OrderItemOption
+		if json.Unmarshal([]byte(raw), &options) == nil {
+			item.Options = options
+		}
+	}
+}
+
+// buildNindaOrderNotification mensaje de WhatsApp para el cliente cuando su
+// compra en Ninda queda registrada
+func buildNindaOrderNotification(branchName string, order *models.Order) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ *¡Recibimos tu pedido en %s!*\n\n", branchName))
+	sb.WriteString(fmt.Sprintf("🧾 *Pedido #%d*\n", order.ID))
+	for _, item := range order.Items {
+		sb.WriteString(fmt.Sprintf("• %dx %s — $%.0f\n", item.Quantity, item.Label(), item.Price*float64(item.Quantity)))
+	}
+	sb.WriteString(fmt.Sprintf("\n💰 *Total pagado:* $%.0f MXN\n", order.Total))
+	sb.WriteString("\nTe avisaremos por aquí cuando esté listo 🙌")
+	return sb.String()
+}
+
 // ─── Helpers ─────────────────────────────────────────────────────────────────
 
-func buildItemsSummary(items []NindaCartItem) string {
+func buildItemsSummary(items models.OrderItems) string {
 	parts := make([]string, 0, len(items))
 	for _, item := range items {
-		parts = append(parts, fmt.Sprintf("%dx %s ($%.0f)", item.Quantity, item.Title, item.Price))
+		parts = append(parts, fmt.Sprintf("%dx %s ($%.0f)", item.Quantity, item.Label(), item.Price))
 	}
-	return strings.Join(parts, ", ")
+	return truncateMetadata(strings.Join(parts, ", "))
 }
 
 // buildWhatsAppMessage construye el mensaje pre-llenado para WhatsApp.
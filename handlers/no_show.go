@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"attomos/config"
+	"attomos/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NoShowPolicyRequest body de PUT /api/no-show-policy/:branch_id
+type NoShowPolicyRequest struct {
+	AutoMark         bool    `json:"autoMark"`
+	GraceMinutes     int     `json:"graceMinutes"`
+	DepositThreshold int     `json:"depositThreshold"`
+	DepositAmount    float64 `json:"depositAmount"`
+}
+
+// GetNoShowPolicy — GET /api/no-show-policy/:branch_id
+// Política de inasistencias de la sucursal (valores por defecto si no existe)
+func GetNoShowPolicy(c *gin.Context) {
+	userInterface, _ := c.Get("user")
+	user := userInterface.(*models.User)
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("branch_id"), user.ID).First(&branch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sucursal no encontrada"})
+		return
+	}
+
+	policy := models.NoShowPolicy{UserID: user.ID, BranchID: branch.ID, GraceMinutes: models.DefaultNoShowGrace}
+	config.DB.Where("branch_id = ?", branch.ID).First(&policy)
+
+	c.JSON(http.StatusOK, noShowPolicyResponse(&policy))
+}
+
+// UpdateNoShowPolicy — PUT /api/no-show-policy/:branch_id
+func UpdateNoShowPolicy(c *gin.Context) {
+	userInterface, _ := c.Get("user")
+	user := userInterface.(*models.User)
+
+	var req NoShowPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+	if req.GraceMinutes < 0 || req.DepositThreshold < 0 || req.DepositAmount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Los valores no pueden ser negativos"})
+		return
+	}
+	if req.DepositThreshold > 0 && req.DepositAmount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indica el monto del anticipo"})
+		return
+	}
+	if req.GraceMinutes == 0 {
+		req.GraceMinutes = models.DefaultNoShowGrace
+	}
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("branch_id"), user.ID).First(&branch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sucursal no encontrada"})
+		return
+	}
+
+	// Si se pide anticipo, la sucursal debe poder cobrarlo
+	if req.DepositThreshold > 0 {
+		var cfg models.PaymentConfig
+		err := config.DB.Where("branch_id = ? AND user_id = ? AND stripe_enabled = ?", branch.ID, user.ID, true).First(&cfg).Error
+		if err != nil || !cfg.StripeChargesEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Conecta Stripe en esta sucursal para cobrar anticipos"})
+			return
+		}
+	}
+
+	var policy models.NoShowPolicy
+	config.DB.Where("branch_id = ?", branch.ID).First(&policy)
+	policy.UserID = user.ID
+	policy.BranchID = branch.ID
+	policy.AutoMark = req.AutoMark
+	policy.GraceMinutes = req.GraceMinutes
+	policy.DepositThreshold = req.DepositThreshold
+	policy.DepositAmount = req.DepositAmount
+
+	if err := config.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando la política"})
+		return
+	}
+
+	log.Printf("✅ [User %d] Política de inasistencias de la sucursal %d actualizada", user.ID, branch.ID)
+	c.JSON(http.StatusOK, noShowPolicyResponse(&policy))
+}
+
+func noShowPolicyResponse(policy *models.NoShowPolicy) gin.H {
+	return gin.H{
+		"branchId":         policy.BranchID,
+		"autoMark":         policy.AutoMark,
+		"graceMinutes":     policy.GraceMinutes,
+		"depositThreshold": policy.DepositThreshold,
+		"depositAmount":    policy.DepositAmount,
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// orderFeedHeartbeat cada cuánto se manda un comentario SSE para que proxies
+// y navegadores no cierren la conexión por inactividad
+const orderFeedHeartbeat = 25 * time.Second
+
+// StreamOrders transmite por SSE los pedidos nuevos, los cambios de estado y
+// los eliminados del usuario. Con ?branch_id= solo los de esa sucursal (y los
+// manuales sin agente). Cada evento "order" lleva {type, order}.
+func StreamOrders(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var branchID uint
+	if raw := c.Query("branch_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID de sucursal inválido"})
+			return
+		}
+		var branch models.MyBusinessInfo
+		if err := config.DB.Where("id = ? AND user_id = ?", id, user.ID).First(&branch).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sucursal no encontrada"})
+			return
+		}
+		branchID = branch.ID
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Streaming no soportado"})
+		return
+	}
+
+	// Configurar headers para SSE
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Importante para nginx
+
+	events, unsubscribe := services.SubscribeOrders(user.ID)
+	defer unsubscribe()
+
+	agentNames := loadAgentNames(user.ID)
+
+	fmt.Fprint(c.Writer, "event: ready\ndata: {}\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(orderFeedHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": ping\n\n")
+			flusher.Flush()
+		case ev := <-events:
+			if branchID != 0 && ev.BranchID != 0 && ev.BranchID != branchID {
+				continue
+			}
+			// Agente creado después de abrir la conexión
+			if ev.Order.AgentID != nil && agentNames[*ev.Order.AgentID] == "" {
+				agentNames = loadAgentNames(user.ID)
+			}
+			payload, err := json.Marshal(gin.H{
+				"type":  ev.Type,
+				"order": orderToResponse(ev.Order, agentNames),
+			})
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "event: order\ndata: %s\n\n", payload)
+			flusher.Flush()
+		}
+	}
+}
+
+// loadAgentNames nombres de los agentes del usuario por ID
+func loadAgentNames(userID uint) map[uint]string {
+	var agents []models.Agent
+	config.DB.Where("user_id = ?", userID).Select("id, name").Find(&agents)
+	names := map[uint]string{}
+	for _, a := range agents {
+		names[a.ID] = a.Name
+	}
+	return names
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrderNotifyConfigRequest body de PUT /api/order-notifications/:branch_id.
+// Un texto vacío usa el mensaje por defecto del estado.
+type OrderNotifyConfigRequest struct {
+	Enabled   bool   `json:"enabled"`
+	Confirmed string `json:"confirmed"`
+	Preparing string `json:"preparing"`
+	Ready     string `json:"ready"`
+	Delivered string `json:"delivered"`
+	Cancelled string `json:"cancelled"`
+}
+
+// GetOrderNotifyConfig — GET /api/order-notifications/:branch_id
+// Avisos de pedidos de la sucursal y los mensajes por defecto de cada estado
+func GetOrderNotifyConfig(c *gin.Context) {
+	userInterface, _ := c.Get("user")
+	user := userInterface.(*models.User)
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("branch_id"), user.ID).First(&branch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sucursal no encontrada"})
+		return
+	}
+
+	cfg := services.OrderNotifyConfigFor(&branch)
+	c.JSON(http.StatusOK, orderNotifyConfigResponse(&cfg))
+}
+
+// UpdateOrderNotifyConfig — PUT /api/order-notifications/:branch_id
+func UpdateOrderNotifyConfig(c *gin.Context) {
+	userInterface, _ := c.Get("user")
+	user := userInterface.(*models.User)
+
+	var req OrderNotifyConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos"})
+		return
+	}
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("branch_id"), user.ID).First(&branch).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sucursal no encontrada"})
+		return
+	}
+
+	var cfg models.OrderNotifyConfig
+	config.DB.Where("branch_id = ?", branch.ID).First(&cfg)
+	cfg.UserID = user.ID
+	cfg.BranchID = branch.ID
+	cfg.Enabled = req.Enabled
+	cfg.Confirmed = req.Confirmed
+	cfg.Preparing = req.Preparing
+	cfg.Ready = req.Ready
+	cfg.Delivered = req.Delivered
+	cfg.Cancelled = req.Cancelled
+
+	// Select("*") para que Enabled=false también se guarde al actualizar
+	if err := config.DB.Select("*").Save(&cfg).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error guardando los avisos"})
+		return
+	}
+
+	log.Printf("✅ [User %d] Avisos de pedidos de la sucursal %d actualizados", user.ID, branch.ID)
+	c.JSON(http.StatusOK, orderNotifyConfigResponse(&cfg))
+}
+
+func orderNotifyConfigResponse(s *models.OrderNotifyConfig) gin.H {
+	defaults := gin.H{}
+	for status, text := range models.DefaultOrderNotificationTemplates {
+		defaults[string(status)] = text
+	}
+	return gin.H{
+		"branchId":  s.BranchID,
+		"enabled":   s.Enabled,
+		"confirmed": s.Confirmed,
+		"preparing": s.Preparing,
+		"ready":     s.Ready,
+		"delivered": s.Delivered,
+		"cancelled": s.Cancelled,
+		"defaults":  defaults,
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 
 	"attomos/config"
 	"attomos/models"
+	"attomos/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -42,9 +44,15 @@ func GetOrders(c *gin.Context) {
 	}
 	user := userInterface.(*models.User)
 
+	query := config.DB.Where("user_id = ?", user.ID)
+	// ?branch_id= pedidos de los agentes de esa sucursal (y los manuales sin agente)
+	if branchID := c.Query("branch_id"); branchID != "" {
+		query = query.Where("agent_id IS NULL OR agent_id IN (?)",
+			config.DB.Model(&models.Agent{}).Select("id").Where("branch_id = ? AND user_id = ?", branchID, user.ID))
+	}
+
 	var orders []models.Order
-	if err := config.DB.
-		Where("user_id = ?", user.ID).
+	if err := query.
 		Order("created_at DESC").
 		Find(&orders).Error; err != nil {
 		log.Printf("❌ [User %d] Error leyendo pedidos: %v", user.ID, err)
@@ -53,12 +61,7 @@ func GetOrders(c *gin.Context) {
 	}
 
 	// Mapa de agentes para nombres
-	var agents []models.Agent
-	config.DB.Where("user_id = ?", user.ID).Select("id, name").Find(&agents)
-	agentNames := map[uint]string{}
-	for _, a := range agents {
-		agentNames[a.ID] = a.Name
-	}
+	agentNames := loadAgentNames(user.ID)
 
 	response := make([]OrderResponse, 0, len(orders))
 	for _, o := range orders {
@@ -118,6 +121,10 @@ func CreateOrder(c *gin.Context) {
 	if req.Status != "" {
 		status = models.OrderStatus(req.Status)
 	}
+	if !status.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido"})
+		return
+	}
 
 	estimatedTime := 30
 	if req.EstimatedTime > 0 {
@@ -154,6 +161,8 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
+	services.RecordOrderCreated(&order, models.OrderEventActorDashboard)
+
 	log.Printf("✅ [User %d] Pedido creado con ID: %d", user.ID, order.ID)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -162,7 +171,8 @@ func CreateOrder(c *gin.Context) {
 	})
 }
 
-// UpdateOrderStatus actualiza el estado de un pedido
+// UpdateOrderStatus actualiza el estado de un pedido. Solo acepta los cambios
+// permitidos por el ciclo de vida del pedido y avisa al cliente por WhatsApp.
 func UpdateOrderStatus(c *gin.Context) {
 	userInterface, exists := c.Get("user")
 	if !exists {
@@ -179,22 +189,52 @@ func UpdateOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido"})
 		return
 	}
+	status := models.OrderStatus(req.Status)
+	if !status.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido"})
+		return
+	}
 
-	result := config.DB.Model(&models.Order{}).
-		Where("id = ? AND user_id = ?", orderID, user.ID).
-		Update("status", req.Status)
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id = ?", orderID, user.ID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pedido no encontrado"})
+		return
+	}
 
-	if result.Error != nil {
+	event, err := services.ChangeOrderStatus(&order, status, models.OrderEventActorDashboard)
+	if errors.Is(err, services.ErrInvalidOrderTransition) || errors.Is(err, services.ErrInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ [User %d] Error actualizando pedido %s: %v", user.ID, orderID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando estado"})
 		return
 	}
-	if result.RowsAffected == 0 {
+
+	log.Printf("✅ [User %d] Pedido %s → %s", user.ID, orderID, req.Status)
+	c.JSON(http.StatusOK, gin.H{"success": true, "notify": event.NotifyStatus != models.OrderNotifyNone})
+}
+
+// GetOrderEvents devuelve el historial de estados de un pedido
+func GetOrderEvents(c *gin.Context) {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return
+	}
+	user := userInterface.(*models.User)
+
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id = ?", c.Param("id"), user.ID).First(&order).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Pedido no encontrado"})
 		return
 	}
 
-	log.Printf("✅ [User %d] Pedido %s → %s", user.ID, orderID, req.Status)
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	var events []models.OrderEvent
+	config.DB.Where("order_id = ?", order.ID).Order("created_at ASC, id ASC").Find(&events)
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
 }
 
 // DeleteOrder elimina un pedido (soft delete)
@@ -207,17 +247,18 @@ func DeleteOrder(c *gin.Context) {
 	user := userInterface.(*models.User)
 	orderID := c.Param("id")
 
-	result := config.DB.Where("id = ? AND user_id = ?", orderID, user.ID).
-		Delete(&models.Order{})
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error eliminando pedido"})
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id = ?", orderID, user.ID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pedido no encontrado"})
 		return
 	}
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Pedido no encontrado"})
+
+	if err := config.DB.Delete(&order).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error eliminando pedido"})
 		return
 	}
+	services.ReleaseOrderStock(&order)
+	services.PublishOrder(&order, services.OrderFeedDeleted)
 
 	log.Printf("✅ [User %d] Pedido %s eliminado", user.ID, orderID)
 	c.JSON(http.StatusOK, gin.H{"success": true})
@@ -260,14 +301,15 @@ func CreateBotOrder(c *gin.Context) {
 	}
 
 	var req struct {
-		AgentID         uint                     `json:"agentId"`
-		ClientName      string                   `json:"clientName"`
-		ClientPhone     string                   `json:"clientPhone"`
-		Items           []map[string]interface{} `json:"items"`
-		Total           float64                  `json:"total"`
-		OrderType       string                   `json:"orderType"`
-		DeliveryAddress string                   `json:"deliveryAddress"`
-		Status          string                   `json:"status"`
+		AgentID          uint                     `json:"agentId"`
+		ClientName       string                   `json:"clientName"`
+		ClientPhone      string                   `json:"clientPhone"`
+		Items            []map[string]interface{} `json:"items"`
+		Total            float64                  `json:"total"`
+		OrderType        string                   `json:"orderType"`
+		DeliveryAddress  string                   `json:"deliveryAddress"`
+		DeliveryLocation string                   `json:"deliveryLocation"` // "lat,lng" si el cliente compartió su ubicación
+		Status           string                   `json:"status"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -292,6 +334,65 @@ func CreateBotOrder(c *gin.Context) {
 	if req.Status != "" {
 		status = models.OrderStatus(req.Status)
 	}
+	if !status.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Estado inválido"})
+		return
+	}
+
+	// Precios y total se recalculan con el catálogo de la sucursal (precio
+	// base + variantes y extras); el bot solo indica qué eligió el cliente
+	total := req.Total
+	branch := services.BranchForAgent(agent.ID)
+	if branch != nil && len(items) > 0 {
+		priced, err := services.PriceOrderItems(branch, items)
+		if err != nil {
+			code := "invalid_options"
+			if errors.Is(err, services.ErrUnknownCatalogItem) {
+				code = "unknown_item"
+			}
+			log.Printf("⚠️  [Bot] Pedido rechazado (agente=%d): %v", agent.ID, err)
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		items = priced
+		total = itemsSubtotal(items)
+
+		// No tomar pedidos de productos agotados o sin existencias suficientes
+		if err := services.CheckStock(branch, items); err != nil {
+			log.Printf("⚠️  [Bot] Pedido rechazado por existencias (agente=%d): %v", agent.ID, err)
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "out_of_stock"})
+			return
+		}
+	}
+
+	// Pedidos a domicilio: la dirección debe caer en una zona de la sucursal;
+	// el costo de envío se agrega como una línea más del pedido
+	estimatedTime := 30
+	if orderType == models.OrderTypeDelivery {
+		if branch != nil {
+			subtotal := total
+			if subtotal == 0 {
+				subtotal = itemsSubtotal(items)
+			}
+			addr := services.DeliveryAddress{
+				Text:     req.DeliveryAddress,
+				Location: services.ParseGeoPoint(req.DeliveryLocation),
+			}
+			quote, err := services.QuoteDelivery(branch, addr, subtotal)
+			if err != nil {
+				log.Printf("⚠️  [Bot] Pedido a domicilio rechazado (agente=%d): %v", agent.ID, err)
+				respondDeliveryRejected(c, quote, err)
+				return
+			}
+			if quote.Fee > 0 {
+				items = append(items, services.DeliveryFeeItem(quote))
+				total = subtotal + quote.Fee
+			}
+			if quote.ETAMinutes > 0 {
+				estimatedTime = quote.ETAMinutes
+			}
+		}
+	}
 
 	agentID := &req.AgentID
 	order := models.Order{
@@ -300,12 +401,12 @@ func CreateBotOrder(c *gin.Context) {
 		ClientName:      req.ClientName,
 		ClientPhone:     req.ClientPhone,
 		Items:           items,
-		Total:           req.Total,
+		Total:           total,
 		OrderType:       orderType,
 		Status:          status,
 		Source:          models.OrderSourceAgent,
 		DeliveryAddress: req.DeliveryAddress,
-		EstimatedTime:   30,
+		EstimatedTime:   estimatedTime,
 	}
 
 	if err := config.DB.Create(&order).Error; err != nil {
@@ -314,6 +415,23 @@ func CreateBotOrder(c *gin.Context) {
 		return
 	}
 
+	services.RecordOrderCreated(&order, models.OrderEventActorBot)
+
 	log.Printf("✅ [Bot] Pedido creado ID=%d agente=%d cliente=%s", order.ID, req.AgentID, req.ClientName)
-	c.JSON(http.StatusOK, gin.H{"success": true, "id": order.ID})
+	// El bot muestra al cliente los precios y el total ya recalculados
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"id":      order.ID,
+		"items":   order.Items,
+		"total":   order.Total,
+	})
+}
+
+// itemsSubtotal suma de los productos del pedido
+func itemsSubtotal(items models.OrderItems) float64 {
+	total := 0.0
+	for _, item := range items {
+		total += item.Price * float64(item.Quantity)
+	}
+	return total
 }
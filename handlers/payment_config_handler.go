@@ -3,6 +3,7 @@ package handlers
 import (
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"regexp"
@@ -16,6 +17,7 @@ import (
 	stripe "github.com/stripe/stripe-go/v78"
 	"github.com/stripe/stripe-go/v78/account"
 	"github.com/stripe/stripe-go/v78/accountlink"
+	"github.com/stripe/stripe-go/v78/checkout/session"
 	"github.com/stripe/stripe-go/v78/paymentlink"
 	"github.com/stripe/stripe-go/v78/price"
 )
@@ -496,8 +498,13 @@ type PaymentLinkRequest struct {
 	ServiceName string  `json:"serviceName"`
 	Amount      float64 `json:"amount"` // en MXN, 0 = sin monto fijo
 	BranchID    string  `json:"branchId"`
+	// AppointmentID cita pendiente cuyo anticipo se cobra (0 = cobro suelto)
+	AppointmentID uint `json:"appointmentId"`
 }
 
+// botDepositSource marca en la metadata los anticipos de citas del bot
+const botDepositSource = "bot_deposit"
+
 func CreateBotPaymentLink(c *gin.Context) {
 	// Auth: token interno del bot (no JWT de usuario)
 	auth := c.GetHeader("Authorization")
@@ -538,6 +545,12 @@ func CreateBotPaymentLink(c *gin.Context) {
 
 	stripe.Key = stripeKey
 
+	// Anticipo de una cita: Checkout con vencimiento ligado a la cita
+	if req.AppointmentID != 0 {
+		createBotDepositCheckout(c, &cfg, req)
+		return
+	}
+
 	amountCents := int64(req.Amount * 100)
 	if amountCents <= 0 {
 		amountCents = 100 // mínimo $1 MXN
@@ -582,3 +595,110 @@ func CreateBotPaymentLink(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"url": link.URL})
 }
+
+// createBotDepositCheckout cobra el anticipo de una cita pendiente agendada
+// por el bot. A diferencia de un Payment Link el Checkout expira: si no se
+// paga en PaymentHold la cita se libera igual que una reserva de Ninda.
+// El monto sale de la política de inasistencias de la sucursal, no del bot.
+func createBotDepositCheckout(c *gin.Context, cfg *models.PaymentConfig, req PaymentLinkRequest) {
+	var appt models.Appointment
+	if err := config.DB.Where("id = ? AND branch_id = ? AND status = ?",
+		req.AppointmentID, cfg.BranchID, models.AppointmentStatusPending).First(&appt).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cita pendiente de anticipo no encontrada"})
+		return
+	}
+
+	// Sin Checkout ligado la cita apartaría su horario para siempre:
+	// cualquier fallo a partir de aquí la libera
+	fail := func(status int, msg string) {
+		releaseHeldAppointment(&appt)
+		c.JSON(status, gin.H{"error": msg, "appointmentCancelled": true})
+	}
+
+	var policy models.NoShowPolicy
+	if err := config.DB.Where("branch_id = ?", cfg.BranchID).First(&policy).Error; err != nil || policy.DepositAmount <= 0 {
+		log.Printf("⚠️  [PaymentLink] La sucursal %d no tiene monto de anticipo configurado (cita %d)", cfg.BranchID, appt.ID)
+		fail(http.StatusBadRequest, "La sucursal no tiene anticipo configurado")
+		return
+	}
+	amountCents := int64(math.Round(policy.DepositAmount * 100))
+
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+
+	params := &stripe.CheckoutSessionParams{
+		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
+		LineItems: []*stripe.CheckoutSessionLineItemParams{{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency:   stripe.String("mxn"),
+				UnitAmount: stripe.Int64(amountCents),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name: stripe.String(req.ServiceName),
+				},
+			},
+			Quantity: stripe.Int64(1),
+		}},
+		Mode:       stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL: stripe.String(fmt.Sprintf("%s/ninda/%d", baseURL, cfg.BranchID)),
+		ExpiresAt:  stripe.Int64(time.Now().Add(models.PaymentHold).Unix()),
+		Metadata: map[string]string{
+			"source":         botDepositSource,
+			"branch_id":      fmt.Sprintf("%d", cfg.BranchID),
+			"appointment_id": fmt.Sprintf("%d", appt.ID),
+		},
+	}
+	params.SetStripeAccount(cfg.StripeAccountID)
+
+	sess, err := session.New(params)
+	if err != nil {
+		log.Printf("❌ [PaymentLink] Error creando Checkout del anticipo de la cita %d: %v", appt.ID, err)
+		fail(http.StatusInternalServerError, "Error al crear link de pago")
+		return
+	}
+
+	// La cita aparta su horario solo mientras el Checkout siga vigente
+	if err := config.DB.Model(&appt).Update("stripe_session_id", sess.ID).Error; err != nil {
+		log.Printf("❌ [PaymentLink] Error ligando el anticipo a la cita %d: %v", appt.ID, err)
+		fail(http.StatusInternalServerError, "Error al crear link de pago")
+		return
+	}
+
+	log.Printf("✅ [PaymentLink] Anticipo de la cita %d: %s", appt.ID, sess.URL)
+	c.JSON(http.StatusOK, gin.H{
+		"url":         sess.URL,
+		"amount":      policy.DepositAmount,
+		"holdMinutes": int(models.PaymentHold / time.Minute),
+	})
+}
+
+// handleBotDepositPaid confirma la cita cuyo anticipo se pagó. El bot ya
+// creó el evento de Calendar y avisó al cliente al agendarla.
+func handleBotDepositPaid(sess *stripe.CheckoutSession, connectedAccountID string) error {
+	var appointment models.Appointment
+	if err := config.DB.Where("stripe_session_id = ?", sess.ID).First(&appointment).Error; err != nil {
+		log.Printf("⚠️  [PaymentLink] Anticipo pagado sin cita ligada (sesión %s)", sess.ID)
+		return nil
+	}
+
+	var cfg models.PaymentConfig
+	if err := config.DB.Where("branch_id = ?", appointment.BranchID).First(&cfg).Error; err != nil || cfg.StripeAccountID != connectedAccountID {
+		log.Printf("⚠️  [PaymentLink] Sesión %s: cuenta %s no corresponde a la sucursal %d", sess.ID, connectedAccountID, appointment.BranchID)
+		return nil
+	}
+
+	paid := float64(sess.AmountTotal) / 100
+	result := config.DB.Model(&models.Appointment{}).
+		Where("id = ? AND status = ?", appointment.ID, models.AppointmentStatusPending).
+		Updates(map[string]interface{}{"status": models.AppointmentStatusConfirmed, "paid_amount": paid})
+	if result.Error != nil {
+		return fmt.Errorf("error confirmando cita %d: %w", appointment.ID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	log.Printf("✅ [PaymentLink] Anticipo de la cita %d pagado ($%.2f MXN) — cita confirmada", appointment.ID, paid)
+	return nil
+}
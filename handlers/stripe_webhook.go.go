@@ -37,6 +37,11 @@ func StripeWebhookHandler(c *gin.Context) {
 
 	if webhookSecret != "" {
 		event, err = webhook.ConstructEvent(body, sigHeader, webhookSecret)
+		// Los eventos de cuentas conectadas (Ninda) llegan firmados con el
+		// secret del endpoint de Connect
+		if connectSecret := os.Getenv("STRIPE_CONNECT_WEBHOOK_SECRET"); err != nil && connectSecret != "" {
+			event, err = webhook.ConstructEvent(body, sigHeader, connectSecret)
+		}
 		if err != nil {
 			log.Printf("❌ [WEBHOOK] Firma inválida: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Firma inválida"})
@@ -89,6 +94,36 @@ func StripeWebhookHandler(c *gin.Context) {
 		}
 		handleSubscriptionDeleted(&sub)
 
+	// ── Checkout completado en cuenta conectada (compras de Ninda) ───────
+	case "checkout.session.completed":
+		var sess stripe_lib.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
+			log.Printf("❌ [WEBHOOK] Error parseando checkout session: %v", err)
+			break
+		}
+		if event.Account == "" {
+			log.Printf("ℹ️  [WEBHOOK] Checkout %s de la plataforma ignorado", sess.ID)
+			break
+		}
+		if err := handleNindaCheckoutCompleted(&sess, event.Account); err != nil {
+			log.Printf("❌ [WEBHOOK] Error registrando pedido Ninda %s: %v", sess.ID, err)
+			// 500 para que Stripe reintente el evento
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error registrando pedido"})
+			return
+		}
+
+	// ── Checkout expirado en cuenta conectada (reservas y anticipos sin pagar)
+	case "checkout.session.expired":
+		var sess stripe_lib.CheckoutSession
+		if err := json.Unmarshal(event.Data.Raw, &sess); err != nil {
+			log.Printf("❌ [WEBHOOK] Error parseando checkout session: %v", err)
+			break
+		}
+		source := sess.Metadata["source"]
+		if event.Account != "" && (source == nindaBookingSource || source == botDepositSource) {
+			handleNindaBookingExpired(&sess)
+		}
+
 	default:
 		log.Printf("ℹ️  [WEBHOOK] Evento no manejado: %s", event.Type)
 	}
@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"attomos/config"
 	"attomos/models"
@@ -11,8 +18,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// passwordResetTTL vigencia del enlace de restablecimiento
+const passwordResetTTL = 30 * time.Minute
+
+var errResetTokenUsed = errors.New("token de restablecimiento ya utilizado")
+
 type UpdatePasswordRequest struct {
 	CurrentPassword string `json:"currentPassword" binding:"required"`
 	NewPassword     string `json:"newPassword" binding:"required,min=8"`
@@ -364,6 +377,17 @@ func RequestPasswordReset(c *gin.Context) {
 		return
 	}
 
+	// El enlace nunca se arma con el Host de la petición: un atacante podría
+	// falsearlo y recibir el token
+	baseURL := strings.TrimRight(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		log.Println("❌ [PasswordReset] BASE_URL no configurado, no se pueden generar enlaces de restablecimiento")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "No pudimos procesar la solicitud",
+		})
+		return
+	}
+
 	var user models.User
 	if err := config.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
 		// No revelar si el email existe o no (seguridad)
@@ -373,8 +397,42 @@ func RequestPasswordReset(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implementar envío de email con token de restablecimiento
-	log.Printf("📧 [User %d] Solicitud de restablecimiento de contraseña: %s", user.ID, user.Email)
+	// Invalidar tokens anteriores que sigan pendientes
+	now := time.Now()
+	config.DB.Model(&models.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Update("used_at", &now)
+
+	rawToken, err := generateResetToken()
+	if err != nil {
+		log.Printf("❌ [User %d] Error generando token de restablecimiento: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No pudimos procesar la solicitud",
+		})
+		return
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashResetToken(rawToken),
+		ExpiresAt: now.Add(passwordResetTTL),
+	}
+	if err := config.DB.Create(&resetToken).Error; err != nil {
+		log.Printf("❌ [User %d] Error guardando token de restablecimiento: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No pudimos procesar la solicitud",
+		})
+		return
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", baseURL, rawToken)
+
+	mailer := services.NewMailSender()
+	if err := mailer.Send(user.Email, "Restablece tu contraseña - Attomos", buildPasswordResetEmail(resetURL)); err != nil {
+		log.Printf("❌ [User %d] Error enviando correo de restablecimiento: %v", user.ID, err)
+	} else {
+		log.Printf("📧 [User %d] Correo de restablecimiento enviado: %s", user.ID, user.Email)
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Si el email existe, recibirás instrucciones para restablecer tu contraseña",
@@ -396,11 +454,68 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	// TODO: Implementar validación de token y actualización de contraseña
-	log.Printf("🔐 Intento de restablecimiento de contraseña con token: %s", req.Token)
+	var resetToken models.PasswordResetToken
+	if err := config.DB.Where("token_hash = ?", hashResetToken(req.Token)).First(&resetToken).Error; err != nil || !resetToken.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "El enlace no es válido o ya expiró. Solicita uno nuevo.",
+		})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, resetToken.UserID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "El enlace no es válido o ya expiró. Solicita uno nuevo.",
+		})
+		return
+	}
+
+	if err := user.HashPassword(req.NewPassword); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error al procesar la contraseña",
+		})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Consumir el token solo si nadie lo usó antes (un solo uso)
+		resetToken.MarkUsed()
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", resetToken.UsedAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenUsed
+		}
 
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error": "Funcionalidad no implementada aún",
+		// Invalidar todas las sesiones (JWT) existentes
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"password":            user.Password,
+			"password_changed_at": resetToken.UsedAt,
+		}).Error
+	})
+	if err == errResetTokenUsed {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "El enlace no es válido o ya expiró. Solicita uno nuevo.",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ [User %d] Error restableciendo contraseña: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Error al restablecer contraseña",
+		})
+		return
+	}
+
+	c.SetCookie("auth_token", "", -1, "/", "", false, true)
+
+	log.Printf("🔐 [User %d] Contraseña restablecida, sesiones anteriores invalidadas", user.ID)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Contraseña restablecida exitosamente",
 	})
 }
 
@@ -427,3 +542,33 @@ func GetServerInfo(c *gin.Context) {
 		},
 	})
 }
+
+// ============================================
+// HELPERS - Restablecimiento de contraseña
+// ============================================
+
+// generateResetToken genera un token aleatorio de 32 bytes en hexadecimal
+func generateResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashResetToken retorna el SHA-256 del token, que es lo que se guarda en BD
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildPasswordResetEmail arma el HTML del correo de restablecimiento
+func buildPasswordResetEmail(resetURL string) string {
+	return fmt.Sprintf(`<div style="font-family: Arial, sans-serif; max-width: 480px; margin: 0 auto;">
+	<h2>Restablece tu contraseña</h2>
+	<p>Recibimos una solicitud para restablecer la contraseña de tu cuenta de Attomos.</p>
+	<p><a href="%s" style="display: inline-block; padding: 12px 20px; background: #06b6d4; color: #fff; text-decoration: none; border-radius: 8px;">Crear nueva contraseña</a></p>
+	<p>El enlace expira en 30 minutos y solo puede usarse una vez.</p>
+	<p style="color: #6b7280; font-size: 13px;">Si no solicitaste este cambio, ignora este correo.</p>
+</div>`, resetURL)
+}
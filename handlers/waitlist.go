@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+	"attomos/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============================================
+// LISTA DE ESPERA (autenticado con BOT_API_TOKEN)
+// ============================================
+
+// JoinBotWaitlist — POST /api/bot/waitlist
+// El bot anota al cliente cuando el horario que pidió está lleno. Si se
+// cancela una cita de la sucursal dentro de su ventana de fechas, el backend
+// le ofrece el horario por WhatsApp.
+func JoinBotWaitlist(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
+	}
+
+	var req struct {
+		AgentID    uint   `json:"agentId" binding:"required"`
+		ClientName string `json:"clientName"`
+		Phone      string `json:"phone" binding:"required"`
+		Service    string `json:"service"`
+		Worker     string `json:"worker"`
+		DateFrom   string `json:"dateFrom" binding:"required"` // YYYY-MM-DD
+		DateTo     string `json:"dateTo"`                      // YYYY-MM-DD, vacío = DateFrom
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+	if req.DateTo == "" {
+		req.DateTo = req.DateFrom
+	}
+
+	dateFrom, errFrom := time.ParseInLocation("2006-01-02", req.DateFrom, time.Local)
+	dateTo, errTo := time.ParseInLocation("2006-01-02", req.DateTo, time.Local)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha inválido, usa YYYY-MM-DD"})
+		return
+	}
+
+	var agent models.Agent
+	if err := config.DB.First(&agent, req.AgentID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agente no encontrado"})
+		return
+	}
+	if agent.BranchID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El agente no tiene sucursal"})
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		UserID:      agent.UserID,
+		BranchID:    agent.BranchID,
+		AgentID:     agent.ID,
+		ClientName:  strings.TrimSpace(req.ClientName),
+		ClientPhone: req.Phone,
+		Service:     strings.TrimSpace(req.Service),
+		Worker:      strings.TrimSpace(req.Worker),
+		DateFrom:    dateFrom,
+		DateTo:      dateTo,
+	}
+	if err := services.JoinWaitlist(&entry); err != nil {
+		log.Printf("⚠️  [Waitlist] No se pudo anotar a %s: %v", req.Phone, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"id":       entry.ID,
+		"dateFrom": entry.DateFrom.Format("2006-01-02"),
+		"dateTo":   entry.DateTo.Format("2006-01-02"),
+	})
+}
+
+// HandleBotWaitlistReply — POST /api/bot/waitlist/reply
+// Respuesta del cliente ("sí" / "no") al horario que se le apartó. Igual que
+// en los recordatorios, handled=false indica al bot que siga su flujo normal.
+func HandleBotWaitlistReply(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
+	}
+
+	var req struct {
+		AgentID uint   `json:"agentId" binding:"required"`
+		Phone   string `json:"phone" binding:"required"`
+		Action  string `json:"action" binding:"required"` // "si" o "no"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action != "si" && action != "no" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Acción inválida, usa si o no"})
+		return
+	}
+
+	reply, err := services.ReplyWaitlistOffer(req.AgentID, req.Phone, action == "si")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !reply.Handled {
+		c.JSON(http.StatusOK, gin.H{"handled": false})
+		return
+	}
+
+	response := gin.H{
+		"handled": true,
+		"action":  action,
+		"message": reply.Message,
+	}
+	if reply.Appointment != nil {
+		response["appointment"] = botAppointmentSummary(reply.Appointment)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CancelBotAppointment — POST /api/bot/appointments/cancel
+// El cliente canceló su cita desde el bot. El bot libera la celda de Sheets;
+// aquí se cancela la cita en la BD y su horario se ofrece a la lista de espera.
+func CancelBotAppointment(c *gin.Context) {
+	botToken := config.GetEnv("BOT_API_TOKEN")
+	if botToken == "" || c.GetHeader("Authorization") != "Bearer "+botToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autorizado"})
+		return
+	}
+
+	var req struct {
+		AgentID uint   `json:"agentId" binding:"required"`
+		Phone   string `json:"phone" binding:"required"`
+		Date    string `json:"date" binding:"required"` // YYYY-MM-DD
+		Time    string `json:"time" binding:"required"` // HH:MM
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	start, err := time.ParseInLocation("2006-01-02 15:04", req.Date+" "+req.Time, time.Local)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Formato de fecha/hora inválido"})
+		return
+	}
+
+	appointment := findClientAppointmentAt(req.AgentID, utils.PhoneKey(req.Phone), start)
+	if appointment == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No se encontró la cita"})
+		return
+	}
+
+	if err := config.DB.Model(appointment).Update("status", models.AppointmentStatusCancelled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelando la cita"})
+		return
+	}
+
+	log.Printf("🚫 [BotAppointment] Cita %d cancelada por el cliente", appointment.ID)
+	services.OfferFreedSlot(appointment)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"appointment": botAppointmentSummary(appointment),
+	})
+}
+
+// findClientAppointmentAt cita activa del teléfono a esa hora en el agente
+// (o en su sucursal)
+func findClientAppointmentAt(agentID uint, phone string, start time.Time) *models.Appointment {
+	var agent models.Agent
+	if phone == "" || config.DB.Select("id", "user_id", "branch_id").First(&agent, agentID).Error != nil {
+		return nil
+	}
+
+	query := config.DB.
+		Where("user_id = ? AND date = ?", agent.UserID, start).
+		Where("status IN ?", []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed})
+	if agent.BranchID > 0 {
+		query = query.Where("(agent_id = ? OR branch_id = ?)", agent.ID, agent.BranchID)
+	} else {
+		query = query.Where("agent_id = ?", agent.ID)
+	}
+
+	var appointments []models.Appointment
+	query.Find(&appointments)
+
+	for i := range appointments {
+		if utils.PhoneKey(appointments[i].ClientPhone) == phone {
+			return &appointments[i]
+		}
+	}
+	return nil
+}
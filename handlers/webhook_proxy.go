@@ -3,12 +3,16 @@ package handlers
 import (
 	"attomos/config"
 	"attomos/models"
+	"attomos/services"
+	"attomos/utils"
 	"bytes"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -94,6 +98,19 @@ func WebhookProxy(c *gin.Context) {
 		return
 	}
 
+	// Verificar firma HMAC de Meta antes de reenviar mensajes al bot
+	if c.Request.Method == "POST" {
+		signature := c.GetHeader("X-Hub-Signature-256")
+		if !utils.VerifyMetaSignature(bodyBytes, signature, os.Getenv("META_APP_SECRET")) {
+			logRejectedWebhook(uint(agentID), c.ClientIP(), signature)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+			return
+		}
+
+		// Abrir/renovar la ventana de 24h de cada cliente que escribió
+		go services.RecordInboundMessages(agent.ID, bodyBytes)
+	}
+
 	// Log del body para debugging (solo para GET de verificación)
 	if c.Request.Method == "GET" {
 		log.Printf("   📋 Verificación de webhook (GET)")
@@ -189,6 +206,30 @@ func WebhookProxy(c *gin.Context) {
 	log.Printf("🏁 [Webhook Proxy] Petición completada para agente %d", agentID)
 }
 
+// rejectedWebhooks contador de webhooks rechazados por agente
+var (
+	rejectedWebhooks      = make(map[uint]int)
+	rejectedWebhooksMutex sync.Mutex
+)
+
+// logRejectedWebhook registra un webhook con firma ausente o inválida
+func logRejectedWebhook(agentID uint, remoteIP, signature string) {
+	rejectedWebhooksMutex.Lock()
+	rejectedWebhooks[agentID]++
+	count := rejectedWebhooks[agentID]
+	rejectedWebhooksMutex.Unlock()
+
+	reason := "firma inválida"
+	if signature == "" {
+		reason = "sin firma"
+	} else if os.Getenv("META_APP_SECRET") == "" {
+		reason = "META_APP_SECRET no configurado"
+	}
+
+	log.Printf("🚫 [Webhook Proxy] Webhook rechazado para agente %d (%s) | IP: %s | Rechazos acumulados: %d",
+		agentID, reason, remoteIP, count)
+}
+
 // maskSensitiveData enmascara datos sensibles para logs
 func maskSensitiveData(data string) string {
 	if len(data) <= 8 {
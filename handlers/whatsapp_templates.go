@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templateNameRegex Meta solo acepta minúsculas, números y guion bajo
+var templateNameRegex = regexp.MustCompile(`^[a-z0-9_]{1,512}$`)
+
+// CreateTemplateRequest plantilla nueva para enviar a revisión de Meta
+type CreateTemplateRequest struct {
+	Name       string            `json:"name" binding:"required"`
+	Language   string            `json:"language"`
+	Category   string            `json:"category" binding:"required"`
+	Components []json.RawMessage `json:"components" binding:"required"`
+	Purpose    string            `json:"purpose"`
+}
+
+// UpdateTemplateRequest solo el propósito es editable localmente;
+// el contenido lo controla Meta
+type UpdateTemplateRequest struct {
+	Purpose string `json:"purpose"`
+}
+
+var validTemplatePurposes = map[string]bool{
+	models.TemplatePurposeUnassigned:   true,
+	models.TemplatePurposeReminder:     true,
+	models.TemplatePurposeOrderUpdate:  true,
+	models.TemplatePurposePaymentNotif: true,
+	models.TemplatePurposeAppointment:  true,
+}
+
+// loadTemplateAgent obtiene el OrbitalBot del usuario autenticado con
+// WhatsApp Business conectado. Responde el error y retorna nil si no aplica.
+func loadTemplateAgent(c *gin.Context) *models.Agent {
+	userInterface, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No autenticado"})
+		return nil
+	}
+	user := userInterface.(*models.User)
+
+	agentID, err := strconv.ParseUint(c.Param("agent_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de agente inválido"})
+		return nil
+	}
+
+	var agent models.Agent
+	if err := config.DB.Where("id = ? AND user_id = ?", agentID, user.ID).First(&agent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Agente no encontrado"})
+		return nil
+	}
+
+	if !agent.IsOrbitalBot() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Las plantillas solo aplican a agentes OrbitalBot"})
+		return nil
+	}
+	if !agent.MetaConnected || agent.MetaWABAID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El agente no tiene WhatsApp Business conectado"})
+		return nil
+	}
+
+	return &agent
+}
+
+// GetWhatsAppTemplates — GET /api/meta/templates/:agent_id
+func GetWhatsAppTemplates(c *gin.Context) {
+	agent := loadTemplateAgent(c)
+	if agent == nil {
+		return
+	}
+
+	var templates []models.WhatsAppTemplate
+	config.DB.Where("agent_id = ?", agent.ID).Order("name ASC").Find(&templates)
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"total":     len(templates),
+	})
+}
+
+// SyncWhatsAppTemplates — POST /api/meta/templates/:agent_id/sync
+// Trae estado y contenido de las plantillas desde la WABA
+func SyncWhatsAppTemplates(c *gin.Context) {
+	agent := loadTemplateAgent(c)
+	if agent == nil {
+		return
+	}
+
+	templates, err := services.SyncWhatsAppTemplates(agent)
+	if err != nil {
+		log.Printf("❌ [Templates] Error sincronizando agente %d: %v", agent.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error sincronizando plantillas con Meta"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+		"total":     len(templates),
+	})
+}
+
+// CreateWhatsAppTemplate — POST /api/meta/templates/:agent_id
+// Envía la plantilla a revisión de Meta y guarda la copia local
+func CreateWhatsAppTemplate(c *gin.Context) {
+	agent := loadTemplateAgent(c)
+	if agent == nil {
+		return
+	}
+
+	var req CreateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if !templateNameRegex.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "El nombre solo puede tener minúsculas, números y guion bajo"})
+		return
+	}
+	if req.Language == "" {
+		req.Language = "es_MX"
+	}
+	req.Category = strings.ToUpper(req.Category)
+	if req.Category != "UTILITY" && req.Category != "MARKETING" && req.Category != "AUTHENTICATION" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Categoría inválida, usa UTILITY, MARKETING o AUTHENTICATION"})
+		return
+	}
+	if !validTemplatePurposes[req.Purpose] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Propósito inválido"})
+		return
+	}
+
+	metaID, status, err := services.CreateMetaTemplate(agent, req.Name, req.Language, req.Category, req.Components)
+	if err != nil {
+		log.Printf("❌ [Templates] Error creando '%s' para agente %d: %v", req.Name, agent.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Meta rechazó la plantilla: " + err.Error()})
+		return
+	}
+
+	components, _ := json.Marshal(req.Components)
+	tmpl := models.WhatsAppTemplate{
+		UserID:         agent.UserID,
+		AgentID:        agent.ID,
+		MetaTemplateID: metaID,
+		Name:           req.Name,
+		Language:       req.Language,
+		Category:       req.Category,
+		Status:         status,
+		Components:     string(components),
+		BodyParams:     services.CountTemplateBodyParams(req.Components),
+		Purpose:        req.Purpose,
+	}
+	if err := config.DB.Create(&tmpl).Error; err != nil {
+		log.Printf("❌ [Templates] Error guardando '%s': %v", req.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Plantilla creada en Meta pero no se pudo guardar; sincroniza de nuevo"})
+		return
+	}
+
+	log.Printf("✅ [Templates] Plantilla '%s' (%s) enviada a revisión para agente %d", tmpl.Name, tmpl.Language, agent.ID)
+	c.JSON(http.StatusCreated, gin.H{"template": tmpl})
+}
+
+// UpdateWhatsAppTemplate — PATCH /api/meta/templates/:agent_id/:template_id
+// Asigna el propósito con el que el backend usa la plantilla
+func UpdateWhatsAppTemplate(c *gin.Context) {
+	agent := loadTemplateAgent(c)
+	if agent == nil {
+		return
+	}
+
+	var req UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datos inválidos: " + err.Error()})
+		return
+	}
+	if !validTemplatePurposes[req.Purpose] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Propósito inválido"})
+		return
+	}
+
+	var tmpl models.WhatsAppTemplate
+	if err := config.DB.Where("id = ? AND agent_id = ?", c.Param("template_id"), agent.ID).First(&tmpl).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plantilla no encontrada"})
+		return
+	}
+
+	tmpl.Purpose = req.Purpose
+	if err := config.DB.Model(&tmpl).Update("purpose", tmpl.Purpose).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error actualizando plantilla"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"template": tmpl})
+}
+
+// DeleteWhatsAppTemplate — DELETE /api/meta/templates/:agent_id/:template_id
+// Meta borra la plantilla en todos sus idiomas, así que se eliminan todas
+// las copias locales con el mismo nombre
+func DeleteWhatsAppTemplate(c *gin.Context) {
+	agent := loadTemplateAgent(c)
+	if agent == nil {
+		return
+	}
+
+	var tmpl models.WhatsAppTemplate
+	if err := config.DB.Where("id = ? AND agent_id = ?", c.Param("template_id"), agent.ID).First(&tmpl).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plantilla no encontrada"})
+		return
+	}
+
+	if err := services.DeleteMetaTemplate(agent, tmpl.Name); err != nil {
+		log.Printf("❌ [Templates] Error eliminando '%s' del agente %d: %v", tmpl.Name, agent.ID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Error eliminando la plantilla en Meta"})
+		return
+	}
+
+	config.DB.Where("agent_id = ? AND name = ?", agent.ID, tmpl.Name).Delete(&models.WhatsAppTemplate{})
+
+	log.Printf("🗑️  [Templates] Plantilla '%s' eliminada del agente %d", tmpl.Name, agent.ID)
+	c.JSON(http.StatusOK, gin.H{"message": "Plantilla eliminada"})
+}
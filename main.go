@@ -9,6 +9,7 @@ import (
 	"attomos/handlers"
 	"attomos/middleware"
 	"attomos/models"
+	"attomos/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -45,18 +46,68 @@ func main() {
 		&models.Subscription{},
 		&models.Payment{},
 		&models.GoogleCloudProject{},
-		&models.GlobalServer{},   // ← Servidor compartido global para AtomicBots
-		&models.Appointment{},    // ← Citas (manual + Google Sheets + agente)
-		&models.MyBusinessInfo{}, // ← Perfil de negocio del usuario
-		&models.Invoice{},        // ← Solicitudes de factura
-		&models.PaymentConfig{},  // ← Config de pagos del bot (CLABE + Stripe Connect)
-		&models.Order{},          // ← Pedidos (giros de comida: pizzería, mariscos, etc.)
+		&models.GlobalServer{},        // ← Servidor compartido global para AtomicBots
+		&models.Appointment{},         // ← Citas (manual + Google Sheets + agente)
+		&models.MyBusinessInfo{},      // ← Perfil de negocio del usuario
+		&models.Invoice{},             // ← Solicitudes de factura
+		&models.PaymentConfig{},       // ← Config de pagos del bot (CLABE + Stripe Connect)
+		&models.Order{},               // ← Pedidos (giros de comida: pizzería, mariscos, etc.)
+		&models.PasswordResetToken{},  // ← Tokens de un solo uso para restablecer contraseña
+		&models.AppointmentReminder{}, // ← Recordatorios de cita enviados por WhatsApp
+		&models.WhatsAppTemplate{},    // ← Plantillas de mensaje de la WABA (OrbitalBot)
+		&models.WhatsAppContact{},     // ← Último mensaje entrante por cliente (ventana de 24h)
+		&models.Conversation{},        // ← Hilos de conversación del bot por cliente
+		&models.Message{},             // ← Mensajes entrantes/salientes de cada hilo
+		&models.SheetSyncState{},      // ← Cursor y estado de la sincronización Sheets → BD por agente
+		&models.CalendarWatch{},       // ← Canal push y sync token del Google Calendar de cada agente
+		&models.CalendarFeed{},        // ← URLs secretas de suscripción ICS por sucursal/trabajador
+		&models.WaitlistEntry{},       // ← Clientes en lista de espera por sucursal/servicio/fechas
+		&models.WaitlistOffer{},       // ← Horarios liberados ofrecidos (y apartados) a la lista de espera
+		&models.NoShowPolicy{},        // ← Inasistencias por sucursal: marcado automático y anticipo
+		&models.AppointmentSeries{},   // ← Series de citas recurrentes (semanal/quincenal/mensual)
+		&models.OrderEvent{},          // ← Historial de estados de cada pedido (y su aviso por WhatsApp)
+		&models.OrderNotifyConfig{},   // ← Avisos de pedidos al cliente por sucursal (plantillas por estado)
 	); err != nil {
 		log.Fatal("❌ Error en migración:", err)
 	}
 
 	log.Println("✅ Base de datos conectada y migrada")
 
+	// ============================================
+	// RECORDATORIOS DE CITAS (WhatsApp vía agente)
+	// ============================================
+	go services.StartReminderScheduler()
+
+	// ============================================
+	// RETENCIÓN DE CONVERSACIONES (según plan)
+	// ============================================
+	go services.StartConversationRetention()
+
+	// ============================================
+	// SINCRONIZACIÓN DE GOOGLE SHEETS → BD (por agente)
+	// ============================================
+	go services.StartSheetsSync()
+
+	// ============================================
+	// SINCRONIZACIÓN DE GOOGLE CALENDAR → BD (push + sync tokens)
+	// ============================================
+	go services.StartCalendarSync()
+
+	// ============================================
+	// LISTA DE ESPERA (apartados vencidos → siguiente cliente)
+	// ============================================
+	go services.StartWaitlistScheduler()
+
+	// ============================================
+	// INASISTENCIAS (citas vencidas → no_show)
+	// ============================================
+	go services.StartNoShowScheduler()
+
+	// ============================================
+	// CITAS RECURRENTES (extender series activas)
+	// ============================================
+	go services.StartSeriesScheduler()
+
 	// ============================================
 	// INICIALIZAR GOOGLE OAUTH
 	// ============================================
@@ -157,6 +208,17 @@ func main() {
 	router.POST("/webhook/stripe", handlers.StripeWebhookHandler)
 	log.Println("✅ Stripe Webhook configurado en: /webhook/stripe")
 
+	// ============================================
+	// 📆 GOOGLE CALENDAR — Notificaciones push (PÚBLICO)
+	// ============================================
+	router.POST("/webhook/google/calendar", handlers.GoogleCalendarWebhook)
+
+	// ============================================
+	// 📅 CALENDARIOS ICS (PÚBLICO — el token es la autenticación)
+	// ============================================
+	router.GET("/ics/feeds/:token", handlers.ServeCalendarFeed)
+	router.GET("/ics/citas/:token", handlers.ServeAppointmentInvite)
+
 	// ============================================
 	// 🔧 WEBHOOK PROXY - Meta WhatsApp (PÚBLICO)
 	// ============================================
@@ -174,11 +236,17 @@ func main() {
 	router.GET("/ninda/login", handlers.GetNindaLogin)
 	router.GET("/ninda/register", handlers.GetNindaRegister)
 	router.GET("/ninda/:branch_id", handlers.GetNindaStore)
+	router.GET("/ninda/:branch_id/reservar", handlers.GetNindaBooking)
 	// API pública
 	router.GET("/api/ninda/stores", handlers.APIGetStores)
 	router.GET("/api/ninda/stores/:branch_id", handlers.APIGetStore)
 	router.POST("/api/ninda/checkout", handlers.APICreateCheckout)
+	router.POST("/api/ninda/delivery/quote", handlers.QuoteNindaDelivery)
 	router.POST("/api/ninda/confirm", handlers.APIConfirmOrder)
+	router.GET("/api/ninda/stores/:branch_id/booking", handlers.APIGetBookingOptions)
+	router.GET("/api/ninda/stores/:branch_id/slots", handlers.APIGetBookingSlots)
+	router.POST("/api/ninda/bookings", handlers.APICreateBooking)
+	router.POST("/api/ninda/bookings/confirm", handlers.APIConfirmBooking)
 	log.Println("✅ Ninda Marketplace configurado en: /ninda")
 
 	// ============================================
@@ -222,26 +290,54 @@ func main() {
 		// ⭐ APPOINTMENTS - CRUD completo (BD + Sheets sync)
 		// ============================================
 		protected.GET("/appointments", handlers.GetAppointments)
+		protected.GET("/appointments/sync-status", handlers.GetAppointmentsSyncStatus)
+		protected.GET("/calendar-feeds", handlers.GetCalendarFeeds)
+		protected.POST("/calendar-feeds/:id/rotate", handlers.RotateCalendarFeed)
 		protected.POST("/appointments", handlers.CreateManualAppointment)
 		protected.PATCH("/appointments/:id/status", handlers.UpdateAppointmentStatus)
+		protected.PATCH("/appointments/:id", handlers.RescheduleAppointment)
 		protected.DELETE("/appointments/:id", handlers.DeleteAppointment)
+		protected.POST("/appointment-series", handlers.CreateAppointmentSeries)
+		protected.GET("/appointment-series/:id", handlers.GetAppointmentSeries)
+		protected.GET("/availability/:branch_id", handlers.GetBranchAvailability)
+		protected.GET("/no-show-policy/:branch_id", handlers.GetNoShowPolicy)
+		protected.PUT("/no-show-policy/:branch_id", handlers.UpdateNoShowPolicy)
+		protected.GET("/order-notifications/:branch_id", handlers.GetOrderNotifyConfig)
+		protected.PUT("/order-notifications/:branch_id", handlers.UpdateOrderNotifyConfig)
 
 		// ============================================
 		// 🍕 ORDERS — Pedidos (giros de comida)
 		// ============================================
 		protected.GET("/orders", handlers.GetOrders)
+		protected.GET("/orders/stream", handlers.StreamOrders)
 		protected.POST("/orders", handlers.CreateOrder)
 		protected.PATCH("/orders/:id/status", handlers.UpdateOrderStatus)
+		protected.GET("/orders/:id/events", handlers.GetOrderEvents)
 		protected.DELETE("/orders/:id", handlers.DeleteOrder)
 
 		// Bot endpoints (no requieren JWT, usan BOT_API_TOKEN)
 		router.POST("/api/bot/orders", handlers.CreateBotOrder)
+		router.POST("/api/bot/delivery/quote", handlers.QuoteBotDelivery)
 		router.POST("/api/bot/appointments", handlers.CreateBotAppointment)
+		router.POST("/api/bot/appointments/reminder-reply", handlers.HandleBotReminderReply)
+		router.GET("/api/bot/appointments/upcoming", handlers.GetBotUpcomingAppointment)
+		router.POST("/api/bot/appointments/reschedule", handlers.RescheduleBotAppointment)
+		router.POST("/api/bot/appointments/cancel", handlers.CancelBotAppointment)
+		router.POST("/api/bot/appointments/:id/calendar-event", handlers.LinkBotAppointmentEvent)
+		router.POST("/api/bot/messages/usage", handlers.ReportBotMessageUsage)
+		router.POST("/api/bot/conversations/messages", handlers.RecordBotMessage)
+		router.GET("/api/bot/availability", handlers.GetBotAvailability)
+		router.POST("/api/bot/waitlist", handlers.JoinBotWaitlist)
+		router.POST("/api/bot/waitlist/reply", handlers.HandleBotWaitlistReply)
 
 		// Client History
 		protected.GET("/client-history", handlers.GetHistorial)
 		protected.GET("/client-history/client/:phone", handlers.GetHistorialCliente)
 
+		// Conversaciones del bot
+		protected.GET("/conversations", handlers.GetConversations)
+		protected.GET("/conversations/:id/messages", handlers.GetConversationMessages)
+
 		// Services Statistics
 		protected.GET("/services/statistics", handlers.GetServicesDashboardStats)
 
@@ -299,6 +395,15 @@ func main() {
 		protected.POST("/meta/credentials/save/:agent_id", handlers.SaveMetaCredentials)
 		protected.DELETE("/meta/credentials/remove/:agent_id", handlers.RemoveMetaCredentials)
 
+		// ============================================
+		// META WHATSAPP BUSINESS API - PLANTILLAS
+		// ============================================
+		protected.GET("/meta/templates/:agent_id", handlers.GetWhatsAppTemplates)
+		protected.POST("/meta/templates/:agent_id", handlers.CreateWhatsAppTemplate)
+		protected.POST("/meta/templates/:agent_id/sync", handlers.SyncWhatsAppTemplates)
+		protected.PATCH("/meta/templates/:agent_id/:template_id", handlers.UpdateWhatsAppTemplate)
+		protected.DELETE("/meta/templates/:agent_id/:template_id", handlers.DeleteWhatsAppTemplate)
+
 		// ============================================
 		// 💳 PAYMENT CONFIG - Pasarela de pagos del bot (CLABE + Stripe Connect)
 		// ============================================
@@ -356,10 +461,18 @@ func main() {
 		c.HTML(200, "orders.html", nil)
 	})
 
+	router.GET("/orders/kitchen", middleware.AuthRequired(), func(c *gin.Context) {
+		c.HTML(200, "kitchen.html", nil)
+	})
+
 	router.GET("/client-history", middleware.AuthRequired(), func(c *gin.Context) {
 		c.HTML(200, "client_history.html", nil)
 	})
 
+	router.GET("/conversations", middleware.AuthRequired(), func(c *gin.Context) {
+		c.HTML(200, "conversations.html", nil)
+	})
+
 	router.GET("/integrations", middleware.AuthRequired(), func(c *gin.Context) {
 		c.HTML(200, "integrations.html", nil)
 	})
@@ -460,8 +573,16 @@ func main() {
 		})
 	})
 
+	router.GET("/reset-password", func(c *gin.Context) {
+		c.HTML(200, "reset-password.html", gin.H{
+			"title": "Nueva Contraseña - Attomos",
+			"token": c.Query("token"),
+		})
+	})
+
 	// API — el usuario no está autenticado, va fuera del grupo protected
 	router.POST("/api/user/password-reset", handlers.RequestPasswordReset)
+	router.POST("/api/user/password-reset/confirm", handlers.ResetPassword)
 
 	// ============================================
 	// ADMIN PANEL
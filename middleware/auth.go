@@ -58,6 +58,15 @@ func AuthRequired() gin.HandlerFunc {
 			return
 		}
 
+		// Rechazar tokens emitidos antes del último restablecimiento de contraseña
+		if claims.IssuedAt != nil && user.IsTokenRevoked(claims.IssuedAt.Time) {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": "Sesión expirada, inicia sesión nuevamente",
+			})
+			c.Abort()
+			return
+		}
+
 		// Establecer usuario en el contexto
 		c.Set("user", &user)
 		c.Set("userId", user.ID)
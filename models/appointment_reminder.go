@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// ReminderStatus estado de un recordatorio de cita
+type ReminderStatus string
+
+const (
+	ReminderStatusPending ReminderStatus = "pending" // Reservado, enviándose
+	ReminderStatusSent    ReminderStatus = "sent"    // Entregado al agente
+	ReminderStatusFailed  ReminderStatus = "failed"  // El agente no pudo enviarlo
+	ReminderStatusSkipped ReminderStatus = "skipped" // La cita se agendó dentro de la ventana
+)
+
+// AppointmentReminder registra cada recordatorio enviado por WhatsApp.
+// El índice único (cita, offset) evita duplicados aunque el backend se reinicie.
+type AppointmentReminder struct {
+	ID            uint           `gorm:"primaryKey" json:"id"`
+	AppointmentID uint           `gorm:"not null;uniqueIndex:idx_appointment_reminder_offset" json:"appointmentId"`
+	OffsetMinutes int            `gorm:"not null;uniqueIndex:idx_appointment_reminder_offset" json:"offsetMinutes"`
+	AgentID       uint           `gorm:"index" json:"agentId"`
+	ClientPhone   string         `gorm:"size:50;index" json:"clientPhone"`
+	Status        ReminderStatus `gorm:"size:20;default:'pending';index" json:"status"`
+	Error         string         `gorm:"type:text" json:"error,omitempty"`
+	SentAt        *time.Time     `json:"sentAt"`
+
+	// Respuesta del cliente: "confirmar" o "cancelar"
+	Response    string     `gorm:"size:20" json:"response,omitempty"`
+	RespondedAt *time.Time `json:"respondedAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Relaciones
+	Appointment Appointment `gorm:"foreignKey:AppointmentID" json:"-"`
+}
+
+func (AppointmentReminder) TableName() string {
+	return "appointment_reminders"
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecurrenceFrequency cada cuánto se repite una serie de citas
+type RecurrenceFrequency string
+
+const (
+	RecurrenceWeekly   RecurrenceFrequency = "weekly"   // Cada semana
+	RecurrenceBiweekly RecurrenceFrequency = "biweekly" // Cada dos semanas
+	RecurrenceMonthly  RecurrenceFrequency = "monthly"  // Mismo día de cada mes
+)
+
+// SeriesStatus estado de la serie
+type SeriesStatus string
+
+const (
+	SeriesStatusActive    SeriesStatus = "active"    // Se siguen generando citas
+	SeriesStatusEnded     SeriesStatus = "ended"     // Llegó a su fin (COUNT/UNTIL o se recortó)
+	SeriesStatusCancelled SeriesStatus = "cancelled" // Se cancelaron todas sus citas
+)
+
+// MaxMonthlySeriesDay último día del mes con el que se puede repetir cada
+// mes: del 29 en adelante hay meses que no lo tienen
+const MaxMonthlySeriesDay = 28
+
+// AppointmentSeries serie de citas recurrentes (terapia, fisio, etc.): el
+// mismo cliente en el mismo horario cada semana, cada dos semanas o cada mes.
+// Las ocurrencias se generan como citas normales (Appointment.SeriesID) hasta
+// un horizonte y se van extendiendo con StartSeriesScheduler.
+type AppointmentSeries struct {
+	ID       uint `gorm:"primaryKey" json:"id"`
+	UserID   uint `gorm:"not null;index" json:"userId"`
+	AgentID  uint `gorm:"index" json:"agentId"`
+	BranchID uint `gorm:"default:0;index" json:"branchId"`
+
+	// Datos que se copian a cada cita
+	ClientFirstName string `gorm:"size:255;not null" json:"clientFirstName"`
+	ClientLastName  string `gorm:"size:255;not null" json:"clientLastName"`
+	ClientPhone     string `gorm:"size:50" json:"clientPhone"`
+	Service         string `gorm:"size:255" json:"service"`
+	Worker          string `gorm:"size:255" json:"worker"`
+	Notes           string `gorm:"type:text" json:"notes"`
+	DurationMinutes int    `gorm:"default:0" json:"durationMinutes"`
+
+	// =============================================
+	// REGLA DE RECURRENCIA
+	// =============================================
+	Frequency RecurrenceFrequency `gorm:"size:20;not null" json:"frequency"`
+	StartDate time.Time           `gorm:"not null" json:"startDate"` // Fecha y hora de la primera ocurrencia
+	Until     *time.Time          `json:"until"`                     // Último día (inclusive), nil = sin fin
+	Count     int                 `gorm:"default:0" json:"count"`    // Número de ocurrencias, 0 = sin límite
+
+	// Ocurrencias ya generadas (incluye los festivos que se saltaron)
+	Generated int          `gorm:"default:0" json:"generated"`
+	Status    SeriesStatus `gorm:"size:20;default:'active';index" json:"status"`
+
+	// Evento recurrente (maestro) en Google Calendar
+	CalendarEventID string `gorm:"size:500" json:"calendarEventId"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (AppointmentSeries) TableName() string {
+	return "appointment_series"
+}
+
+// IsActive verifica si la serie sigue generando citas
+func (s *AppointmentSeries) IsActive() bool {
+	return s.Status == SeriesStatusActive
+}
+
+// IsValid verifica que la frecuencia sea una de las soportadas
+func (f RecurrenceFrequency) IsValid() bool {
+	return f == RecurrenceWeekly || f == RecurrenceBiweekly || f == RecurrenceMonthly
+}
+
+// Occurrence fecha y hora de la ocurrencia n (0 = StartDate) según la regla,
+// sin tomar en cuenta COUNT/UNTIL
+func (s *AppointmentSeries) Occurrence(n int) time.Time {
+	switch s.Frequency {
+	case RecurrenceBiweekly:
+		return s.StartDate.AddDate(0, 0, 14*n)
+	case RecurrenceMonthly:
+		return s.StartDate.AddDate(0, n, 0)
+	default:
+		return s.StartDate.AddDate(0, 0, 7*n)
+	}
+}
+
+// Includes indica si la ocurrencia n sigue dentro de COUNT/UNTIL
+func (s *AppointmentSeries) Includes(n int) bool {
+	if n < 0 || (s.Count > 0 && n >= s.Count) {
+		return false
+	}
+	if s.Until != nil {
+		y, m, d := s.Until.Date()
+		endOfDay := time.Date(y, m, d, 0, 0, 0, 0, s.StartDate.Location()).AddDate(0, 0, 1)
+		return s.Occurrence(n).Before(endOfDay)
+	}
+	return true
+}
+
+// RRule regla RFC 5545 de la serie (para el evento recurrente de Google
+// Calendar). COUNT y UNTIL nunca van juntos.
+func (s *AppointmentSeries) RRule() string {
+	rule := "FREQ=WEEKLY"
+	switch s.Frequency {
+	case RecurrenceBiweekly:
+		rule = "FREQ=WEEKLY;INTERVAL=2"
+	case RecurrenceMonthly:
+		rule = "FREQ=MONTHLY"
+	}
+
+	switch {
+	case s.Count > 0:
+		rule += fmt.Sprintf(";COUNT=%d", s.Count)
+	case s.Until != nil:
+		// Con DTSTART en zona horaria, UNTIL debe ir en UTC
+		y, m, d := s.Until.Date()
+		endOfDay := time.Date(y, m, d, 23, 59, 59, 0, s.StartDate.Location())
+		rule += ";UNTIL=" + endOfDay.UTC().Format("20060102T150405Z")
+	}
+	return rule
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,8 +14,13 @@ const (
 	AppointmentSourceManual AppointmentSource = "manual" // Creada desde el panel
 	AppointmentSourceSheets AppointmentSource = "sheets" // Sincronizada desde Google Sheets
 	AppointmentSourceAgent  AppointmentSource = "agent"  // Creada por el agente de WhatsApp
+	AppointmentSourceNinda  AppointmentSource = "ninda"  // Reservada por el cliente en Ninda
 )
 
+// PaymentHold tiempo que una reserva pendiente de pago aparta su horario.
+// Stripe exige que un Checkout Session expire en al menos 30 minutos.
+const PaymentHold = 35 * time.Minute
+
 // AppointmentStatus indica el estado de la cita
 type AppointmentStatus string
 
@@ -23,12 +29,15 @@ const (
 	AppointmentStatusConfirmed AppointmentStatus = "confirmed"
 	AppointmentStatusCompleted AppointmentStatus = "completed"
 	AppointmentStatusCancelled AppointmentStatus = "cancelled"
+	AppointmentStatusNoShow    AppointmentStatus = "no_show" // El cliente no se presentó
 )
 
 type Appointment struct {
 	ID      uint `gorm:"primaryKey" json:"id"`
 	UserID  uint `gorm:"not null;index" json:"userId"`
 	AgentID uint `gorm:"index" json:"agentId"` // Agente que gestionó/creó la cita (puede ser 0 si es manual)
+	// Sucursal donde se atiende (0 = sin sucursal, citas previas al motor de disponibilidad)
+	BranchID uint `gorm:"default:0;index" json:"branchId"`
 
 	// =============================================
 	// INFORMACIÓN DEL CLIENTE
@@ -44,6 +53,16 @@ type Appointment struct {
 	Worker  string    `gorm:"size:255" json:"worker"`     // Trabajador/Especialista asignado
 	Date    time.Time `gorm:"not null;index" json:"date"` // Fecha y hora de la cita
 	Notes   string    `gorm:"type:text" json:"notes"`     // Notas adicionales
+	// Duración en minutos (0 = DefaultServiceDuration)
+	DurationMinutes int `gorm:"default:0" json:"durationMinutes"`
+	// Recursos de la sucursal que ocupa (sillas, cabinas...), separados por coma
+	Resources string `gorm:"size:500" json:"resources"`
+
+	// =============================================
+	// SERIE (citas recurrentes)
+	// =============================================
+	SeriesID    uint `gorm:"default:0;index" json:"seriesId"` // AppointmentSeries.ID (0 = cita única)
+	SeriesIndex int  `gorm:"default:0" json:"seriesIndex"`    // Número de ocurrencia dentro de la serie
 
 	// =============================================
 	// ESTADO Y ORIGEN
@@ -67,6 +86,16 @@ type Appointment struct {
 	// SINCRONIZACIÓN CON GOOGLE CALENDAR
 	// =============================================
 	CalendarEventID string `gorm:"size:500" json:"calendarEventId"` // ID del evento en Google Calendar
+	// Token secreto del enlace .ics que recibe el cliente (sin Google)
+	InviteToken string `gorm:"size:64;index" json:"-"`
+
+	// =============================================
+	// ANTICIPO (reservas de Ninda)
+	// =============================================
+	// Checkout Session de Stripe cuando la sucursal exige pago para reservar.
+	// La cita queda "pending" hasta que el webhook confirma el pago.
+	StripeSessionID *string `gorm:"size:255;uniqueIndex" json:"-"`
+	PaidAmount      float64 `gorm:"default:0" json:"paidAmount"`
 
 	// =============================================
 	// TIMESTAMPS
@@ -91,6 +120,22 @@ func (a *Appointment) GetClientFullName() string {
 	return a.ClientFirstName + " " + a.ClientLastName
 }
 
+// ResourceNames recursos que ocupa la cita
+func (a *Appointment) ResourceNames() []string {
+	var names []string
+	for _, name := range strings.Split(a.Resources, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SetResources guarda los recursos reservados para la cita
+func (a *Appointment) SetResources(names []string) {
+	a.Resources = strings.Join(names, ",")
+}
+
 // IsFromSheets verifica si la cita proviene de Google Sheets
 func (a *Appointment) IsFromSheets() bool {
 	return a.Source == AppointmentSourceSheets
@@ -101,11 +146,21 @@ func (a *Appointment) IsFromAgent() bool {
 	return a.Source == AppointmentSourceAgent
 }
 
+// IsFromNinda verifica si la cita fue reservada desde la página pública de Ninda
+func (a *Appointment) IsFromNinda() bool {
+	return a.Source == AppointmentSourceNinda
+}
+
 // IsManual verifica si la cita fue creada manualmente desde el panel
 func (a *Appointment) IsManual() bool {
 	return a.Source == AppointmentSourceManual
 }
 
+// IsRecurring verifica si la cita es una ocurrencia de una serie
+func (a *Appointment) IsRecurring() bool {
+	return a.SeriesID > 0
+}
+
 // IsPending verifica si la cita está pendiente
 func (a *Appointment) IsPending() bool {
 	return a.Status == AppointmentStatusPending
@@ -126,6 +181,11 @@ func (a *Appointment) IsCancelled() bool {
 	return a.Status == AppointmentStatusCancelled
 }
 
+// IsNoShow verifica si el cliente no se presentó a la cita
+func (a *Appointment) IsNoShow() bool {
+	return a.Status == AppointmentStatusNoShow
+}
+
 // Confirm confirma la cita
 func (a *Appointment) Confirm() {
 	a.Status = AppointmentStatusConfirmed
@@ -141,6 +201,11 @@ func (a *Appointment) Cancel() {
 	a.Status = AppointmentStatusCancelled
 }
 
+// MarkNoShow marca que el cliente no se presentó
+func (a *Appointment) MarkNoShow() {
+	a.Status = AppointmentStatusNoShow
+}
+
 // MarkSynced actualiza la marca de sincronización con Sheets
 func (a *Appointment) MarkSynced() {
 	now := time.Now()
@@ -152,6 +217,21 @@ func (a *Appointment) HasCalendarEvent() bool {
 	return a.CalendarEventID != ""
 }
 
+// EndTime hora de término de la cita según su duración
+func (a *Appointment) EndTime() time.Time {
+	d := a.DurationMinutes
+	if d <= 0 {
+		d = DefaultServiceDuration
+	}
+	return a.Date.Add(time.Duration(d) * time.Minute)
+}
+
+// PaymentHoldExpired indica si la reserva pendiente de pago ya no aparta su
+// horario (el Checkout de Stripe expiró aunque no haya llegado el webhook)
+func (a *Appointment) PaymentHoldExpired() bool {
+	return a.IsPending() && a.StripeSessionID != nil && time.Since(a.CreatedAt) > PaymentHold
+}
+
 // IsPast verifica si la cita ya pasó
 func (a *Appointment) IsPast() bool {
 	return time.Now().After(a.Date)
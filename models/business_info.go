@@ -63,6 +63,14 @@ type BusinessLocation struct {
 	State          string `json:"state"`
 	Country        string `json:"country"`
 	PostalCode     string `json:"postalCode"`
+	// Coordenadas de la sucursal (centro de las zonas de entrega por radio)
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// HasCoordinates indica si la sucursal registró su ubicación en el mapa
+func (bl BusinessLocation) HasCoordinates() bool {
+	return bl.Latitude != 0 || bl.Longitude != 0
 }
 
 func (bl BusinessLocation) Value() (driver.Value, error) { return json.Marshal(bl) }
@@ -92,6 +100,71 @@ type BranchService struct {
 	PromoDateStart  string   `json:"promoDateStart"`  // "2025-01-15" cuando type="range"
 	PromoDateEnd    string   `json:"promoDateEnd"`    // "2025-02-28" cuando type="range"
 	InStock         bool     `json:"inStock"`         // true = en existencia, false = agotado
+	DurationMinutes int      `json:"durationMinutes"` // duración de la cita; 0 = DefaultServiceDuration
+
+	// Inventario opcional: con TrackStock cada pedido confirmado descuenta
+	// Stock y el producto se marca agotado al llegar a cero
+	TrackStock    bool `json:"trackStock"`
+	Stock         int  `json:"stock"`         // existencias actuales
+	LowStockAlert int  `json:"lowStockAlert"` // avisar al dueño al bajar a esta cantidad; 0 = sin aviso
+
+	// Variantes y extras (tamaños, ingredientes...) con su diferencia de precio
+	Modifiers []ModifierGroup `json:"modifiers,omitempty"`
+}
+
+// ModifierGroup grupo de opciones de un producto. Una variante como el
+// tamaño es Required y de una sola opción; los extras son Multiple.
+type ModifierGroup struct {
+	Name     string           `json:"name"`     // "Tamaño", "Extras", "Sin ingredientes"
+	Required bool             `json:"required"` // el cliente debe elegir al menos una opción
+	Multiple bool             `json:"multiple"` // se pueden elegir varias opciones
+	Options  []ModifierOption `json:"options"`
+}
+
+// ModifierOption opción de un grupo; PriceDelta se suma al precio base
+type ModifierOption struct {
+	Name       string  `json:"name"`
+	PriceDelta float64 `json:"priceDelta"`
+}
+
+// FindOption busca una opción del grupo por nombre (sin distinguir mayúsculas)
+func (g ModifierGroup) FindOption(name string) (ModifierOption, bool) {
+	for _, o := range g.Options {
+		if strings.EqualFold(strings.TrimSpace(o.Name), strings.TrimSpace(name)) {
+			return o, true
+		}
+	}
+	return ModifierOption{}, false
+}
+
+// DefaultServiceDuration duración en minutos para servicios sin duración configurada
+const DefaultServiceDuration = 60
+
+// Duration duración efectiva del servicio en minutos
+func (s BranchService) Duration() int {
+	if s.DurationMinutes > 0 {
+		return s.DurationMinutes
+	}
+	return DefaultServiceDuration
+}
+
+// IsBookable indica si el servicio se reserva como cita. Solo los que el
+// dueño configuró con duración; los productos del catálogo no la tienen.
+func (s BranchService) IsBookable() bool {
+	return s.DurationMinutes > 0
+}
+
+// EffectivePrice precio base a cobrar: el de promoción si aplica
+func (s BranchService) EffectivePrice() float64 {
+	if s.PriceType == "promotion" && s.PromoPrice > 0 {
+		return s.PromoPrice
+	}
+	return s.Price
+}
+
+// IsLowStock indica si quedan pocas existencias (sin llegar a agotarse)
+func (s BranchService) IsLowStock() bool {
+	return s.TrackStock && s.LowStockAlert > 0 && s.Stock > 0 && s.Stock <= s.LowStockAlert
 }
 
 type BranchServices []BranchService
@@ -109,6 +182,33 @@ type BranchWorker struct {
 	StartTime string   `json:"startTime"`
 	EndTime   string   `json:"endTime"`
 	Days      []string `json:"days"`
+	Services  []string `json:"services"` // servicios que realiza; vacío = todos
+}
+
+// CanPerform indica si el trabajador realiza el servicio (sin distinguir mayúsculas)
+func (w BranchWorker) CanPerform(service string) bool {
+	if len(w.Services) == 0 || service == "" {
+		return true
+	}
+	for _, s := range w.Services {
+		if strings.EqualFold(strings.TrimSpace(s), strings.TrimSpace(service)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WorksOn indica si el trabajador labora ese día ("monday", "tuesday", ...)
+func (w BranchWorker) WorksOn(day string) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if strings.EqualFold(d, day) {
+			return true
+		}
+	}
+	return false
 }
 
 type BranchWorkers []BranchWorker
@@ -121,6 +221,96 @@ func (bw *BranchWorkers) Scan(v interface{}) error {
 	return nil
 }
 
+// BranchResource espacio o equipo físico de la sucursal (sillas, cabinas,
+// canchas...) que limita cuántas citas caben a la vez, aparte de los
+// trabajadores
+type BranchResource struct {
+	Name     string   `json:"name"`
+	Capacity int      `json:"capacity"` // unidades iguales (p. ej. 3 sillas); 0 = 1
+	Services []string `json:"services"` // servicios que lo ocupan; vacío = todos
+}
+
+// Units unidades del recurso que se pueden ocupar al mismo tiempo
+func (r BranchResource) Units() int {
+	if r.Capacity > 0 {
+		return r.Capacity
+	}
+	return 1
+}
+
+// NeededFor indica si el servicio ocupa el recurso (sin distinguir mayúsculas)
+func (r BranchResource) NeededFor(service string) bool {
+	if len(r.Services) == 0 {
+		return true
+	}
+	for _, s := range r.Services {
+		if strings.EqualFold(strings.TrimSpace(s), strings.TrimSpace(service)) {
+			return true
+		}
+	}
+	return false
+}
+
+type BranchResources []BranchResource
+
+func (br BranchResources) Value() (driver.Value, error) { return json.Marshal(br) }
+func (br *BranchResources) Scan(v interface{}) error {
+	if b, ok := v.([]byte); ok {
+		return json.Unmarshal(b, br)
+	}
+	return nil
+}
+
+// Tipos de zona de entrega
+const (
+	DeliveryZonePostalCodes = "postal_codes" // Lista de códigos postales
+	DeliveryZoneRadius      = "radius"       // Radio en km alrededor de la sucursal
+	DeliveryZonePolygon     = "polygon"      // Polígono dibujado en el mapa
+)
+
+// GeoPoint punto en el mapa
+type GeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// DeliveryZone zona de entrega a domicilio de la sucursal, con su costo,
+// pedido mínimo y tiempo estimado
+type DeliveryZone struct {
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`        // DeliveryZonePostalCodes | DeliveryZoneRadius | DeliveryZonePolygon
+	PostalCodes []string   `json:"postalCodes"` // para postal_codes
+	RadiusKm    float64    `json:"radiusKm"`    // para radius
+	Polygon     []GeoPoint `json:"polygon"`     // para polygon
+	Fee         float64    `json:"fee"`         // costo de envío (MXN)
+	MinOrder    float64    `json:"minOrder"`    // pedido mínimo sin envío (MXN); 0 = sin mínimo
+	ETAMinutes  int        `json:"etaMinutes"`  // tiempo estimado de entrega
+}
+
+// CoversPostalCode indica si el código postal está en la lista de la zona
+func (z DeliveryZone) CoversPostalCode(postalCode string) bool {
+	postalCode = strings.TrimSpace(postalCode)
+	if z.Type != DeliveryZonePostalCodes || postalCode == "" {
+		return false
+	}
+	for _, pc := range z.PostalCodes {
+		if strings.TrimSpace(pc) == postalCode {
+			return true
+		}
+	}
+	return false
+}
+
+type BranchDeliveryZones []DeliveryZone
+
+func (bz BranchDeliveryZones) Value() (driver.Value, error) { return json.Marshal(bz) }
+func (bz *BranchDeliveryZones) Scan(v interface{}) error {
+	if b, ok := v.([]byte); ok {
+		return json.Unmarshal(b, bz)
+	}
+	return nil
+}
+
 // MyBusinessInfo representa una sucursal del negocio del usuario.
 // Un usuario puede tener múltiples sucursales (one-to-many).
 type MyBusinessInfo struct {
@@ -144,6 +334,9 @@ type MyBusinessInfo struct {
 	Holidays    BusinessHolidays    `gorm:"type:json" json:"holidays"`
 	Services    BranchServices      `gorm:"type:json" json:"services"`
 	Workers     BranchWorkers       `gorm:"type:json" json:"workers"`
+	Resources   BranchResources     `gorm:"type:json" json:"resources"` // sillas, cabinas, canchas...
+	// Zonas de entrega a domicilio (vacío = no se valida la dirección)
+	DeliveryZones BranchDeliveryZones `gorm:"type:json" json:"deliveryZones"`
 
 	// Imágenes de marca (subidas vía /api/upload/service-image)
 	LogoURL   string `gorm:"size:500" json:"logoUrl"`   // Logotipo cuadrado
@@ -159,6 +352,67 @@ type MyBusinessInfo struct {
 
 func (MyBusinessInfo) TableName() string { return "my_business_info" }
 
+// FindService busca un servicio de la sucursal por título (sin distinguir mayúsculas)
+func (b *MyBusinessInfo) FindService(title string) (BranchService, bool) {
+	if i := b.ServiceIndex(title); i >= 0 {
+		return b.Services[i], true
+	}
+	return BranchService{}, false
+}
+
+// ServiceIndex posición del servicio en el catálogo de la sucursal; -1 si no existe
+func (b *MyBusinessInfo) ServiceIndex(title string) int {
+	for i, s := range b.Services {
+		if strings.EqualFold(strings.TrimSpace(s.Title), strings.TrimSpace(title)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ForWeekday horario de la sucursal para un día de la semana
+func (bs BusinessSchedule) ForWeekday(day time.Weekday) DaySchedule {
+	switch day {
+	case time.Monday:
+		return bs.Monday
+	case time.Tuesday:
+		return bs.Tuesday
+	case time.Wednesday:
+		return bs.Wednesday
+	case time.Thursday:
+		return bs.Thursday
+	case time.Friday:
+		return bs.Friday
+	case time.Saturday:
+		return bs.Saturday
+	}
+	return bs.Sunday
+}
+
+// ResourcesFor recursos que ocupa una cita del servicio
+func (b *MyBusinessInfo) ResourcesFor(service string) []BranchResource {
+	var list []BranchResource
+	for _, r := range b.Resources {
+		if strings.TrimSpace(r.Name) != "" && r.NeededFor(service) {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// IsHoliday indica si la fecha es un día festivo de la sucursal.
+// Acepta "DD/MM" (formato de my-business) y "YYYY-MM-DD".
+func (bh BusinessHolidays) IsHoliday(date time.Time) bool {
+	dayMonth := date.Format("02/01")
+	iso := date.Format("2006-01-02")
+	for _, h := range bh {
+		if h.Date == dayMonth || h.Date == iso {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *MyBusinessInfo) GenerateBranchName() string {
 	addr := strings.TrimSpace(b.Location.Address)
 	if addr != "" {
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarFeed URL secreta de suscripción iCalendar (ICS) de una sucursal o
+// de uno de sus trabajadores, para ver las citas en Apple Calendar, Outlook,
+// etc. sin conectar Google. Quien tenga el token ve las citas: se puede rotar.
+type CalendarFeed struct {
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	UserID   uint   `gorm:"not null;index" json:"userId"`
+	BranchID uint   `gorm:"not null;uniqueIndex:idx_calendar_feed_scope" json:"branchId"`
+	Worker   string `gorm:"size:255;uniqueIndex:idx_calendar_feed_scope" json:"worker"` // vacío = toda la sucursal
+	Token    string `gorm:"size:64;uniqueIndex" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (CalendarFeed) TableName() string {
+	return "calendar_feeds"
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarWatch canal de notificaciones push y sync token del Google Calendar
+// de un agente. Google avisa por el canal que algo cambió; los cambios se leen
+// de forma incremental con SyncToken.
+type CalendarWatch struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	AgentID    uint   `gorm:"not null;uniqueIndex" json:"agentId"`
+	UserID     uint   `gorm:"not null;index" json:"userId"`
+	CalendarID string `gorm:"size:500" json:"calendarId"`
+
+	// Canal push (vacío si BASE_URL no es HTTPS: se sincroniza por sondeo)
+	ChannelID    string     `gorm:"size:100;index" json:"channelId"`
+	ChannelToken string     `gorm:"size:100" json:"-"` // Google lo reenvía en X-Goog-Channel-Token
+	ResourceID   string     `gorm:"size:255" json:"-"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+
+	// Sincronización incremental
+	SyncToken  string     `gorm:"type:text" json:"-"`
+	LastSyncAt *time.Time `json:"lastSyncAt"`
+	LastError  string     `gorm:"type:text" json:"lastError,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (CalendarWatch) TableName() string {
+	return "calendar_watches"
+}
+
+// ChannelExpiresWithin el canal no existe o vence antes de d
+func (w *CalendarWatch) ChannelExpiresWithin(d time.Duration) bool {
+	return w.ChannelID == "" || w.ExpiresAt == nil || time.Until(*w.ExpiresAt) < d
+}
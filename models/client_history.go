@@ -13,11 +13,12 @@ const (
 	ClientHistoryEntryTypeVisit       ClientHistoryEntryType = "visit"       // Completed visit
 	ClientHistoryEntryTypeCancelled   ClientHistoryEntryType = "cancelled"   // Cancelled appointment
 	ClientHistoryEntryTypeAppointment ClientHistoryEntryType = "appointment" // Scheduled appointment
+	ClientHistoryEntryTypeNoShow      ClientHistoryEntryType = "no_show"     // Client did not show up
 )
 
 // ClientHistoryEntry represents a single entry in a client's visit history.
 // It is created automatically when an appointment from Sheets or Agent
-// transitions to "completed" or "cancelled", or during sync.
+// transitions to "completed", "cancelled" or "no_show", or during sync.
 type ClientHistoryEntry struct {
 	ID     uint `gorm:"primaryKey" json:"id"`
 	UserID uint `gorm:"not null;index" json:"userId"`
@@ -93,12 +94,20 @@ func (h *ClientHistoryEntry) IsCancelled() bool {
 	return h.EntryType == ClientHistoryEntryTypeCancelled
 }
 
-// HistoryEntryFromAppointment creates a ClientHistoryEntry from a completed or cancelled Appointment.
+// IsNoShow returns true if the client missed the appointment
+func (h *ClientHistoryEntry) IsNoShow() bool {
+	return h.EntryType == ClientHistoryEntryTypeNoShow
+}
+
+// HistoryEntryFromAppointment creates a ClientHistoryEntry from a completed, cancelled or no-show Appointment.
 // Call this in the handler when an appointment status changes to "completed" or during Sheets sync.
 func HistoryEntryFromAppointment(appt *Appointment, agentName string) *ClientHistoryEntry {
 	entryType := ClientHistoryEntryTypeVisit
-	if appt.Status == AppointmentStatusCancelled {
+	switch appt.Status {
+	case AppointmentStatusCancelled:
 		entryType = ClientHistoryEntryTypeCancelled
+	case AppointmentStatusNoShow:
+		entryType = ClientHistoryEntryTypeNoShow
 	}
 
 	return &ClientHistoryEntry{
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+// Dirección de un mensaje de la conversación
+const (
+	MessageDirectionInbound  = "inbound"  // Cliente → agente
+	MessageDirectionOutbound = "outbound" // Agente → cliente
+)
+
+// Conversation hilo entre un agente y un cliente (identificado por teléfono).
+// Los bots reportan cada mensaje entrante y saliente; se conserva según los
+// días de retención del plan del usuario.
+type Conversation struct {
+	ID      uint `gorm:"primaryKey" json:"id"`
+	UserID  uint `gorm:"not null;index" json:"userId"`
+	AgentID uint `gorm:"not null;uniqueIndex:idx_agent_conversation_phone" json:"agentId"`
+
+	PhoneKey      string `gorm:"size:20;not null;uniqueIndex:idx_agent_conversation_phone" json:"-"` // últimos 10 dígitos
+	CustomerPhone string `gorm:"size:50" json:"customerPhone"`
+	CustomerName  string `gorm:"size:255" json:"customerName"`
+
+	LastMessageAt      time.Time `gorm:"index" json:"lastMessageAt"`
+	LastMessagePreview string    `gorm:"size:255" json:"lastMessagePreview"`
+	LastDirection      string    `gorm:"size:20" json:"lastDirection"`
+	MessageCount       int       `gorm:"default:0" json:"messageCount"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+
+	Agent Agent `gorm:"foreignKey:AgentID" json:"-"`
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// Message mensaje individual de una conversación
+type Message struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	ConversationID uint      `gorm:"not null;index:idx_conversation_message_time" json:"conversationId"`
+	Direction      string    `gorm:"size:20;not null" json:"direction"`
+	MessageType    string    `gorm:"size:30;default:'text'" json:"messageType"` // text | audio | image | document | location | interactive
+	Body           string    `gorm:"type:text" json:"body"`
+	CreatedAt      time.Time `gorm:"index:idx_conversation_message_time" json:"createdAt"`
+}
+
+func (Message) TableName() string {
+	return "conversation_messages"
+}
+
+// IsInbound indica si el mensaje lo envió el cliente
+func (m *Message) IsInbound() bool {
+	return m.Direction == MessageDirectionInbound
+}
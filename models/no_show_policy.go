@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultNoShowGrace minutos después del fin de la cita antes de marcarla
+// como inasistencia
+const DefaultNoShowGrace = 30
+
+// NoShowPolicy política de inasistencias de una sucursal: marca sola las
+// citas a las que el cliente no llegó y, a partir de cierto número de
+// inasistencias, el bot le pide un anticipo por Stripe Connect para agendar.
+type NoShowPolicy struct {
+	ID       uint `gorm:"primaryKey" json:"id"`
+	UserID   uint `gorm:"not null;index" json:"userId"`
+	BranchID uint `gorm:"not null;uniqueIndex" json:"branchId"` // MyBusinessInfo.ID
+
+	// Marcar como "no_show" las citas pendientes/confirmadas que pasaron su
+	// hora de fin + GraceMinutes sin completarse ni cancelarse
+	AutoMark     bool `gorm:"default:false" json:"autoMark"`
+	GraceMinutes int  `gorm:"default:30" json:"graceMinutes"`
+
+	// Inasistencias a partir de las cuales se exige anticipo (0 = nunca)
+	DepositThreshold int     `gorm:"default:0" json:"depositThreshold"`
+	DepositAmount    float64 `gorm:"default:0" json:"depositAmount"` // en MXN
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (NoShowPolicy) TableName() string {
+	return "no_show_policies"
+}
+
+// Grace tiempo de tolerancia tras el fin de la cita
+func (p *NoShowPolicy) Grace() time.Duration {
+	minutes := p.GraceMinutes
+	if minutes <= 0 {
+		minutes = DefaultNoShowGrace
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RequiresDeposit el cliente con esas inasistencias debe dejar anticipo
+func (p *NoShowPolicy) RequiresDeposit(noShows int64) bool {
+	return p.DepositThreshold > 0 && p.DepositAmount > 0 && noShows >= int64(p.DepositThreshold)
+}
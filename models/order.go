@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
@@ -45,10 +46,30 @@ const (
 // ============================================
 
 type OrderItem struct {
-	Name     string  `json:"name"`
-	Quantity int     `json:"quantity"`
-	Price    float64 `json:"price"`
-	Notes    string  `json:"notes,omitempty"`
+	Name     string            `json:"name"`
+	Quantity int               `json:"quantity"`
+	Price    float64           `json:"price"` // precio unitario con las opciones incluidas
+	Notes    string            `json:"notes,omitempty"`
+	Options  []OrderItemOption `json:"options,omitempty"`
+}
+
+// OrderItemOption variante o extra elegido para el producto
+type OrderItemOption struct {
+	Group      string  `json:"group"`
+	Name       string  `json:"name"`
+	PriceDelta float64 `json:"priceDelta"`
+}
+
+// Label nombre del producto con sus opciones: "Pizza Hawaiana (Grande, Extra queso)"
+func (i OrderItem) Label() string {
+	if len(i.Options) == 0 {
+		return i.Name
+	}
+	names := make([]string, len(i.Options))
+	for n, o := range i.Options {
+		names[n] = o.Name
+	}
+	return i.Name + " (" + strings.Join(names, ", ") + ")"
 }
 
 type OrderItems []OrderItem
@@ -105,6 +126,14 @@ type Order struct {
 	PaymentMethod string  `gorm:"size:50;default:'cash'" json:"paymentMethod"` // cash | card | transfer
 	CashReceived  float64 `gorm:"default:0" json:"cashReceived"`               // monto entregado en efectivo
 
+	// Checkout Session de Stripe (pedidos pagados en Ninda). Único para que
+	// el webhook sea idempotente; NULL en pedidos sin pago en línea.
+	StripeSessionID *string `gorm:"size:255;uniqueIndex" json:"stripeSessionId,omitempty"`
+
+	// Sucursal de la que se descontaron existencias al confirmar el pedido;
+	// 0 = no se ha descontado. Se usa para devolverlas si se cancela.
+	StockBranchID uint `gorm:"default:0" json:"-"`
+
 	// ── Timestamps ───────────────────────────
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
@@ -121,3 +150,65 @@ func (o *Order) IsPending() bool   { return o.Status == OrderStatusPending }
 func (o *Order) IsReady() bool     { return o.Status == OrderStatusReady }
 func (o *Order) IsCancelled() bool { return o.Status == OrderStatusCancelled }
 func (o *Order) IsDelivery() bool  { return o.OrderType == OrderTypeDelivery }
+
+// ============================================
+// CICLO DE VIDA
+// ============================================
+
+// orderTransitions estados a los que puede pasar un pedido desde cada estado.
+// Entregado y cancelado son finales.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusConfirmed, OrderStatusPreparing, OrderStatusReady, OrderStatusCancelled},
+	OrderStatusConfirmed: {OrderStatusPreparing, OrderStatusReady, OrderStatusCancelled},
+	OrderStatusPreparing: {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:     {OrderStatusDelivered, OrderStatusCancelled},
+}
+
+// IsValid indica si el estado es uno de los OrderStatus conocidos
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusConfirmed, OrderStatusPreparing,
+		OrderStatusReady, OrderStatusDelivered, OrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo indica si un pedido en este estado puede pasar a next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldsStock indica si en este estado el pedido ya comprometió existencias
+// (confirmado por el negocio y no cancelado)
+func (s OrderStatus) HoldsStock() bool {
+	switch s {
+	case OrderStatusConfirmed, OrderStatusPreparing, OrderStatusReady, OrderStatusDelivered:
+		return true
+	}
+	return false
+}
+
+// Label nombre del estado para mostrar al cliente
+func (s OrderStatus) Label() string {
+	switch s {
+	case OrderStatusPending:
+		return "Pendiente"
+	case OrderStatusConfirmed:
+		return "Confirmado"
+	case OrderStatusPreparing:
+		return "En preparación"
+	case OrderStatusReady:
+		return "Listo"
+	case OrderStatusDelivered:
+		return "Entregado"
+	case OrderStatusCancelled:
+		return "Cancelado"
+	}
+	return string(s)
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// OrderEventActor quién provocó el cambio de estado del pedido
+type OrderEventActor string
+
+const (
+	OrderEventActorDashboard OrderEventActor = "dashboard" // Dueño desde el panel
+	OrderEventActorBot       OrderEventActor = "bot"       // Bot de WhatsApp
+	OrderEventActorNinda     OrderEventActor = "ninda"     // Checkout de Ninda
+)
+
+// OrderNotifyStatus resultado del aviso al cliente por WhatsApp
+type OrderNotifyStatus string
+
+const (
+	OrderNotifyNone    OrderNotifyStatus = ""        // El estado no lleva aviso
+	OrderNotifyPending OrderNotifyStatus = "pending" // Enviándose
+	OrderNotifySent    OrderNotifyStatus = "sent"    // Entregado al agente
+	OrderNotifyFailed  OrderNotifyStatus = "failed"  // El agente no pudo enviarlo
+	OrderNotifySkipped OrderNotifyStatus = "skipped" // Sin agente, sin teléfono o avisos apagados
+)
+
+// OrderEvent historial de estados de un pedido. El primer evento de cada
+// pedido tiene FromStatus vacío (alta del pedido).
+type OrderEvent struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	OrderID    uint            `gorm:"not null;index" json:"orderId"`
+	UserID     uint            `gorm:"not null;index" json:"userId"`
+	FromStatus OrderStatus     `gorm:"size:50" json:"fromStatus"`
+	ToStatus   OrderStatus     `gorm:"size:50;not null" json:"toStatus"`
+	Actor      OrderEventActor `gorm:"size:20" json:"actor"`
+
+	NotifyStatus OrderNotifyStatus `gorm:"size:20" json:"notifyStatus"`
+	NotifyError  string            `gorm:"type:text" json:"notifyError,omitempty"`
+	NotifiedAt   *time.Time        `json:"notifiedAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Relaciones
+	Order Order `gorm:"foreignKey:OrderID" json:"-"`
+}
+
+func (OrderEvent) TableName() string {
+	return "order_events"
+}
+
+// DefaultOrderNotificationTemplates mensajes que recibe el cliente cuando la
+// sucursal no personalizó el del estado. Variables: {cliente}, {pedido},
+// {negocio}, {total}, {minutos}, {entrega}.
+var DefaultOrderNotificationTemplates = map[OrderStatus]string{
+	OrderStatusConfirmed: "👍 Hola {cliente}, {negocio} confirmó tu pedido #{pedido} por ${total}. Tiempo estimado: {minutos} min.",
+	OrderStatusPreparing: "👨‍🍳 {cliente}, tu pedido #{pedido} de {negocio} ya se está preparando.",
+	OrderStatusReady:     "✅ {cliente}, tu pedido #{pedido} de {negocio} está listo {entrega}.",
+	OrderStatusDelivered: "📦 Tu pedido #{pedido} de {negocio} fue entregado. ¡Gracias por tu compra, {cliente}!",
+	OrderStatusCancelled: "❌ {cliente}, tu pedido #{pedido} de {negocio} fue cancelado. Escríbenos si tienes dudas.",
+}
+
+// OrderNotifyConfig avisos de pedidos por sucursal: si se envían y el
+// texto de cada estado (vacío = DefaultOrderNotificationTemplates)
+type OrderNotifyConfig struct {
+	ID       uint `gorm:"primaryKey" json:"id"`
+	UserID   uint `gorm:"not null;index" json:"userId"`
+	BranchID uint `gorm:"not null;uniqueIndex" json:"branchId"` // MyBusinessInfo.ID
+
+	Enabled   bool   `gorm:"default:true" json:"enabled"`
+	Confirmed string `gorm:"type:text" json:"confirmed"`
+	Preparing string `gorm:"type:text" json:"preparing"`
+	Ready     string `gorm:"type:text" json:"ready"`
+	Delivered string `gorm:"type:text" json:"delivered"`
+	Cancelled string `gorm:"type:text" json:"cancelled"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (OrderNotifyConfig) TableName() string {
+	return "order_notify_configs"
+}
+
+// TemplateFor texto del aviso para el estado ("" si el estado no lleva aviso)
+func (s *OrderNotifyConfig) TemplateFor(status OrderStatus) string {
+	custom := map[OrderStatus]string{
+		OrderStatusConfirmed: s.Confirmed,
+		OrderStatusPreparing: s.Preparing,
+		OrderStatusReady:     s.Ready,
+		OrderStatusDelivered: s.Delivered,
+		OrderStatusCancelled: s.Cancelled,
+	}[status]
+	if strings.TrimSpace(custom) != "" {
+		return custom
+	}
+	return DefaultOrderNotificationTemplates[status]
+}
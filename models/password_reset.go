@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetToken token de un solo uso para restablecer la contraseña.
+// Solo se guarda el hash SHA-256 del token; el valor en claro viaja únicamente
+// en el enlace enviado por correo.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"userId"`
+	TokenHash string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+
+	// Relaciones
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
+
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
+
+// IsValid verifica que el token no se haya usado ni haya expirado
+func (t *PasswordResetToken) IsValid() bool {
+	return t.UsedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// MarkUsed marca el token como consumido
+func (t *PasswordResetToken) MarkUsed() {
+	now := time.Now()
+	t.UsedAt = &now
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// SheetSyncStatus estado de la sincronización Sheets → BD de un agente
+type SheetSyncStatus string
+
+const (
+	SheetSyncStatusPending SheetSyncStatus = "pending" // Aún no se sincroniza por primera vez
+	SheetSyncStatusSyncing SheetSyncStatus = "syncing" // El worker la está procesando
+	SheetSyncStatusOK      SheetSyncStatus = "ok"      // Última sincronización correcta
+	SheetSyncStatusBackoff SheetSyncStatus = "backoff" // Cuota de Google agotada, reintento diferido
+	SheetSyncStatusError   SheetSyncStatus = "error"   // Falló por otro motivo (token, hoja borrada...)
+)
+
+// SheetSyncState cursor y estado de la sincronización de la hoja de un agente.
+// Cursor guarda la versión del archivo en Drive: si no cambió desde la última
+// pasada, no se vuelve a leer la cuadrícula.
+type SheetSyncState struct {
+	ID      uint `gorm:"primaryKey" json:"id"`
+	AgentID uint `gorm:"not null;uniqueIndex" json:"agentId"`
+	UserID  uint `gorm:"not null;index" json:"userId"`
+
+	Status        SheetSyncStatus `gorm:"size:20;default:'pending'" json:"status"`
+	Cursor        string          `gorm:"size:100" json:"cursor"`
+	NextSyncAt    time.Time       `gorm:"index" json:"nextSyncAt"`
+	LastSyncAt    *time.Time      `json:"lastSyncAt"`
+	LastSuccessAt *time.Time      `json:"lastSuccessAt"`
+	Failures      int             `gorm:"default:0" json:"failures"`
+	LastError     string          `gorm:"type:text" json:"lastError,omitempty"`
+
+	// Resultado de la última pasada que leyó la hoja
+	Imported  int `gorm:"default:0" json:"imported"`
+	Updated   int `gorm:"default:0" json:"updated"`
+	Conflicts int `gorm:"default:0" json:"conflicts"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (SheetSyncState) TableName() string {
+	return "sheet_sync_states"
+}
@@ -81,9 +81,14 @@ func (s *Subscription) CanCreateAgent(currentAgentCount int) bool {
 	return currentAgentCount < s.MaxAgents
 }
 
+// HasUnlimitedMessages indica si el plan no tiene tope de mensajes
+func (s *Subscription) HasUnlimitedMessages() bool {
+	return s.Plan == "electron" || s.Plan == "neutron"
+}
+
 // CanSendMessage verifica si puede enviar más mensajes
 func (s *Subscription) CanSendMessage() bool {
-	if s.Plan == "electron" || s.Plan == "neutron" {
+	if s.HasUnlimitedMessages() {
 		return true
 	}
 	return s.UsedMessages < s.MaxMessages
@@ -101,6 +106,32 @@ func (s *Subscription) ResetMessageUsage() {
 	s.ResetMessagesAt = &now
 }
 
+// ResetMessageUsageIfDue resetea el contador si ya se cruzó el límite del
+// período de facturación. Si no hay período (ej. plan gratuito sin Stripe)
+// se usa un ciclo mensual contado desde el último reset.
+// Retorna true si se reseteó.
+func (s *Subscription) ResetMessageUsageIfDue() bool {
+	now := time.Now()
+
+	// Nuevo período de facturación: el último reset es anterior a su inicio
+	if s.CurrentPeriodStart != nil && !now.Before(*s.CurrentPeriodStart) {
+		if s.ResetMessagesAt == nil || s.ResetMessagesAt.Before(*s.CurrentPeriodStart) {
+			s.ResetMessageUsage()
+			return true
+		}
+	}
+
+	// Sin período vigente: ciclo mensual desde el último reset
+	if s.CurrentPeriodEnd == nil || now.After(*s.CurrentPeriodEnd) {
+		if s.ResetMessagesAt == nil || !now.Before(s.ResetMessagesAt.AddDate(0, 1, 0)) {
+			s.ResetMessageUsage()
+			return true
+		}
+	}
+
+	return false
+}
+
 // GetPlanLimits retorna los límites del plan actual
 func (s *Subscription) GetPlanLimits() map[string]interface{} {
 	limits := map[string]interface{}{
@@ -109,10 +140,26 @@ func (s *Subscription) GetPlanLimits() map[string]interface{} {
 		"maxMessages":  s.MaxMessages,
 		"usedMessages": s.UsedMessages,
 		"isUnlimited":  s.Plan == "electron",
+
+		"transcriptRetentionDays": s.TranscriptRetentionDays(),
 	}
 	return limits
 }
 
+// TranscriptRetentionDays días que se conservan las conversaciones del bot
+func (s *Subscription) TranscriptRetentionDays() int {
+	switch s.Plan {
+	case "proton":
+		return 30
+	case "neutron":
+		return 90
+	case "electron":
+		return 365
+	default:
+		return 7
+	}
+}
+
 // GetDaysRemaining retorna los días restantes del período actual
 func (s *Subscription) GetDaysRemaining() int {
 	if s.CurrentPeriodEnd == nil {
@@ -16,6 +16,9 @@ type User struct {
 	BusinessSize string `gorm:"size:50;index" json:"businessSize"`
 	PhoneNumber  string `gorm:"size:50" json:"phoneNumber"`
 
+	// Los JWT emitidos antes de esta fecha dejan de ser válidos
+	PasswordChangedAt *time.Time `json:"-"`
+
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -39,6 +42,16 @@ func (u *User) CheckPassword(password string) bool {
 	return err == nil
 }
 
+// IsTokenRevoked indica si un JWT emitido en issuedAt quedó invalidado por un
+// cambio de contraseña posterior
+func (u *User) IsTokenRevoked(issuedAt time.Time) bool {
+	if u.PasswordChangedAt == nil {
+		return false
+	}
+	// IssuedAt del JWT tiene precisión de segundos
+	return issuedAt.Before(u.PasswordChangedAt.Truncate(time.Second))
+}
+
 func (User) TableName() string {
 	return "users"
 }
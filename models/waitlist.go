@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+)
+
+// WaitlistStatus estado de un cliente en la lista de espera
+type WaitlistStatus string
+
+const (
+	WaitlistStatusWaiting   WaitlistStatus = "waiting"   // Esperando que se libere un horario
+	WaitlistStatusOffered   WaitlistStatus = "offered"   // Tiene un horario apartado, esperando su respuesta
+	WaitlistStatusBooked    WaitlistStatus = "booked"    // Aceptó y se le agendó la cita
+	WaitlistStatusExpired   WaitlistStatus = "expired"   // Pasó la ventana de fechas sin cita
+	WaitlistStatusCancelled WaitlistStatus = "cancelled" // Salió de la lista
+)
+
+// WaitlistEntry cliente que pidió un horario lleno. Cuando una cita de la
+// sucursal se cancela, el horario se ofrece por WhatsApp a los clientes en
+// espera en orden de llegada.
+type WaitlistEntry struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	UserID      uint           `gorm:"not null;index" json:"userId"`
+	BranchID    uint           `gorm:"not null;index" json:"branchId"`
+	AgentID     uint           `gorm:"index" json:"agentId"` // Agente por el que se le escribe
+	ClientName  string         `gorm:"size:255" json:"clientName"`
+	ClientPhone string         `gorm:"size:50;index" json:"clientPhone"`
+	Service     string         `gorm:"size:255" json:"service"`
+	Worker      string         `gorm:"size:255" json:"worker"` // Vacío = cualquier trabajador
+	DateFrom    time.Time      `gorm:"type:date;not null" json:"dateFrom"`
+	DateTo      time.Time      `gorm:"type:date;not null;index" json:"dateTo"`
+	Status      WaitlistStatus `gorm:"size:20;default:'waiting';index" json:"status"`
+
+	// Cita agendada al aceptar un horario
+	AppointmentID uint `json:"appointmentId,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (WaitlistEntry) TableName() string {
+	return "waitlist_entries"
+}
+
+// Covers la fecha cae dentro de la ventana del cliente
+func (w *WaitlistEntry) Covers(date time.Time) bool {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	from := time.Date(w.DateFrom.Year(), w.DateFrom.Month(), w.DateFrom.Day(), 0, 0, 0, 0, time.Local)
+	to := time.Date(w.DateTo.Year(), w.DateTo.Month(), w.DateTo.Day(), 0, 0, 0, 0, time.Local)
+	return !day.Before(from) && !day.After(to)
+}
+
+// WaitlistOfferStatus estado de un horario ofrecido
+type WaitlistOfferStatus string
+
+const (
+	WaitlistOfferPending  WaitlistOfferStatus = "pending"  // Apartado, esperando respuesta
+	WaitlistOfferAccepted WaitlistOfferStatus = "accepted" // El cliente lo tomó
+	WaitlistOfferDeclined WaitlistOfferStatus = "declined" // El cliente respondió que no
+	WaitlistOfferExpired  WaitlistOfferStatus = "expired"  // No respondió a tiempo
+	WaitlistOfferTaken    WaitlistOfferStatus = "taken"    // Aceptó pero el horario ya se había ocupado
+)
+
+// WaitlistOffer horario liberado ofrecido a un cliente en espera. Mientras
+// está pendiente, el horario cuenta como ocupado para el motor de
+// disponibilidad; al vencer se ofrece al siguiente cliente.
+type WaitlistOffer struct {
+	ID        uint                `gorm:"primaryKey" json:"id"`
+	EntryID   uint                `gorm:"not null;index" json:"entryId"`
+	BranchID  uint                `gorm:"not null;index:idx_waitlist_offer_slot" json:"branchId"`
+	SlotStart time.Time           `gorm:"not null;index:idx_waitlist_offer_slot" json:"slotStart"`
+	SlotEnd   time.Time           `gorm:"not null" json:"slotEnd"`
+	Worker    string              `gorm:"size:255" json:"worker"`
+	Status    WaitlistOfferStatus `gorm:"size:20;default:'pending';index" json:"status"`
+	ExpiresAt time.Time           `gorm:"not null;index" json:"expiresAt"`
+
+	// Cita que liberó el horario
+	SourceAppointmentID uint `json:"sourceAppointmentId"`
+
+	RespondedAt *time.Time `json:"respondedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+
+	// Relaciones
+	Entry WaitlistEntry `gorm:"foreignKey:EntryID" json:"-"`
+}
+
+func (WaitlistOffer) TableName() string {
+	return "waitlist_offers"
+}
+
+// IsHolding el horario sigue apartado para el cliente
+func (o *WaitlistOffer) IsHolding() bool {
+	return o.Status == WaitlistOfferPending && time.Now().Before(o.ExpiresAt)
+}
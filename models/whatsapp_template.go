@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+)
+
+// Propósitos de una plantilla: qué notificaciones del backend la usan cuando
+// la ventana de 24h del cliente está cerrada. Solo se usa una plantilla que
+// el dueño asignó explícitamente al propósito; las sincronizadas de Meta
+// quedan sin asignar.
+const (
+	TemplatePurposeUnassigned   = ""                     // Sin asignar: el backend nunca la envía
+	TemplatePurposeReminder     = "appointment_reminder" // Recordatorios de cita
+	TemplatePurposeOrderUpdate  = "order_update"         // Cambios de estado del pedido
+	TemplatePurposePaymentNotif = "payment_confirmation" // Confirmación de pago
+	TemplatePurposeAppointment  = "appointment_update"   // Confirmación o cambios de una cita
+)
+
+// Estados de revisión de Meta
+const (
+	TemplateStatusApproved = "APPROVED"
+	TemplateStatusPending  = "PENDING"
+	TemplateStatusRejected = "REJECTED"
+)
+
+// WhatsAppTemplate plantilla de mensaje registrada en la WABA de un agente
+// OrbitalBot. Es una copia local de lo que devuelve Meta (se sincroniza) más
+// el propósito que el dueño le asigna.
+type WhatsAppTemplate struct {
+	ID      uint `gorm:"primaryKey" json:"id"`
+	UserID  uint `gorm:"not null;index" json:"userId"`
+	AgentID uint `gorm:"not null;uniqueIndex:idx_agent_template_lang" json:"agentId"`
+
+	MetaTemplateID string `gorm:"size:100" json:"metaTemplateId"`
+	Name           string `gorm:"size:512;not null;uniqueIndex:idx_agent_template_lang" json:"name"`
+	Language       string `gorm:"size:20;not null;uniqueIndex:idx_agent_template_lang" json:"language"`
+	Category       string `gorm:"size:50" json:"category"` // UTILITY | MARKETING | AUTHENTICATION
+	Status         string `gorm:"size:50;index" json:"status"`
+	Components     string `gorm:"type:json" json:"components"` // JSON tal cual lo devuelve Meta
+
+	// Cantidad de variables {{n}} en el cuerpo
+	BodyParams int `gorm:"default:0" json:"bodyParams"`
+
+	Purpose string `gorm:"size:50;index" json:"purpose"`
+
+	LastSyncedAt *time.Time `json:"lastSyncedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+func (WhatsAppTemplate) TableName() string {
+	return "whatsapp_templates"
+}
+
+// IsApproved indica si Meta aprobó la plantilla y se puede enviar
+func (t *WhatsAppTemplate) IsApproved() bool {
+	return t.Status == TemplateStatusApproved
+}
+
+// sessionWindow ventana de servicio al cliente de WhatsApp Business
+const sessionWindow = 24 * time.Hour
+
+// WhatsAppContact último mensaje entrante de un cliente a un agente.
+// Meta solo permite mensajes libres dentro de las 24h siguientes; fuera de
+// esa ventana hay que usar una plantilla aprobada.
+type WhatsAppContact struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	AgentID       uint      `gorm:"not null;uniqueIndex:idx_agent_contact_phone" json:"agentId"`
+	PhoneKey      string    `gorm:"size:20;not null;uniqueIndex:idx_agent_contact_phone" json:"phoneKey"` // últimos 10 dígitos
+	WaID          string    `gorm:"size:50" json:"waId"`                                                  // número tal cual lo envía Meta
+	LastInboundAt time.Time `gorm:"index" json:"lastInboundAt"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+func (WhatsAppContact) TableName() string {
+	return "whatsapp_contacts"
+}
+
+// IsSessionOpen indica si todavía se puede enviar un mensaje libre
+func (c *WhatsAppContact) IsSessionOpen() bool {
+	return time.Since(c.LastInboundAt) < sessionWindow
+}
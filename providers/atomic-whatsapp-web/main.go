@@ -111,6 +111,13 @@ func main() {
 		log.Println("ℹ️  No hay métodos de pago configurados en este negocio")
 	}
 
+	// Estado de conversaciones persistente (sobrevive reinicios)
+	log.Println("💾 Inicializando estado de conversaciones...")
+	if err := src.InitStateStore(); err != nil {
+		log.Printf("⚠️  Estado persistente no disponible: %v\n", err)
+		log.Println("💡 Las conversaciones en curso se perderán al reiniciar el bot")
+	}
+
 	// Iniciar watchdog para recargar configuración
 	go configWatchdog()
 
@@ -148,14 +155,20 @@ func main() {
 	src.SetClient(client)
 
 	// ── Servidor HTTP de control interno ──────────────────────────────────
-	// Permite llamar /logout desde el backend antes de un redeploy
+	// Permite llamar /logout desde el backend antes de un redeploy y
+	// /notify para que el backend envíe mensajes a clientes. Ambos exigen
+	// el Bearer BOT_API_TOKEN; solo /health queda abierto.
+	// Usa el PORT asignado al agente para no chocar con otros bots del servidor.
 	botHTTPPort := os.Getenv("BOT_HTTP_PORT")
+	if botHTTPPort == "" {
+		botHTTPPort = os.Getenv("PORT")
+	}
 	if botHTTPPort == "" {
 		botHTTPPort = "3999"
 	}
 	go func() {
 		mux := http.NewServeMux()
-		mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		mux.HandleFunc("/logout", src.RequireBotToken(func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodPost {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 				return
@@ -171,7 +184,8 @@ func main() {
 				time.Sleep(500 * time.Millisecond)
 				os.Exit(0) // systemd reiniciará si es necesario
 			}()
-		})
+		}))
+		mux.HandleFunc("/notify", src.RequireBotToken(src.NotifyHandler))
 		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("ok"))
@@ -3,9 +3,11 @@ package src
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,18 +21,28 @@ import (
 type OrderItem struct {
 	Title    string
 	Quantity int
-	Price    float64
+	Price    float64 // precio unitario con las opciones incluidas
+	Options  []OrderOption
+}
+
+// OrderOption variante o extra elegido para un producto del carrito
+type OrderOption struct {
+	Group      string  `json:"group"`
+	Name       string  `json:"name"`
+	PriceDelta float64 `json:"priceDelta"`
 }
 
 // UserState estado del usuario
 type UserState struct {
 	IsScheduling        bool
 	IsCancelling        bool
+	IsRescheduling      bool
 	IsAskingForEmail    bool
 	IsOrdering          bool
 	Step                int
 	Data                map[string]string
 	Cart                []OrderItem
+	PendingItems        []OrderItem // productos a los que les falta elegir una variante obligatoria
 	ConversationHistory []string
 	LastMessageTime     int64
 }
@@ -75,6 +87,17 @@ func GetUserState(userID string) *UserState {
 		return state
 	}
 
+	// Recuperar la conversación persistida (p. ej. tras un reinicio)
+	if stateStore != nil {
+		state, err := stateStore.Load(userID)
+		if err != nil {
+			log.Printf("⚠️  Error cargando estado de %s: %v", userID, err)
+		} else if state != nil && !isStateExpired(state) {
+			userStates[userID] = state
+			return state
+		}
+	}
+
 	state := &UserState{
 		IsScheduling:        false,
 		IsCancelling:        false,
@@ -94,6 +117,12 @@ func ClearUserState(userID string) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 	delete(userStates, userID)
+
+	if stateStore != nil {
+		if err := stateStore.Delete(userID); err != nil {
+			log.Printf("⚠️  Error borrando estado de %s: %v", userID, err)
+		}
+	}
 }
 
 // HandleMessage maneja los mensajes entrantes
@@ -138,6 +167,20 @@ func HandleMessage(msg *events.Message, client *whatsmeow.Client) {
 	log.Printf("   💬 Texto: %s", messageText)
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
+	RecordConversationMessage(phoneNumber, senderName, directionInbound, "text", messageText)
+
+	// Cada respuesta enviada consume un mensaje de la cuota del plan.
+	// Se verifica antes de procesar para no agendar ni tomar pedidos sin cuota.
+	if !CheckMessageQuota() {
+		if notice := QuotaExhaustedReply(phoneNumber); notice != "" {
+			if err := SendMessage(msg.Info.Chat, notice); err != nil {
+				log.Printf("❌ ERROR enviando aviso de cuota: %v", err)
+			}
+		}
+		log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		return
+	}
+
 	// Procesar mensaje — Gemini es quien decide qué hacer
 	response := ProcessMessage(messageText, phoneNumber, senderName)
 
@@ -170,6 +213,7 @@ func HandleMessage(msg *events.Message, client *whatsmeow.Client) {
 			// No hay MenuUrl — enviar el menú en texto
 			SendMessage(msg.Info.Chat, buildMenuResponse())
 		}
+		ReportMessageUsage()
 		log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 		return
 	}
@@ -223,6 +267,7 @@ func HandleMessage(msg *events.Message, client *whatsmeow.Client) {
 			log.Printf("⚠️  Servicio '%s' no encontrado o sin fotos", serviceTitle)
 			SendMessage(msg.Info.Chat, "No encontré fotos de ese producto. ¿Puedes ser más específico?")
 		}
+		ReportMessageUsage()
 		log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 		return
 	}
@@ -239,6 +284,7 @@ func HandleMessage(msg *events.Message, client *whatsmeow.Client) {
 		} else {
 			log.Printf("✅ RESPUESTA ENVIADA correctamente")
 			log.Printf("   📝 Contenido: %s", response)
+			ReportMessageUsage()
 		}
 	} else {
 		log.Printf("⚠️  No se generó respuesta para este mensaje")
@@ -250,6 +296,7 @@ func HandleMessage(msg *events.Message, client *whatsmeow.Client) {
 func ProcessMessage(message, userID, userName string) string {
 	state := GetUserState(userID)
 	state.LastMessageTime = time.Now().Unix()
+	defer SaveUserState(userID)
 
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║     PROCESANDO MENSAJE                 ║")
@@ -257,12 +304,27 @@ func ProcessMessage(message, userID, userName string) string {
 	log.Printf("📊 Estado del usuario %s:", userName)
 	log.Printf("   🔄 isScheduling: %v", state.IsScheduling)
 	log.Printf("   🚫 isCancelling: %v", state.IsCancelling)
+	log.Printf("   📅 isRescheduling: %v", state.IsRescheduling)
 	log.Printf("   📋 Datos recopilados: %v", state.Data)
 	log.Printf("   📝 Pasos completados: %d", state.Step)
 
 	// Agregar al historial
 	state.ConversationHistory = append(state.ConversationHistory, "Usuario: "+message)
 
+	// Respuesta a un recordatorio de cita ("confirmar" / "cancelar") o a un
+	// horario ofrecido de la lista de espera ("sí" / "no"). En medio de un
+	// pedido el "cancelar" o el "sí"/"no" son para el pedido.
+	if !state.IsScheduling && !state.IsCancelling && !state.IsRescheduling && !state.IsOrdering {
+		if reply, ok := HandleReminderReply(userID, message); ok {
+			state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+reply)
+			return reply
+		}
+		if reply, ok := HandleWaitlistReply(userID, message); ok {
+			state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+reply)
+			return reply
+		}
+	}
+
 	messageLower := strings.ToLower(message)
 
 	// Detectar intención de cancelar cita
@@ -315,7 +377,7 @@ func ProcessMessage(message, userID, userName string) string {
 	// Si quiere cancelar y no está cancelando
 	if wantsToCancelAppointment && !state.IsCancelling {
 		log.Println("🚫 INICIANDO PROCESO DE CANCELACIÓN")
-		return startCancellationFlow(state, message, userName)
+		return startCancellationFlow(state, message, userID, userName)
 	}
 
 	// Si está cancelando, continuar
@@ -324,6 +386,22 @@ func ProcessMessage(message, userID, userName string) string {
 		return continueCancellationFlow(state, message, userID, userName)
 	}
 
+	// Reprogramar la próxima cita del cliente
+	if state.IsRescheduling {
+		log.Println("📅 CONTINUANDO PROCESO DE REPROGRAMACIÓN")
+		return continueRescheduleFlow(state, message, userID)
+	}
+	if !state.IsScheduling && wantsToReschedule(messageLower) {
+		log.Println("📅 INICIANDO PROCESO DE REPROGRAMACIÓN")
+		return startRescheduleFlow(state, message, userID)
+	}
+
+	// El horario que pidió está lleno y quiere que le avisen si se libera
+	if state.IsScheduling && state.Data["espera_fecha"] != "" && wantsWaitlist(messageLower) {
+		log.Println("📋 ANOTANDO EN LISTA DE ESPERA")
+		return joinWaitlist(state, userID, userName)
+	}
+
 	// Analizar intención usando Gemini
 	log.Println("🔍 Analizando intención del mensaje...")
 	analysis, err := AnalyzeForAppointment(
@@ -360,7 +438,7 @@ func ProcessMessage(message, userID, userName string) string {
 }
 
 // startCancellationFlow inicia el flujo de cancelación de citas
-func startCancellationFlow(state *UserState, message, userName string) string {
+func startCancellationFlow(state *UserState, message, userID, userName string) string {
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║  INICIANDO FLUJO DE CANCELACIÓN        ║")
 	log.Println("╚════════════════════════════════════════╝")
@@ -378,7 +456,7 @@ func startCancellationFlow(state *UserState, message, userName string) string {
 		state.Data["fecha_cancelar"] = fmt.Sprintf("%s/%s/%s", dateMatch[1], dateMatch[2], dateMatch[3])
 		state.Data["hora_cancelar"] = fmt.Sprintf("%s:%s", timeMatch[1], timeMatch[2])
 		log.Printf("✅ Fecha y hora extraídas: %s %s\n", state.Data["fecha_cancelar"], state.Data["hora_cancelar"])
-		return processCancellation(state, userName)
+		return processCancellation(state, userID, userName)
 	}
 
 	response := fmt.Sprintf(`Para cancelar tu cita, %s, necesito los siguientes datos:
@@ -395,7 +473,7 @@ Por favor envíame los datos de la cita que deseas cancelar.`, userName)
 }
 
 // continueCancellationFlow continúa el flujo de cancelación
-func continueCancellationFlow(state *UserState, message string, _ string, userName string) string {
+func continueCancellationFlow(state *UserState, message string, userID string, userName string) string {
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║  CONTINUANDO FLUJO DE CANCELACIÓN      ║")
 	log.Println("╚════════════════════════════════════════╝")
@@ -417,7 +495,7 @@ func continueCancellationFlow(state *UserState, message string, _ string, userNa
 	}
 
 	if state.Data["fecha_cancelar"] != "" && state.Data["hora_cancelar"] != "" {
-		return processCancellation(state, userName)
+		return processCancellation(state, userID, userName)
 	}
 
 	if state.Data["fecha_cancelar"] == "" {
@@ -432,7 +510,7 @@ func continueCancellationFlow(state *UserState, message string, _ string, userNa
 }
 
 // processCancellation procesa la cancelación de la cita
-func processCancellation(state *UserState, userName string) string {
+func processCancellation(state *UserState, userID, userName string) string {
 	log.Println("🚫 PROCESANDO CANCELACIÓN DE CITA")
 
 	fecha := state.Data["fecha_cancelar"]
@@ -472,6 +550,13 @@ Por favor verifica los datos y vuelve a intentar.`,
 		}
 	}
 
+	// El panel libera el horario y lo ofrece a la lista de espera
+	if err := CancelInBackend(cleanPhoneNumber(userID), appointmentDateTime); err != nil {
+		log.Printf("⚠️  [Backend] No se pudo cancelar la cita en Attomos: %v", err)
+	} else {
+		log.Printf("✅ [Backend] Cita cancelada en el panel de Attomos")
+	}
+
 	if IsCalendarEnabled() {
 		events, err := SearchEventsByPatient(userName)
 		if err == nil && len(events) > 0 {
@@ -585,6 +670,12 @@ func continueAppointmentFlow(state *UserState, analysis *AppointmentAnalysis, me
 		return response
 	}
 
+	// Validar el horario contra el motor de disponibilidad del backend
+	if msg := checkRequestedSlot(state); msg != "" {
+		state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+msg)
+		return msg
+	}
+
 	log.Println("🎉 TODOS LOS DATOS COMPLETOS - PREGUNTANDO POR RECORDATORIO")
 	return askForEmailReminder(state)
 }
@@ -738,7 +829,53 @@ func saveAppointment(state *UserState, userID string) string {
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	log.Println("")
 
-	log.Println("📊 PASO 1/2: Guardando en Google Sheets...")
+	// El backend valida el horario (disponibilidad por trabajador y duración)
+	// antes de escribir en Sheets/Calendar, así un horario ocupado no deja
+	// rastros en la hoja.
+	log.Println("📤 PASO 1/3: Guardando cita en backend de Attomos...")
+	backendPayload := BotAppointmentPayload{
+		ClientName: appointmentData["nombre"],
+		Phone:      appointmentData["telefono"],
+		Service:    appointmentData["servicio"],
+		Worker:     appointmentData["barbero"],
+		Notes:      appointmentData["email"],
+	}
+	if date, hhmm, err := backendDateTime(state.Data["fecha"], state.Data["hora"]); err == nil {
+		backendPayload.Date = date
+		backendPayload.Time = hhmm
+		horaNormalizada = formatHora12(hhmm)
+		appointmentData["hora"] = horaNormalizada
+	} else {
+		backendPayload.Time = horaNormalizada
+		if t, err := time.Parse("02/01/2006", fechaExacta); err == nil {
+			backendPayload.Date = t.Format("2006-01-02")
+		}
+		if h, m, err := ConvertirHoraA24h(horaNormalizada); err == nil {
+			backendPayload.Time = fmt.Sprintf("%02d:%02d", h, m)
+		}
+	}
+
+	saved, backendErr := SaveAppointmentToBackend(backendPayload)
+	if errors.Is(backendErr, ErrSlotUnavailable) {
+		log.Printf("📅 [Backend] Horario ocupado al confirmar: %v", backendErr)
+		if availability, err := FetchAvailability(backendPayload.Service, backendPayload.Worker, backendPayload.Date); err == nil {
+			return slotUnavailableMessage(state, availability, backendPayload.Time)
+		}
+		delete(state.Data, "hora")
+		return "Ese horario se acaba de ocupar 😔 ¿Qué otra hora te acomoda?"
+	}
+	if backendErr != nil {
+		log.Printf("⚠️  [Backend] No se pudo guardar cita en Attomos: %v", backendErr)
+	} else {
+		log.Println("✅ [Backend] Cita guardada correctamente en panel de Attomos")
+		if saved.Worker != "" && appointmentData["barbero"] == "" {
+			appointmentData["barbero"] = saved.Worker
+			state.Data["barbero"] = saved.Worker
+		}
+	}
+	log.Println("")
+
+	log.Println("📊 PASO 2/3: Guardando en Google Sheets...")
 	sheetsErr := SaveAppointmentToSheets(
 		appointmentData["nombre"],
 		appointmentData["telefono"],
@@ -754,7 +891,7 @@ func saveAppointment(state *UserState, userID string) string {
 	}
 
 	log.Println("")
-	log.Println("📅 PASO 2/2: Creando evento en Google Calendar...")
+	log.Println("📅 PASO 3/3: Creando evento en Google Calendar...")
 	calendarEvent, calendarErr := CreateCalendarEvent(appointmentData)
 	if calendarErr != nil {
 		log.Printf("❌ ERROR creando evento en Calendar: %v", calendarErr)
@@ -762,6 +899,8 @@ func saveAppointment(state *UserState, userID string) string {
 		log.Println("✅ EVENTO EN CALENDAR CREADO EXITOSO")
 		if calendarEvent != nil {
 			log.Printf("   🔗 Link: %s", calendarEvent.HtmlLink)
+			// Ligar el evento a la cita para que reprogramarla lo mueva
+			LinkCalendarEvent(saved.ID, calendarEvent.Id)
 		}
 	}
 
@@ -783,39 +922,16 @@ func saveAppointment(state *UserState, userID string) string {
 	}
 	log.Println("")
 
-	log.Println("📤 PASO 3/3: Guardando cita en backend de Attomos...")
-	backendPayload := BotAppointmentPayload{
-		ClientName: appointmentData["nombre"],
-		Phone:      appointmentData["telefono"],
-		Service:    appointmentData["servicio"],
-		Worker:     appointmentData["barbero"],
-		Date:       appointmentData["fechaExacta"],
-		Time:       appointmentData["hora"],
-		Notes:      appointmentData["email"],
-	}
-	if len(backendPayload.Date) == 10 {
-		parts := strings.Split(backendPayload.Date, "/")
-		if len(parts) == 3 {
-			backendPayload.Date = parts[2] + "-" + parts[1] + "-" + parts[0]
-		}
-	}
-	if h, m, err := ConvertirHoraA24h(backendPayload.Time); err == nil {
-		backendPayload.Time = fmt.Sprintf("%02d:%02d", h, m)
-	}
-
-	if backendErr := SaveAppointmentToBackend(backendPayload); backendErr != nil {
-		log.Printf("⚠️  [Backend] No se pudo guardar cita en Attomos: %v", backendErr)
-	} else {
-		log.Println("✅ [Backend] Cita guardada correctamente en panel de Attomos")
-	}
-
-	confirmation := generateConfirmationMessage(state.Data, fechaExacta, horaNormalizada)
+	confirmation := generateConfirmationMessage(state.Data, fechaExacta, horaNormalizada, saved.ICSURL)
 
 	log.Println("✅ Mensaje de confirmación generado")
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	log.Println("")
 
-	if HasPaymentMethods() {
+	if saved.DepositRequired {
+		log.Printf("💳 [Payments] Cliente con %d inasistencias: pidiendo anticipo de $%.0f", saved.NoShows, saved.DepositAmount)
+		confirmation += "\n\n" + BuildDepositMessage(state.Data["servicio"], saved, backendPayload)
+	} else if HasPaymentMethods() {
 		servicio := state.Data["servicio"]
 		precio := GetServicePrice(servicio)
 		paymentMsg := BuildPaymentMessage(servicio, precio, "")
@@ -831,7 +947,7 @@ func saveAppointment(state *UserState, userID string) string {
 	return confirmation
 }
 
-func generateConfirmationMessage(data map[string]string, fechaExacta, horaNormalizada string) string {
+func generateConfirmationMessage(data map[string]string, fechaExacta, horaNormalizada, icsURL string) string {
 	if geminiEnabled && BusinessCfg != nil {
 		promptContext := fmt.Sprintf(`Genera un mensaje de confirmación de cita breve y profesional.
 
@@ -857,7 +973,7 @@ Máximo 4-5 líneas.`,
 
 		response, err := Chat(promptContext, "Confirmar cita", "")
 		if err == nil && response != "" {
-			return response
+			return withCalendarLink(response, icsURL)
 		}
 	}
 
@@ -871,7 +987,16 @@ Máximo 4-5 líneas.`,
 	confirmation += fmt.Sprintf("📅 %s a las %s\n\n", fechaExacta, horaNormalizada)
 	confirmation += "¡Te esperamos! 😊"
 
-	return confirmation
+	return withCalendarLink(confirmation, icsURL)
+}
+
+// withCalendarLink agrega el enlace .ics para guardar la cita en el calendario
+// del cliente (Google, Apple, Outlook)
+func withCalendarLink(message, icsURL string) string {
+	if icsURL == "" {
+		return message
+	}
+	return message + "\n\n📆 Agrégala a tu calendario: " + icsURL
 }
 
 // isPizzeriaMode detecta si el negocio es de comida
@@ -898,8 +1023,13 @@ func startOrderFlow(state *UserState, message, userName string) string {
 	state.IsOrdering = true
 	state.Step = 1
 	state.Cart = []OrderItem{}
+	state.PendingItems = nil
 	state.Data["userName"] = userName
 	parseCartFromMessage(state, message)
+	if question := askPendingOptions(state); question != "" {
+		state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+question)
+		return question
+	}
 	if len(state.Cart) > 0 {
 		state.Step = 2
 		response := buildCartSummary(state) + "\n\n" + "¿Cómo lo prefieres? 😊\n\n🛵 A domicilio\n🏪 Recoger en local\n🍽️ Comer aquí"
@@ -926,14 +1056,24 @@ func continueOrderFlow(state *UserState, message, userID, userName string) strin
 	if strings.Contains(msgL, "cancelar") || strings.Contains(msgL, "olvida") || strings.Contains(msgL, "no quiero") {
 		state.IsOrdering = false
 		state.Cart = []OrderItem{}
+		state.PendingItems = nil
 		state.Data = make(map[string]string)
 		return "Entendido, pedido cancelado. ¿En qué más te puedo ayudar? 😊"
 	}
 
 	switch state.Step {
 	case 1:
-		// Intentar detectar productos en el mensaje
-		parseCartFromMessage(state, message)
+		// Si falta una variante obligatoria el mensaje es la respuesta a esa
+		// pregunta; si no, intentar detectar productos en el mensaje
+		if len(state.PendingItems) > 0 {
+			resolvePendingOptions(state, message)
+		} else {
+			parseCartFromMessage(state, message)
+		}
+		if question := askPendingOptions(state); question != "" {
+			state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+question)
+			return question
+		}
 		if len(state.Cart) == 0 {
 			// Gemini responde cuando no detecta productos
 			response, err := Chat(
@@ -982,6 +1122,34 @@ func continueOrderFlow(state *UserState, message, userID, userName string) strin
 		return response
 
 	case 3:
+		// El cliente puede cambiar a recoger si su dirección no tiene envío
+		if strings.Contains(msgL, "recoger") || strings.Contains(msgL, "paso por") {
+			state.Data["deliveryType"] = "llevar"
+			delete(state.Data, "deliveryAddress")
+			state.Step = 4
+			return confirmOrder(state, userID, userName)
+		}
+
+		// Validar la dirección contra las zonas de entrega de la sucursal.
+		// Solo un rechazo (fuera de zona, dirección que no se ubicó o mínimo
+		// no alcanzado) pide otra dirección; si no hay cotización (agente
+		// sin sucursal, backend caído) se confirma sin costo de envío
+		quote, err := QuoteDelivery(message, cartSubtotal(state.Cart))
+		if err != nil {
+			if response := deliveryRejectedMessage(err); response != "" {
+				state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+response)
+				return response
+			}
+			log.Printf("⚠️  [Delivery] No se pudo cotizar el envío, se confirma sin costo de envío: %v", err)
+		} else {
+			if quote.Fee > 0 {
+				state.Data["deliveryFee"] = strconv.FormatFloat(quote.Fee, 'f', 2, 64)
+			}
+			state.Data["deliveryZone"] = quote.Zone
+			if quote.ETAMinutes > 0 {
+				state.Data["deliveryETA"] = strconv.Itoa(quote.ETAMinutes)
+			}
+		}
 		state.Data["deliveryAddress"] = message
 		state.Step = 4
 		return confirmOrder(state, userID, userName)
@@ -995,13 +1163,71 @@ func continueOrderFlow(state *UserState, message, userID, userName string) strin
 func confirmOrder(state *UserState, userID, userName string) string {
 	deliveryType := state.Data["deliveryType"]
 	address := state.Data["deliveryAddress"]
+
+	// Guardar primero en Attomos: el backend recalcula precios con el
+	// catálogo, valida la zona de entrega y agrega el envío
+	orderItems := make([]map[string]interface{}, 0, len(state.Cart))
+	for _, item := range state.Cart {
+		orderItems = append(orderItems, map[string]interface{}{
+			"name":     item.Title,
+			"title":    item.Title,
+			"quantity": item.Quantity,
+			"price":    item.Price,
+			"options":  item.Options,
+		})
+	}
+	orderType := deliveryType
+	if orderType == "llevar" {
+		orderType = "pickup"
+	}
+	if orderType == "domicilio" {
+		orderType = "delivery"
+	}
+	subtotal := cartSubtotal(state.Cart)
+	saved, err := SaveOrderToBackend(BotOrderPayload{
+		ClientName:       userName,
+		ClientPhone:      userID,
+		Items:            orderItems,
+		Total:            subtotal, // el backend agrega el envío de la zona
+		OrderType:        orderType,
+		DeliveryAddress:  address,
+		DeliveryLocation: deliveryLocation(address),
+		Status:           "pending",
+	})
+	if err != nil {
+		response := orderNotSavedMessage(state, err)
+		state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+response)
+		return response
+	}
+
+	// Resumen con los precios que cobró el backend; sin ellos (agente sin
+	// sucursal) se usan los del carrito más el envío cotizado
+	lines := saved.Lines()
+	if len(lines) == 0 {
+		lines = append([]OrderItem{}, state.Cart...)
+		var deliveryFee float64
+		if deliveryType == "domicilio" {
+			deliveryFee, _ = strconv.ParseFloat(state.Data["deliveryFee"], 64)
+		}
+		if deliveryFee > 0 {
+			feeLabel := "Envío"
+			if zone := state.Data["deliveryZone"]; zone != "" {
+				feeLabel += " (" + zone + ")"
+			}
+			lines = append(lines, OrderItem{Title: feeLabel, Quantity: 1, Price: deliveryFee})
+		}
+	}
+
 	var sb strings.Builder
 	sb.WriteString("🧾 *Resumen de tu pedido:*\n\n")
 	total := 0.0
-	for _, item := range state.Cart {
-		sb.WriteString(fmt.Sprintf("• %dx %s — $%.0f\n", item.Quantity, item.Title, item.Price*float64(item.Quantity)))
+	for _, item := range lines {
+		sb.WriteString(fmt.Sprintf("• %dx %s — $%.0f\n", item.Quantity, item.Label(), item.Price*float64(item.Quantity)))
 		total += item.Price * float64(item.Quantity)
 	}
+	if saved.Total > 0 {
+		total = saved.Total
+	}
 	sb.WriteString(fmt.Sprintf("\n💰 *Total: $%.0f MXN*\n", total))
 	switch deliveryType {
 	case "domicilio":
@@ -1010,6 +1236,9 @@ func confirmOrder(state *UserState, userID, userName string) string {
 		} else {
 			sb.WriteString("🛵 *Entrega a domicilio*\n")
 		}
+		if eta := state.Data["deliveryETA"]; eta != "" {
+			sb.WriteString(fmt.Sprintf("⏱️ *Tiempo estimado:* %s min\n", eta))
+		}
 	case "dine_in":
 		sb.WriteString("🍽️ *Para comer en el local*\n")
 	default:
@@ -1041,7 +1270,7 @@ func confirmOrder(state *UserState, userID, userName string) string {
 			if hasSPEI {
 				sb.WriteString("\n")
 			}
-			checkoutURL, err := CreateBotCheckoutURL(userName, userID, state.Cart)
+			checkoutURL, err := CreateBotCheckoutURL(userName, userID, lines)
 			if err != nil {
 				log.Printf("⚠️  [confirmOrder] Error generando link de pago: %v", err)
 			} else {
@@ -1055,40 +1284,36 @@ func confirmOrder(state *UserState, userID, userName string) string {
 	}
 	sb.WriteString("\n\n" + "Pedido recibido! Nos pondremos en contacto pronto. 🙌")
 
-	// Guardar pedido en Attomos
-	orderItems := make([]map[string]interface{}, 0, len(state.Cart))
-	for _, item := range state.Cart {
-		orderItems = append(orderItems, map[string]interface{}{
-			"title":    item.Title,
-			"quantity": item.Quantity,
-			"price":    item.Price,
-		})
-	}
-	orderType := deliveryType
-	if orderType == "llevar" {
-		orderType = "pickup"
-	}
-	if orderType == "domicilio" {
-		orderType = "delivery"
-	}
-	go SaveOrderToBackend(BotOrderPayload{
-		ClientName:      userName,
-		ClientPhone:     userID,
-		Items:           orderItems,
-		Total:           total,
-		OrderType:       orderType,
-		DeliveryAddress: address,
-		Status:          "pending",
-	})
-
 	state.IsOrdering = false
 	state.Cart = []OrderItem{}
+	state.PendingItems = nil
 	state.Data = make(map[string]string)
 	response := sb.String()
 	state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+response)
 	return response
 }
 
+// orderNotSavedMessage responde cuando el backend no registró el pedido y
+// deja el flujo en el paso donde el cliente puede corregirlo
+func orderNotSavedMessage(state *UserState, err error) string {
+	if response := orderRejectedMessage(err); response != "" {
+		log.Printf("⚠️  [confirmOrder] Pedido rechazado por el catálogo o las existencias: %v", err)
+		state.Step = 1
+		state.Cart = []OrderItem{}
+		state.PendingItems = nil
+		return response
+	}
+	if response := deliveryRejectedMessage(err); response != "" {
+		log.Printf("⚠️  [confirmOrder] Envío rechazado al guardar el pedido: %v", err)
+		state.Step = 3
+		return response
+	}
+	log.Printf("❌ [confirmOrder] No se pudo guardar el pedido: %v", err)
+	state.Step = 2
+	return "😕 No pude registrar tu pedido en este momento.\n\n" +
+		"Dime de nuevo cómo lo prefieres para intentarlo otra vez:\n\n🛵 A domicilio\n🏪 Recoger en local\n🍽️ Comer aquí"
+}
+
 // extractQuantity detecta la cantidad en un mensaje en lenguaje natural.
 func extractQuantity(msgL string) int {
 	for _, pair := range []struct {
@@ -1127,16 +1352,8 @@ func parseCartFromMessage(state *UserState, message string) {
 		items, err := extractCartWithGemini(message)
 		if err == nil && len(items) > 0 {
 			for _, item := range items {
-				alreadyIn := false
-				for i, existing := range state.Cart {
-					if strings.EqualFold(existing.Title, item.Title) {
-						state.Cart[i].Quantity += item.Quantity
-						alreadyIn = true
-						break
-					}
-				}
-				if !alreadyIn {
-					state.Cart = append(state.Cart, item)
+				if svc := findCatalogService(item.Title); svc != nil {
+					queueCartItem(state, *svc, item.Quantity, optionNames(item))
 				}
 			}
 			return
@@ -1157,18 +1374,7 @@ func parseCartFromMessage(state *UserState, message string) {
 			continue
 		}
 		qty := extractQuantity(msgL)
-		price := effectivePrice(svc)
-		alreadyIn := false
-		for i, item := range state.Cart {
-			if strings.EqualFold(item.Title, svc.Title) {
-				state.Cart[i].Quantity += qty
-				alreadyIn = true
-				break
-			}
-		}
-		if !alreadyIn {
-			state.Cart = append(state.Cart, OrderItem{Title: svc.Title, Quantity: qty, Price: price})
-		}
+		queueCartItem(state, svc, qty, detectOptionNames(svc, msgL))
 	}
 }
 
@@ -1183,6 +1389,9 @@ func extractCartWithGemini(message string) ([]OrderItem, error) {
 	for i, svc := range BusinessCfg.Services {
 		price := effectivePrice(svc)
 		catalog += fmt.Sprintf("%d. %s ($%.0f)\n", i+1, svc.Title, price)
+		for _, group := range svc.Modifiers {
+			catalog += "   Opciones - " + describeModifierGroup(group) + "\n"
+		}
 	}
 
 	prompt := fmt.Sprintf(`Eres un sistema de detección de pedidos. Dado el siguiente catálogo y mensaje del cliente, identifica qué productos pidió y en qué cantidad.
@@ -1198,9 +1407,10 @@ REGLAS:
 - Si el cliente no pidió ningún producto del catálogo, devuelve un array vacío
 - Tolera errores ortográficos (ej: "peperroni" = "pepperoni")
 - Si no se especifica cantidad, asume 1
+- En "options" pon solo las opciones del producto que el cliente mencionó (tamaño, extras, ingredientes), con el nombre EXACTO del catálogo; no inventes las que no dijo
 
 RESPONDE ÚNICAMENTE con un JSON válido, sin texto adicional:
-[{"title": "Nombre exacto del producto", "quantity": 1, "price": 0.0}]
+[{"title": "Nombre exacto del producto", "quantity": 1, "options": []}]
 
 Si no hay productos: []`, catalog, message)
 
@@ -1231,9 +1441,9 @@ Si no hay productos: []`, catalog, message)
 	jsonStr := responseText[jsonStart : jsonEnd+1]
 
 	type geminiItem struct {
-		Title    string  `json:"title"`
-		Quantity int     `json:"quantity"`
-		Price    float64 `json:"price"`
+		Title    string   `json:"title"`
+		Quantity int      `json:"quantity"`
+		Options  []string `json:"options"`
 	}
 
 	var geminiItems []geminiItem
@@ -1246,17 +1456,7 @@ Si no hay productos: []`, catalog, message)
 		if gi.Quantity <= 0 {
 			gi.Quantity = 1
 		}
-		price := 0.0
-		var matchedSvc *Service
-		giNorm := normalizeStr(strings.TrimSpace(gi.Title))
-		for i := range BusinessCfg.Services {
-			svcNorm := normalizeStr(strings.TrimSpace(BusinessCfg.Services[i].Title))
-			if svcNorm == giNorm {
-				matchedSvc = &BusinessCfg.Services[i]
-				price = effectivePrice(*matchedSvc)
-				break
-			}
-		}
+		matchedSvc := findCatalogService(gi.Title)
 		if matchedSvc == nil {
 			log.Printf("⚠️  [Cart] Producto no encontrado en catálogo: %s — omitiendo", gi.Title)
 			continue
@@ -1265,9 +1465,10 @@ Si no hay productos: []`, catalog, message)
 			log.Printf("⚠️  [Cart] Producto agotado ignorado: %s", gi.Title)
 			continue
 		}
-		realTitle := matchedSvc.Title
-		items = append(items, OrderItem{Title: realTitle, Quantity: gi.Quantity, Price: price})
-		log.Printf("✅ [Cart] Gemini detectó: %dx %s ($%.0f)", gi.Quantity, realTitle, price)
+		// El precio se recalcula con las opciones que sí existen en el catálogo
+		item, _ := buildCartItem(*matchedSvc, gi.Quantity, gi.Options)
+		items = append(items, item)
+		log.Printf("✅ [Cart] Gemini detectó: %dx %s ($%.0f)", item.Quantity, item.Label(), item.Price)
 	}
 
 	return items, nil
@@ -1281,7 +1482,7 @@ func buildCartSummary(state *UserState) string {
 	sb.WriteString("🛒 *Tu pedido:*\n")
 	total := 0.0
 	for _, item := range state.Cart {
-		sb.WriteString(fmt.Sprintf("  • %dx %s — $%.0f\n", item.Quantity, item.Title, item.Price*float64(item.Quantity)))
+		sb.WriteString(fmt.Sprintf("  • %dx %s — $%.0f\n", item.Quantity, item.Label(), item.Price*float64(item.Quantity)))
 		total += item.Price * float64(item.Quantity)
 	}
 	sb.WriteString(fmt.Sprintf("💰 Subtotal: $%.0f MXN", total))
@@ -0,0 +1,215 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrSlotUnavailable el backend rechazó la cita porque el horario ya no está libre
+var ErrSlotUnavailable = errors.New("horario no disponible")
+
+// maxSuggestedSlots cuántos horarios alternativos se ofrecen al cliente
+const maxSuggestedSlots = 5
+
+// AvailableSlot horario libre calculado por el backend
+type AvailableSlot struct {
+	Time    string   `json:"time"` // HH:MM
+	Workers []string `json:"workers,omitempty"`
+}
+
+// Availability respuesta de GET /api/bot/availability
+type Availability struct {
+	Date            string          `json:"date"`
+	DurationMinutes int             `json:"durationMinutes"`
+	Closed          bool            `json:"closed"`
+	Reason          string          `json:"reason"`
+	Slots           []AvailableSlot `json:"slots"`
+}
+
+var availabilityHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchAvailability consulta al backend los horarios libres de un día.
+// date en formato YYYY-MM-DD. El backend considera horario, festivos,
+// turnos de cada trabajador y las citas ya agendadas.
+func FetchAvailability(service, worker, date string) (*Availability, error) {
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+	agentID := os.Getenv("AGENT_ID")
+	if attomosURL == "" || botToken == "" || agentID == "" {
+		return nil, fmt.Errorf("ATTOMOS_API_URL, BOT_API_TOKEN o AGENT_ID no configurados")
+	}
+
+	query := url.Values{}
+	query.Set("agentId", agentID)
+	query.Set("service", service)
+	query.Set("worker", worker)
+	query.Set("date", date)
+
+	req, err := http.NewRequest("GET", attomosURL+"/api/bot/availability?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	resp, err := availabilityHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error llamando API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API retornó %d: %s", resp.StatusCode, apiErr.Error)
+	}
+
+	var availability Availability
+	if err := json.NewDecoder(resp.Body).Decode(&availability); err != nil {
+		return nil, fmt.Errorf("error parseando respuesta: %w", err)
+	}
+	return &availability, nil
+}
+
+// Has indica si la hora (HH:MM) está entre los horarios libres
+func (a *Availability) Has(hhmm string) bool {
+	for _, s := range a.Slots {
+		if s.Time == hhmm {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggest los horarios libres más cercanos a la hora pedida, en orden cronológico
+func (a *Availability) Suggest(hhmm string) []string {
+	target, _ := time.Parse("15:04", hhmm)
+	distance := func(slot string) time.Duration {
+		t, _ := time.Parse("15:04", slot)
+		if d := t.Sub(target); d < 0 {
+			return -d
+		}
+		return t.Sub(target)
+	}
+
+	times := make([]string, len(a.Slots))
+	for i, s := range a.Slots {
+		times[i] = s.Time
+	}
+	sort.SliceStable(times, func(i, j int) bool { return distance(times[i]) < distance(times[j]) })
+
+	if len(times) > maxSuggestedSlots {
+		times = times[:maxSuggestedSlots]
+	}
+	sort.Strings(times)
+	return times
+}
+
+// backendDateTime convierte la fecha y hora del flujo (texto del cliente)
+// al formato de la API: YYYY-MM-DD y HH:MM.
+func backendDateTime(fecha, hora string) (string, string, error) {
+	_, fechaExacta, err := ConvertirFechaADia(fecha)
+	if err != nil {
+		return "", "", err
+	}
+	fechaObj, err := time.Parse("02/01/2006", fechaExacta)
+	if err != nil {
+		return "", "", err
+	}
+
+	hhmm, err := horaA24h(hora)
+	if err != nil {
+		return "", "", err
+	}
+	return fechaObj.Format("2006-01-02"), hhmm, nil
+}
+
+// horaA24h interpreta la hora sin redondearla a los HORARIOS de la hoja,
+// para respetar horarios como 10:30 que ofrece el backend
+func horaA24h(hora string) (string, error) {
+	hora = strings.TrimSpace(hora)
+	if t, err := time.Parse("15:04", hora); err == nil {
+		return t.Format("15:04"), nil
+	}
+	if h, m, err := ConvertirHoraA24h(strings.ToUpper(hora)); err == nil {
+		return fmt.Sprintf("%02d:%02d", h, m), nil
+	}
+	normalizada, err := NormalizarHora(hora)
+	if err != nil {
+		return "", err
+	}
+	h, m, err := ConvertirHoraA24h(normalizada)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%02d:%02d", h, m), nil
+}
+
+// formatHora12 "15:30" → "3:30 PM", como se muestran las horas al cliente
+func formatHora12(hhmm string) string {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return hhmm
+	}
+	return t.Format("3:04 PM")
+}
+
+// checkRequestedSlot valida fecha y hora del flujo contra el backend antes de
+// confirmar. Si no están libres, borra el dato inválido del estado y devuelve
+// el mensaje para el cliente; devuelve "" si el horario es válido o si el
+// backend no responde (en ese caso se conserva el comportamiento anterior).
+func checkRequestedSlot(state *UserState) string {
+	date, hhmm, err := backendDateTime(state.Data["fecha"], state.Data["hora"])
+	if err != nil {
+		return ""
+	}
+
+	availability, err := FetchAvailability(state.Data["servicio"], state.Data["barbero"], date)
+	if err != nil {
+		log.Printf("⚠️  [Availability] No se pudo consultar disponibilidad: %v", err)
+		return ""
+	}
+
+	if availability.Has(hhmm) {
+		log.Printf("✅ [Availability] %s %s disponible", date, hhmm)
+		return ""
+	}
+
+	log.Printf("📅 [Availability] %s %s no disponible (%d horarios libres)", date, hhmm, len(availability.Slots))
+	return slotUnavailableMessage(state, availability, hhmm)
+}
+
+// slotUnavailableMessage pide otra hora (u otro día) con alternativas libres
+// y ofrece la lista de espera del día (si se cancela una cita, se le avisa)
+func slotUnavailableMessage(state *UserState, availability *Availability, hhmm string) string {
+	delete(state.Data, "hora")
+
+	if availability.Closed {
+		delete(state.Data, "fecha")
+		return "Ese día no abrimos 😔 ¿Qué otro día te acomoda?"
+	}
+
+	state.Data["espera_fecha"] = availability.Date
+	waitlistHint := "\n\nSi prefieres ese día, escribe *lista de espera* y te aviso si se libera un horario."
+
+	if len(availability.Slots) == 0 {
+		delete(state.Data, "fecha")
+		return "Ya no tenemos horarios libres ese día 😔 ¿Qué otro día te acomoda?" + waitlistHint
+	}
+
+	var options []string
+	for _, s := range availability.Suggest(hhmm) {
+		options = append(options, formatHora12(s))
+	}
+	return fmt.Sprintf("Ese horario ya no está disponible 😔 Tenemos libre: %s. ¿Cuál prefieres?",
+		strings.Join(options, ", ")) + waitlistHint
+}
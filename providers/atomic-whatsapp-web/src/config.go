@@ -74,6 +74,24 @@ type Service struct {
 	PromoPrice    float64  `json:"promoPrice,omitempty"`
 	ImageUrls     []string `json:"imageUrls,omitempty"`
 	InStock       bool     `json:"inStock"` // true = en existencia, false = agotado
+	// Duración de la cita en minutos (la usa el backend para la disponibilidad)
+	DurationMinutes int `json:"durationMinutes,omitempty"`
+	// Variantes y extras (tamaño, ingredientes...) con su diferencia de precio
+	Modifiers []ModifierGroup `json:"modifiers,omitempty"`
+}
+
+// ModifierGroup grupo de opciones de un producto
+type ModifierGroup struct {
+	Name     string           `json:"name"`
+	Required bool             `json:"required"` // el cliente debe elegir una opción
+	Multiple bool             `json:"multiple"` // se pueden elegir varias opciones
+	Options  []ModifierOption `json:"options"`
+}
+
+// ModifierOption opción de un grupo; PriceDelta se suma al precio base
+type ModifierOption struct {
+	Name       string  `json:"name"`
+	PriceDelta float64 `json:"priceDelta"`
 }
 
 // Worker representa un trabajador
@@ -81,7 +99,8 @@ type Worker struct {
 	Name      string   `json:"name"`
 	StartTime string   `json:"startTime"`
 	EndTime   string   `json:"endTime"`
-	Days      []string `json:"days"` // monday, tuesday, etc.
+	Days      []string `json:"days"`               // monday, tuesday, etc.
+	Services  []string `json:"services,omitempty"` // servicios que realiza; vacío = todos
 }
 
 // Location representa la ubicación del negocio
@@ -229,6 +248,9 @@ func GetBusinessInfoPrompt() string {
 			} else {
 				sb.WriteString(fmt.Sprintf("- %s: $%.2f%s\n", service.Title, service.Price, stockLabel))
 			}
+			if service.DurationMinutes > 0 {
+				sb.WriteString(fmt.Sprintf("  Duración: %d minutos\n", service.DurationMinutes))
+			}
 			if service.Description != "" {
 				// Limpiar HTML del description
 				desc := strings.ReplaceAll(service.Description, "<br>", " ")
@@ -239,6 +261,9 @@ func GetBusinessInfoPrompt() string {
 					sb.WriteString(fmt.Sprintf("  %s\n", desc))
 				}
 			}
+			for _, group := range service.Modifiers {
+				sb.WriteString(fmt.Sprintf("  %s\n", describeModifierGroup(group)))
+			}
 		}
 	}
 
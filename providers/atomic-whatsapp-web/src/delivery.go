@@ -0,0 +1,138 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+)
+
+// DeliveryQuote zona, costo de envío y tiempo estimado calculados por el backend
+type DeliveryQuote struct {
+	Zone       string  `json:"zone"`
+	Fee        float64 `json:"fee"`
+	MinOrder   float64 `json:"minOrder"`
+	ETAMinutes int     `json:"etaMinutes"`
+}
+
+// DeliveryRejectedError el backend no acepta el envío a esa dirección:
+// Code es "outside_zone" o "below_minimum"
+type DeliveryRejectedError struct {
+	Code     string
+	Message  string
+	Zone     string
+	MinOrder float64
+}
+
+func (e *DeliveryRejectedError) Error() string {
+	return e.Message
+}
+
+var deliveryHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// "19.432608,-99.133209" suelto o dentro de un link de Google Maps (?q=)
+var deliveryCoordsPattern = regexp.MustCompile(`(-?\d{1,2}\.\d+)\s*,\s*(-?\d{1,3}\.\d+)`)
+
+// deliveryLocation extrae "lat,lng" de la dirección si el cliente mandó
+// coordenadas o un link de Google Maps; "" si solo escribió la dirección
+func deliveryLocation(address string) string {
+	m := deliveryCoordsPattern.FindStringSubmatch(address)
+	if m == nil {
+		return ""
+	}
+	return m[1] + "," + m[2]
+}
+
+// QuoteDelivery valida la dirección del cliente contra las zonas de entrega
+// de la sucursal. subtotal es el total de productos, sin envío.
+// La dirección puede traer coordenadas ("lat,lng") o un link de Google Maps.
+func QuoteDelivery(address string, subtotal float64) (*DeliveryQuote, error) {
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+	var agentID uint
+	fmt.Sscanf(os.Getenv("AGENT_ID"), "%d", &agentID)
+	if attomosURL == "" || botToken == "" || agentID == 0 {
+		return nil, fmt.Errorf("ATTOMOS_API_URL, BOT_API_TOKEN o AGENT_ID no configurados")
+	}
+
+	bodyBytes, err := json.Marshal(map[string]interface{}{
+		"agentId":  agentID,
+		"address":  address,
+		"location": deliveryLocation(address),
+		"subtotal": subtotal,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error serializando dirección: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", attomosURL+"/api/bot/delivery/quote", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	resp, err := deliveryHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error llamando API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		var rejected struct {
+			Error    string  `json:"error"`
+			Code     string  `json:"code"`
+			Zone     string  `json:"zone"`
+			MinOrder float64 `json:"minOrder"`
+		}
+		json.NewDecoder(resp.Body).Decode(&rejected)
+		return nil, &DeliveryRejectedError{
+			Code:     rejected.Code,
+			Message:  rejected.Error,
+			Zone:     rejected.Zone,
+			MinOrder: rejected.MinOrder,
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return nil, fmt.Errorf("API retornó %d: %s", resp.StatusCode, apiErr.Error)
+	}
+
+	var quote DeliveryQuote
+	if err := json.NewDecoder(resp.Body).Decode(&quote); err != nil {
+		return nil, fmt.Errorf("error parseando respuesta: %w", err)
+	}
+	return &quote, nil
+}
+
+// deliveryRejectedMessage explica al cliente por qué no se puede enviar y
+// qué puede hacer
+func deliveryRejectedMessage(err error) string {
+	var rejected *DeliveryRejectedError
+	if !errors.As(err, &rejected) {
+		return ""
+	}
+	if rejected.Code == "below_minimum" {
+		return fmt.Sprintf("😕 Para envíos a *%s* el pedido mínimo es de $%.0f MXN.\n\n"+
+			"Puedes enviarme otra dirección o escribir *recoger* para pasar por tu pedido al local. 🏪",
+			rejected.Zone, rejected.MinOrder)
+	}
+	return "😕 Lo siento, esa dirección está fuera de nuestra zona de entrega.\n\n" +
+		"Puedes enviarme otra dirección (o tu ubicación de Google Maps) o escribir *recoger* para pasar por tu pedido al local. 🏪"
+}
+
+// cartSubtotal total de productos del carrito, sin envío
+func cartSubtotal(cart []OrderItem) float64 {
+	total := 0.0
+	for _, item := range cart {
+		total += item.Price * float64(item.Quantity)
+	}
+	return total
+}
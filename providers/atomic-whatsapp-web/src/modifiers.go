@@ -0,0 +1,203 @@
+package src
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Label nombre del producto con sus opciones: "Pizza Hawaiana (Grande, Extra queso)"
+func (item OrderItem) Label() string {
+	if len(item.Options) == 0 {
+		return item.Title
+	}
+	names := make([]string, 0, len(item.Options))
+	for _, o := range item.Options {
+		names = append(names, o.Name)
+	}
+	return fmt.Sprintf("%s (%s)", item.Title, strings.Join(names, ", "))
+}
+
+// describeModifierGroup línea del grupo para el catálogo que ve Gemini:
+// "Tamaño (obligatorio, elige una): Chica, Grande +$40"
+func describeModifierGroup(group ModifierGroup) string {
+	rules := []string{}
+	if group.Required {
+		rules = append(rules, "obligatorio")
+	}
+	if group.Multiple {
+		rules = append(rules, "puede elegir varias")
+	} else {
+		rules = append(rules, "elige una")
+	}
+	options := make([]string, 0, len(group.Options))
+	for _, o := range group.Options {
+		options = append(options, o.Name+formatPriceDelta(o.PriceDelta))
+	}
+	return fmt.Sprintf("%s (%s): %s", group.Name, strings.Join(rules, ", "), strings.Join(options, ", "))
+}
+
+func formatPriceDelta(delta float64) string {
+	switch {
+	case delta > 0:
+		return fmt.Sprintf(" +$%.0f", delta)
+	case delta < 0:
+		return fmt.Sprintf(" -$%.0f", -delta)
+	}
+	return ""
+}
+
+// findCatalogService busca un producto del catálogo por su título
+func findCatalogService(title string) *Service {
+	if BusinessCfg == nil {
+		return nil
+	}
+	titleNorm := normalizeStr(strings.TrimSpace(title))
+	for i := range BusinessCfg.Services {
+		if normalizeStr(strings.TrimSpace(BusinessCfg.Services[i].Title)) == titleNorm {
+			return &BusinessCfg.Services[i]
+		}
+	}
+	return nil
+}
+
+// buildCartItem arma la línea del carrito con las opciones reconocidas en
+// el orden de los grupos y el precio recalculado (base + diferencias).
+// Devuelve el primer grupo obligatorio que quedó sin elegir.
+func buildCartItem(svc Service, quantity int, optionNames []string) (OrderItem, *ModifierGroup) {
+	if quantity <= 0 {
+		quantity = 1
+	}
+	wanted := make(map[string]bool, len(optionNames))
+	for _, name := range optionNames {
+		wanted[normalizeStr(strings.TrimSpace(name))] = true
+	}
+
+	item := OrderItem{Title: svc.Title, Quantity: quantity, Price: effectivePrice(svc)}
+	var missing *ModifierGroup
+	for g, group := range svc.Modifiers {
+		picked := 0
+		for _, o := range group.Options {
+			if !wanted[normalizeStr(strings.TrimSpace(o.Name))] {
+				continue
+			}
+			item.Options = append(item.Options, OrderOption{Group: group.Name, Name: o.Name, PriceDelta: o.PriceDelta})
+			item.Price += o.PriceDelta
+			picked++
+			if !group.Multiple {
+				break
+			}
+		}
+		if group.Required && picked == 0 && missing == nil {
+			missing = &svc.Modifiers[g]
+		}
+	}
+	if item.Price < 0 {
+		item.Price = 0
+	}
+	return item, missing
+}
+
+// detectOptionNames opciones del producto que el cliente mencionó en su mensaje
+func detectOptionNames(svc Service, msgL string) []string {
+	var names []string
+	for _, group := range svc.Modifiers {
+		for _, o := range group.Options {
+			if name := normalizeStr(strings.TrimSpace(o.Name)); name != "" && strings.Contains(msgL, name) {
+				names = append(names, o.Name)
+			}
+		}
+	}
+	return names
+}
+
+// queueCartItem agrega el producto al carrito o, si le falta una variante
+// obligatoria, lo deja pendiente para preguntarla
+func queueCartItem(state *UserState, svc Service, quantity int, optionNames []string) {
+	item, missing := buildCartItem(svc, quantity, optionNames)
+	if missing != nil {
+		state.PendingItems = append(state.PendingItems, item)
+		return
+	}
+	addToCart(state, item)
+}
+
+// addToCart suma la cantidad si ya hay una línea con el mismo producto y
+// las mismas opciones
+func addToCart(state *UserState, item OrderItem) {
+	for i, existing := range state.Cart {
+		if strings.EqualFold(existing.Title, item.Title) && sameOptions(existing.Options, item.Options) {
+			state.Cart[i].Quantity += item.Quantity
+			return
+		}
+	}
+	state.Cart = append(state.Cart, item)
+}
+
+func sameOptions(a, b []OrderOption) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i].Group, b[i].Group) || !strings.EqualFold(a[i].Name, b[i].Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// pendingGroup producto pendiente y el grupo obligatorio que le falta
+func pendingGroup(state *UserState) (*Service, *ModifierGroup) {
+	for len(state.PendingItems) > 0 {
+		item := state.PendingItems[0]
+		svc := findCatalogService(item.Title)
+		if svc != nil {
+			if _, missing := buildCartItem(*svc, item.Quantity, optionNames(item)); missing != nil {
+				return svc, missing
+			}
+		}
+		// El producto ya no está en el catálogo o ya se completó
+		state.PendingItems = state.PendingItems[1:]
+	}
+	return nil, nil
+}
+
+// askPendingOptions pregunta la variante obligatoria del primer producto
+// pendiente; vacío si no falta ninguna
+func askPendingOptions(state *UserState) string {
+	svc, group := pendingGroup(state)
+	if svc == nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Para tu *%s*, ¿qué %s prefieres? 🤔\n\n", svc.Title, strings.ToLower(group.Name)))
+	for _, o := range group.Options {
+		sb.WriteString(fmt.Sprintf("• %s%s\n", o.Name, formatPriceDelta(o.PriceDelta)))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// resolvePendingOptions aplica las opciones que el cliente eligió en su
+// respuesta al primer producto pendiente y lo pasa al carrito si ya está completo
+func resolvePendingOptions(state *UserState, message string) {
+	svc, _ := pendingGroup(state)
+	if svc == nil {
+		return
+	}
+	pending := state.PendingItems[0]
+	names := append(optionNames(pending), detectOptionNames(*svc, normalizeStr(message))...)
+	item, missing := buildCartItem(*svc, pending.Quantity, names)
+	if missing != nil {
+		state.PendingItems[0] = item
+		return
+	}
+	state.PendingItems = state.PendingItems[1:]
+	addToCart(state, item)
+}
+
+func optionNames(item OrderItem) []string {
+	names := make([]string, 0, len(item.Options))
+	for _, o := range item.Options {
+		names = append(names, o.Name)
+	}
+	return names
+}
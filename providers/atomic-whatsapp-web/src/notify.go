@@ -0,0 +1,93 @@
+package src
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+// NotifyRequest mensaje que el backend de Attomos pide enviar a un cliente
+// (pedidos pagados en Ninda, recordatorios, cambios de estado, etc.)
+type NotifyRequest struct {
+	Phone   string `json:"phone"`
+	Message string `json:"message"`
+}
+
+// RequireBotToken protege los endpoints de control del bot (/logout,
+// /notify): el puerto queda abierto para que el backend los llame, así que
+// sin el Bearer BOT_API_TOKEN se rechaza la petición
+func RequireBotToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		botToken := os.Getenv("BOT_API_TOKEN")
+		auth := r.Header.Get("Authorization")
+		if botToken == "" || subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+botToken)) != 1 {
+			log.Printf("🚫 [Control] %s rechazado desde %s", r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// NotifyHandler — POST /notify
+// Autenticado con BOT_API_TOKEN (Bearer token interno) vía RequireBotToken.
+func NotifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req NotifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Phone == "" || req.Message == "" {
+		http.Error(w, "phone y message requeridos", http.StatusBadRequest)
+		return
+	}
+
+	jid, err := resolvePhoneJID(req.Phone)
+	if err != nil {
+		log.Printf("❌ [Notify] No se pudo resolver %s: %v", req.Phone, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := SendMessage(jid, req.Message); err != nil {
+		log.Printf("❌ [Notify] Error enviando a %s: %v", req.Phone, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("✅ [Notify] Mensaje enviado a %s", req.Phone)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// resolvePhoneJID convierte un teléfono en el JID real de WhatsApp.
+// Se consulta a WhatsApp porque en México el JID puede llevar o no el "1"
+// después del 52.
+func resolvePhoneJID(phone string) (types.JID, error) {
+	digits := cleanPhoneNumber(phone)
+	if digits == "" {
+		return types.JID{}, fmt.Errorf("teléfono inválido")
+	}
+
+	if client != nil {
+		resp, err := client.IsOnWhatsApp(context.Background(), []string{"+" + digits})
+		if err == nil {
+			for _, r := range resp {
+				if r.IsIn {
+					return r.JID, nil
+				}
+			}
+			return types.JID{}, fmt.Errorf("el número %s no está en WhatsApp", digits)
+		}
+		log.Printf("⚠️  [Notify] IsOnWhatsApp falló, usando JID directo: %v", err)
+	}
+
+	return types.NewJID(digits, types.DefaultUserServer), nil
+}
@@ -3,6 +3,7 @@ package src
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -12,22 +13,60 @@ import (
 
 // BotOrderPayload datos del pedido para enviar al backend de Attomos
 type BotOrderPayload struct {
-	AgentID         uint                     `json:"agentId"`
-	ClientName      string                   `json:"clientName"`
-	ClientPhone     string                   `json:"clientPhone"`
-	Items           []map[string]interface{} `json:"items"`
-	Total           float64                  `json:"total"`
-	OrderType       string                   `json:"orderType"`
-	DeliveryAddress string                   `json:"deliveryAddress"`
-	Status          string                   `json:"status"`
+	AgentID          uint                     `json:"agentId"`
+	ClientName       string                   `json:"clientName"`
+	ClientPhone      string                   `json:"clientPhone"`
+	Items            []map[string]interface{} `json:"items"`
+	Total            float64                  `json:"total"`
+	OrderType        string                   `json:"orderType"`
+	DeliveryAddress  string                   `json:"deliveryAddress"`
+	DeliveryLocation string                   `json:"deliveryLocation"` // "lat,lng" si el cliente compartió su ubicación
+	Status           string                   `json:"status"`
+}
+
+// SavedOrder pedido registrado con los precios que recalculó el backend
+// (incluye la línea del envío si aplica)
+type SavedOrder struct {
+	ID    uint    `json:"id"`
+	Total float64 `json:"total"`
+	Items []struct {
+		Name     string        `json:"name"`
+		Quantity int           `json:"quantity"`
+		Price    float64       `json:"price"`
+		Options  []OrderOption `json:"options"`
+	} `json:"items"`
+}
+
+// Lines productos del pedido como los cobró el backend
+func (o SavedOrder) Lines() []OrderItem {
+	lines := make([]OrderItem, 0, len(o.Items))
+	for _, item := range o.Items {
+		lines = append(lines, OrderItem{Title: item.Name, Quantity: item.Quantity, Price: item.Price, Options: item.Options})
+	}
+	return lines
+}
+
+// OrderRejectedError el backend no acepta el pedido tal como está:
+// Code es "unknown_item", "invalid_options" o "out_of_stock"
+type OrderRejectedError struct {
+	Code    string
+	Message string
+}
+
+func (e *OrderRejectedError) Error() string {
+	return e.Message
 }
 
 // SaveOrderToBackend guarda el pedido del bot en la BD de Attomos vía API REST.
-func SaveOrderToBackend(payload BotOrderPayload) error {
+// Los rechazos por catálogo llegan como *OrderRejectedError y los de la zona
+// de entrega como *DeliveryRejectedError.
+func SaveOrderToBackend(payload BotOrderPayload) (SavedOrder, error) {
+	var saved SavedOrder
+
 	attomosURL := os.Getenv("ATTOMOS_API_URL")
 	botToken := os.Getenv("BOT_API_TOKEN")
 	if attomosURL == "" || botToken == "" {
-		return fmt.Errorf("ATTOMOS_API_URL o BOT_API_TOKEN no configurados")
+		return saved, fmt.Errorf("ATTOMOS_API_URL o BOT_API_TOKEN no configurados")
 	}
 
 	// Inyectar AgentID desde env si no viene
@@ -37,12 +76,12 @@ func SaveOrderToBackend(payload BotOrderPayload) error {
 
 	bodyBytes, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("error serializando pedido: %w", err)
+		return saved, fmt.Errorf("error serializando pedido: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", attomosURL+"/api/bot/orders", bytes.NewBuffer(bodyBytes))
 	if err != nil {
-		return fmt.Errorf("error creando request: %w", err)
+		return saved, fmt.Errorf("error creando request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+botToken)
@@ -50,15 +89,60 @@ func SaveOrderToBackend(payload BotOrderPayload) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error llamando API: %w", err)
+		return saved, fmt.Errorf("error llamando API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		var rejected struct {
+			Error    string  `json:"error"`
+			Code     string  `json:"code"`
+			Zone     string  `json:"zone"`
+			MinOrder float64 `json:"minOrder"`
+		}
+		json.Unmarshal(respBody, &rejected)
+		if rejected.Code == "outside_zone" || rejected.Code == "below_minimum" {
+			return saved, &DeliveryRejectedError{
+				Code:     rejected.Code,
+				Message:  rejected.Error,
+				Zone:     rejected.Zone,
+				MinOrder: rejected.MinOrder,
+			}
+		}
+		return saved, &OrderRejectedError{Code: rejected.Code, Message: rejected.Error}
+	}
+	if resp.StatusCode == http.StatusConflict {
+		// El mensaje nombra el producto: "...: Pizza Hawaiana (quedan 2)"
+		var rejected struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		json.Unmarshal(respBody, &rejected)
+		return saved, &OrderRejectedError{Code: rejected.Code, Message: rejected.Error}
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
+		return saved, fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	log.Printf("✅ [Backend] Pedido guardado en BD: %s", string(respBody))
-	return nil
+	if err := json.Unmarshal(respBody, &saved); err != nil {
+		return saved, fmt.Errorf("error parseando respuesta: %w", err)
+	}
+	log.Printf("✅ [Backend] Pedido guardado en BD: ID=%d total=$%.2f", saved.ID, saved.Total)
+	return saved, nil
+}
+
+// orderRejectedMessage explica al cliente qué producto no se pudo pedir
+func orderRejectedMessage(err error) string {
+	var rejected *OrderRejectedError
+	if !errors.As(err, &rejected) {
+		return ""
+	}
+	if rejected.Code == "out_of_stock" {
+		return fmt.Sprintf("😕 Lo siento, no pude registrar tu pedido: %s.\n\nCambia ese producto o pide menos piezas: escríbeme tu pedido de nuevo. 🙏", rejected.Message)
+	}
+	if rejected.Code == "unknown_item" {
+		return fmt.Sprintf("😕 No pude registrar tu pedido: %s.\n\nEse producto ya no está en nuestro menú. ¿Qué te gustaría pedir? Escríbeme tu pedido de nuevo. 🙏", rejected.Message)
+	}
+	return fmt.Sprintf("😕 No pude registrar tu pedido: %s.\n\n¿Qué te gustaría pedir? Escríbeme tu pedido de nuevo con las opciones que prefieras. 🙏", rejected.Message)
 }
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 )
 
 // PaymentConfig configuración de pagos leída desde la API de Attomos
@@ -215,23 +216,15 @@ type BotCheckoutItem struct {
 // con URL corta (buy.stripe.com/xxx) — sin caracteres especiales que rompan el link
 // en WhatsApp mobile.
 func CreateBotCheckoutURL(customerName, customerPhone string, items []OrderItem) (string, error) {
-	attomosURL := os.Getenv("ATTOMOS_API_URL")
-	branchID := os.Getenv("BRANCH_ID")
-	botToken := os.Getenv("BOT_API_TOKEN")
-
-	if attomosURL == "" || branchID == "" || botToken == "" {
-		return "", fmt.Errorf("ATTOMOS_API_URL, BRANCH_ID o BOT_API_TOKEN no configurados")
-	}
-
 	// Calcular total y construir descripción del pedido
 	total := 0.0
 	itemNames := make([]string, 0, len(items))
 	for _, item := range items {
 		total += item.Price * float64(item.Quantity)
 		if item.Quantity > 1 {
-			itemNames = append(itemNames, fmt.Sprintf("%dx %s", item.Quantity, item.Title))
+			itemNames = append(itemNames, fmt.Sprintf("%dx %s", item.Quantity, item.Label()))
 		} else {
-			itemNames = append(itemNames, item.Title)
+			itemNames = append(itemNames, item.Label())
 		}
 	}
 
@@ -240,21 +233,58 @@ func CreateBotCheckoutURL(customerName, customerPhone string, items []OrderItem)
 		serviceName = serviceName[:77] + "..."
 	}
 
-	// Llamar al endpoint de Payment Link (URL corta sin # ni %2F)
+	return CreateStripePaymentLink(serviceName, total)
+}
+
+// CreateStripePaymentLink crea un Payment Link de Stripe Connect de la
+// sucursal por el monto indicado (URL corta sin # ni %2F)
+func CreateStripePaymentLink(serviceName string, amount float64) (string, error) {
+	link, err := requestPaymentLink(serviceName, amount, 0)
+	return link.URL, err
+}
+
+// DepositLink link de anticipo con el monto y la vigencia que fijó el backend
+type DepositLink struct {
+	URL         string  `json:"url"`
+	Amount      float64 `json:"amount"`      // en MXN, de la política de la sucursal
+	HoldMinutes int     `json:"holdMinutes"` // minutos que la cita aparta su horario
+}
+
+// CreateDepositPaymentLink cobra el anticipo de una cita pendiente. El
+// backend liga el pago a la cita: la confirma al pagarse y la libera si el
+// link vence sin pago o no se pudo crear.
+func CreateDepositPaymentLink(appointmentID uint, serviceName string) (DepositLink, error) {
+	return requestPaymentLink(serviceName, 0, appointmentID)
+}
+
+func requestPaymentLink(serviceName string, amount float64, appointmentID uint) (DepositLink, error) {
+	var link DepositLink
+
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	branchID := os.Getenv("BRANCH_ID")
+	botToken := os.Getenv("BOT_API_TOKEN")
+
+	if attomosURL == "" || branchID == "" || botToken == "" {
+		return link, fmt.Errorf("ATTOMOS_API_URL, BRANCH_ID o BOT_API_TOKEN no configurados")
+	}
+
 	reqBody := map[string]interface{}{
 		"serviceName": serviceName,
-		"amount":      total,
+		"amount":      amount,
 		"branchId":    branchID,
 	}
+	if appointmentID != 0 {
+		reqBody["appointmentId"] = appointmentID
+	}
 
 	bodyBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("error serializando request: %w", err)
+		return link, fmt.Errorf("error serializando request: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", attomosURL+"/api/payment-config/stripe/payment-link", bytes.NewBuffer(bodyBytes))
 	if err != nil {
-		return "", fmt.Errorf("error creando request: %w", err)
+		return link, fmt.Errorf("error creando request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+botToken)
@@ -262,27 +292,24 @@ func CreateBotCheckoutURL(customerName, customerPhone string, items []OrderItem)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error llamando API de payment link: %w", err)
+		return link, fmt.Errorf("error llamando API de payment link: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
+		return link, fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("error parseando respuesta: %w", err)
+	if err := json.Unmarshal(respBody, &link); err != nil {
+		return link, fmt.Errorf("error parseando respuesta: %w", err)
 	}
-
-	paymentURL, ok := result["url"].(string)
-	if !ok || paymentURL == "" {
-		return "", fmt.Errorf("respuesta sin url")
+	if link.URL == "" {
+		return link, fmt.Errorf("respuesta sin url")
 	}
 
-	log.Printf("✅ [BotPaymentLink] Link creado: %s", paymentURL)
-	return paymentURL, nil
+	log.Printf("✅ [BotPaymentLink] Link creado: %s", link.URL)
+	return link, nil
 }
 
 // BuildStripeOnlyMessage construye el mensaje con el link directo de Stripe Checkout.
@@ -313,15 +340,67 @@ type BotAppointmentPayload struct {
 	Notes      string `json:"notes"`
 }
 
+// SavedAppointment cita registrada en el backend
+type SavedAppointment struct {
+	ID     uint   `json:"id"`
+	Worker string `json:"worker"`
+	ICSURL string `json:"icsUrl"` // enlace .ics para el calendario del cliente
+
+	// Anticipo que exige la política de inasistencias de la sucursal
+	DepositRequired bool    `json:"depositRequired"`
+	DepositAmount   float64 `json:"depositAmount"`
+	NoShows         int     `json:"noShows"`
+}
+
+// BuildDepositMessage pide el anticipo al cliente con inasistencias
+// previas. La cita queda pendiente hasta que el negocio vea el pago; si no
+// se pudo generar el link se cancela para no apartar el horario sin cobro.
+func BuildDepositMessage(servicio string, saved SavedAppointment, booked BotAppointmentPayload) string {
+	var sb strings.Builder
+	sb.WriteString("\n💳 *Anticipo requerido*\n")
+	sb.WriteString("━━━━━━━━━━━━━━━━━━━━━━\n")
+
+	link, err := CreateDepositPaymentLink(saved.ID, "Anticipo — "+servicio)
+	if err != nil {
+		log.Printf("⚠️  [Payments] Error generando link de anticipo: %v", err)
+		releaseUnpaidAppointment(booked)
+		sb.WriteString(fmt.Sprintf("Como tienes %d citas a las que no asististe, necesitamos un anticipo para apartar tu lugar, pero no pude generar el link de pago 😔\n\n", saved.NoShows))
+		sb.WriteString("Tu horario *no quedó apartado*. Escríbenos para darte los datos de pago y agendarlo de nuevo.")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Como tienes %d citas a las que no asististe, para apartar tu lugar te pedimos un anticipo de *$%.0f MXN*.\n\n", saved.NoShows, link.Amount))
+	sb.WriteString("👉 " + link.URL + "\n")
+	sb.WriteString("━━━━━━━━━━━━━━━━━━━━━━\n")
+	sb.WriteString(fmt.Sprintf("_Tu cita queda pendiente hasta recibir el anticipo; si no se paga en %d minutos el horario se libera_ ⏳", link.HoldMinutes))
+	return sb.String()
+}
+
+// releaseUnpaidAppointment cancela en el backend la cita pendiente cuyo link
+// de anticipo no se generó. Si el backend ya la liberó el aviso solo se registra.
+func releaseUnpaidAppointment(booked BotAppointmentPayload) {
+	start, err := time.ParseInLocation("2006-01-02 15:04", booked.Date+" "+booked.Time, time.Local)
+	if err != nil {
+		return
+	}
+	if err := CancelInBackend(booked.Phone, start); err != nil {
+		log.Printf("ℹ️  [Payments] Cita sin anticipo no cancelada en el backend: %v", err)
+	}
+}
+
 // SaveAppointmentToBackend guarda la cita en la BD de Attomos vía API REST.
 // Se llama siempre al confirmar una cita, independientemente de si Google Sheets
 // está conectado o no. Así la cita aparece en el panel de Mis Citas.
-func SaveAppointmentToBackend(payload BotAppointmentPayload) error {
+// Devuelve la cita con el trabajador asignado por el backend y
+// ErrSlotUnavailable si el horario se ocupó mientras el cliente confirmaba.
+func SaveAppointmentToBackend(payload BotAppointmentPayload) (SavedAppointment, error) {
+	var saved SavedAppointment
+
 	attomosURL := os.Getenv("ATTOMOS_API_URL")
 	botToken := os.Getenv("BOT_API_TOKEN")
 
 	if attomosURL == "" || botToken == "" {
-		return fmt.Errorf("ATTOMOS_API_URL o BOT_API_TOKEN no configurados")
+		return saved, fmt.Errorf("ATTOMOS_API_URL o BOT_API_TOKEN no configurados")
 	}
 
 	// Leer agentID y userID desde el entorno si no vienen en el payload
@@ -331,12 +410,12 @@ func SaveAppointmentToBackend(payload BotAppointmentPayload) error {
 
 	bodyBytes, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("error serializando cita: %w", err)
+		return saved, fmt.Errorf("error serializando cita: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", attomosURL+"/api/bot/appointments", bytes.NewBuffer(bodyBytes))
 	if err != nil {
-		return fmt.Errorf("error creando request: %w", err)
+		return saved, fmt.Errorf("error creando request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+botToken)
@@ -344,15 +423,20 @@ func SaveAppointmentToBackend(payload BotAppointmentPayload) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("error llamando API: %w", err)
+		return saved, fmt.Errorf("error llamando API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusConflict {
+		return saved, fmt.Errorf("%w: %s", ErrSlotUnavailable, string(respBody))
+	}
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
+		return saved, fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
 	}
 
+	json.Unmarshal(respBody, &saved)
+
 	log.Printf("✅ [Backend] Cita guardada en BD: %s", string(respBody))
-	return nil
+	return saved, nil
 }
@@ -0,0 +1,331 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rescheduleKeywords frases con las que el cliente pide mover su cita
+var rescheduleKeywords = []string{
+	"reprogramar", "reagendar", "cambiar mi cita", "cambiar la cita",
+	"mover mi cita", "mover la cita", "cambiar de horario", "cambiar el horario",
+	"cambiar la hora de mi cita", "cambiar el día de mi cita",
+}
+
+// wantsToReschedule detecta la intención de reprogramar una cita
+func wantsToReschedule(messageLower string) bool {
+	for _, keyword := range rescheduleKeywords {
+		if strings.Contains(messageLower, keyword) {
+			log.Printf("📅 KEYWORD DE REPROGRAMACIÓN DETECTADO: %s\n", keyword)
+			return true
+		}
+	}
+	return false
+}
+
+// BackendAppointment cita del cliente según el backend de Attomos
+type BackendAppointment struct {
+	ID         uint   `json:"id"`
+	ClientName string `json:"clientName"`
+	Date       string `json:"date"` // YYYY-MM-DD
+	Time       string `json:"time"` // HH:MM
+	Service    string `json:"service"`
+	Worker     string `json:"worker"`
+}
+
+var rescheduleHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// callAppointmentsAPI llama a /api/bot/appointments/... con el token del bot
+// y decodifica la respuesta en out. Devuelve el status HTTP.
+func callAppointmentsAPI(method, path string, payload interface{}, out interface{}) (int, error) {
+	return callBotAPI(method, "/appointments"+path, payload, out)
+}
+
+// callBotAPI llama a /api/bot/... con el token del bot
+func callBotAPI(method, path string, payload interface{}, out interface{}) (int, error) {
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if attomosURL == "" || botToken == "" {
+		return 0, fmt.Errorf("ATTOMOS_API_URL o BOT_API_TOKEN no configurados")
+	}
+
+	var body io.Reader
+	if payload != nil {
+		bodyBytes, err := json.Marshal(payload)
+		if err != nil {
+			return 0, fmt.Errorf("error serializando request: %w", err)
+		}
+		body = bytes.NewBuffer(bodyBytes)
+	}
+
+	req, err := http.NewRequest(method, attomosURL+"/api/bot"+path, body)
+	if err != nil {
+		return 0, fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	resp, err := rescheduleHTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error llamando API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(respBody, &apiErr)
+		return resp.StatusCode, fmt.Errorf("API retornó %d: %s", resp.StatusCode, apiErr.Error)
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("error parseando respuesta: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func botAgentID() uint {
+	id, _ := strconv.ParseUint(os.Getenv("AGENT_ID"), 10, 64)
+	return uint(id)
+}
+
+// FetchUpcomingAppointment próxima cita activa del cliente (nil si no tiene)
+func FetchUpcomingAppointment(phone string) (*BackendAppointment, error) {
+	query := url.Values{}
+	query.Set("agentId", strconv.FormatUint(uint64(botAgentID()), 10))
+	query.Set("phone", phone)
+
+	var result struct {
+		Found       bool               `json:"found"`
+		Appointment BackendAppointment `json:"appointment"`
+	}
+	if _, err := callAppointmentsAPI("GET", "/upcoming?"+query.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	if !result.Found {
+		return nil, nil
+	}
+	return &result.Appointment, nil
+}
+
+// RescheduleInBackend mueve la cita al nuevo horario. El backend valida la
+// disponibilidad y propaga el cambio a Sheets y Calendar. Devuelve
+// ErrSlotUnavailable si el horario está ocupado.
+func RescheduleInBackend(phone string, appt *BackendAppointment, date, hhmm string) (*BackendAppointment, error) {
+	payload := map[string]interface{}{
+		"agentId":       botAgentID(),
+		"phone":         phone,
+		"appointmentId": appt.ID,
+		"date":          date,
+		"time":          hhmm,
+		"worker":        appt.Worker,
+	}
+
+	var result struct {
+		Appointment BackendAppointment `json:"appointment"`
+	}
+	status, err := callAppointmentsAPI("POST", "/reschedule", payload, &result)
+	if status == http.StatusConflict {
+		return nil, fmt.Errorf("%w: %v", ErrSlotUnavailable, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result.Appointment, nil
+}
+
+// LinkCalendarEvent liga el evento de Calendar recién creado a la cita del
+// backend, para que reprogramarla mueva ese mismo evento
+func LinkCalendarEvent(appointmentID uint, eventID string) {
+	if appointmentID == 0 || eventID == "" {
+		return
+	}
+	payload := map[string]interface{}{"agentId": botAgentID(), "eventId": eventID}
+	if _, err := callAppointmentsAPI("POST", fmt.Sprintf("/%d/calendar-event", appointmentID), payload, nil); err != nil {
+		log.Printf("⚠️  [Backend] No se pudo ligar el evento %s a la cita %d: %v", eventID, appointmentID, err)
+	}
+}
+
+// ============================================
+// FLUJO DE REPROGRAMACIÓN
+// ============================================
+
+// startRescheduleFlow busca la próxima cita del cliente y pide el nuevo horario
+func startRescheduleFlow(state *UserState, message, userID string) string {
+	log.Println("╔════════════════════════════════════════╗")
+	log.Println("║  INICIANDO FLUJO DE REPROGRAMACIÓN     ║")
+	log.Println("╚════════════════════════════════════════╝")
+
+	appt, err := FetchUpcomingAppointment(cleanPhoneNumber(userID))
+	if err != nil {
+		log.Printf("⚠️  [Reschedule] No se pudo consultar la cita: %v", err)
+		return "No pude consultar tu cita en este momento 😔 Intenta de nuevo en unos minutos."
+	}
+	if appt == nil {
+		return "No encontré una cita próxima con este número 🤔 ¿Quieres agendar una nueva?"
+	}
+
+	state.IsRescheduling = true
+	state.Data["reprogramar_id"] = strconv.FormatUint(uint64(appt.ID), 10)
+	state.Data["reprogramar_fecha"] = appt.Date
+	state.Data["reprogramar_hora"] = appt.Time
+	state.Data["reprogramar_servicio"] = appt.Service
+	state.Data["reprogramar_barbero"] = appt.Worker
+
+	// "Quiero reprogramar mi cita para el viernes a las 5"
+	extractRescheduleData(state, message)
+	if state.Data["fecha_nueva"] != "" && state.Data["hora_nueva"] != "" {
+		return processReschedule(state, userID)
+	}
+
+	response := fmt.Sprintf(`Claro 😊 Tu cita actual es:
+
+✂️ *Servicio:* %s
+📅 *Fecha:* %s
+🕐 *Hora:* %s
+
+¿Para qué *día* y *hora* quieres moverla?`,
+		appt.Service, formatBackendDate(appt.Date), formatHora12(appt.Time))
+	if appt.Worker != "" {
+		response = strings.Replace(response, "\n\n¿Para", fmt.Sprintf("\n💈 *Con:* %s\n\n¿Para", appt.Worker), 1)
+	}
+
+	state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+response)
+	return response
+}
+
+// continueRescheduleFlow recibe el nuevo día y hora
+func continueRescheduleFlow(state *UserState, message, userID string) string {
+	log.Println("╔════════════════════════════════════════╗")
+	log.Println("║  CONTINUANDO FLUJO DE REPROGRAMACIÓN   ║")
+	log.Println("╚════════════════════════════════════════╝")
+
+	msgL := strings.ToLower(message)
+	if strings.Contains(msgL, "olvida") || strings.Contains(msgL, "ya no") || strings.Contains(msgL, "dejala") || strings.Contains(msgL, "déjala") {
+		clearRescheduleState(state)
+		return "Listo, tu cita se queda como estaba 👍"
+	}
+
+	extractRescheduleData(state, message)
+
+	if state.Data["fecha_nueva"] != "" && state.Data["hora_nueva"] != "" {
+		return processReschedule(state, userID)
+	}
+	if state.Data["fecha_nueva"] == "" {
+		return "¿Para qué *día* quieres mover tu cita?"
+	}
+	return "¿A qué *hora* te gustaría?"
+}
+
+// processReschedule valida el nuevo horario con el backend y confirma
+func processReschedule(state *UserState, userID string) string {
+	log.Println("📅 PROCESANDO REPROGRAMACIÓN DE CITA")
+
+	date, hhmm, err := backendDateTime(state.Data["fecha_nueva"], state.Data["hora_nueva"])
+	if err != nil {
+		log.Printf("⚠️  [Reschedule] Fecha/hora inválida %q %q: %v", state.Data["fecha_nueva"], state.Data["hora_nueva"], err)
+		delete(state.Data, "fecha_nueva")
+		delete(state.Data, "hora_nueva")
+		return "No entendí la nueva fecha 😅 ¿Me la dices como \"viernes 5:00 PM\" o \"15/01/2026 10:30\"?"
+	}
+
+	id, _ := strconv.ParseUint(state.Data["reprogramar_id"], 10, 64)
+	current := &BackendAppointment{
+		ID:      uint(id),
+		Service: state.Data["reprogramar_servicio"],
+		Worker:  state.Data["reprogramar_barbero"],
+	}
+
+	moved, err := RescheduleInBackend(cleanPhoneNumber(userID), current, date, hhmm)
+	if errors.Is(err, ErrSlotUnavailable) {
+		log.Printf("📅 [Reschedule] %s %s no disponible", date, hhmm)
+		delete(state.Data, "hora_nueva")
+		availability, aErr := FetchAvailability(current.Service, current.Worker, date)
+		if aErr != nil {
+			return "Ese horario no está disponible 😔 ¿Qué otra hora te acomoda?"
+		}
+		if availability.Closed || len(availability.Slots) == 0 {
+			delete(state.Data, "fecha_nueva")
+			return "Ese día no tenemos horarios libres 😔 ¿Qué otro día te acomoda?"
+		}
+		var options []string
+		for _, s := range availability.Suggest(hhmm) {
+			options = append(options, formatHora12(s))
+		}
+		return fmt.Sprintf("Ese horario no está disponible 😔 Ese día tenemos libre: %s. ¿Cuál prefieres?",
+			strings.Join(options, ", "))
+	}
+	if err != nil {
+		log.Printf("❌ [Reschedule] Error reprogramando: %v", err)
+		clearRescheduleState(state)
+		return "No pude reprogramar tu cita en este momento 😔 Intenta de nuevo en unos minutos."
+	}
+
+	clearRescheduleState(state)
+	log.Printf("✅ [Reschedule] Cita %d movida a %s %s", moved.ID, moved.Date, moved.Time)
+
+	response := fmt.Sprintf(`✅ *Cita reprogramada*
+
+✂️ *Servicio:* %s
+📅 *Nueva fecha:* %s
+🕐 *Nueva hora:* %s`,
+		moved.Service, formatBackendDate(moved.Date), formatHora12(moved.Time))
+	if moved.Worker != "" {
+		response += fmt.Sprintf("\n💈 *Con:* %s", moved.Worker)
+	}
+	response += "\n\n¡Te esperamos! ¿Puedo ayudarte en algo más?"
+
+	state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+response)
+	return response
+}
+
+// extractRescheduleData extrae el nuevo día y hora del mensaje: primero con
+// Gemini (entiende "el viernes a las 5") y si no, con el formato DD/MM/YYYY HH:MM
+func extractRescheduleData(state *UserState, message string) {
+	if analysis, err := AnalyzeForAppointment(message, "", true); err == nil && analysis.ExtractedData != nil {
+		if v := analysis.ExtractedData["fecha"]; v != "" && v != "null" {
+			state.Data["fecha_nueva"] = v
+		}
+		if v := analysis.ExtractedData["hora"]; v != "" && v != "null" {
+			state.Data["hora_nueva"] = v
+		}
+	}
+
+	if m := regexp.MustCompile(`(\d{1,2}/\d{1,2}/\d{4})`).FindStringSubmatch(message); len(m) >= 2 {
+		state.Data["fecha_nueva"] = m[1]
+	}
+	if m := regexp.MustCompile(`(\d{1,2}:\d{2})`).FindStringSubmatch(message); len(m) >= 2 && state.Data["hora_nueva"] == "" {
+		state.Data["hora_nueva"] = m[1]
+	}
+}
+
+func clearRescheduleState(state *UserState) {
+	state.IsRescheduling = false
+	for _, key := range []string{"reprogramar_id", "reprogramar_fecha", "reprogramar_hora",
+		"reprogramar_servicio", "reprogramar_barbero", "fecha_nueva", "hora_nueva"} {
+		delete(state.Data, key)
+	}
+}
+
+// formatBackendDate "2026-01-15" → "15/01/2026"
+func formatBackendDate(date string) string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return date
+	}
+	return t.Format("02/01/2006")
+}
@@ -0,0 +1,208 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// StateStore persiste el estado de conversación de cada usuario para que un
+// reinicio del bot (redeploy, watchdog) no pierda citas o carritos a medias
+type StateStore interface {
+	Load(userID string) (*UserState, error) // nil, nil si no existe
+	Save(userID string, state *UserState) error
+	Delete(userID string) error
+	DeleteIdle(before int64) (int64, error) // borra estados con LastMessageTime < before
+	Close() error
+}
+
+// maxConversationHistory mensajes que se conservan por usuario
+// (el prompt de Gemini solo usa los últimos 10)
+const maxConversationHistory = 30
+
+// defaultStateTTL tiempo sin mensajes tras el cual se descarta una conversación
+const defaultStateTTL = 24 * time.Hour
+
+var (
+	stateStore StateStore
+	stateTTL   = defaultStateTTL
+)
+
+// InitStateStore abre el store SQLite (STATE_DB_FILE, por defecto states.db)
+// y arranca la limpieza de conversaciones inactivas (STATE_TTL_HOURS).
+// Si falla, el bot sigue funcionando solo con estado en memoria.
+func InitStateStore() error {
+	if h, err := strconv.Atoi(os.Getenv("STATE_TTL_HOURS")); err == nil && h > 0 {
+		stateTTL = time.Duration(h) * time.Hour
+	}
+
+	// La limpieza en memoria aplica aunque no haya store en disco
+	go stateJanitor()
+
+	path := os.Getenv("STATE_DB_FILE")
+	if path == "" {
+		path = "states.db"
+	}
+
+	store, err := NewSQLiteStateStore(path)
+	if err != nil {
+		return err
+	}
+	stateStore = store
+
+	log.Printf("✅ Estado de conversaciones persistido en %s (expira tras %v sin mensajes)", path, stateTTL)
+	return nil
+}
+
+// SaveUserState persiste el estado actual del usuario. Se guarda lo que haya
+// en memoria para ese ID: si el flujo llamó ClearUserState no se reescribe.
+func SaveUserState(userID string) {
+	stateMutex.RLock()
+	state, exists := userStates[userID]
+	stateMutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	trimConversationHistory(state)
+
+	if stateStore == nil {
+		return
+	}
+	if err := stateStore.Save(userID, state); err != nil {
+		log.Printf("⚠️  Error guardando estado de %s: %v", userID, err)
+	}
+}
+
+// trimConversationHistory conserva solo los últimos mensajes del historial
+func trimConversationHistory(state *UserState) {
+	if n := len(state.ConversationHistory); n > maxConversationHistory {
+		state.ConversationHistory = append([]string(nil), state.ConversationHistory[n-maxConversationHistory:]...)
+	}
+}
+
+// isStateExpired indica si la conversación lleva más del TTL sin mensajes
+func isStateExpired(state *UserState) bool {
+	return time.Since(time.Unix(state.LastMessageTime, 0)) > stateTTL
+}
+
+// stateJanitor descarta periódicamente las conversaciones inactivas
+func stateJanitor() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-stateTTL).Unix()
+
+		stateMutex.Lock()
+		expired := 0
+		for id, state := range userStates {
+			if state.LastMessageTime < cutoff {
+				delete(userStates, id)
+				expired++
+			}
+		}
+		stateMutex.Unlock()
+
+		var removed int64
+		if stateStore != nil {
+			n, err := stateStore.DeleteIdle(cutoff)
+			if err != nil {
+				log.Printf("⚠️  Error limpiando estados inactivos: %v", err)
+			}
+			removed = n
+		}
+
+		if expired > 0 || removed > 0 {
+			log.Printf("🧹 Conversaciones inactivas descartadas: %d en memoria, %d en disco", expired, removed)
+		}
+	}
+}
+
+// ============================================
+// SQLITE
+// ============================================
+
+// SQLiteStateStore guarda cada UserState como JSON en un archivo SQLite
+type SQLiteStateStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStateStore abre (o crea) el archivo y la tabla de estados
+func NewSQLiteStateStore(path string) (*SQLiteStateStore, error) {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", path))
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo %s: %w", path, err)
+	}
+	// SQLite solo admite un escritor a la vez
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS user_states (
+		user_id           TEXT PRIMARY KEY,
+		state             TEXT NOT NULL,
+		last_message_time INTEGER NOT NULL
+	)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creando tabla user_states: %w", err)
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_user_states_last ON user_states(last_message_time)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creando índice: %w", err)
+	}
+
+	return &SQLiteStateStore{db: db}, nil
+}
+
+func (s *SQLiteStateStore) Load(userID string) (*UserState, error) {
+	var raw string
+	err := s.db.QueryRow(`SELECT state FROM user_states WHERE user_id = ?`, userID).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var state UserState
+	if err := json.Unmarshal([]byte(raw), &state); err != nil {
+		return nil, fmt.Errorf("estado corrupto: %w", err)
+	}
+	if state.Data == nil {
+		state.Data = make(map[string]string)
+	}
+	return &state, nil
+}
+
+func (s *SQLiteStateStore) Save(userID string, state *UserState) error {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO user_states (user_id, state, last_message_time) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET state = excluded.state, last_message_time = excluded.last_message_time`,
+		userID, string(raw), state.LastMessageTime)
+	return err
+}
+
+func (s *SQLiteStateStore) Delete(userID string) error {
+	_, err := s.db.Exec(`DELETE FROM user_states WHERE user_id = ?`, userID)
+	return err
+}
+
+func (s *SQLiteStateStore) DeleteIdle(before int64) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM user_states WHERE last_message_time < ?`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLiteStateStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,75 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Dirección del mensaje reportado al backend
+const (
+	directionInbound  = "inbound"
+	directionOutbound = "outbound"
+)
+
+var transcriptHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// RecordConversationMessage reporta un mensaje al backend para el historial
+// de conversaciones del dashboard. Es asíncrono y best-effort: un fallo del
+// backend nunca bloquea ni afecta la respuesta al cliente.
+func RecordConversationMessage(phone, name, direction, messageType, body string) {
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if attomosURL == "" || botToken == "" {
+		return
+	}
+
+	var agentID uint
+	fmt.Sscanf(os.Getenv("AGENT_ID"), "%d", &agentID)
+	if agentID == 0 {
+		return
+	}
+
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"agentId":     agentID,
+		"phone":       cleanPhoneNumber(phone),
+		"name":        name,
+		"direction":   direction,
+		"messageType": messageType,
+		"body":        body,
+	})
+
+	go func() {
+		req, err := http.NewRequest("POST", attomosURL+"/api/bot/conversations/messages", bytes.NewBuffer(bodyBytes))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+botToken)
+
+		resp, err := transcriptHTTPClient.Do(req)
+		if err != nil {
+			log.Printf("⚠️  [Transcripts] Error reportando mensaje: %v", err)
+			return
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Printf("⚠️  [Transcripts] API retornó %d", resp.StatusCode)
+		}
+	}()
+}
+
+// firstNonEmpty retorna el primer string no vacío
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
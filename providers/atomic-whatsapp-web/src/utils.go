@@ -39,6 +39,9 @@ func SendMessage(jid types.JID, text string) error {
 	}
 
 	_, err := client.SendMessage(context.Background(), jid, msg)
+	if err == nil {
+		RecordConversationMessage(jid.User, "", directionOutbound, "text", text)
+	}
 	return err
 }
 
@@ -72,6 +75,9 @@ func SendImage(jid types.JID, imageURL string, caption string) error {
 	}
 
 	_, err = client.SendMessage(context.Background(), jid, msg)
+	if err == nil {
+		RecordConversationMessage(jid.User, "", directionOutbound, "image", firstNonEmpty(caption, imageURL))
+	}
 	return err
 }
 
@@ -106,6 +112,9 @@ func SendDocument(jid types.JID, fileURL string, fileName string, caption string
 	}
 
 	_, err = client.SendMessage(context.Background(), jid, msg)
+	if err == nil {
+		RecordConversationMessage(jid.User, "", directionOutbound, "document", firstNonEmpty(fileName, fileURL))
+	}
 	return err
 }
 
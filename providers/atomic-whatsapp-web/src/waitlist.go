@@ -0,0 +1,118 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// waitlistKeywords frases con las que el cliente pide que le avisen si se
+// libera el horario que estaba lleno
+var waitlistKeywords = []string{
+	"lista de espera", "avísame", "avisame", "avísenme", "avisenme",
+	"me avisas", "me avisan",
+}
+
+// wantsWaitlist detecta la intención de entrar a la lista de espera
+func wantsWaitlist(messageLower string) bool {
+	for _, keyword := range waitlistKeywords {
+		if strings.Contains(messageLower, keyword) {
+			log.Printf("📋 KEYWORD DE LISTA DE ESPERA DETECTADO: %s\n", keyword)
+			return true
+		}
+	}
+	return false
+}
+
+// JoinWaitlistInBackend anota al cliente en la lista de espera del día
+// (YYYY-MM-DD). Si se cancela una cita ese día, el backend le ofrece el
+// horario por WhatsApp y se lo aparta unos minutos.
+func JoinWaitlistInBackend(phone, clientName, service, worker, date string) error {
+	payload := map[string]interface{}{
+		"agentId":    botAgentID(),
+		"clientName": clientName,
+		"phone":      phone,
+		"service":    service,
+		"worker":     worker,
+		"dateFrom":   date,
+		"dateTo":     date,
+	}
+	_, err := callBotAPI("POST", "/waitlist", payload, nil)
+	return err
+}
+
+// joinWaitlist anota al cliente para el día lleno que pidió y cierra el flujo
+// de agendamiento
+func joinWaitlist(state *UserState, userID, userName string) string {
+	date := state.Data["espera_fecha"]
+	nombre := state.Data["nombre"]
+	if nombre == "" {
+		nombre = userName
+	}
+
+	if err := JoinWaitlistInBackend(cleanPhoneNumber(userID), nombre, state.Data["servicio"], state.Data["barbero"], date); err != nil {
+		log.Printf("⚠️  [Waitlist] No se pudo anotar al cliente: %v", err)
+		return "No pude anotarte en la lista de espera 😔 ¿Quieres elegir otro horario?"
+	}
+	log.Printf("✅ [Waitlist] Cliente anotado para el %s", date)
+
+	state.IsScheduling = false
+	state.Data = make(map[string]string)
+
+	fechaTexto := date
+	if t, err := time.Parse("2006-01-02", date); err == nil {
+		fechaTexto = t.Format("02/01/2006")
+	}
+	response := fmt.Sprintf("📋 Listo, te anoté en la lista de espera para el *%s*. Si se libera un horario te escribo por aquí y te lo aparto unos minutos.\n\nSi mientras tanto quieres agendar otro día, solo dime.", fechaTexto)
+	state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+response)
+	return response
+}
+
+// HandleWaitlistReply procesa "sí" / "no" como respuesta a un horario que el
+// backend ofreció de la lista de espera. Retorna false si el cliente no tiene
+// un horario apartado, para seguir con el flujo normal.
+func HandleWaitlistReply(phone, message string) (string, bool) {
+	action := strings.Trim(strings.ToLower(strings.TrimSpace(message)), "¡!.¿? ")
+	switch action {
+	case "sí", "si", "sí quiero", "si quiero":
+		action = "si"
+	case "no", "no gracias", "no, gracias":
+		action = "no"
+	default:
+		return "", false
+	}
+
+	payload := map[string]interface{}{
+		"agentId": botAgentID(),
+		"phone":   cleanPhoneNumber(phone),
+		"action":  action,
+	}
+	var result struct {
+		Handled bool   `json:"handled"`
+		Message string `json:"message"`
+	}
+	if _, err := callBotAPI("POST", "/waitlist/reply", payload, &result); err != nil {
+		log.Printf("⚠️  [Waitlist] Error enviando respuesta: %v", err)
+		return "", false
+	}
+	if !result.Handled {
+		return "", false
+	}
+
+	log.Printf("✅ [Waitlist] Respuesta '%s' aplicada al horario ofrecido", action)
+	return result.Message, true
+}
+
+// CancelInBackend marca la cita como cancelada en el panel para que su
+// horario se ofrezca a la lista de espera
+func CancelInBackend(phone string, start time.Time) error {
+	payload := map[string]interface{}{
+		"agentId": botAgentID(),
+		"phone":   phone,
+		"date":    start.Format("2006-01-02"),
+		"time":    start.Format("15:04"),
+	}
+	_, err := callAppointmentsAPI("POST", "/cancel", payload, nil)
+	return err
+}
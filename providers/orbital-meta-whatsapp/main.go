@@ -102,6 +102,13 @@ func main() {
 		log.Println("ℹ️  No hay métodos de pago configurados en este negocio")
 	}
 
+	// Estado de conversaciones persistente (sobrevive reinicios)
+	log.Println("💾 Inicializando estado de conversaciones...")
+	if err := src.InitStateStore(); err != nil {
+		log.Printf("⚠️  Estado persistente no disponible: %v\n", err)
+		log.Println("💡 Las conversaciones en curso se perderán al reiniciar el bot")
+	}
+
 	// Iniciar watchdog para recargar configuración
 	go configWatchdog()
 
@@ -204,6 +211,7 @@ func showConfigurationStatus() {
 		"META_ACCESS_TOKEN":    "Meta Access Token",
 		"META_PHONE_NUMBER_ID": "Meta Phone Number ID",
 		"META_WABA_ID":         "Meta WABA ID",
+		"META_APP_SECRET":      "Meta App Secret (firma de webhooks)",
 		"WEBHOOK_VERIFY_TOKEN": "Webhook Verify Token",
 		"PORT":                 "Puerto del Webhook",
 		"GEMINI_API_KEY":       "Gemini AI",
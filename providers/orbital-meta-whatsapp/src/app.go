@@ -1,6 +1,7 @@
 package src
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
@@ -13,6 +14,7 @@ import (
 type UserState struct {
 	IsScheduling        bool
 	IsCancelling        bool
+	IsRescheduling      bool
 	IsAskingForEmail    bool
 	Step                int
 	Data                map[string]string
@@ -34,6 +36,17 @@ func GetUserState(userID string) *UserState {
 		return state
 	}
 
+	// Recuperar la conversación persistida (p. ej. tras un reinicio)
+	if stateStore != nil {
+		state, err := stateStore.Load(userID)
+		if err != nil {
+			log.Printf("⚠️  Error cargando estado de %s: %v", userID, err)
+		} else if state != nil && !isStateExpired(state) {
+			userStates[userID] = state
+			return state
+		}
+	}
+
 	state := &UserState{
 		IsScheduling:        false,
 		IsCancelling:        false,
@@ -53,12 +66,19 @@ func ClearUserState(userID string) {
 	stateMutex.Lock()
 	defer stateMutex.Unlock()
 	delete(userStates, userID)
+
+	if stateStore != nil {
+		if err := stateStore.Delete(userID); err != nil {
+			log.Printf("⚠️  Error borrando estado de %s: %v", userID, err)
+		}
+	}
 }
 
 // ProcessMessage procesa un mensaje entrante y retorna la respuesta
 func ProcessMessage(messageText, phoneNumber, senderName string) string {
 	state := GetUserState(phoneNumber)
 	state.LastMessageTime = time.Now().Unix()
+	defer SaveUserState(phoneNumber)
 
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║     PROCESANDO MENSAJE                 ║")
@@ -66,6 +86,7 @@ func ProcessMessage(messageText, phoneNumber, senderName string) string {
 	log.Printf("📊 Estado del usuario %s:", senderName)
 	log.Printf("   🔄 isScheduling: %v", state.IsScheduling)
 	log.Printf("   🚫 isCancelling: %v", state.IsCancelling)
+	log.Printf("   📅 isRescheduling: %v", state.IsRescheduling)
 	log.Printf("   📧 isAskingForEmail: %v", state.IsAskingForEmail)
 	log.Printf("   📋 Datos recopilados: %v", state.Data)
 	log.Printf("   📝 Pasos completados: %d", state.Step)
@@ -73,6 +94,19 @@ func ProcessMessage(messageText, phoneNumber, senderName string) string {
 	// Agregar al historial
 	state.ConversationHistory = append(state.ConversationHistory, "Usuario: "+messageText)
 
+	// Respuesta a un recordatorio de cita ("confirmar" / "cancelar")
+	if !state.IsScheduling && !state.IsCancelling && !state.IsRescheduling {
+		if reply, ok := HandleReminderReply(phoneNumber, messageText); ok {
+			state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+reply)
+			return reply
+		}
+		// Respuesta a un horario ofrecido de la lista de espera ("sí" / "no")
+		if reply, ok := HandleWaitlistReply(phoneNumber, messageText); ok {
+			state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+reply)
+			return reply
+		}
+	}
+
 	// Construir historial de conversación como string
 	historyStr := strings.Join(state.ConversationHistory, "\n")
 
@@ -100,7 +134,7 @@ func ProcessMessage(messageText, phoneNumber, senderName string) string {
 
 	if wantsToCancelAppointment && !state.IsCancelling {
 		log.Println("🚫 INICIANDO PROCESO DE CANCELACIÓN")
-		return startCancellationFlow(state, messageText, senderName)
+		return startCancellationFlow(state, messageText, phoneNumber, senderName)
 	}
 
 	if state.IsCancelling {
@@ -108,6 +142,23 @@ func ProcessMessage(messageText, phoneNumber, senderName string) string {
 		return continueCancellationFlow(state, messageText, phoneNumber, senderName)
 	}
 
+	// --- FLUJO DE REPROGRAMACIÓN ---
+	if state.IsRescheduling {
+		log.Println("📅 CONTINUANDO PROCESO DE REPROGRAMACIÓN")
+		return continueRescheduleFlow(state, messageText, phoneNumber)
+	}
+	if !state.IsScheduling && wantsToReschedule(messageLower) {
+		log.Println("📅 INICIANDO PROCESO DE REPROGRAMACIÓN")
+		return startRescheduleFlow(state, messageText, phoneNumber)
+	}
+
+	// --- LISTA DE ESPERA ---
+	// El horario que pidió está lleno y quiere que le avisen si se libera
+	if state.IsScheduling && state.Data["espera_fecha"] != "" && wantsWaitlist(messageLower) {
+		log.Println("📋 ANOTANDO EN LISTA DE ESPERA")
+		return joinWaitlist(state, phoneNumber, senderName)
+	}
+
 	// --- FLUJO DE AGENDAMIENTO ACTIVO ---
 	if state.IsScheduling {
 		log.Println("📅 CONTINUANDO FLUJO DE AGENDAMIENTO")
@@ -132,7 +183,7 @@ func ProcessMessage(messageText, phoneNumber, senderName string) string {
 }
 
 // startCancellationFlow inicia el flujo de cancelación de citas
-func startCancellationFlow(state *UserState, message, userName string) string {
+func startCancellationFlow(state *UserState, message, phoneNumber, userName string) string {
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║  INICIANDO FLUJO DE CANCELACIÓN        ║")
 	log.Println("╚════════════════════════════════════════╝")
@@ -150,7 +201,7 @@ func startCancellationFlow(state *UserState, message, userName string) string {
 		state.Data["fecha_cancelar"] = fmt.Sprintf("%s/%s/%s", dateMatch[1], dateMatch[2], dateMatch[3])
 		state.Data["hora_cancelar"] = fmt.Sprintf("%s:%s", timeMatch[1], timeMatch[2])
 		log.Printf("✅ Fecha y hora extraídas: %s %s\n", state.Data["fecha_cancelar"], state.Data["hora_cancelar"])
-		return processCancellation(state, userName)
+		return processCancellation(state, phoneNumber, userName)
 	}
 
 	response := fmt.Sprintf(`Para cancelar tu cita, %s, necesito los siguientes datos:
@@ -167,7 +218,7 @@ Por favor envíame los datos de la cita que deseas cancelar.`, userName)
 }
 
 // continueCancellationFlow continúa el flujo de cancelación
-func continueCancellationFlow(state *UserState, message, _, userName string) string {
+func continueCancellationFlow(state *UserState, message, phoneNumber, userName string) string {
 	log.Println("╔════════════════════════════════════════╗")
 	log.Println("║  CONTINUANDO FLUJO DE CANCELACIÓN      ║")
 	log.Println("╚════════════════════════════════════════╝")
@@ -189,7 +240,7 @@ func continueCancellationFlow(state *UserState, message, _, userName string) str
 	}
 
 	if state.Data["fecha_cancelar"] != "" && state.Data["hora_cancelar"] != "" {
-		return processCancellation(state, userName)
+		return processCancellation(state, phoneNumber, userName)
 	}
 
 	if state.Data["fecha_cancelar"] == "" {
@@ -204,7 +255,7 @@ func continueCancellationFlow(state *UserState, message, _, userName string) str
 }
 
 // processCancellation procesa la cancelación de la cita
-func processCancellation(state *UserState, userName string) string {
+func processCancellation(state *UserState, phoneNumber, userName string) string {
 	log.Println("🚫 PROCESANDO CANCELACIÓN DE CITA")
 
 	fecha := state.Data["fecha_cancelar"]
@@ -239,6 +290,13 @@ Por favor verifica los datos y vuelve a intentar.`,
 		}
 	}
 
+	// El panel libera el horario y lo ofrece a la lista de espera
+	if err := CancelInBackend(cleanPhoneNumber(phoneNumber), appointmentDateTime); err != nil {
+		log.Printf("⚠️  [Backend] No se pudo cancelar la cita en Attomos: %v", err)
+	} else {
+		log.Printf("✅ [Backend] Cita cancelada en el panel de Attomos")
+	}
+
 	state.IsCancelling = false
 	state.Data = make(map[string]string)
 
@@ -306,6 +364,11 @@ func continueAppointmentFlow(state *UserState, messageText, phoneNumber, senderN
 	missing := getMissingData(state.Data)
 
 	if len(missing) == 0 {
+		// Validar el horario contra el motor de disponibilidad del backend
+		if msg := checkRequestedSlot(state); msg != "" {
+			state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+msg)
+			return msg
+		}
 		// Tenemos todo, guardar la cita
 		return saveAppointment(state, phoneNumber, senderName)
 	}
@@ -359,19 +422,10 @@ func askForField(field string, state *UserState, _, historyStr string) string {
 		return msg
 
 	case "servicio":
-		servicesList := ""
-		if BusinessCfg != nil && len(BusinessCfg.Services) > 0 {
-			for i, s := range BusinessCfg.Services {
-				if s.Price > 0 {
-					servicesList += fmt.Sprintf("\n%d. %s - $%.0f", i+1, s.Title, s.Price)
-				} else {
-					servicesList += fmt.Sprintf("\n%d. %s", i+1, s.Title)
-				}
-			}
-		}
-		msg := fmt.Sprintf("¿Qué servicio deseas?\n%s", servicesList)
-		state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+msg)
-		return msg
+		msg := "¿Qué servicio deseas?"
+		state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+msg+"\n"+buildServicesText())
+		// El webhook envía el catálogo como lista interactiva
+		return markerSendServiceList + "\n" + msg
 
 	case "barbero":
 		workersList := ""
@@ -391,6 +445,15 @@ func askForField(field string, state *UserState, _, historyStr string) string {
 
 	case "hora":
 		horariosStr := strings.Join(HORARIOS, ", ")
+		if slots, ok := availableSlotsText(state); ok {
+			if slots == "" {
+				delete(state.Data, "fecha")
+				msg := "Ya no tenemos horarios libres ese día 😔 ¿Qué otro día te acomoda?"
+				state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+msg)
+				return msg
+			}
+			horariosStr = slots
+		}
 		msg := fmt.Sprintf("¿A qué hora? Horarios disponibles:\n%s", horariosStr)
 		state.ConversationHistory = append(state.ConversationHistory, "Asistente: "+msg)
 		return msg
@@ -413,7 +476,8 @@ func saveAppointment(state *UserState, phoneNumber, senderName string) string {
 		return "❌ Hubo un problema con la fecha. ¿Puedes intentarlo de nuevo?"
 	}
 
-	horaNormalizada, err := NormalizarHora(state.Data["hora"])
+	rawHora := state.Data["hora"]
+	horaNormalizada, err := NormalizarHora(rawHora)
 	if err != nil {
 		log.Printf("❌ Error normalizando hora: %v", err)
 		// Intentar con hora tal cual
@@ -432,6 +496,41 @@ func saveAppointment(state *UserState, phoneNumber, senderName string) string {
 	log.Printf("   📅 Fecha exacta: %s (%s)", fechaExacta, diaSemana)
 	log.Printf("   ⏰ Hora normalizada: %s", horaNormalizada)
 
+	// Guardar primero en el backend: valida disponibilidad por trabajador y
+	// duración antes de escribir en Sheets/Calendar
+	backendPayload := BotAppointmentPayload{
+		ClientName: state.Data["nombre"],
+		Phone:      state.Data["telefono"],
+		Service:    state.Data["servicio"],
+		Worker:     state.Data["barbero"],
+		Notes:      state.Data["email"],
+	}
+	if date, hhmm, err := backendDateTime(state.Data["fecha"], rawHora); err == nil {
+		backendPayload.Date = date
+		backendPayload.Time = hhmm
+		horaNormalizada = formatHora12(hhmm)
+		state.Data["hora"] = horaNormalizada
+	}
+
+	var saved SavedAppointment
+	if backendPayload.Date != "" {
+		var err error
+		saved, err = SaveAppointmentToBackend(backendPayload)
+		if errors.Is(err, ErrSlotUnavailable) {
+			log.Printf("📅 [Backend] Horario ocupado al confirmar: %v", err)
+			if availability, aErr := FetchAvailability(backendPayload.Service, backendPayload.Worker, backendPayload.Date); aErr == nil {
+				return slotUnavailableMessage(state, availability, backendPayload.Time)
+			}
+			delete(state.Data, "hora")
+			return "Ese horario se acaba de ocupar 😔 ¿Qué otra hora te acomoda?"
+		}
+		if err != nil {
+			log.Printf("⚠️  [Backend] No se pudo guardar cita en Attomos: %v", err)
+		} else if saved.Worker != "" && state.Data["barbero"] == "" {
+			state.Data["barbero"] = saved.Worker
+		}
+	}
+
 	// Guardar en Google Sheets
 	if IsSheetsEnabled() {
 		err := SaveAppointmentToSheets(
@@ -451,11 +550,15 @@ func saveAppointment(state *UserState, phoneNumber, senderName string) string {
 
 	// Crear evento en Google Calendar
 	if IsCalendarEnabled() {
-		_, err := CreateCalendarEvent(state.Data)
+		event, err := CreateCalendarEvent(state.Data)
 		if err != nil {
 			log.Printf("❌ Error creando evento en Calendar: %v", err)
 		} else {
 			log.Printf("✅ Evento creado en Google Calendar")
+			// Ligar el evento a la cita para que reprogramarla lo mueva
+			if event != nil {
+				LinkCalendarEvent(saved.ID, event.Id)
+			}
 		}
 	}
 
@@ -463,10 +566,13 @@ func saveAppointment(state *UserState, phoneNumber, senderName string) string {
 	emailQuestion := askForEmailReminder(state, senderName)
 
 	// Construir mensaje de confirmación
-	confirmMsg := generateConfirmationMessage(state.Data, senderName)
+	confirmMsg := generateConfirmationMessage(state.Data, saved.ICSURL)
 
-	// ── Agregar opciones de pago si el negocio las tiene configuradas ─────
-	if HasPaymentMethods() {
+	// ── Anticipo por inasistencias u opciones de pago del negocio ─────────
+	if saved.DepositRequired {
+		log.Printf("💳 [Payments] Cliente con %d inasistencias: pidiendo anticipo de $%.0f", saved.NoShows, saved.DepositAmount)
+		confirmMsg += "\n\n" + BuildDepositMessage(state.Data["servicio"], saved, backendPayload)
+	} else if HasPaymentMethods() {
 		servicio := state.Data["servicio"]
 		precio := GetServicePrice(servicio)
 		paymentMsg := BuildPaymentMessage(servicio, precio)
@@ -545,8 +651,9 @@ func isValidEmail(email string) bool {
 	return emailRegex.MatchString(strings.TrimSpace(email))
 }
 
-// generateConfirmationMessage genera el mensaje de confirmación
-func generateConfirmationMessage(data map[string]string, _ string) string {
+// generateConfirmationMessage genera el mensaje de confirmación. icsURL es el
+// enlace .ics de la cita (vacío si el backend no lo devolvió).
+func generateConfirmationMessage(data map[string]string, icsURL string) string {
 	// Intentar generar con Gemini
 	if geminiEnabled {
 		prompt := fmt.Sprintf("Genera un mensaje de confirmación de cita amigable y breve para %s. Fecha: %s (%s), Hora: %s, Servicio: %s",
@@ -557,7 +664,7 @@ func generateConfirmationMessage(data map[string]string, _ string) string {
 			data["servicio"],
 		)
 		if resp, err := Chat(prompt, "confirmar cita", ""); err == nil && resp != "" {
-			return resp
+			return withCalendarLink(resp, icsURL)
 		}
 	}
 
@@ -580,7 +687,16 @@ func generateConfirmationMessage(data map[string]string, _ string) string {
 	}
 
 	msg += "\n\n¡Te esperamos! 😊"
-	return msg
+	return withCalendarLink(msg, icsURL)
+}
+
+// withCalendarLink agrega el enlace .ics para guardar la cita en el calendario
+// del cliente (Google, Apple, Outlook)
+func withCalendarLink(message, icsURL string) string {
+	if icsURL == "" {
+		return message
+	}
+	return message + "\n\n📆 Agrégala a tu calendario: " + icsURL
 }
 
 // handleNormalConversation maneja conversaciones normales con contexto
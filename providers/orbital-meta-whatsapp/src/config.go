@@ -45,10 +45,17 @@ type Holiday struct {
 
 // Service representa un servicio ofrecido por el negocio
 type Service struct {
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
-	Duration    int     `json:"duration"` // en minutos
-	Price       float64 `json:"price"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Duration    int      `json:"duration"` // en minutos
+	Price       float64  `json:"price"`
+	ImageUrls   []string `json:"imageUrls,omitempty"`
+	InStock     *bool    `json:"inStock,omitempty"` // nil en configs anteriores = disponible
+}
+
+// IsAvailable indica si el servicio/producto se puede ofrecer
+func (s Service) IsAvailable() bool {
+	return s.InStock == nil || *s.InStock
 }
 
 // Worker representa un trabajador/empleado del negocio
@@ -98,6 +105,9 @@ type BusinessConfig struct {
 	// Ubicación
 	Location Location `json:"location"`
 
+	// Menú como archivo (PDF o imagen)
+	MenuUrl string `json:"menuUrl,omitempty"`
+
 	// Redes sociales
 	SocialMedia SocialMedia `json:"socialMedia"`
 
@@ -110,9 +110,39 @@ func Chat(promptContext, userMessage, conversationHistory string) (string, error
 	// Obtener el prompt del sistema desde la configuración del negocio
 	systemPrompt := GetSystemPrompt()
 
+	// ── Construir reglas de media (fotos y menú) ─────────────────────────────
+	mediaCatalog := ""
+	if BusinessCfg != nil {
+		// Fotos de servicios/productos
+		photosSection := ""
+		for _, svc := range BusinessCfg.Services {
+			if len(svc.ImageUrls) > 0 {
+				photosSection += fmt.Sprintf("  - %s\n", svc.Title)
+			}
+		}
+		if photosSection != "" {
+			mediaCatalog += "\nSERVICIOS/PRODUCTOS CON FOTOS DISPONIBLES:\n" + photosSection
+			mediaCatalog += "\n⚠️ REGLA ABSOLUTA DE FOTOS (NO IGNORAR): Si el cliente pide ver fotos, imágenes o cómo se ve alguno de los productos/servicios de la lista anterior, tu ÚNICA respuesta permitida es exactamente:\nSEND_PHOTOS:TituloExactoDelServicio\nDonde TituloExactoDelServicio es el título tal como aparece en la lista. NO agregues explicación, emojis ni texto adicional antes o después.\n"
+		}
+
+		// Menú como archivo (PDF o imagen)
+		if BusinessCfg.MenuUrl != "" {
+			mediaCatalog += `
+⚠️ REGLA ABSOLUTA DE MENÚ (OBLIGATORIA, NO IGNORAR):
+Este negocio tiene un menú en imagen/PDF disponible.
+Si el cliente pide VER el menú, la carta, fotos del menú, el PDF, o dice frases como:
+"puedo ver el menú", "mándame el menú", "foto del menú", "tienen menú en foto",
+"menú foto", "foto", "imagen del menú", o cualquier variación similar,
+tu ÚNICA respuesta permitida es exactamente esta palabra, sin nada más:
+SEND_MENU
+NO listes productos. NO expliques. NO agregues texto antes ni después. Solo escribe: SEND_MENU
+`
+		}
+	}
+
 	// Construir prompt completo
 	fullPrompt := fmt.Sprintf(`%s
-
+%s
 HISTORIAL DE CONVERSACIÓN:
 %s
 
@@ -128,6 +158,7 @@ INSTRUCCIONES:
 
 RESPUESTA:`,
 		systemPrompt,
+		mediaCatalog,
 		conversationHistory,
 		promptContext,
 		userMessage)
@@ -427,6 +458,68 @@ RESPONDE SOLO CON EL MENSAJE, SIN EXPLICACIONES.`,
 	return defaultMsg
 }
 
+// TranscribeAudio transcribe una nota de voz del cliente a texto
+func TranscribeAudio(data []byte, mimeType string) (string, error) {
+	prompt := `Transcribe literalmente esta nota de voz en español.
+Responde SOLO con la transcripción, sin comillas ni comentarios.
+Si no se entiende nada, responde exactamente: [inaudible]`
+
+	text, err := generateFromMedia(prompt, data, mimeType)
+	if err != nil {
+		return "", err
+	}
+	if text == "[inaudible]" {
+		return "", fmt.Errorf("audio inaudible")
+	}
+	return text, nil
+}
+
+// DescribeImage resume el contenido de una imagen enviada por el cliente.
+// Si es un comprobante de pago extrae monto, banco, fecha y referencia.
+func DescribeImage(data []byte, mimeType string) (string, error) {
+	prompt := `Describe brevemente esta imagen enviada por un cliente a un negocio (máximo 2 líneas).
+Si es un comprobante de pago o transferencia, responde con el formato:
+COMPROBANTE DE PAGO | Monto: ... | Banco: ... | Fecha: ... | Referencia: ...
+Responde SOLO con la descripción.`
+
+	return generateFromMedia(prompt, data, mimeType)
+}
+
+// generateFromMedia envía un prompt junto con un archivo (audio o imagen) a Gemini
+func generateFromMedia(prompt string, data []byte, mimeType string) (string, error) {
+	if !geminiEnabled || geminiModel == nil {
+		return "", fmt.Errorf("Gemini no está habilitado")
+	}
+
+	// Meta envía "audio/ogg; codecs=opus"; Gemini solo acepta el tipo base
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+
+	ctx := context.Background()
+	resp, err := geminiModel.GenerateContent(ctx, genai.Text(prompt), genai.Blob{MIMEType: mimeType, Data: data})
+	if err != nil {
+		return "", fmt.Errorf("error procesando media con Gemini: %w", err)
+	}
+
+	var answer strings.Builder
+	if resp != nil {
+		for _, cand := range resp.Candidates {
+			if cand.Content != nil {
+				for _, part := range cand.Content.Parts {
+					answer.WriteString(fmt.Sprintf("%v", part))
+				}
+			}
+		}
+	}
+
+	result := strings.TrimSpace(answer.String())
+	if result == "" {
+		return "", fmt.Errorf("Gemini no retornó contenido")
+	}
+	return result, nil
+}
+
 // CloseGemini cierra el cliente de Gemini
 func CloseGemini() {
 	if geminiClient != nil {
@@ -0,0 +1,168 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// audioNotUnderstoodReply aviso al cliente cuando no se pudo transcribir su nota de voz
+const audioNotUnderstoodReply = "🎧 No pude escuchar bien tu nota de voz. ¿Podrías escribirme tu mensaje, por favor?"
+
+// isSupportedInboundType indica si el bot sabe procesar el tipo de mensaje
+func isSupportedInboundType(messageType string) bool {
+	switch messageType {
+	case "text", "audio", "image", "document", "location", "interactive", "button":
+		return true
+	}
+	return false
+}
+
+// resolveInboundText convierte un mensaje entrante de cualquier tipo en el
+// texto que procesa ProcessMessage. Si el mensaje no se puede aprovechar,
+// retorna text vacío y en reply el aviso para el cliente (o "" para ignorarlo).
+func resolveInboundText(message *MetaInboundMessage, client *MetaClient) (text string, reply string) {
+	switch message.Type {
+	case "text":
+		return message.Text.Body, ""
+
+	case "audio":
+		if message.Audio == nil {
+			return "", ""
+		}
+		transcript, err := transcribeInboundAudio(message.Audio, client)
+		if err != nil {
+			log.Printf("⚠️  No se pudo transcribir el audio %s: %v", message.Audio.ID, err)
+			return "", audioNotUnderstoodReply
+		}
+		log.Printf("🎧 Nota de voz transcrita: %s", transcript)
+		return transcript, ""
+
+	case "image":
+		if message.Image == nil {
+			return "", ""
+		}
+		return describeInboundImage(message.Image, client), ""
+
+	case "document":
+		if message.Document == nil {
+			return "", ""
+		}
+		doc := message.Document
+		text := fmt.Sprintf("[El cliente envió un documento: %s]", firstNonEmpty(doc.Filename, doc.MimeType, "archivo"))
+		if doc.Caption != "" {
+			text += " " + doc.Caption
+		}
+		return text, ""
+
+	case "location":
+		if message.Location == nil {
+			return "", ""
+		}
+		return handleInboundLocation(message.From, message.Location), ""
+
+	case "interactive":
+		if message.Interactive == nil {
+			return "", ""
+		}
+		switch {
+		case message.Interactive.ButtonReply != nil:
+			return message.Interactive.ButtonReply.Title, ""
+		case message.Interactive.ListReply != nil:
+			if title, ok := resolveServiceRowID(message.Interactive.ListReply.ID); ok {
+				return title, ""
+			}
+			return message.Interactive.ListReply.Title, ""
+		}
+		return "", ""
+
+	case "button":
+		// Botón de respuesta rápida de una plantilla
+		if message.Button == nil {
+			return "", ""
+		}
+		return firstNonEmpty(message.Button.Text, message.Button.Payload), ""
+	}
+
+	return "", ""
+}
+
+// transcribeInboundAudio descarga la nota de voz y la transcribe con Gemini
+func transcribeInboundAudio(audio *MetaMedia, client *MetaClient) (string, error) {
+	if !IsGeminiEnabled() {
+		return "", fmt.Errorf("Gemini no está habilitado")
+	}
+
+	data, mimeType, err := client.DownloadMedia(audio.ID)
+	if err != nil {
+		return "", err
+	}
+	if mimeType == "" {
+		mimeType = audio.MimeType
+	}
+
+	return TranscribeAudio(data, mimeType)
+}
+
+// describeInboundImage arma el texto de una imagen: la descripción de Gemini
+// (útil para comprobantes de pago) más el pie de foto, si lo hay.
+func describeInboundImage(image *MetaMedia, client *MetaClient) string {
+	text := "[El cliente envió una imagen]"
+
+	if IsGeminiEnabled() {
+		data, mimeType, err := client.DownloadMedia(image.ID)
+		if err != nil {
+			log.Printf("⚠️  No se pudo descargar la imagen %s: %v", image.ID, err)
+		} else {
+			if mimeType == "" {
+				mimeType = image.MimeType
+			}
+			if description, err := DescribeImage(data, mimeType); err != nil {
+				log.Printf("⚠️  No se pudo describir la imagen %s: %v", image.ID, err)
+			} else {
+				log.Printf("🖼️  Imagen descrita: %s", description)
+				text = fmt.Sprintf("[El cliente envió una imagen: %s]", description)
+			}
+		}
+	}
+
+	if image.Caption != "" {
+		text += " " + image.Caption
+	}
+	return text
+}
+
+// handleInboundLocation guarda la ubicación compartida como dirección de
+// entrega del cliente (mismas claves que usa el flujo de pedidos) y retorna
+// su representación en texto.
+func handleInboundLocation(phoneNumber string, loc *MetaLocation) string {
+	mapsURL := fmt.Sprintf("https://maps.google.com/?q=%.6f,%.6f", loc.Latitude, loc.Longitude)
+
+	var parts []string
+	if loc.Name != "" {
+		parts = append(parts, loc.Name)
+	}
+	if loc.Address != "" {
+		parts = append(parts, loc.Address)
+	}
+	parts = append(parts, mapsURL)
+	address := strings.Join(parts, " - ")
+
+	state := GetUserState(phoneNumber)
+	state.Data["deliveryAddress"] = address
+	state.Data["deliveryLocation"] = fmt.Sprintf("%.6f,%.6f", loc.Latitude, loc.Longitude)
+	SaveUserState(phoneNumber)
+
+	log.Printf("📍 Ubicación recibida de %s: %s", phoneNumber, address)
+	return "📍 Mi ubicación para la entrega: " + address
+}
+
+// firstNonEmpty retorna el primer string no vacío
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
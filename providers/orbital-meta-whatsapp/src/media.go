@@ -0,0 +1,201 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Marcadores que ProcessMessage/Gemini insertan en la respuesta para pedir
+// un envío enriquecido en lugar de texto (mismos que AtomicBot)
+const (
+	markerSendMenu        = "SEND_MENU"
+	markerSendPhotos      = "SEND_PHOTOS:"
+	markerSendServiceList = "SEND_SERVICE_LIST"
+)
+
+// serviceRowPrefix prefijo del ID de cada fila de la lista de servicios.
+// La fila elegida llega como list_reply y se traduce al título completo.
+const serviceRowPrefix = "svc:"
+
+// interceptRichResponse envía menú, fotos o la lista de servicios cuando la
+// respuesta trae un marcador. Retorna true si ya se respondió al cliente.
+func interceptRichResponse(client *MetaClient, to, response string) bool {
+	// ── SEND_MENU: Gemini decidió enviar el menú como archivo ───────────────
+	if strings.Contains(response, markerSendMenu) {
+		sendMenu(client, to)
+		return true
+	}
+
+	// ── SEND_PHOTOS: Gemini solicita enviar fotos de un producto ────────────
+	if idx := strings.Index(response, markerSendPhotos); idx != -1 {
+		raw := response[idx+len(markerSendPhotos):]
+		if end := strings.IndexAny(raw, "\r\n"); end != -1 {
+			raw = raw[:end]
+		}
+		sendServicePhotos(client, to, strings.TrimSpace(raw))
+		return true
+	}
+
+	// ── SEND_SERVICE_LIST: catálogo de servicios como lista interactiva ─────
+	if strings.HasPrefix(response, markerSendServiceList) {
+		body := strings.TrimSpace(strings.TrimPrefix(response, markerSendServiceList))
+		sendServiceList(client, to, body)
+		return true
+	}
+
+	return false
+}
+
+// sendMenu envía el menú del negocio (PDF o imagen) o, si no hay, en texto
+func sendMenu(client *MetaClient, to string) {
+	if BusinessCfg == nil || BusinessCfg.MenuUrl == "" {
+		if err := client.SendMessage(to, buildServicesText()); err != nil {
+			log.Printf("❌ Error enviando menú en texto: %v", err)
+		}
+		return
+	}
+
+	menuURL := BusinessCfg.MenuUrl
+	var err error
+	if strings.HasSuffix(strings.ToLower(menuURL), ".pdf") {
+		err = client.SendDocument(to, menuURL, "Menú - "+BusinessCfg.AgentName+".pdf", "")
+	} else {
+		err = client.SendImage(to, menuURL, "")
+	}
+
+	if err != nil {
+		log.Printf("❌ Error enviando menú: %v", err)
+		client.SendMessage(to, "Aquí te lo dejo: "+menuURL)
+		return
+	}
+	log.Printf("✅ Menú enviado como archivo")
+}
+
+// sendServicePhotos envía las fotos del servicio cuyo título coincida
+func sendServicePhotos(client *MetaClient, to, serviceTitle string) {
+	log.Printf("📸 Gemini solicita fotos del servicio: %s", serviceTitle)
+
+	matched := findServiceByTitle(serviceTitle)
+	if matched == nil || len(matched.ImageUrls) == 0 {
+		log.Printf("⚠️  Servicio '%s' no encontrado o sin fotos", serviceTitle)
+		client.SendMessage(to, "No encontré fotos de ese producto. ¿Puedes ser más específico?")
+		return
+	}
+
+	for _, imgURL := range matched.ImageUrls {
+		if err := client.SendImage(to, imgURL, ""); err != nil {
+			log.Printf("❌ Error enviando foto de servicio: %v", err)
+		}
+	}
+	log.Printf("✅ Fotos de '%s' enviadas (%d imágenes)", matched.Title, len(matched.ImageUrls))
+}
+
+// sendServiceList envía el catálogo de servicios como lista interactiva.
+// Si hay más de 10 servicios o la API falla, se envía en texto.
+func sendServiceList(client *MetaClient, to, body string) {
+	if body == "" {
+		body = "¿Qué servicio deseas?"
+	}
+
+	var rows []MetaListRow
+	if BusinessCfg != nil {
+		for i, svc := range BusinessCfg.Services {
+			if !svc.IsAvailable() {
+				continue
+			}
+			rows = append(rows, MetaListRow{
+				ID:          serviceRowPrefix + strconv.Itoa(i),
+				Title:       svc.Title,
+				Description: serviceRowDescription(svc),
+			})
+		}
+	}
+
+	if len(rows) > 0 && len(rows) <= maxListRows {
+		err := client.SendList(to, "", body, "Ver servicios", []MetaListSection{{Title: "Servicios", Rows: rows}})
+		if err == nil {
+			return
+		}
+		log.Printf("⚠️  Error enviando lista de servicios, usando texto: %v", err)
+	}
+
+	if err := client.SendMessage(to, body+"\n"+buildServicesText()); err != nil {
+		log.Printf("❌ Error enviando servicios en texto: %v", err)
+	}
+}
+
+// resolveServiceRowID traduce el ID de una fila de la lista de servicios al
+// título completo del servicio (la fila solo muestra 24 caracteres)
+func resolveServiceRowID(id string) (string, bool) {
+	if !strings.HasPrefix(id, serviceRowPrefix) || BusinessCfg == nil {
+		return "", false
+	}
+	i, err := strconv.Atoi(strings.TrimPrefix(id, serviceRowPrefix))
+	if err != nil || i < 0 || i >= len(BusinessCfg.Services) {
+		return "", false
+	}
+	return BusinessCfg.Services[i].Title, true
+}
+
+// serviceRowDescription precio y duración para la descripción de la fila
+func serviceRowDescription(svc Service) string {
+	var parts []string
+	if svc.Price > 0 {
+		parts = append(parts, fmt.Sprintf("$%.0f", svc.Price))
+	}
+	if svc.Duration > 0 {
+		parts = append(parts, FormatDuration(svc.Duration))
+	}
+	if len(parts) == 0 {
+		return svc.Description
+	}
+	return strings.Join(parts, " · ")
+}
+
+// buildServicesText catálogo de servicios en texto (respaldo de la lista)
+func buildServicesText() string {
+	if BusinessCfg == nil || len(BusinessCfg.Services) == 0 {
+		return "¿En qué te puedo ayudar?"
+	}
+
+	var sb strings.Builder
+	n := 0
+	for _, s := range BusinessCfg.Services {
+		if !s.IsAvailable() {
+			continue
+		}
+		n++
+		if s.Price > 0 {
+			sb.WriteString(fmt.Sprintf("\n%d. %s - $%.0f", n, s.Title, s.Price))
+		} else {
+			sb.WriteString(fmt.Sprintf("\n%d. %s", n, s.Title))
+		}
+	}
+	return sb.String()
+}
+
+// findServiceByTitle busca un servicio por título exacto o aproximado
+func findServiceByTitle(title string) *Service {
+	if BusinessCfg == nil {
+		return nil
+	}
+
+	// 1. Coincidencia exacta (case-insensitive)
+	for i := range BusinessCfg.Services {
+		if strings.EqualFold(strings.TrimSpace(BusinessCfg.Services[i].Title), title) {
+			return &BusinessCfg.Services[i]
+		}
+	}
+
+	// 2. Fuzzy: el título normalizado contiene la query o viceversa
+	queryNorm := NormalizeText(title)
+	for i := range BusinessCfg.Services {
+		titleNorm := NormalizeText(BusinessCfg.Services[i].Title)
+		if strings.Contains(titleNorm, queryNorm) || strings.Contains(queryNorm, titleNorm) {
+			return &BusinessCfg.Services[i]
+		}
+	}
+	return nil
+}
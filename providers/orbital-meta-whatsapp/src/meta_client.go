@@ -24,70 +24,210 @@ type MetaClient struct {
 
 // MetaMessage representa un mensaje de WhatsApp de Meta
 type MetaMessage struct {
-	MessagingProduct string      `json:"messaging_product"`
-	RecipientType    string      `json:"recipient_type"`
-	To               string      `json:"to"`
-	Type             string      `json:"type"`
-	Text             *MetaText   `json:"text,omitempty"`
-	Template         interface{} `json:"template,omitempty"`
+	MessagingProduct string                  `json:"messaging_product"`
+	RecipientType    string                  `json:"recipient_type"`
+	To               string                  `json:"to"`
+	Type             string                  `json:"type"`
+	Text             *MetaText               `json:"text,omitempty"`
+	Image            *MetaMediaLink          `json:"image,omitempty"`
+	Document         *MetaMediaLink          `json:"document,omitempty"`
+	Interactive      *MetaInteractiveContent `json:"interactive,omitempty"`
+	Template         *MetaTemplateContent    `json:"template,omitempty"`
 }
 
 // MetaText contenido de texto del mensaje
 type MetaText struct {
-	PreviewURL bool   `json:"preview_url"`
+	PreviewURL bool   `json:"preview_url,omitempty"`
 	Body       string `json:"body"`
 }
 
+// MetaMediaLink imagen o documento enviado por URL pública
+type MetaMediaLink struct {
+	Link     string `json:"link"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+// MetaTemplateContent plantilla aprobada (permite escribir fuera de la
+// ventana de 24h)
+type MetaTemplateContent struct {
+	Name       string                  `json:"name"`
+	Language   MetaTemplateLanguage    `json:"language"`
+	Components []MetaTemplateComponent `json:"components,omitempty"`
+}
+
+type MetaTemplateLanguage struct {
+	Code string `json:"code"`
+}
+
+type MetaTemplateComponent struct {
+	Type       string                  `json:"type"`
+	Parameters []MetaTemplateParameter `json:"parameters"`
+}
+
+type MetaTemplateParameter struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Límites de la API de mensajes interactivos
+const (
+	maxReplyButtons    = 3
+	maxButtonTitle     = 20
+	maxListRows        = 10
+	maxListTitle       = 24
+	maxListDescription = 72
+)
+
+// MetaInteractiveContent mensaje con botones (type "button") o lista (type "list")
+type MetaInteractiveContent struct {
+	Type   string                 `json:"type"`
+	Header *MetaInteractiveHeader `json:"header,omitempty"`
+	Body   MetaText               `json:"body"`
+	Action MetaInteractiveAction  `json:"action"`
+}
+
+// MetaInteractiveHeader encabezado de texto de un mensaje interactivo
+type MetaInteractiveHeader struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// MetaInteractiveAction botones o secciones del mensaje interactivo
+type MetaInteractiveAction struct {
+	Buttons  []MetaInteractiveButton `json:"buttons,omitempty"`
+	Button   string                  `json:"button,omitempty"` // texto del botón que abre la lista
+	Sections []MetaListSection       `json:"sections,omitempty"`
+}
+
+// MetaInteractiveButton botón de respuesta rápida
+type MetaInteractiveButton struct {
+	Type  string          `json:"type"`
+	Reply MetaReplyButton `json:"reply"`
+}
+
+// MetaReplyButton ID y título de un botón de respuesta
+type MetaReplyButton struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// MetaListSection sección de un mensaje de lista
+type MetaListSection struct {
+	Title string        `json:"title,omitempty"`
+	Rows  []MetaListRow `json:"rows"`
+}
+
+// MetaListRow fila seleccionable de un mensaje de lista
+type MetaListRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
 // MetaWebhookPayload estructura del webhook de Meta
 type MetaWebhookPayload struct {
 	Object string `json:"object"`
 	Entry  []struct {
 		ID      string `json:"id"`
 		Changes []struct {
-			Value struct {
-				MessagingProduct string `json:"messaging_product"`
-				Metadata         struct {
-					DisplayPhoneNumber string `json:"display_phone_number"`
-					PhoneNumberID      string `json:"phone_number_id"`
-				} `json:"metadata"`
-				Contacts []struct {
-					Profile struct {
-						Name string `json:"name"`
-					} `json:"profile"`
-					WAID string `json:"wa_id"`
-				} `json:"contacts"`
-				Messages []struct {
-					From      string `json:"from"`
-					ID        string `json:"id"`
-					Timestamp string `json:"timestamp"`
-					Type      string `json:"type"`
-					Text      struct {
-						Body string `json:"body"`
-					} `json:"text"`
-				} `json:"messages"`
-				Statuses []struct {
-					ID           string `json:"id"`
-					Status       string `json:"status"`
-					Timestamp    string `json:"timestamp"`
-					RecipientID  string `json:"recipient_id"`
-					Conversation struct {
-						ID     string `json:"id"`
-						Origin struct {
-							Type string `json:"type"`
-						} `json:"origin"`
-					} `json:"conversation"`
-					Pricing struct {
-						Billable     bool   `json:"billable"`
-						PricingModel string `json:"pricing_model"`
-						Category     string `json:"category"`
-					} `json:"pricing"`
-				} `json:"statuses"`
-			} `json:"value"`
-			Field string `json:"field"`
+			Value MetaWebhookValue `json:"value"`
+			Field string           `json:"field"`
 		} `json:"changes"`
 	} `json:"entry"`
 }
 
+// MetaWebhookValue contenido de un cambio "messages" del webhook
+type MetaWebhookValue struct {
+	MessagingProduct string `json:"messaging_product"`
+	Metadata         struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		PhoneNumberID      string `json:"phone_number_id"`
+	} `json:"metadata"`
+	Contacts []struct {
+		Profile struct {
+			Name string `json:"name"`
+		} `json:"profile"`
+		WAID string `json:"wa_id"`
+	} `json:"contacts"`
+	Messages []MetaInboundMessage `json:"messages"`
+	Statuses []MetaMessageStatus  `json:"statuses"`
+}
+
+// MetaInboundMessage mensaje entrante. Según Type solo viene poblado uno de
+// los bloques de contenido (text, audio, image, document, location,
+// interactive o button).
+type MetaInboundMessage struct {
+	From      string `json:"from"`
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Text      struct {
+		Body string `json:"body"`
+	} `json:"text"`
+	Audio       *MetaMedia       `json:"audio,omitempty"`
+	Image       *MetaMedia       `json:"image,omitempty"`
+	Document    *MetaMedia       `json:"document,omitempty"`
+	Location    *MetaLocation    `json:"location,omitempty"`
+	Interactive *MetaInteractive `json:"interactive,omitempty"`
+	Button      *struct {
+		Payload string `json:"payload"`
+		Text    string `json:"text"`
+	} `json:"button,omitempty"`
+}
+
+// MetaMedia referencia a un archivo multimedia recibido (audio, imagen, documento).
+// El contenido se descarga aparte con DownloadMedia.
+type MetaMedia struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	SHA256   string `json:"sha256"`
+	Caption  string `json:"caption,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Voice    bool   `json:"voice,omitempty"`
+}
+
+// MetaLocation ubicación compartida por el cliente
+type MetaLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+}
+
+// MetaInteractive respuesta a un mensaje con botones o lista
+type MetaInteractive struct {
+	Type        string `json:"type"` // button_reply | list_reply
+	ButtonReply *struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"button_reply,omitempty"`
+	ListReply *struct {
+		ID          string `json:"id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"list_reply,omitempty"`
+}
+
+// MetaMessageStatus actualización de estado de un mensaje enviado
+type MetaMessageStatus struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	Timestamp    string `json:"timestamp"`
+	RecipientID  string `json:"recipient_id"`
+	Conversation struct {
+		ID     string `json:"id"`
+		Origin struct {
+			Type string `json:"type"`
+		} `json:"origin"`
+	} `json:"conversation"`
+	Pricing struct {
+		Billable     bool   `json:"billable"`
+		PricingModel string `json:"pricing_model"`
+		Category     string `json:"category"`
+	} `json:"pricing"`
+}
+
 var globalMetaClient *MetaClient
 
 // NewMetaClient crea un nuevo cliente de Meta WhatsApp
@@ -163,13 +303,6 @@ func (c *MetaClient) IsConfigured() bool {
 
 // SendMessage envía un mensaje de texto a un número de WhatsApp
 func (c *MetaClient) SendMessage(to, message string) error {
-	// Verificar si el cliente está configurado
-	if !c.IsConfigured() {
-		return fmt.Errorf("cliente Meta no configurado - configura las credenciales en Integraciones")
-	}
-
-	url := fmt.Sprintf("https://graph.facebook.com/%s/%s/messages", c.APIVersion, c.PhoneNumberID)
-
 	payload := MetaMessage{
 		MessagingProduct: "whatsapp",
 		RecipientType:    "individual",
@@ -181,6 +314,162 @@ func (c *MetaClient) SendMessage(to, message string) error {
 		},
 	}
 
+	if err := c.postMessage(payload); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Mensaje enviado a %s", to)
+	return nil
+}
+
+// SendImage envía una imagen pública (URL) con un caption opcional
+func (c *MetaClient) SendImage(to, imageURL, caption string) error {
+	media := &MetaMediaLink{Link: imageURL, Caption: caption}
+	if err := c.postMessage(MetaMessage{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "image",
+		Image:            media,
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Imagen enviada a %s", to)
+	return nil
+}
+
+// SendTemplate envía una plantilla aprobada; params llena {{1}}, {{2}}, ...
+// del cuerpo en orden
+func (c *MetaClient) SendTemplate(to, name, language string, params []string) error {
+	tmpl := &MetaTemplateContent{
+		Name:     name,
+		Language: MetaTemplateLanguage{Code: language},
+	}
+	if len(params) > 0 {
+		body := MetaTemplateComponent{Type: "body"}
+		for _, p := range params {
+			body.Parameters = append(body.Parameters, MetaTemplateParameter{Type: "text", Text: p})
+		}
+		tmpl.Components = []MetaTemplateComponent{body}
+	}
+
+	if err := c.postMessage(MetaMessage{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "template",
+		Template:         tmpl,
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Plantilla '%s' enviada a %s", name, to)
+	return nil
+}
+
+// SendDocument envía un documento público (URL), p. ej. el menú en PDF
+func (c *MetaClient) SendDocument(to, fileURL, fileName, caption string) error {
+	media := &MetaMediaLink{Link: fileURL, Caption: caption, Filename: fileName}
+	if err := c.postMessage(MetaMessage{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "document",
+		Document:         media,
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Documento enviado a %s", to)
+	return nil
+}
+
+// SendButtons envía un mensaje con hasta 3 botones de respuesta rápida.
+// La respuesta del cliente llega como interactive.button_reply.
+func (c *MetaClient) SendButtons(to, body string, buttons []MetaReplyButton) error {
+	if len(buttons) == 0 || len(buttons) > maxReplyButtons {
+		return fmt.Errorf("se requieren entre 1 y %d botones", maxReplyButtons)
+	}
+
+	action := MetaInteractiveAction{}
+	for _, b := range buttons {
+		action.Buttons = append(action.Buttons, MetaInteractiveButton{
+			Type:  "reply",
+			Reply: MetaReplyButton{ID: b.ID, Title: truncateRunes(b.Title, maxButtonTitle)},
+		})
+	}
+
+	if err := c.postMessage(MetaMessage{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "interactive",
+		Interactive: &MetaInteractiveContent{
+			Type:   "button",
+			Body:   MetaText{Body: body},
+			Action: action,
+		},
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Botones enviados a %s", to)
+	return nil
+}
+
+// SendList envía un mensaje de lista (hasta 10 filas en total).
+// La respuesta del cliente llega como interactive.list_reply.
+func (c *MetaClient) SendList(to, header, body, buttonText string, sections []MetaListSection) error {
+	totalRows := 0
+	for i := range sections {
+		sections[i].Title = truncateRunes(sections[i].Title, maxListTitle)
+		for j := range sections[i].Rows {
+			row := &sections[i].Rows[j]
+			row.Title = truncateRunes(row.Title, maxListTitle)
+			row.Description = truncateRunes(row.Description, maxListDescription)
+		}
+		totalRows += len(sections[i].Rows)
+	}
+	if totalRows == 0 || totalRows > maxListRows {
+		return fmt.Errorf("la lista debe tener entre 1 y %d filas", maxListRows)
+	}
+
+	content := &MetaInteractiveContent{
+		Type: "list",
+		Body: MetaText{Body: body},
+		Action: MetaInteractiveAction{
+			Button:   truncateRunes(buttonText, maxButtonTitle),
+			Sections: sections,
+		},
+	}
+	if header != "" {
+		content.Header = &MetaInteractiveHeader{Type: "text", Text: header}
+	}
+
+	if err := c.postMessage(MetaMessage{
+		MessagingProduct: "whatsapp",
+		RecipientType:    "individual",
+		To:               to,
+		Type:             "interactive",
+		Interactive:      content,
+	}); err != nil {
+		return err
+	}
+
+	log.Printf("✅ Lista enviada a %s", to)
+	return nil
+}
+
+// postMessage envía cualquier payload al endpoint /messages
+func (c *MetaClient) postMessage(payload MetaMessage) error {
+	// Verificar si el cliente está configurado
+	if !c.IsConfigured() {
+		return fmt.Errorf("cliente Meta no configurado - configura las credenciales en Integraciones")
+	}
+
+	url := fmt.Sprintf("https://graph.facebook.com/%s/%s/messages", c.APIVersion, c.PhoneNumberID)
+
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("error marshaling payload: %w", err)
@@ -206,7 +495,9 @@ func (c *MetaClient) SendMessage(to, message string) error {
 		return fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 	}
 
-	log.Printf("✅ Mensaje enviado a %s", to)
+	msgType, text := describeOutbound(payload)
+	RecordConversationMessage(payload.To, "", directionOutbound, msgType, text)
+
 	return nil
 }
 
@@ -288,11 +579,92 @@ func (c *MetaClient) GetPhoneNumberInfo() (map[string]interface{}, error) {
 	return result, nil
 }
 
+// maxMediaSize límite de descarga de archivos multimedia (16 MB, el máximo
+// de audio/imagen que acepta WhatsApp)
+const maxMediaSize = 16 << 20
+
+// DownloadMedia descarga un archivo multimedia recibido. La Graph API primero
+// resuelve el media ID a una URL temporal que también requiere el token.
+func (c *MetaClient) DownloadMedia(mediaID string) ([]byte, string, error) {
+	if !c.IsConfigured() {
+		return nil, "", fmt.Errorf("cliente Meta no configurado")
+	}
+
+	url := fmt.Sprintf("https://graph.facebook.com/%s/%s", c.APIVersion, mediaID)
+	req, err := http.NewRequestWithContext(c.ctx, "GET", url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error sending request: %w", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var media struct {
+		URL      string `json:"url"`
+		MimeType string `json:"mime_type"`
+		FileSize int64  `json:"file_size"`
+	}
+	if err := json.Unmarshal(body, &media); err != nil {
+		return nil, "", fmt.Errorf("error parsing response: %w", err)
+	}
+	if media.URL == "" {
+		return nil, "", fmt.Errorf("la API no retornó URL para el media %s", mediaID)
+	}
+	if media.FileSize > maxMediaSize {
+		return nil, "", fmt.Errorf("archivo demasiado grande (%d bytes)", media.FileSize)
+	}
+
+	req, err = http.NewRequestWithContext(c.ctx, "GET", media.URL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+
+	resp, err = c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("error downloading media: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error descargando media (status %d)", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMediaSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading media: %w", err)
+	}
+	if len(data) > maxMediaSize {
+		return nil, "", fmt.Errorf("archivo demasiado grande")
+	}
+
+	return data, media.MimeType, nil
+}
+
 // Close cierra el cliente (por compatibilidad con AtomicBot)
 func (c *MetaClient) Close() {
 	log.Println("👋 Meta Client cerrado")
 }
 
+// truncateRunes recorta un texto a max caracteres (no bytes) para respetar
+// los límites de la API sin cortar acentos o emojis a la mitad
+func truncateRunes(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
+
 // maskSensitiveData enmascara datos sensibles para logs
 func maskSensitiveData(data string) string {
 	if len(data) <= 8 {
@@ -0,0 +1,68 @@
+package src
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+)
+
+// NotifyRequest mensaje que el backend de Attomos pide enviar a un cliente
+// (pedidos pagados en Ninda, recordatorios, cambios de estado, etc.)
+type NotifyRequest struct {
+	Phone    string          `json:"phone"`
+	Message  string          `json:"message"`
+	Template *NotifyTemplate `json:"template,omitempty"`
+}
+
+// NotifyTemplate el backend la incluye cuando la ventana de 24h del cliente
+// está cerrada y Meta no aceptaría el texto libre
+type NotifyTemplate struct {
+	Name     string   `json:"name"`
+	Language string   `json:"language"`
+	Params   []string `json:"params"`
+}
+
+// handleNotify — POST /notify
+// Autenticado con BOT_API_TOKEN (Bearer token interno).
+func handleNotify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if botToken == "" || r.Header.Get("Authorization") != "Bearer "+botToken {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req NotifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Phone == "" || req.Message == "" {
+		http.Error(w, "phone y message requeridos", http.StatusBadRequest)
+		return
+	}
+
+	client := GetClient()
+	if client == nil || !client.IsConfigured() {
+		http.Error(w, "Meta no configurado", http.StatusServiceUnavailable)
+		return
+	}
+
+	phone := cleanPhoneNumber(req.Phone)
+	var err error
+	if req.Template != nil && req.Template.Name != "" {
+		err = client.SendTemplate(phone, req.Template.Name, req.Template.Language, req.Template.Params)
+	} else {
+		err = client.SendMessage(phone, req.Message)
+	}
+	if err != nil {
+		log.Printf("❌ [Notify] Error enviando a %s: %v", phone, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("✅ [Notify] Mensaje enviado a %s", phone)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
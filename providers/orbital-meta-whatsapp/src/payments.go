@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
 // PaymentConfig configuración de pagos leída desde la API de Attomos
@@ -152,22 +153,45 @@ type stripePaymentLinkRequest struct {
 	ServiceName string  `json:"serviceName"`
 	Amount      float64 `json:"amount"` // en MXN
 	BranchID    string  `json:"branchId"`
+	// AppointmentID cita pendiente cuyo anticipo se cobra
+	AppointmentID uint `json:"appointmentId,omitempty"`
 }
 
 type stripePaymentLinkResponse struct {
-	URL   string `json:"url"`
+	DepositLink
 	Error string `json:"error"`
 }
 
+// DepositLink link de anticipo con el monto y la vigencia que fijó el backend
+type DepositLink struct {
+	URL         string  `json:"url"`
+	Amount      float64 `json:"amount"`      // en MXN, de la política de la sucursal
+	HoldMinutes int     `json:"holdMinutes"` // minutos que la cita aparta su horario
+}
+
 // CreateStripePaymentLink crea un Payment Link de Stripe vía la API de Attomos.
 // Retorna la URL del link o "" si falla.
 func CreateStripePaymentLink(serviceName string, amount float64) (string, error) {
+	link, err := requestPaymentLink(serviceName, amount, 0)
+	return link.URL, err
+}
+
+// CreateDepositPaymentLink cobra el anticipo de una cita pendiente. El
+// backend liga el pago a la cita: la confirma al pagarse y la libera si el
+// link vence sin pago o no se pudo crear.
+func CreateDepositPaymentLink(appointmentID uint, serviceName string) (DepositLink, error) {
+	return requestPaymentLink(serviceName, 0, appointmentID)
+}
+
+func requestPaymentLink(serviceName string, amount float64, appointmentID uint) (DepositLink, error) {
+	var link DepositLink
+
 	attomosURL := os.Getenv("ATTOMOS_API_URL")
 	botToken := os.Getenv("BOT_API_TOKEN")
 	branchID := os.Getenv("BRANCH_ID")
 
 	if attomosURL == "" || botToken == "" || branchID == "" {
-		return "", fmt.Errorf("variables de entorno no configuradas")
+		return link, fmt.Errorf("variables de entorno no configuradas")
 	}
 
 	if amount <= 0 {
@@ -176,20 +200,21 @@ func CreateStripePaymentLink(serviceName string, amount float64) (string, error)
 	}
 
 	payload := stripePaymentLinkRequest{
-		ServiceName: serviceName,
-		Amount:      amount,
-		BranchID:    branchID,
+		ServiceName:   serviceName,
+		Amount:        amount,
+		BranchID:      branchID,
+		AppointmentID: appointmentID,
 	}
 
 	body, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("error serializando payload: %w", err)
+		return link, fmt.Errorf("error serializando payload: %w", err)
 	}
 
 	url := fmt.Sprintf("%s/api/payment-config/stripe/payment-link", attomosURL)
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
 	if err != nil {
-		return "", fmt.Errorf("error creando request: %w", err)
+		return link, fmt.Errorf("error creando request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+botToken)
 	req.Header.Set("Content-Type", "application/json")
@@ -197,22 +222,25 @@ func CreateStripePaymentLink(serviceName string, amount float64) (string, error)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error llamando API: %w", err)
+		return link, fmt.Errorf("error llamando API: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, _ := io.ReadAll(resp.Body)
 	var linkResp stripePaymentLinkResponse
 	if err := json.Unmarshal(respBody, &linkResp); err != nil {
-		return "", fmt.Errorf("error parseando respuesta: %w", err)
+		return link, fmt.Errorf("error parseando respuesta: %w", err)
 	}
 
 	if linkResp.Error != "" {
-		return "", fmt.Errorf("error del servidor: %s", linkResp.Error)
+		return link, fmt.Errorf("error del servidor: %s", linkResp.Error)
+	}
+	if linkResp.URL == "" {
+		return link, fmt.Errorf("respuesta sin url")
 	}
 
 	log.Printf("✅ [Payments] Stripe Payment Link generado: %s", linkResp.URL)
-	return linkResp.URL, nil
+	return linkResp.DepositLink, nil
 }
 
 // GetServicePrice busca el precio de un servicio en BusinessCfg.
@@ -231,3 +259,113 @@ func GetServicePrice(serviceName string) float64 {
 	}
 	return 0
 }
+
+// BotAppointmentPayload datos de la cita para enviar al backend
+type BotAppointmentPayload struct {
+	AgentID    uint   `json:"agentId"`
+	ClientName string `json:"clientName"`
+	Phone      string `json:"phone"`
+	Service    string `json:"service"`
+	Worker     string `json:"worker"`
+	Date       string `json:"date"` // YYYY-MM-DD
+	Time       string `json:"time"` // HH:MM
+	Notes      string `json:"notes"`
+}
+
+// SavedAppointment cita registrada en el backend
+type SavedAppointment struct {
+	ID     uint   `json:"id"`
+	Worker string `json:"worker"`
+	ICSURL string `json:"icsUrl"` // enlace .ics para el calendario del cliente
+
+	// Anticipo que exige la política de inasistencias de la sucursal
+	DepositRequired bool    `json:"depositRequired"`
+	DepositAmount   float64 `json:"depositAmount"`
+	NoShows         int     `json:"noShows"`
+}
+
+// BuildDepositMessage pide el anticipo al cliente con inasistencias
+// previas. La cita queda pendiente hasta que el negocio vea el pago; si no
+// se pudo generar el link se cancela para no apartar el horario sin cobro.
+func BuildDepositMessage(servicio string, saved SavedAppointment, booked BotAppointmentPayload) string {
+	var sb strings.Builder
+	sb.WriteString("\n💳 *Anticipo requerido*\n")
+	sb.WriteString("━━━━━━━━━━━━━━━━━━━━━━\n")
+
+	link, err := CreateDepositPaymentLink(saved.ID, "Anticipo — "+servicio)
+	if err != nil {
+		log.Printf("⚠️  [Payments] Error generando link de anticipo: %v", err)
+		releaseUnpaidAppointment(booked)
+		sb.WriteString(fmt.Sprintf("Como tienes %d citas a las que no asististe, necesitamos un anticipo para apartar tu lugar, pero no pude generar el link de pago 😔\n\n", saved.NoShows))
+		sb.WriteString("Tu horario *no quedó apartado*. Escríbenos para darte los datos de pago y agendarlo de nuevo.")
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("Como tienes %d citas a las que no asististe, para apartar tu lugar te pedimos un anticipo de *$%.0f MXN*.\n\n", saved.NoShows, link.Amount))
+	sb.WriteString("👉 " + link.URL + "\n")
+	sb.WriteString("━━━━━━━━━━━━━━━━━━━━━━\n")
+	sb.WriteString(fmt.Sprintf("_Tu cita queda pendiente hasta recibir el anticipo; si no se paga en %d minutos el horario se libera_ ⏳", link.HoldMinutes))
+	return sb.String()
+}
+
+// releaseUnpaidAppointment cancela en el backend la cita pendiente cuyo link
+// de anticipo no se generó. Si el backend ya la liberó el aviso solo se registra.
+func releaseUnpaidAppointment(booked BotAppointmentPayload) {
+	start, err := time.ParseInLocation("2006-01-02 15:04", booked.Date+" "+booked.Time, time.Local)
+	if err != nil {
+		return
+	}
+	if err := CancelInBackend(booked.Phone, start); err != nil {
+		log.Printf("ℹ️  [Payments] Cita sin anticipo no cancelada en el backend: %v", err)
+	}
+}
+
+// SaveAppointmentToBackend guarda la cita en la BD de Attomos vía API REST.
+// Devuelve la cita con el trabajador asignado por el backend y
+// ErrSlotUnavailable si el horario se ocupó mientras el cliente confirmaba.
+func SaveAppointmentToBackend(payload BotAppointmentPayload) (SavedAppointment, error) {
+	var saved SavedAppointment
+
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+
+	if attomosURL == "" || botToken == "" {
+		return saved, fmt.Errorf("ATTOMOS_API_URL o BOT_API_TOKEN no configurados")
+	}
+
+	if payload.AgentID == 0 {
+		fmt.Sscanf(os.Getenv("AGENT_ID"), "%d", &payload.AgentID)
+	}
+
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return saved, fmt.Errorf("error serializando cita: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", attomosURL+"/api/bot/appointments", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return saved, fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return saved, fmt.Errorf("error llamando API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusConflict {
+		return saved, fmt.Errorf("%w: %s", ErrSlotUnavailable, string(respBody))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return saved, fmt.Errorf("API retornó %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	json.Unmarshal(respBody, &saved)
+
+	log.Printf("✅ [Backend] Cita guardada en BD: %s", string(respBody))
+	return saved, nil
+}
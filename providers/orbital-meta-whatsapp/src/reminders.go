@@ -0,0 +1,93 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// reminderReplyResponse respuesta de /api/bot/appointments/reminder-reply
+type reminderReplyResponse struct {
+	Handled    bool   `json:"handled"`
+	Action     string `json:"action"`
+	Message    string `json:"message"`
+	ClientName string `json:"clientName"`
+	Date       string `json:"date"` // YYYY-MM-DD
+	Time       string `json:"time"` // HH:MM
+	Service    string `json:"service"`
+	Worker     string `json:"worker"`
+}
+
+// HandleReminderReply procesa "confirmar" / "cancelar" como respuesta a un
+// recordatorio de cita enviado por el backend. Retorna false si el mensaje no
+// es una respuesta a un recordatorio, para seguir con el flujo normal.
+func HandleReminderReply(phone, message string) (string, bool) {
+	action := strings.Trim(strings.ToLower(strings.TrimSpace(message)), "¡!.¿? ")
+	if action != "confirmar" && action != "cancelar" {
+		return "", false
+	}
+
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if attomosURL == "" || botToken == "" {
+		return "", false
+	}
+
+	var agentID uint
+	fmt.Sscanf(os.Getenv("AGENT_ID"), "%d", &agentID)
+	if agentID == 0 {
+		return "", false
+	}
+
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"agentId": agentID,
+		"phone":   cleanPhoneNumber(phone),
+		"action":  action,
+	})
+	req, err := http.NewRequest("POST", attomosURL+"/api/bot/appointments/reminder-reply", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		log.Printf("⚠️  [Reminders] Error creando request: %v", err)
+		return "", false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("⚠️  [Reminders] Error llamando API: %v", err)
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("⚠️  [Reminders] API retornó %d: %s", resp.StatusCode, string(respBody))
+		return "", false
+	}
+
+	var result reminderReplyResponse
+	if err := json.Unmarshal(respBody, &result); err != nil || !result.Handled {
+		return "", false
+	}
+
+	log.Printf("✅ [Reminders] Respuesta '%s' aplicada a la cita del %s %s", result.Action, result.Date, result.Time)
+
+	// Liberar el espacio en Sheets si el cliente canceló
+	if result.Action == "cancelar" && IsSheetsEnabled() {
+		appointmentDate, err := time.Parse("2006-01-02 15:04", result.Date+" "+result.Time)
+		if err == nil {
+			if err := CancelAppointmentByClient(result.ClientName, phone, appointmentDate); err != nil {
+				log.Printf("⚠️  [Reminders] Error cancelando en Sheets: %v", err)
+			}
+		}
+	}
+
+	return result.Message, true
+}
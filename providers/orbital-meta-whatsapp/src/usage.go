@@ -0,0 +1,112 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// defaultQuotaExhaustedMessage respuesta cuando el plan ya no tiene mensajes.
+// Se puede personalizar con QUOTA_EXHAUSTED_MESSAGE en el .env
+const defaultQuotaExhaustedMessage = "Por el momento no podemos atenderte por este medio 🙏 Por favor intenta más tarde o comunícate directamente con el negocio."
+
+// quotaNoticeInterval evita repetir el aviso de cuota agotada al mismo cliente
+const quotaNoticeInterval = 24 * time.Hour
+
+var (
+	quotaNotices      = make(map[string]time.Time)
+	quotaNoticesMutex sync.Mutex
+)
+
+// messageUsageResponse respuesta de /api/bot/messages/usage
+type messageUsageResponse struct {
+	Allowed      bool   `json:"allowed"`
+	UsedMessages int    `json:"usedMessages"`
+	MaxMessages  int    `json:"maxMessages"`
+	Error        string `json:"error"`
+}
+
+// CheckMessageQuota consulta al backend si el plan aún tiene mensajes, sin
+// descontar ninguno. Se llama antes de procesar para no agendar ni tomar
+// pedidos sin cuota.
+func CheckMessageQuota() bool {
+	return postMessageUsage(true)
+}
+
+// ReportMessageUsage registra en el backend una respuesta ya enviada y
+// retorna false si el plan agotó su cuota de mensajes.
+func ReportMessageUsage() bool {
+	return postMessageUsage(false)
+}
+
+// postMessageUsage llama a /api/bot/messages/usage. Si el backend no está
+// configurado o no responde, se permite el envío para no dejar al cliente sin
+// atención por una falla de red.
+func postMessageUsage(checkOnly bool) bool {
+	attomosURL := os.Getenv("ATTOMOS_API_URL")
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if attomosURL == "" || botToken == "" {
+		return true
+	}
+
+	var agentID uint
+	fmt.Sscanf(os.Getenv("AGENT_ID"), "%d", &agentID)
+	if agentID == 0 {
+		return true
+	}
+
+	bodyBytes, _ := json.Marshal(map[string]interface{}{"agentId": agentID, "checkOnly": checkOnly})
+	req, err := http.NewRequest("POST", attomosURL+"/api/bot/messages/usage", bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		log.Printf("⚠️  [Usage] Error creando request: %v", err)
+		return true
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("⚠️  [Usage] Error llamando API: %v", err)
+		return true
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var usage messageUsageResponse
+	json.Unmarshal(respBody, &usage)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true
+	case http.StatusTooManyRequests, http.StatusForbidden:
+		log.Printf("🚫 [Usage] Cuota de mensajes agotada (%d/%d): %s", usage.UsedMessages, usage.MaxMessages, usage.Error)
+		return false
+	default:
+		log.Printf("⚠️  [Usage] API retornó %d: %s", resp.StatusCode, string(respBody))
+		return true
+	}
+}
+
+// QuotaExhaustedReply retorna el mensaje de cuota agotada para un cliente,
+// o "" si ya se le avisó dentro de quotaNoticeInterval.
+func QuotaExhaustedReply(userID string) string {
+	quotaNoticesMutex.Lock()
+	defer quotaNoticesMutex.Unlock()
+
+	if last, ok := quotaNotices[userID]; ok && time.Since(last) < quotaNoticeInterval {
+		return ""
+	}
+	quotaNotices[userID] = time.Now()
+
+	if msg := os.Getenv("QUOTA_EXHAUSTED_MESSAGE"); msg != "" {
+		return msg
+	}
+	return defaultQuotaExhaustedMessage
+}
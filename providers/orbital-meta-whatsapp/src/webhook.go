@@ -1,6 +1,9 @@
 package src
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -32,6 +35,9 @@ func StartWebhookServer(client *MetaClient) {
 		handleWebhook(w, r, client, verifyToken)
 	})
 
+	// Mensajes salientes solicitados por el backend de Attomos
+	http.HandleFunc("/notify", handleNotify)
+
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		// Health check mejorado que indica el estado del cliente
 		status := "waiting_credentials"
@@ -72,6 +78,7 @@ func StartWebhookServer(client *MetaClient) {
 	log.Printf("📡 Endpoint general: http://localhost:%s/webhook", port)
 	log.Printf("💚 Health check: http://localhost:%s/health", port)
 	log.Printf("📊 Status: http://localhost:%s/status", port)
+	log.Printf("📬 Notify: http://localhost:%s/notify", port)
 
 	if !client.IsConfigured() {
 		log.Println("")
@@ -181,6 +188,23 @@ func handleIncomingMessage(w http.ResponseWriter, r *http.Request, client *MetaC
 	}
 	defer r.Body.Close()
 
+	// Verificar firma HMAC de Meta (X-Hub-Signature-256)
+	// Sin META_APP_SECRET no hay forma de verificar: se rechaza todo
+	signature := r.Header.Get("X-Hub-Signature-256")
+	appSecret := os.Getenv("META_APP_SECRET")
+	if !verifyMetaSignature(body, signature, appSecret) {
+		reason := "firma inválida"
+		switch {
+		case appSecret == "":
+			reason = "META_APP_SECRET no configurado"
+		case signature == "":
+			reason = "sin firma"
+		}
+		log.Printf("🚫 Webhook rechazado para agente %s (%s) | IP: %s", agentID, reason, r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	// 🔧 CAMBIO: Verificar si el cliente tiene credenciales antes de procesar
 	if !client.IsConfigured() {
 		log.Println("")
@@ -243,62 +267,15 @@ func processWebhookPayload(payload *MetaWebhookPayload, client *MetaClient, agen
 }
 
 // processMessage procesa un mensaje individual
-func processMessage(message *struct {
-	From      string `json:"from"`
-	ID        string `json:"id"`
-	Timestamp string `json:"timestamp"`
-	Type      string `json:"type"`
-	Text      struct {
-		Body string `json:"body"`
-	} `json:"text"`
-}, value *struct {
-	MessagingProduct string `json:"messaging_product"`
-	Metadata         struct {
-		DisplayPhoneNumber string `json:"display_phone_number"`
-		PhoneNumberID      string `json:"phone_number_id"`
-	} `json:"metadata"`
-	Contacts []struct {
-		Profile struct {
-			Name string `json:"name"`
-		} `json:"profile"`
-		WAID string `json:"wa_id"`
-	} `json:"contacts"`
-	Messages []struct {
-		From      string `json:"from"`
-		ID        string `json:"id"`
-		Timestamp string `json:"timestamp"`
-		Type      string `json:"type"`
-		Text      struct {
-			Body string `json:"body"`
-		} `json:"text"`
-	} `json:"messages"`
-	Statuses []struct {
-		ID           string `json:"id"`
-		Status       string `json:"status"`
-		Timestamp    string `json:"timestamp"`
-		RecipientID  string `json:"recipient_id"`
-		Conversation struct {
-			ID     string `json:"id"`
-			Origin struct {
-				Type string `json:"type"`
-			} `json:"origin"`
-		} `json:"conversation"`
-		Pricing struct {
-			Billable     bool   `json:"billable"`
-			PricingModel string `json:"pricing_model"`
-			Category     string `json:"category"`
-		} `json:"pricing"`
-	} `json:"statuses"`
-}, client *MetaClient, agentID string) {
-
-	// Solo procesar mensajes de texto
-	if message.Type != "text" {
+func processMessage(message *MetaInboundMessage, value *MetaWebhookValue, client *MetaClient, agentID string) {
+
+	// Tipos sin contenido útil para el bot (stickers, reacciones, etc.)
+	if !isSupportedInboundType(message.Type) {
 		log.Printf("ℹ️  Mensaje de tipo '%s' ignorado", message.Type)
 		return
 	}
 
 	phoneNumber := message.From
-	messageText := message.Text.Body
 	messageID := message.ID
 
 	// Obtener nombre del contacto
@@ -313,7 +290,10 @@ func processMessage(message *struct {
 		log.Printf("   🤖 Agent ID: %s", agentID)
 	}
 	log.Printf("   👤 De: %s (%s)", senderName, phoneNumber)
-	log.Printf("   💬 Texto: %s", messageText)
+	log.Printf("   📎 Tipo: %s", message.Type)
+	if message.Type == "text" {
+		log.Printf("   💬 Texto: %s", message.Text.Body)
+	}
 	log.Printf("   🆔 Message ID: %s", messageID)
 	log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
@@ -322,9 +302,44 @@ func processMessage(message *struct {
 		log.Printf("⚠️  Error marcando mensaje como leído: %v", err)
 	}
 
+	// Cada respuesta enviada consume un mensaje de la cuota del plan.
+	// Se verifica antes de procesar para no agendar citas sin cuota.
+	if !CheckMessageQuota() {
+		if notice := QuotaExhaustedReply(phoneNumber); notice != "" {
+			if err := client.SendMessage(phoneNumber, notice); err != nil {
+				log.Printf("❌ ERROR enviando aviso de cuota: %v", err)
+			}
+		}
+		log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		return
+	}
+
+	// Audio, imagen, ubicación, botones, etc. → texto
+	messageText, reply := resolveInboundText(message, client)
+	RecordConversationMessage(phoneNumber, senderName, directionInbound, message.Type,
+		firstNonEmpty(messageText, "["+message.Type+"]"))
+	if messageText == "" {
+		if reply != "" {
+			if err := client.SendMessage(phoneNumber, reply); err != nil {
+				log.Printf("❌ ERROR enviando mensaje: %v", err)
+			} else {
+				ReportMessageUsage()
+			}
+		}
+		log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		return
+	}
+
 	// Procesar mensaje (usar la misma lógica de AtomicBot)
 	response := ProcessMessage(messageText, phoneNumber, senderName)
 
+	// Menú, fotos o lista de servicios en lugar de texto
+	if interceptRichResponse(client, phoneNumber, response) {
+		ReportMessageUsage()
+		log.Println("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+		return
+	}
+
 	// Enviar respuesta
 	if response != "" {
 		log.Printf("📤 ENVIANDO RESPUESTA a %s...", senderName)
@@ -333,6 +348,7 @@ func processMessage(message *struct {
 		} else {
 			log.Printf("✅ RESPUESTA ENVIADA correctamente")
 			log.Printf("   📝 Contenido: %s", truncateString(response, 100))
+			ReportMessageUsage()
 		}
 	} else {
 		log.Printf("⚠️  No se generó respuesta para este mensaje")
@@ -341,23 +357,7 @@ func processMessage(message *struct {
 }
 
 // processStatus procesa actualizaciones de estado de mensajes
-func processStatus(status *struct {
-	ID           string `json:"id"`
-	Status       string `json:"status"`
-	Timestamp    string `json:"timestamp"`
-	RecipientID  string `json:"recipient_id"`
-	Conversation struct {
-		ID     string `json:"id"`
-		Origin struct {
-			Type string `json:"type"`
-		} `json:"origin"`
-	} `json:"conversation"`
-	Pricing struct {
-		Billable     bool   `json:"billable"`
-		PricingModel string `json:"pricing_model"`
-		Category     string `json:"category"`
-	} `json:"pricing"`
-}) {
+func processStatus(status *MetaMessageStatus) {
 	statusMap := map[string]string{
 		"sent":      "✓ Enviado",
 		"delivered": "✓✓ Entregado",
@@ -373,6 +373,22 @@ func processStatus(status *struct {
 	log.Printf("%s Mensaje %s - Destinatario: %s", statusEmoji, status.ID[:8], status.RecipientID)
 }
 
+// verifyMetaSignature valida "sha256=" + HMAC-SHA256(body, app secret)
+func verifyMetaSignature(body []byte, signatureHeader, appSecret string) bool {
+	if appSecret == "" || !strings.HasPrefix(signatureHeader, "sha256=") {
+		return false
+	}
+
+	received, err := hex.DecodeString(strings.TrimPrefix(signatureHeader, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(received, mac.Sum(nil))
+}
+
 // truncateString trunca un string a una longitud máxima
 func truncateString(s string, maxLen int) string {
 	if len(s) <= maxLen {
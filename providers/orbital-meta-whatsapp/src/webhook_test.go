@@ -0,0 +1,40 @@
+package src
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestVerifyMetaSignature(t *testing.T) {
+	body := []byte(`{"object":"whatsapp_business_account","entry":[{"changes":[{"value":{"messages":[{"from":"5216629876543","type":"text","text":{"body":"Hola"}}]}}]}]}`)
+	sign := func(b []byte, secret string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(b)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	valid := sign(body, "secreto")
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		secret    string
+		want      bool
+	}{
+		{"firma válida", body, valid, "secreto", true},
+		{"firma inválida", body, sign(body, "otro"), "secreto", false},
+		{"sin header", body, "", "secreto", false},
+		{"body alterado", append(append([]byte{}, body...), ' '), valid, "secreto", false},
+		{"sin META_APP_SECRET se rechaza", body, sign(body, ""), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyMetaSignature(tt.body, tt.signature, tt.secret); got != tt.want {
+				t.Errorf("verifyMetaSignature() = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
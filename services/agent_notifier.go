@@ -0,0 +1,100 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"attomos/models"
+)
+
+// notifyTemplate plantilla que el OrbitalBot debe usar en lugar de texto libre
+type notifyTemplate struct {
+	Name     string   `json:"name"`
+	Language string   `json:"language"`
+	Params   []string `json:"params,omitempty"`
+}
+
+// SendWhatsAppViaAgent pide al bot del agente (AtomicBot u OrbitalBot) que
+// envíe un mensaje de WhatsApp a un cliente. Ambos bots exponen POST /notify
+// en su puerto asignado, autenticado con BOT_API_TOKEN.
+//
+// En OrbitalBot, si el cliente no escribió en las últimas 24h, Meta rechaza
+// el texto libre: se envía la plantilla aprobada asignada al propósito
+// indicado con el mensaje como parámetro {{1}}; si no hay ninguna asignada
+// se devuelve error.
+func SendWhatsAppViaAgent(agent *models.Agent, phone, message, purpose string) error {
+	botToken := os.Getenv("BOT_API_TOKEN")
+	if botToken == "" {
+		return fmt.Errorf("BOT_API_TOKEN no está configurado")
+	}
+	if agent.ServerIP == "" || agent.Port == 0 {
+		return fmt.Errorf("agente %d sin servidor asignado", agent.ID)
+	}
+	if phone == "" {
+		return fmt.Errorf("teléfono vacío")
+	}
+
+	payload := map[string]interface{}{
+		"phone":   phone,
+		"message": message,
+	}
+	if agent.IsOrbitalBot() && !IsSessionOpen(agent.ID, phone) {
+		tmpl, err := FindTemplateForPurpose(agent.ID, purpose)
+		if err != nil {
+			return fmt.Errorf("ventana de 24h cerrada y el agente %d no puede enviar: %w", agent.ID, err)
+		}
+		nt := notifyTemplate{Name: tmpl.Name, Language: tmpl.Language}
+		if tmpl.BodyParams > 0 {
+			nt.Params = []string{flattenTemplateParam(message)}
+		}
+		payload["template"] = nt
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error serializando mensaje: %w", err)
+	}
+
+	url := fmt.Sprintf("http://%s:%d/notify", agent.ServerIP, agent.Port)
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+botToken)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error comunicando con el bot: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("bot retornó %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+// flattenTemplateParam Meta no acepta saltos de línea, tabs ni más de 4
+// espacios seguidos dentro de un parámetro de plantilla
+func flattenTemplateParam(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	return truncateParam(text, 1024)
+}
+
+func truncateParam(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max-3]) + "..."
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"attomos/config"
+	"attomos/models"
+)
+
+// newIntegrationCalendarService cliente de Calendar con las credenciales
+// OAuth de la integración de Google (las mismas con que se conectó el agente)
+func newIntegrationCalendarService() *GoogleCalendarService {
+	clientID := config.GetEnv("GOOGLE_INTEGRATION_CLIENT_ID")
+	if clientID == "" {
+		clientID = config.GetEnv("GOOGLE_CLIENT_ID")
+	}
+	clientSecret := config.GetEnv("GOOGLE_INTEGRATION_CLIENT_SECRET")
+	if clientSecret == "" {
+		clientSecret = config.GetEnv("GOOGLE_CLIENT_SECRET")
+	}
+	redirectURL := config.GetEnv("GOOGLE_INTEGRATION_REDIRECT_URL")
+	if redirectURL == "" {
+		redirectURL = config.GetEnv("GOOGLE_REDIRECT_URL")
+	}
+	return &GoogleCalendarService{ClientID: clientID, ClientSecret: clientSecret, RedirectURL: redirectURL}
+}
+
+// calendarAgentFor agente con Google Calendar conectado que lleva la agenda
+// de la cita: el agente de la cita o, si no tiene, uno de su sucursal
+func calendarAgentFor(appt *models.Appointment) (*models.Agent, error) {
+	return googleAgentFor(appt, "google_calendar_id")
+}
+
+// sheetsAgentFor agente con la hoja de citas (cuadrícula "Calendario")
+func sheetsAgentFor(appt *models.Appointment) (*models.Agent, error) {
+	return googleAgentFor(appt, "google_sheet_id")
+}
+
+// googleAgentFor agente con Google conectado y el recurso (columna) configurado
+func googleAgentFor(appt *models.Appointment, column string) (*models.Agent, error) {
+	var agent models.Agent
+	query := config.DB.Where("google_connected = ? AND "+column+" <> ''", true)
+
+	switch {
+	case appt.AgentID > 0:
+		query = query.Where("id = ?", appt.AgentID)
+	case appt.BranchID > 0:
+		query = query.Where("branch_id = ?", appt.BranchID)
+	default:
+		return nil, fmt.Errorf("la cita %d no tiene agente ni sucursal", appt.ID)
+	}
+
+	if err := query.First(&agent).Error; err != nil {
+		return nil, fmt.Errorf("sin agente con Google conectado (%s)", column)
+	}
+	return &agent, nil
+}
+
+// appointmentEventData datos del evento de Calendar para una cita
+func appointmentEventData(appt *models.Appointment, clientEmail string) EventData {
+	title := appt.Service
+	if title == "" {
+		title = "Cita"
+	}
+	title += " - " + appt.GetClientFullName()
+
+	description := fmt.Sprintf("Cliente: %s", appt.GetClientFullName())
+	if appt.Worker != "" {
+		description += fmt.Sprintf("\nCon: %s", appt.Worker)
+	}
+	if appt.Notes != "" {
+		description += "\n" + appt.Notes
+	}
+
+	return EventData{
+		Title:       title,
+		Description: description,
+		StartTime:   appt.Date,
+		EndTime:     appt.EndTime(),
+		ClientEmail: clientEmail,
+		ClientPhone: appt.ClientPhone,
+	}
+}
+
+// CreateAppointmentCalendarEvent crea el evento de Google Calendar de la cita
+// y guarda su ID. Si la sucursal no tiene Calendar conectado no hace nada.
+func CreateAppointmentCalendarEvent(appt *models.Appointment, clientEmail string) error {
+	if appt.HasCalendarEvent() {
+		return nil
+	}
+
+	agent, err := calendarAgentFor(appt)
+	if err != nil {
+		log.Printf("ℹ️  [Calendar] Cita %d sin evento: %v", appt.ID, err)
+		return nil
+	}
+
+	eventID, err := newIntegrationCalendarService().CreateEvent(context.Background(),
+		agent.GoogleToken, agent.GoogleCalendarID, appointmentEventData(appt, clientEmail))
+	if err != nil {
+		return fmt.Errorf("error creando evento: %w", err)
+	}
+
+	appt.CalendarEventID = eventID
+	if err := config.DB.Model(appt).Update("calendar_event_id", eventID).Error; err != nil {
+		return fmt.Errorf("error guardando ID del evento: %w", err)
+	}
+
+	log.Printf("✅ [Calendar] Evento %s creado para la cita %d (agente %d)", eventID, appt.ID, agent.ID)
+	return nil
+}
+
+// UpdateAppointmentCalendarEvent mueve el evento ligado a la cita a su fecha,
+// servicio y trabajador actuales. Si la cita no tiene evento no hace nada:
+// los eventos que el bot creó antes de ligarse no se pueden identificar.
+func UpdateAppointmentCalendarEvent(appt *models.Appointment) error {
+	if !appt.HasCalendarEvent() {
+		log.Printf("ℹ️  [Calendar] Cita %d sin evento ligado, no se actualiza", appt.ID)
+		return nil
+	}
+
+	agent, err := calendarAgentFor(appt)
+	if err != nil {
+		return err
+	}
+
+	if err := newIntegrationCalendarService().UpdateEvent(context.Background(),
+		agent.GoogleToken, agent.GoogleCalendarID, appt.CalendarEventID, appointmentEventData(appt, "")); err != nil {
+		return fmt.Errorf("error actualizando evento: %w", err)
+	}
+
+	log.Printf("✅ [Calendar] Evento %s movido al %s (cita %d)", appt.CalendarEventID, appt.Date.Format("02/01/2006 15:04"), appt.ID)
+	return nil
+}
+
+// DeleteAppointmentCalendarEvent elimina el evento ligado a la cita. En una
+// cita de una serie elimina solo su ocurrencia del evento recurrente.
+func DeleteAppointmentCalendarEvent(appt *models.Appointment) error {
+	if !appt.HasCalendarEvent() {
+		return nil
+	}
+
+	agent, err := calendarAgentFor(appt)
+	if err != nil {
+		return err
+	}
+
+	if err := newIntegrationCalendarService().DeleteEvent(context.Background(),
+		agent.GoogleToken, agent.GoogleCalendarID, appt.CalendarEventID); err != nil {
+		return fmt.Errorf("error eliminando evento: %w", err)
+	}
+
+	log.Printf("🗑️  [Calendar] Evento %s eliminado (cita %d)", appt.CalendarEventID, appt.ID)
+	return nil
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+)
+
+// ErrSlotUnavailable el nuevo horario no está libre
+var ErrSlotUnavailable = errors.New("horario no disponible")
+
+// RescheduleChange cambios de una reprogramación
+type RescheduleChange struct {
+	Start   time.Time
+	Service string // vacío = conserva el servicio
+	Worker  string // vacío = cualquier trabajador libre
+	Force   bool   // el panel puede sobreagendar, igual que al crear citas manuales
+}
+
+// RescheduleAppointment mueve la cita a un nuevo horario (y opcionalmente otro
+// servicio o trabajador) validando la disponibilidad sin contar la propia cita.
+// Reinicia sus recordatorios para la nueva fecha. Devuelve la fecha anterior
+// para propagar el cambio con PropagateReschedule.
+func RescheduleAppointment(appt *models.Appointment, change RescheduleChange) (time.Time, error) {
+	oldDate := appt.Date
+
+	if appt.IsCancelled() || appt.IsCompleted() {
+		return oldDate, fmt.Errorf("la cita está %s y no se puede reprogramar", appt.Status)
+	}
+	if change.Start.Before(time.Now()) {
+		return oldDate, fmt.Errorf("el nuevo horario ya pasó")
+	}
+
+	service := strings.TrimSpace(change.Service)
+	if service == "" {
+		service = appt.Service
+	}
+	worker := strings.TrimSpace(change.Worker)
+
+	branch := appointmentBranch(appt)
+	duration := models.DefaultServiceDuration
+	var resources []string
+	if branch != nil {
+		unlock := LockBranch(branch.ID)
+		defer unlock()
+
+		slot, err := CheckSlot(branch, service, worker, change.Start, appt.ID)
+		switch {
+		case err == nil:
+			worker = slot.Worker
+			resources = slot.Resources
+		case !change.Force:
+			return oldDate, fmt.Errorf("%w: %v", ErrSlotUnavailable, err)
+		default:
+			resources = ServiceResources(branch, service)
+		}
+		duration = ServiceDuration(branch, service)
+	}
+
+	updates := map[string]interface{}{
+		"date":             change.Start,
+		"service":          service,
+		"worker":           worker,
+		"resources":        strings.Join(resources, ","),
+		"duration_minutes": duration,
+	}
+	if branch != nil {
+		updates["branch_id"] = branch.ID
+	}
+
+	if err := config.DB.Model(appt).Updates(updates).Error; err != nil {
+		return oldDate, fmt.Errorf("error guardando la cita: %w", err)
+	}
+	appt.Date = change.Start
+	appt.Service = service
+	appt.Worker = worker
+	appt.SetResources(resources)
+	appt.DurationMinutes = duration
+
+	// Los recordatorios se vuelven a programar para la nueva fecha
+	if err := config.DB.Where("appointment_id = ?", appt.ID).Delete(&models.AppointmentReminder{}).Error; err != nil {
+		log.Printf("⚠️  [Reschedule] Error reiniciando recordatorios de la cita %d: %v", appt.ID, err)
+	}
+
+	log.Printf("✅ [Reschedule] Cita %d movida del %s al %s (%s, %s)",
+		appt.ID, oldDate.Format("02/01/2006 15:04"), appt.Date.Format("02/01/2006 15:04"), service, worker)
+	return oldDate, nil
+}
+
+// PropagateReschedule lleva el cambio de horario a la cuadrícula de Sheets y
+// al evento de Google Calendar ligado a la cita. Los errores solo se registran:
+// la cita en la BD ya quedó movida.
+func PropagateReschedule(appt *models.Appointment, oldDate time.Time) {
+	if err := UpdateAppointmentCalendarEvent(appt); err != nil {
+		log.Printf("⚠️  [Reschedule] Calendar de la cita %d: %v", appt.ID, err)
+	}
+	if err := moveAppointmentInSheets(appt, oldDate); err != nil {
+		log.Printf("⚠️  [Reschedule] Sheets de la cita %d: %v", appt.ID, err)
+	}
+}
+
+// moveAppointmentInSheets libera la celda anterior y escribe la nueva
+func moveAppointmentInSheets(appt *models.Appointment, oldDate time.Time) error {
+	agent, err := sheetsAgentFor(appt)
+	if err != nil {
+		log.Printf("ℹ️  [Sheets] Cita %d sin hoja: %v", appt.ID, err)
+		return nil
+	}
+
+	ctx := context.Background()
+	svc := newIntegrationSheetsService()
+
+	match := appt.ClientPhone
+	if match == "" {
+		match = appt.GetClientFullName()
+	}
+	if err := svc.ClearAppointmentCell(ctx, agent.GoogleToken, agent.GoogleSheetID, oldDate, match); err != nil {
+		return fmt.Errorf("error liberando celda anterior: %w", err)
+	}
+
+	// La cita ahora vive en otra celda: el worker de sincronización no debe
+	// tomar la celda nueva como cita nueva ni la anterior como borrada
+	return writeAppointmentToSheets(agent, appt)
+}
+
+// addAppointmentToSheets escribe en la hoja una cita creada por el backend
+// (p. ej. desde la lista de espera) y la liga a su celda
+func addAppointmentToSheets(appt *models.Appointment) error {
+	agent, err := sheetsAgentFor(appt)
+	if err != nil {
+		log.Printf("ℹ️  [Sheets] Cita %d sin hoja: %v", appt.ID, err)
+		return nil
+	}
+	return writeAppointmentToSheets(agent, appt)
+}
+
+// writeAppointmentToSheets escribe la cita en su celda de la cuadrícula y
+// guarda la celda en la cita
+func writeAppointmentToSheets(agent *models.Agent, appt *models.Appointment) error {
+	if err := newIntegrationSheetsService().AddAppointment(context.Background(), agent.GoogleToken, agent.GoogleSheetID, AppointmentData{
+		Date:        appt.Date.Format("2006-01-02"),
+		StartTime:   appt.Date.Format("15:04"),
+		ClientName:  appt.GetClientFullName(),
+		ClientPhone: appt.ClientPhone,
+		Description: appt.Service,
+		WorkerName:  appt.Worker,
+	}); err != nil {
+		return err
+	}
+
+	cell, _ := CalendarGridCell(appt.Date)
+	now := time.Now()
+	appt.SheetRowID = fmt.Sprintf("agent_%d_%s", agent.ID, cell)
+	appt.LastSyncedAt = &now
+	return config.DB.Model(appt).Updates(map[string]interface{}{
+		"sheet_row_id":   appt.SheetRowID,
+		"sheet_id":       agent.GoogleSheetID,
+		"last_synced_at": now,
+	}).Error
+}
+
+// appointmentBranch sucursal de la cita (o la del agente en citas anteriores a BranchID)
+func appointmentBranch(appt *models.Appointment) *models.MyBusinessInfo {
+	if appt.BranchID > 0 {
+		var branch models.MyBusinessInfo
+		if config.DB.First(&branch, appt.BranchID).Error == nil {
+			return &branch
+		}
+	}
+	if appt.AgentID > 0 {
+		return BranchForAgent(appt.AgentID)
+	}
+	return nil
+}
+
+// newIntegrationSheetsService cliente de Sheets con las credenciales OAuth de
+// la integración de Google
+func newIntegrationSheetsService() *GoogleSheetsService {
+	cal := newIntegrationCalendarService()
+	return &GoogleSheetsService{ClientID: cal.ClientID, ClientSecret: cal.ClientSecret, RedirectURL: cal.RedirectURL}
+}
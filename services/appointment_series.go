@@ -0,0 +1,605 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+)
+
+const (
+	// seriesInterval cada cuánto se extienden las series activas
+	seriesInterval = 6 * time.Hour
+
+	// seriesHorizon hasta dónde se agendan por adelantado las ocurrencias:
+	// las series sin fin se van extendiendo con el scheduler
+	seriesHorizon = 90 * 24 * time.Hour
+)
+
+// activeAppointmentStatuses citas que siguen ocupando su horario
+var activeAppointmentStatuses = []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}
+
+// SeriesConflict ocurrencia que quedó empalmada con otra cita
+type SeriesConflict struct {
+	Date   time.Time
+	Reason string
+}
+
+// SeriesResult citas que se agendaron al crear o extender una serie
+type SeriesResult struct {
+	Created   []models.Appointment
+	Holidays  []time.Time      // Ocurrencias que cayeron en día festivo (no se agendan)
+	Conflicts []SeriesConflict // Se agendaron aunque el horario estaba ocupado
+}
+
+// StartSeriesScheduler extiende las series activas hasta seriesHorizon y
+// lleva las nuevas ocurrencias al evento recurrente de Google Calendar.
+// Bloquea: llamarlo con `go`.
+func StartSeriesScheduler() {
+	log.Printf("🔁 [Series] Scheduler iniciado | Intervalo: %v | Horizonte: %v", seriesInterval, seriesHorizon)
+
+	ticker := time.NewTicker(seriesInterval)
+	defer ticker.Stop()
+
+	for {
+		extendSeries()
+		<-ticker.C
+	}
+}
+
+func extendSeries() {
+	var series []models.AppointmentSeries
+	if err := config.DB.Where("status = ?", models.SeriesStatusActive).Find(&series).Error; err != nil {
+		log.Printf("❌ [Series] Error consultando series: %v", err)
+		return
+	}
+
+	for i := range series {
+		s := &series[i]
+		result, err := generateOccurrences(s)
+		if err != nil {
+			log.Printf("⚠️  [Series] No se pudo extender la serie %d: %v", s.ID, err)
+			continue
+		}
+		if len(result.Created) == 0 && len(result.Holidays) == 0 {
+			continue
+		}
+
+		log.Printf("🔁 [Series] Serie %d extendida: %d cita(s), %d festivo(s) saltados",
+			s.ID, len(result.Created), len(result.Holidays))
+		if err := SyncSeriesCalendar(s); err != nil {
+			log.Printf("⚠️  [Series] Calendar de la serie %d: %v", s.ID, err)
+		}
+	}
+}
+
+// ============================================
+// ALTA
+// ============================================
+
+// CreateSeries valida la regla, guarda la serie y agenda sus ocurrencias
+// hasta seriesHorizon. Como las citas manuales, no se bloquea por
+// disponibilidad: los empalmes se reportan en el resultado.
+func CreateSeries(series *models.AppointmentSeries) (*SeriesResult, error) {
+	if err := validateSeriesRule(series); err != nil {
+		return nil, err
+	}
+	if series.StartDate.Before(time.Now()) {
+		return nil, fmt.Errorf("la primera cita ya pasó")
+	}
+
+	series.DurationMinutes = models.DefaultServiceDuration
+	if branch := BranchForAgent(series.AgentID); branch != nil {
+		series.BranchID = branch.ID
+		series.DurationMinutes = ServiceDuration(branch, series.Service)
+	}
+	series.Status = models.SeriesStatusActive
+	series.Generated = 0
+
+	if err := config.DB.Create(series).Error; err != nil {
+		return nil, fmt.Errorf("error guardando la serie: %w", err)
+	}
+
+	result, err := generateOccurrences(series)
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("✅ [Series] Serie %d creada (%s, %s): %d cita(s), %d festivo(s) saltados, %d empalme(s)",
+		series.ID, series.Frequency, series.StartDate.Format("02/01/2006 15:04"),
+		len(result.Created), len(result.Holidays), len(result.Conflicts))
+	return result, nil
+}
+
+// validateSeriesRule frecuencia soportada y COUNT/UNTIL coherentes
+func validateSeriesRule(series *models.AppointmentSeries) error {
+	if !series.Frequency.IsValid() {
+		return fmt.Errorf("frecuencia inválida, usa weekly, biweekly o monthly")
+	}
+	if series.Count < 0 {
+		return fmt.Errorf("el número de citas no puede ser negativo")
+	}
+	if series.Count > 0 && series.Until != nil {
+		return fmt.Errorf("indica el número de citas o la fecha de fin, no ambos")
+	}
+	if series.Frequency == models.RecurrenceMonthly && series.StartDate.Day() > models.MaxMonthlySeriesDay {
+		return fmt.Errorf("para repetir cada mes elige un día del 1 al %d", models.MaxMonthlySeriesDay)
+	}
+	if !series.Includes(0) {
+		return fmt.Errorf("la fecha de fin es anterior a la primera cita")
+	}
+	return nil
+}
+
+// generateOccurrences agenda las ocurrencias pendientes de la serie hasta el
+// horizonte. Los festivos de la sucursal se saltan pero cuentan para COUNT,
+// igual que un EXDATE en el evento de Calendar.
+func generateOccurrences(series *models.AppointmentSeries) (*SeriesResult, error) {
+	branch := appointmentBranch(&models.Appointment{AgentID: series.AgentID, BranchID: series.BranchID})
+	if branch != nil {
+		unlock := LockBranch(branch.ID)
+		defer unlock()
+	}
+
+	result := &SeriesResult{}
+	horizon := time.Now().Add(seriesHorizon)
+	var createErr error
+
+	for series.IsActive() {
+		n := series.Generated
+		if !series.Includes(n) {
+			series.Status = models.SeriesStatusEnded
+			break
+		}
+		start := series.Occurrence(n)
+		if start.After(horizon) {
+			break
+		}
+
+		if branch != nil && branch.Holidays.IsHoliday(start) {
+			series.Generated++
+			result.Holidays = append(result.Holidays, start)
+			continue
+		}
+
+		worker := series.Worker
+		var resources []string
+		if branch != nil {
+			slot, err := CheckSlot(branch, series.Service, series.Worker, start, 0)
+			if err == nil {
+				worker = slot.Worker
+				resources = slot.Resources
+			} else {
+				result.Conflicts = append(result.Conflicts, SeriesConflict{Date: start, Reason: err.Error()})
+				resources = ServiceResources(branch, series.Service)
+			}
+		}
+
+		appt := models.Appointment{
+			UserID:          series.UserID,
+			AgentID:         series.AgentID,
+			BranchID:        series.BranchID,
+			SeriesID:        series.ID,
+			SeriesIndex:     n,
+			DurationMinutes: series.DurationMinutes,
+			ClientFirstName: series.ClientFirstName,
+			ClientLastName:  series.ClientLastName,
+			ClientPhone:     series.ClientPhone,
+			Service:         series.Service,
+			Worker:          worker,
+			Date:            start,
+			Notes:           series.Notes,
+			Status:          models.AppointmentStatusConfirmed,
+			Source:          models.AppointmentSourceManual,
+		}
+		appt.SetResources(resources)
+		if err := config.DB.Create(&appt).Error; err != nil {
+			createErr = fmt.Errorf("error guardando la ocurrencia %d: %w", n, err)
+			break
+		}
+		series.Generated++
+		result.Created = append(result.Created, appt)
+	}
+
+	if err := config.DB.Model(series).Updates(map[string]interface{}{
+		"generated": series.Generated,
+		"status":    series.Status,
+	}).Error; err != nil {
+		return result, fmt.Errorf("error guardando la serie: %w", err)
+	}
+	return result, createErr
+}
+
+// ============================================
+// CANCELAR "ESTA Y LAS SIGUIENTES"
+// ============================================
+
+// CancelSeriesFrom cancela la ocurrencia y todas las siguientes de su serie y
+// recorta la regla para que no se generen más. Devuelve la serie y las citas
+// canceladas para propagar el cambio con PropagateSeriesCancel.
+func CancelSeriesFrom(appt *models.Appointment) (*models.AppointmentSeries, []models.Appointment, error) {
+	series, err := loadSeries(appt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var following []models.Appointment
+	config.DB.
+		Where("series_id = ? AND series_index >= ? AND status IN ?", series.ID, appt.SeriesIndex, activeAppointmentStatuses).
+		Find(&following)
+
+	ids := make([]uint, 0, len(following))
+	for i := range following {
+		ids = append(ids, following[i].ID)
+		following[i].Status = models.AppointmentStatusCancelled
+	}
+	if len(ids) > 0 {
+		if err := config.DB.Model(&models.Appointment{}).Where("id IN ?", ids).
+			Update("status", models.AppointmentStatusCancelled).Error; err != nil {
+			return nil, nil, fmt.Errorf("error cancelando las citas: %w", err)
+		}
+	}
+
+	if err := truncateSeries(series, appt.SeriesIndex); err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("🚫 [Series] Serie %d cancelada desde la ocurrencia %d: %d cita(s)", series.ID, appt.SeriesIndex, len(following))
+	return series, following, nil
+}
+
+// PropagateSeriesCancel recorta el evento recurrente de Calendar, libera las
+// celdas de Sheets y ofrece los horarios a la lista de espera. Los errores
+// solo se registran: las citas ya quedaron canceladas.
+func PropagateSeriesCancel(series *models.AppointmentSeries, cancelled []models.Appointment) {
+	if err := SyncSeriesCalendar(series); err != nil {
+		log.Printf("⚠️  [Series] Calendar de la serie %d: %v", series.ID, err)
+	}
+	for i := range cancelled {
+		if cancelled[i].SheetRowID != "" {
+			ClearAppointmentFromSheets(&cancelled[i])
+		}
+		OfferFreedSlot(&cancelled[i])
+	}
+}
+
+// ============================================
+// REPROGRAMAR "ESTA Y LAS SIGUIENTES"
+// ============================================
+
+// SeriesSplit resultado de reprogramar una ocurrencia y las siguientes: la
+// serie original se recorta y las ocurrencias pasan a una serie nueva con el
+// nuevo horario
+type SeriesSplit struct {
+	Previous  *models.AppointmentSeries
+	Series    *models.AppointmentSeries
+	Moved     []models.Appointment
+	Cancelled []models.Appointment // Con el nuevo horario cayeron en día festivo
+	Conflicts []SeriesConflict     // Se movieron aunque el horario estaba ocupado
+
+	oldDates []time.Time // Fecha anterior de cada cita de Moved
+}
+
+// RescheduleSeriesFrom mueve la ocurrencia al nuevo horario y las siguientes
+// a la misma regla a partir de ahí (los cambios hechos a una sola ocurrencia
+// se pierden, igual que en Google Calendar). La primera respeta change.Force
+// como una reprogramación normal; las demás se mueven aunque se empalmen y
+// el empalme se reporta.
+func RescheduleSeriesFrom(appt *models.Appointment, change RescheduleChange) (*SeriesSplit, error) {
+	previous, err := loadSeries(appt)
+	if err != nil {
+		return nil, err
+	}
+	index := appt.SeriesIndex
+
+	next := *previous
+	next.ID = 0
+	next.CalendarEventID = ""
+	next.CreatedAt = time.Time{}
+	next.UpdatedAt = time.Time{}
+	next.StartDate = change.Start
+	next.Status = models.SeriesStatusActive
+	if next.Count > 0 {
+		next.Count -= index
+	}
+	next.Generated -= index
+	if next.Generated < 1 {
+		next.Generated = 1
+	}
+	if err := validateSeriesRule(&next); err != nil {
+		return nil, err
+	}
+
+	var following []models.Appointment
+	config.DB.
+		Where("series_id = ? AND series_index > ? AND status IN ?", previous.ID, index, activeAppointmentStatuses).
+		Order("series_index ASC").
+		Find(&following)
+
+	oldDate, err := RescheduleAppointment(appt, change)
+	if err != nil {
+		return nil, err
+	}
+
+	next.Service = appt.Service
+	next.Worker = change.Worker
+	next.DurationMinutes = appt.DurationMinutes
+	if err := config.DB.Create(&next).Error; err != nil {
+		return nil, fmt.Errorf("error guardando la serie: %w", err)
+	}
+	if err := attachToSeries(appt, next.ID, 0); err != nil {
+		return nil, err
+	}
+
+	split := &SeriesSplit{
+		Previous: previous,
+		Series:   &next,
+		Moved:    []models.Appointment{*appt},
+		oldDates: []time.Time{oldDate},
+	}
+
+	branch := appointmentBranch(appt)
+	for i := range following {
+		occ := &following[i]
+		k := occ.SeriesIndex - index
+		if err := attachToSeries(occ, next.ID, k); err != nil {
+			log.Printf("⚠️  [Series] %v", err)
+			continue
+		}
+
+		start := next.Occurrence(k)
+		if branch != nil && branch.Holidays.IsHoliday(start) {
+			if err := config.DB.Model(occ).Update("status", models.AppointmentStatusCancelled).Error; err == nil {
+				occ.Status = models.AppointmentStatusCancelled
+				split.Cancelled = append(split.Cancelled, *occ)
+			}
+			continue
+		}
+
+		occChange := RescheduleChange{Start: start, Service: change.Service, Worker: change.Worker}
+		prev, err := RescheduleAppointment(occ, occChange)
+		if errors.Is(err, ErrSlotUnavailable) {
+			split.Conflicts = append(split.Conflicts, SeriesConflict{Date: start, Reason: err.Error()})
+			occChange.Force = true
+			prev, err = RescheduleAppointment(occ, occChange)
+		}
+		if err != nil {
+			log.Printf("⚠️  [Series] Ocurrencia %d (cita %d) no se pudo mover: %v", k, occ.ID, err)
+			continue
+		}
+		split.Moved = append(split.Moved, *occ)
+		split.oldDates = append(split.oldDates, prev)
+	}
+
+	if err := truncateSeries(previous, index); err != nil {
+		return split, err
+	}
+
+	log.Printf("✅ [Series] Serie %d dividida en la ocurrencia %d → serie %d (%d cita(s), %d empalme(s))",
+		previous.ID, index, next.ID, len(split.Moved), len(split.Conflicts))
+	return split, nil
+}
+
+// PropagateSeriesSplit recorta el evento recurrente anterior, crea el de la
+// serie nueva y mueve las celdas de Sheets. Los errores solo se registran.
+func PropagateSeriesSplit(split *SeriesSplit) {
+	if err := SyncSeriesCalendar(split.Previous); err != nil {
+		log.Printf("⚠️  [Series] Calendar de la serie %d: %v", split.Previous.ID, err)
+	}
+	for i := range split.Moved {
+		if split.Moved[i].SheetRowID == "" {
+			continue
+		}
+		if err := moveAppointmentInSheets(&split.Moved[i], split.oldDates[i]); err != nil {
+			log.Printf("⚠️  [Series] Sheets de la cita %d: %v", split.Moved[i].ID, err)
+		}
+	}
+	for i := range split.Cancelled {
+		if split.Cancelled[i].SheetRowID != "" {
+			ClearAppointmentFromSheets(&split.Cancelled[i])
+		}
+		OfferFreedSlot(&split.Cancelled[i])
+	}
+	if err := SyncSeriesCalendar(split.Series); err != nil {
+		log.Printf("⚠️  [Series] Calendar de la serie %d: %v", split.Series.ID, err)
+	}
+}
+
+// attachToSeries pasa la cita a otra serie. Se desliga de su ocurrencia en
+// Calendar para que el recorte de la serie anterior no la cancele.
+func attachToSeries(appt *models.Appointment, seriesID uint, index int) error {
+	if err := config.DB.Model(appt).Updates(map[string]interface{}{
+		"series_id":         seriesID,
+		"series_index":      index,
+		"calendar_event_id": "",
+	}).Error; err != nil {
+		return fmt.Errorf("error moviendo la cita %d a la serie %d: %w", appt.ID, seriesID, err)
+	}
+	appt.SeriesID = seriesID
+	appt.SeriesIndex = index
+	appt.CalendarEventID = ""
+	return nil
+}
+
+// truncateSeries deja la serie con sus primeras index ocurrencias. Si no le
+// queda ninguna, la serie queda cancelada.
+func truncateSeries(series *models.AppointmentSeries, index int) error {
+	series.Count = index
+	series.Until = nil
+	if series.Generated > index {
+		series.Generated = index
+	}
+	series.Status = models.SeriesStatusEnded
+	if index == 0 {
+		series.Status = models.SeriesStatusCancelled
+	}
+
+	if err := config.DB.Model(series).Updates(map[string]interface{}{
+		"count":     series.Count,
+		"until":     nil,
+		"generated": series.Generated,
+		"status":    series.Status,
+	}).Error; err != nil {
+		return fmt.Errorf("error recortando la serie: %w", err)
+	}
+	return nil
+}
+
+// loadSeries serie de la ocurrencia
+func loadSeries(appt *models.Appointment) (*models.AppointmentSeries, error) {
+	if !appt.IsRecurring() {
+		return nil, fmt.Errorf("la cita no pertenece a una serie")
+	}
+	var series models.AppointmentSeries
+	if err := config.DB.Where("id = ? AND user_id = ?", appt.SeriesID, appt.UserID).First(&series).Error; err != nil {
+		return nil, fmt.Errorf("serie no encontrada")
+	}
+	return &series, nil
+}
+
+// ============================================
+// GOOGLE CALENDAR
+// ============================================
+
+// SyncSeriesCalendar lleva la serie a Google Calendar como un evento
+// recurrente: crea el maestro (o actualiza su RRULE/EXDATE) y liga cada cita
+// con su ocurrencia. Una serie cancelada elimina el maestro. Si la sucursal
+// no tiene Calendar conectado no hace nada.
+func SyncSeriesCalendar(series *models.AppointmentSeries) error {
+	agent, err := calendarAgentFor(&models.Appointment{AgentID: series.AgentID, BranchID: series.BranchID})
+	if err != nil {
+		log.Printf("ℹ️  [Series] Serie %d sin evento: %v", series.ID, err)
+		return nil
+	}
+
+	ctx := context.Background()
+	svc := newIntegrationCalendarService()
+
+	if series.Status == models.SeriesStatusCancelled {
+		if series.CalendarEventID == "" {
+			return nil
+		}
+		if err := svc.DeleteEvent(ctx, agent.GoogleToken, agent.GoogleCalendarID, series.CalendarEventID); err != nil {
+			return fmt.Errorf("error eliminando evento recurrente: %w", err)
+		}
+		series.CalendarEventID = ""
+		return config.DB.Model(series).Update("calendar_event_id", "").Error
+	}
+
+	var appointments []models.Appointment
+	config.DB.Where("series_id = ?", series.ID).Order("series_index ASC").Find(&appointments)
+	recurrence := seriesRecurrence(series, appointments)
+
+	if series.CalendarEventID == "" {
+		first := models.Appointment{
+			ClientFirstName: series.ClientFirstName,
+			ClientLastName:  series.ClientLastName,
+			ClientPhone:     series.ClientPhone,
+			Service:         series.Service,
+			Worker:          series.Worker,
+			Notes:           series.Notes,
+			Date:            series.StartDate,
+			DurationMinutes: series.DurationMinutes,
+		}
+		data := appointmentEventData(&first, "")
+		data.Recurrence = recurrence
+
+		eventID, err := svc.CreateEvent(ctx, agent.GoogleToken, agent.GoogleCalendarID, data)
+		if err != nil {
+			return fmt.Errorf("error creando evento recurrente: %w", err)
+		}
+		series.CalendarEventID = eventID
+		if err := config.DB.Model(series).Update("calendar_event_id", eventID).Error; err != nil {
+			return fmt.Errorf("error guardando ID del evento: %w", err)
+		}
+		log.Printf("✅ [Series] Evento recurrente %s creado para la serie %d (%s)", eventID, series.ID, series.RRule())
+	} else if err := svc.SetEventRecurrence(ctx, agent.GoogleToken, agent.GoogleCalendarID, series.CalendarEventID, recurrence); err != nil {
+		return err
+	}
+
+	return linkSeriesInstances(ctx, svc, agent, series, appointments)
+}
+
+// seriesRecurrence RRULE de la serie y un EXDATE por cada ocurrencia ya
+// generada que no tiene cita activa (festivos, canceladas o eliminadas)
+func seriesRecurrence(series *models.AppointmentSeries, appointments []models.Appointment) []string {
+	booked := make(map[int]bool, len(appointments))
+	for i := range appointments {
+		if !appointments[i].IsCancelled() {
+			booked[appointments[i].SeriesIndex] = true
+		}
+	}
+
+	recurrence := []string{"RRULE:" + series.RRule()}
+	for n := 0; n < series.Generated; n++ {
+		if !booked[n] {
+			recurrence = append(recurrence, "EXDATE:"+series.Occurrence(n).UTC().Format("20060102T150405Z"))
+		}
+	}
+	return recurrence
+}
+
+// linkSeriesInstances liga cada cita activa sin evento a la ocurrencia del
+// evento recurrente que empieza a la hora de la regla. Si la cita se movió
+// de esa hora, mueve también la ocurrencia.
+func linkSeriesInstances(ctx context.Context, svc *GoogleCalendarService, agent *models.Agent, series *models.AppointmentSeries, appointments []models.Appointment) error {
+	pending := 0
+	for i := range appointments {
+		if !appointments[i].HasCalendarEvent() && !appointments[i].IsCancelled() {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return nil
+	}
+
+	from := series.StartDate.AddDate(0, 0, -1)
+	to := series.Occurrence(series.Generated).AddDate(0, 0, 1)
+	instances, err := svc.ListEventInstances(ctx, agent.GoogleToken, agent.GoogleCalendarID, series.CalendarEventID, from, to)
+	if err != nil {
+		return err
+	}
+
+	byStart := make(map[int64]string, len(instances))
+	for _, inst := range instances {
+		if inst.OriginalStartTime == nil || inst.OriginalStartTime.DateTime == "" {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, inst.OriginalStartTime.DateTime); err == nil {
+			byStart[t.Unix()] = inst.Id
+		}
+	}
+
+	linked := 0
+	for i := range appointments {
+		appt := &appointments[i]
+		if appt.HasCalendarEvent() || appt.IsCancelled() {
+			continue
+		}
+		ruleStart := series.Occurrence(appt.SeriesIndex)
+		eventID, ok := byStart[ruleStart.Unix()]
+		if !ok {
+			continue
+		}
+
+		appt.CalendarEventID = eventID
+		if err := config.DB.Model(appt).Update("calendar_event_id", eventID).Error; err != nil {
+			log.Printf("⚠️  [Series] Error ligando la cita %d: %v", appt.ID, err)
+			continue
+		}
+		linked++
+
+		if !appt.Date.Equal(ruleStart) || appt.Worker != series.Worker || appt.Service != series.Service {
+			if err := UpdateAppointmentCalendarEvent(appt); err != nil {
+				log.Printf("⚠️  [Series] Calendar de la cita %d: %v", appt.ID, err)
+			}
+		}
+	}
+
+	log.Printf("🔗 [Series] Serie %d: %d cita(s) ligadas a su ocurrencia en Calendar", series.ID, linked)
+	return nil
+}
@@ -85,6 +85,9 @@ type Service struct {
 	PromoDateStart  string   `json:"promoDateStart,omitempty"`
 	PromoDateEnd    string   `json:"promoDateEnd,omitempty"`
 	InStock         bool     `json:"inStock"` // true = en existencia, false = agotado
+	DurationMinutes int      `json:"durationMinutes,omitempty"`
+	// Variantes y extras con su diferencia de precio
+	Modifiers []models.ModifierGroup `json:"modifiers,omitempty"`
 }
 
 type Worker struct {
@@ -92,6 +95,7 @@ type Worker struct {
 	StartTime string   `json:"startTime"`
 	EndTime   string   `json:"endTime"`
 	Days      []string `json:"days"`
+	Services  []string `json:"services,omitempty"` // vacío = todos
 }
 
 type Location struct {
@@ -929,6 +933,8 @@ func convertBranchServices(services models.BranchServices) []Service {
 			PromoDateStart:  s.PromoDateStart,
 			PromoDateEnd:    s.PromoDateEnd,
 			InStock:         s.InStock,
+			DurationMinutes: s.Duration(),
+			Modifiers:       s.Modifiers,
 		}
 	}
 	return result
@@ -942,6 +948,7 @@ func convertBranchWorkers(workers models.BranchWorkers) []Worker {
 			StartTime: w.StartTime,
 			EndTime:   w.EndTime,
 			Days:      w.Days,
+			Services:  w.Services,
 		}
 	}
 	return result
@@ -1159,6 +1166,12 @@ WantedBy=multi-user.target`,
 		return fmt.Errorf("error habilitando servicio: %w", err)
 	}
 
+	// Abrir el puerto del agente: el backend envía notificaciones a /notify.
+	// Los endpoints de control del bot exigen el Bearer BOT_API_TOKEN.
+	if _, err := s.executeCommand(fmt.Sprintf("ufw allow %d/tcp", agent.Port)); err != nil {
+		log.Printf("   ⚠️  No se pudo abrir el puerto %d: %v", agent.Port, err)
+	}
+
 	log.Printf("   ✅ Servicio systemd creado y habilitado")
 	return nil
 }
@@ -1497,6 +1510,25 @@ func (s *AtomicBotDeployService) GetSSHClient() *ssh.Client {
 func (s *AtomicBotDeployService) UpdateBusinessConfig(agent *models.Agent, branch *models.MyBusinessInfo) error {
 	log.Printf("🔄 [Agent %d] Sincronizando business_config.json con datos de MyBusinessInfo...", agent.ID)
 
+	if err := s.WriteBusinessConfig(agent, branch); err != nil {
+		return err
+	}
+
+	// Reiniciar para que el bot tome los cambios inmediatamente
+	// (el bot tiene file-watcher pero restart garantiza consistencia)
+	if err := s.RestartBot(agent.ID); err != nil {
+		log.Printf("   ⚠️  [Agent %d] No se pudo reiniciar bot: %v (se recargará solo)", agent.ID, err)
+	} else {
+		log.Printf("   ✅ [Agent %d] Bot reiniciado con nueva configuración", agent.ID)
+	}
+
+	return nil
+}
+
+// WriteBusinessConfig escribe el business_config.json sin reiniciar el bot;
+// su watchdog lo recarga en menos de 30 segundos. Se usa para cambios
+// frecuentes como las existencias, donde un reinicio cortaría conversaciones.
+func (s *AtomicBotDeployService) WriteBusinessConfig(agent *models.Agent, branch *models.MyBusinessInfo) error {
 	businessConfig := s.generateBusinessConfig(agent, branch)
 	businessJSON, err := json.MarshalIndent(businessConfig, "", "  ")
 	if err != nil {
@@ -1517,15 +1549,6 @@ func (s *AtomicBotDeployService) UpdateBusinessConfig(agent *models.Agent, branc
 	}
 
 	log.Printf("   ✅ [Agent %d] business_config.json actualizado (%d bytes)", agent.ID, len(businessJSON))
-
-	// Reiniciar para que el bot tome los cambios inmediatamente
-	// (el bot tiene file-watcher pero restart garantiza consistencia)
-	if err := s.RestartBot(agent.ID); err != nil {
-		log.Printf("   ⚠️  [Agent %d] No se pudo reiniciar bot: %v (se recargará solo)", agent.ID, err)
-	} else {
-		log.Printf("   ✅ [Agent %d] Bot reiniciado con nueva configuración", agent.ID)
-	}
-
 	return nil
 }
 
@@ -0,0 +1,402 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+)
+
+// slotStep separación máxima entre horarios ofrecidos; servicios más cortos
+// usan su propia duración como paso.
+const slotStep = 30
+
+// AvailableSlot un horario libre y los trabajadores que pueden atenderlo
+type AvailableSlot struct {
+	Time    string   `json:"time"`              // HH:MM
+	Workers []string `json:"workers,omitempty"` // vacío si la sucursal no tiene trabajadores
+}
+
+// AvailabilityResult respuesta del motor de disponibilidad para un día
+type AvailabilityResult struct {
+	Date            string          `json:"date"` // YYYY-MM-DD
+	Service         string          `json:"service"`
+	Worker          string          `json:"worker"`
+	DurationMinutes int             `json:"durationMinutes"`
+	Closed          bool            `json:"closed"`
+	Reason          string          `json:"reason,omitempty"`
+	Slots           []AvailableSlot `json:"slots"`
+}
+
+// busyBlock intervalo ocupado por una cita existente
+type busyBlock struct {
+	start, end time.Time
+	worker     string
+	resources  []string
+}
+
+// uses indica si el bloque ocupa una unidad del recurso
+func (b busyBlock) uses(resource string) bool {
+	for _, r := range b.resources {
+		if strings.EqualFold(r, strings.TrimSpace(resource)) {
+			return true
+		}
+	}
+	return false
+}
+
+// SlotAssignment lo que se reserva para una cita: el trabajador y los
+// recursos de la sucursal (sillas, cabinas...) que ocupa el servicio
+type SlotAssignment struct {
+	Worker    string
+	Resources []string
+}
+
+// branchLocks un mutex por sucursal para que validar y guardar una cita sea
+// atómico dentro del proceso (dos clientes no toman el mismo horario)
+var branchLocks sync.Map
+
+// LockBranch bloquea las reservas de la sucursal; devuelve la función para liberarla
+func LockBranch(branchID uint) func() {
+	m, _ := branchLocks.LoadOrStore(branchID, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// BranchForAgent sucursal a la que pertenece el agente (nil si no tiene)
+func BranchForAgent(agentID uint) *models.MyBusinessInfo {
+	var agent models.Agent
+	if err := config.DB.Select("id", "branch_id").First(&agent, agentID).Error; err != nil || agent.BranchID == 0 {
+		return nil
+	}
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, agent.BranchID).Error; err != nil {
+		return nil
+	}
+	return &branch
+}
+
+// ServiceDuration duración en minutos del servicio en la sucursal
+func ServiceDuration(branch *models.MyBusinessInfo, service string) int {
+	if branch != nil {
+		if svc, ok := branch.FindService(service); ok {
+			return svc.Duration()
+		}
+	}
+	return models.DefaultServiceDuration
+}
+
+// ServiceResources nombres de los recursos que ocupa una cita del servicio
+// (para citas que se agendan sin validar disponibilidad)
+func ServiceResources(branch *models.MyBusinessInfo, service string) []string {
+	if branch == nil {
+		return nil
+	}
+	return resourceNames(branch.ResourcesFor(service))
+}
+
+// GetAvailability calcula los horarios libres de un día para un servicio y,
+// opcionalmente, un trabajador. Respeta el horario y los días festivos de la
+// sucursal, el turno, los días y los servicios de cada trabajador, los
+// recursos que ocupa el servicio y las citas ya agendadas (cada trabajador
+// atiende una cita a la vez y cada recurso admite tantas como su capacidad).
+func GetAvailability(branch *models.MyBusinessInfo, service, worker string, date time.Time) (*AvailabilityResult, error) {
+	duration := ServiceDuration(branch, service)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+
+	result := &AvailabilityResult{
+		Date:            day.Format("2006-01-02"),
+		Service:         service,
+		Worker:          worker,
+		DurationMinutes: duration,
+		Slots:           []AvailableSlot{},
+	}
+
+	if branch.Holidays.IsHoliday(day) {
+		result.Closed = true
+		result.Reason = "holiday"
+		return result, nil
+	}
+
+	sched := branch.Schedule.ForWeekday(day.Weekday())
+	openAt, okOpen := clockOn(day, sched.Start)
+	closeAt, okClose := clockOn(day, sched.End)
+	if !sched.Open || !okOpen || !okClose || !closeAt.After(openAt) {
+		result.Closed = true
+		result.Reason = "closed"
+		return result, nil
+	}
+
+	candidates, err := eligibleWorkers(branch, service, worker, day)
+	if err != nil {
+		return nil, err
+	}
+	if len(branch.Workers) > 0 && len(candidates) == 0 {
+		result.Reason = "no_workers"
+		return result, nil
+	}
+
+	busy, err := loadBusyBlocks(branch, day, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	step := slotStep
+	if duration < step {
+		step = duration
+	}
+	length := time.Duration(duration) * time.Minute
+	now := time.Now()
+	needs := branch.ResourcesFor(service)
+
+	for start := openAt; !start.Add(length).After(closeAt); start = start.Add(time.Duration(step) * time.Minute) {
+		if start.Before(now) {
+			continue
+		}
+		free := freeWorkersAt(branch, candidates, busy, start, start.Add(length), day)
+		if free == nil {
+			continue
+		}
+		if _, err := freeResourcesAt(needs, busy, start, start.Add(length)); err != nil {
+			continue
+		}
+		result.Slots = append(result.Slots, AvailableSlot{Time: start.Format("15:04"), Workers: free})
+	}
+
+	return result, nil
+}
+
+// CheckSlot valida que el horario siga libre justo antes de guardar una cita.
+// Devuelve el trabajador asignado (el solicitado o el primero libre) y los
+// recursos que ocupa el servicio. excludeID permite ignorar la propia cita al
+// reprogramar.
+func CheckSlot(branch *models.MyBusinessInfo, service, worker string, start time.Time, excludeID uint) (SlotAssignment, error) {
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+
+	if branch.Holidays.IsHoliday(day) {
+		return SlotAssignment{}, fmt.Errorf("la sucursal no abre ese día (festivo)")
+	}
+
+	sched := branch.Schedule.ForWeekday(day.Weekday())
+	openAt, okOpen := clockOn(day, sched.Start)
+	closeAt, okClose := clockOn(day, sched.End)
+	end := start.Add(time.Duration(ServiceDuration(branch, service)) * time.Minute)
+	if !sched.Open || !okOpen || !okClose || start.Before(openAt) || end.After(closeAt) {
+		return SlotAssignment{}, fmt.Errorf("el horario está fuera del horario de atención")
+	}
+
+	candidates, err := eligibleWorkers(branch, service, worker, day)
+	if err != nil {
+		return SlotAssignment{}, err
+	}
+	if len(branch.Workers) > 0 && len(candidates) == 0 {
+		return SlotAssignment{}, fmt.Errorf("ningún trabajador disponible realiza ese servicio ese día")
+	}
+
+	busy, err := loadBusyBlocks(branch, day, excludeID)
+	if err != nil {
+		return SlotAssignment{}, err
+	}
+
+	free := freeWorkersAt(branch, candidates, busy, start, end, day)
+	if free == nil {
+		return SlotAssignment{}, fmt.Errorf("el horario ya está ocupado")
+	}
+	resources, err := freeResourcesAt(branch.ResourcesFor(service), busy, start, end)
+	if err != nil {
+		return SlotAssignment{}, err
+	}
+
+	if worker == "" && len(free) > 0 {
+		worker = free[0]
+	}
+	return SlotAssignment{Worker: worker, Resources: resources}, nil
+}
+
+// eligibleWorkers trabajadores que trabajan ese día y realizan el servicio.
+// Si se pide un trabajador concreto, solo se considera a él.
+func eligibleWorkers(branch *models.MyBusinessInfo, service, worker string, day time.Time) ([]models.BranchWorker, error) {
+	weekday := strings.ToLower(day.Weekday().String())
+	var list []models.BranchWorker
+	found := false
+
+	for _, w := range branch.Workers {
+		if worker != "" && !strings.EqualFold(strings.TrimSpace(w.Name), strings.TrimSpace(worker)) {
+			continue
+		}
+		found = true
+		if w.WorksOn(weekday) && w.CanPerform(service) {
+			list = append(list, w)
+		}
+	}
+
+	if worker != "" && len(branch.Workers) > 0 && !found {
+		return nil, fmt.Errorf("el trabajador %q no existe en la sucursal", worker)
+	}
+	return list, nil
+}
+
+// loadBusyBlocks citas activas del día en la sucursal. Incluye las citas sin
+// sucursal de los agentes de la sucursal (registradas antes de BranchID).
+func loadBusyBlocks(branch *models.MyBusinessInfo, day time.Time, excludeID uint) ([]busyBlock, error) {
+	var appointments []models.Appointment
+	agentIDs := config.DB.Model(&models.Agent{}).Select("id").Where("branch_id = ?", branch.ID)
+
+	query := config.DB.
+		Where("user_id = ? AND date >= ? AND date < ?", branch.UserID, day.Add(-24*time.Hour), day.Add(24*time.Hour)).
+		Where("status NOT IN ?", []models.AppointmentStatus{models.AppointmentStatusCancelled, models.AppointmentStatusNoShow}).
+		Where("(branch_id = ? OR (branch_id = 0 AND agent_id IN (?)))", branch.ID, agentIDs)
+	if excludeID > 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+
+	if err := query.Find(&appointments).Error; err != nil {
+		return nil, fmt.Errorf("error consultando citas: %w", err)
+	}
+
+	blocks := make([]busyBlock, 0, len(appointments))
+	for i := range appointments {
+		a := &appointments[i]
+		if a.PaymentHoldExpired() {
+			continue
+		}
+		// Las citas anteriores a los recursos ocupan los que pide su servicio
+		resources := a.ResourceNames()
+		if len(resources) == 0 {
+			resources = ServiceResources(branch, a.Service)
+		}
+		blocks = append(blocks, busyBlock{start: a.Date, end: a.EndTime(), worker: strings.TrimSpace(a.Worker), resources: resources})
+	}
+	// Horarios liberados que están apartados para alguien de la lista de espera
+	blocks = append(blocks, waitlistHolds(branch, day.Add(-24*time.Hour), day.Add(24*time.Hour))...)
+	return blocks, nil
+}
+
+// freeWorkersAt trabajadores libres en [start, end). Devuelve nil si el
+// horario no tiene cupo y un slice vacío si la sucursal no tiene trabajadores
+// (en ese caso la sucursal atiende una cita a la vez, salvo que tenga
+// recursos: entonces el cupo lo ponen ellos).
+func freeWorkersAt(branch *models.MyBusinessInfo, candidates []models.BranchWorker, busy []busyBlock, start, end, day time.Time) []string {
+	overlaps := func(b busyBlock) bool { return b.start.Before(end) && b.end.After(start) }
+
+	if len(branch.Workers) == 0 {
+		if len(branch.Resources) > 0 {
+			return []string{}
+		}
+		for _, b := range busy {
+			if overlaps(b) {
+				return nil
+			}
+		}
+		return []string{}
+	}
+
+	free := []string{}
+	for _, w := range candidates {
+		shiftStart, okStart := clockOn(day, w.StartTime)
+		shiftEnd, okEnd := clockOn(day, w.EndTime)
+		if okStart && start.Before(shiftStart) || okEnd && end.After(shiftEnd) {
+			continue
+		}
+
+		taken := false
+		for _, b := range busy {
+			if overlaps(b) && strings.EqualFold(b.worker, strings.TrimSpace(w.Name)) {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			free = append(free, w.Name)
+		}
+	}
+
+	// Las citas sin trabajador asignado ocupan a cualquiera de los libres
+	for _, b := range busy {
+		if overlaps(b) && !isBranchWorker(branch, b.worker) {
+			if len(free) == 0 {
+				break
+			}
+			free = free[1:]
+		}
+	}
+
+	if len(free) == 0 {
+		return nil
+	}
+	return free
+}
+
+// freeResourcesAt verifica que cada recurso que ocupa el servicio tenga una
+// unidad libre en [start, end). Devuelve los nombres de los recursos a reservar.
+func freeResourcesAt(needs []models.BranchResource, busy []busyBlock, start, end time.Time) ([]string, error) {
+	for _, r := range needs {
+		if peakUsage(busy, r.Name, start, end) >= r.Units() {
+			return nil, fmt.Errorf("no hay %s disponible en ese horario", strings.TrimSpace(r.Name))
+		}
+	}
+	return resourceNames(needs), nil
+}
+
+// peakUsage máximo de citas que ocupan el recurso al mismo tiempo dentro de
+// [start, end). El máximo se alcanza al inicio del rango o al inicio de alguna
+// de esas citas.
+func peakUsage(busy []busyBlock, resource string, start, end time.Time) int {
+	var using []busyBlock
+	for _, b := range busy {
+		if b.start.Before(end) && b.end.After(start) && b.uses(resource) {
+			using = append(using, b)
+		}
+	}
+
+	peak := 0
+	for _, b := range using {
+		at := b.start
+		if at.Before(start) {
+			at = start
+		}
+		n := 0
+		for _, o := range using {
+			if !o.start.After(at) && o.end.After(at) {
+				n++
+			}
+		}
+		if n > peak {
+			peak = n
+		}
+	}
+	return peak
+}
+
+func resourceNames(resources []models.BranchResource) []string {
+	names := make([]string, 0, len(resources))
+	for _, r := range resources {
+		names = append(names, strings.TrimSpace(r.Name))
+	}
+	return names
+}
+
+func isBranchWorker(branch *models.MyBusinessInfo, name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, w := range branch.Workers {
+		if strings.EqualFold(strings.TrimSpace(w.Name), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// clockOn combina el día con una hora "HH:MM"
+func clockOn(day time.Time, hhmm string) (time.Time, bool) {
+	t, err := time.Parse("15:04", strings.TrimSpace(hhmm))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), true
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+
+	"github.com/google/uuid"
+	"google.golang.org/api/calendar/v3"
+)
+
+const (
+	// calendarWatchInterval cada cuánto se renuevan canales y se sincroniza
+	// por sondeo (respaldo si se pierde una notificación)
+	calendarWatchInterval = 15 * time.Minute
+	// calendarChannelTTL vida pedida a Google para cada canal (máximo 7 días)
+	calendarChannelTTL = 7 * 24 * time.Hour
+	// calendarChannelRenewBefore se abre un canal nuevo antes de que venza
+	calendarChannelRenewBefore = 24 * time.Hour
+)
+
+var (
+	// ErrUnknownCalendarChannel la notificación no corresponde a ningún canal vigente
+	ErrUnknownCalendarChannel = errors.New("canal de calendario desconocido")
+	// ErrInvalidChannelToken el token de la notificación no coincide
+	ErrInvalidChannelToken = errors.New("token de canal inválido")
+
+	calendarSyncLocks sync.Map // agentID → *sync.Mutex
+)
+
+// StartCalendarSync mantiene un canal de notificaciones push por cada
+// calendario de agente y aplica a las citas los cambios hechos directamente
+// en Google Calendar (eventos movidos o eliminados).
+// Bloquea: llamarlo con `go`.
+func StartCalendarSync() {
+	if calendarWebhookAddress() == "" {
+		log.Printf("📆 [CalendarSync] BASE_URL no es HTTPS: sin notificaciones push, sondeo cada %v", calendarWatchInterval)
+	} else {
+		log.Printf("📆 [CalendarSync] Notificaciones push en %s", calendarWebhookAddress())
+	}
+
+	ticker := time.NewTicker(calendarWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		maintainCalendarWatches()
+		<-ticker.C
+	}
+}
+
+// calendarWebhookAddress URL pública del webhook. Google solo acepta HTTPS.
+func calendarWebhookAddress() string {
+	base := strings.TrimRight(os.Getenv("BASE_URL"), "/")
+	if !strings.HasPrefix(base, "https://") {
+		return ""
+	}
+	return base + "/webhook/google/calendar"
+}
+
+// maintainCalendarWatches renueva los canales por vencer y sincroniza cada
+// calendario (la primera vez obtiene el sync token)
+func maintainCalendarWatches() {
+	var agents []models.Agent
+	if err := config.DB.
+		Where("google_connected = ? AND google_calendar_id <> ''", true).
+		Find(&agents).Error; err != nil {
+		log.Printf("❌ [CalendarSync] Error consultando agentes: %v", err)
+		return
+	}
+
+	address := calendarWebhookAddress()
+	agentIDs := make([]uint, 0, len(agents))
+
+	for i := range agents {
+		agent := &agents[i]
+		agentIDs = append(agentIDs, agent.ID)
+
+		var watch models.CalendarWatch
+		if err := config.DB.
+			Where(models.CalendarWatch{AgentID: agent.ID}).
+			Attrs(models.CalendarWatch{UserID: agent.UserID, CalendarID: agent.GoogleCalendarID}).
+			FirstOrCreate(&watch).Error; err != nil {
+			log.Printf("⚠️  [CalendarSync] Agente %d: error leyendo canal: %v", agent.ID, err)
+			continue
+		}
+
+		// El agente reconectó Google con otro calendario: empezar de cero
+		if watch.CalendarID != agent.GoogleCalendarID {
+			stopCalendarChannel(agent, &watch)
+			config.DB.Model(&watch).Updates(map[string]interface{}{
+				"calendar_id": agent.GoogleCalendarID,
+				"sync_token":  "",
+			})
+			watch.CalendarID = agent.GoogleCalendarID
+			watch.SyncToken = ""
+		}
+
+		if address != "" && watch.ChannelExpiresWithin(calendarChannelRenewBefore) {
+			if err := renewCalendarChannel(agent, &watch, address); err != nil {
+				log.Printf("⚠️  [CalendarSync] Agente %d: no se pudo abrir el canal: %v", agent.ID, err)
+			}
+		}
+
+		if err := SyncCalendarChanges(agent.ID); err != nil {
+			log.Printf("⚠️  [CalendarSync] Agente %d: %v", agent.ID, err)
+		}
+	}
+
+	// Agentes que desconectaron Google: sus canales vencen solos y las
+	// notificaciones que lleguen se descartan
+	stale := config.DB.Where("agent_id > 0")
+	if len(agentIDs) > 0 {
+		stale = stale.Where("agent_id NOT IN ?", agentIDs)
+	}
+	stale.Delete(&models.CalendarWatch{})
+}
+
+// renewCalendarChannel abre un canal nuevo y cierra el anterior
+func renewCalendarChannel(agent *models.Agent, watch *models.CalendarWatch, address string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	channelID := uuid.NewString()
+	channelToken := uuid.NewString()
+
+	channel, err := newIntegrationCalendarService().WatchEvents(ctx, agent.GoogleToken, agent.GoogleCalendarID,
+		channelID, channelToken, address, calendarChannelTTL)
+	if err != nil {
+		return err
+	}
+
+	stopCalendarChannel(agent, watch)
+
+	expiresAt := time.UnixMilli(channel.Expiration)
+	watch.ChannelID = channelID
+	watch.ChannelToken = channelToken
+	watch.ResourceID = channel.ResourceId
+	watch.ExpiresAt = &expiresAt
+
+	log.Printf("✅ [CalendarSync] Agente %d: canal %s vigente hasta %s", agent.ID, channelID, expiresAt.Format("02/01/2006 15:04"))
+	return config.DB.Model(watch).Updates(map[string]interface{}{
+		"channel_id":    channelID,
+		"channel_token": channelToken,
+		"resource_id":   channel.ResourceId,
+		"expires_at":    expiresAt,
+	}).Error
+}
+
+// stopCalendarChannel cierra el canal actual (si lo hay). Los errores se
+// ignoran: el canal vence solo y sus notificaciones se descartan.
+func stopCalendarChannel(agent *models.Agent, watch *models.CalendarWatch) {
+	if watch.ChannelID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := newIntegrationCalendarService().StopChannel(ctx, agent.GoogleToken, watch.ChannelID, watch.ResourceID); err != nil {
+		log.Printf("ℹ️  [CalendarSync] Canal %s no se pudo cerrar: %v", watch.ChannelID, err)
+	}
+}
+
+// HandleCalendarNotification procesa un aviso de Google: valida el canal y
+// sincroniza en segundo plano. resourceState "sync" es el aviso inicial del
+// canal y no trae cambios.
+func HandleCalendarNotification(channelID, channelToken, resourceState string) error {
+	var watch models.CalendarWatch
+	if channelID == "" || config.DB.Where("channel_id = ?", channelID).First(&watch).Error != nil {
+		return ErrUnknownCalendarChannel
+	}
+	if watch.ChannelToken != channelToken {
+		return ErrInvalidChannelToken
+	}
+	if resourceState == "sync" {
+		return nil
+	}
+
+	go func() {
+		if err := SyncCalendarChanges(watch.AgentID); err != nil {
+			log.Printf("⚠️  [CalendarSync] Agente %d: %v", watch.AgentID, err)
+		}
+	}()
+	return nil
+}
+
+// SyncCalendarChanges lee los eventos que cambiaron desde el último sync
+// token y los aplica a las citas ligadas por CalendarEventID
+func SyncCalendarChanges(agentID uint) error {
+	lock, _ := calendarSyncLocks.LoadOrStore(agentID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	var agent models.Agent
+	if err := config.DB.First(&agent, agentID).Error; err != nil {
+		return fmt.Errorf("agente no encontrado")
+	}
+	var watch models.CalendarWatch
+	if err := config.DB.Where("agent_id = ?", agentID).First(&watch).Error; err != nil {
+		return fmt.Errorf("el agente no tiene calendario vigilado")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	svc := newIntegrationCalendarService()
+	events, nextToken, err := svc.ListEventChanges(ctx, agent.GoogleToken, agent.GoogleCalendarID, watch.SyncToken)
+	if errors.Is(err, ErrSyncTokenExpired) {
+		log.Printf("🔄 [CalendarSync] Agente %d: sync token expirado, sincronización completa", agentID)
+		events, nextToken, err = svc.ListEventChanges(ctx, agent.GoogleToken, agent.GoogleCalendarID, "")
+	}
+	if err != nil {
+		config.DB.Model(&watch).Update("last_error", err.Error())
+		return err
+	}
+
+	applied := 0
+	for _, event := range events {
+		if applyCalendarEventChange(&agent, event) {
+			applied++
+		}
+	}
+
+	now := time.Now()
+	config.DB.Model(&watch).Updates(map[string]interface{}{
+		"sync_token":   nextToken,
+		"last_sync_at": now,
+		"last_error":   "",
+	})
+
+	if applied > 0 {
+		log.Printf("✅ [CalendarSync] Agente %d: %d cita(s) actualizadas desde Google Calendar", agentID, applied)
+	}
+	return nil
+}
+
+// applyCalendarEventChange lleva a la cita el estado del evento. Devuelve
+// true si la cita cambió.
+func applyCalendarEventChange(agent *models.Agent, event *calendar.Event) bool {
+	var appt models.Appointment
+	if err := config.DB.
+		Where("calendar_event_id = ? AND user_id = ?", event.Id, agent.UserID).
+		First(&appt).Error; err != nil {
+		return false // evento que no viene de una cita
+	}
+	if appt.IsCancelled() || appt.IsCompleted() {
+		return false
+	}
+
+	// Evento eliminado en Calendar → cita cancelada
+	if event.Status == "cancelled" {
+		if err := config.DB.Model(&appt).Update("status", models.AppointmentStatusCancelled).Error; err != nil {
+			log.Printf("⚠️  [CalendarSync] Error cancelando la cita %d: %v", appt.ID, err)
+			return false
+		}
+		appt.Status = models.AppointmentStatusCancelled
+		log.Printf("🗑️  [CalendarSync] Cita %d cancelada: su evento se eliminó de Calendar", appt.ID)
+		ClearAppointmentFromSheets(&appt)
+		OfferFreedSlot(&appt)
+		return true
+	}
+
+	if event.Start == nil || event.Start.DateTime == "" {
+		return false // pasó a ser de todo el día: no se puede mapear a un horario
+	}
+	start, err := time.Parse(time.RFC3339, event.Start.DateTime)
+	if err != nil {
+		return false
+	}
+	start = start.In(time.Local)
+
+	duration := 0
+	if event.End != nil && event.End.DateTime != "" {
+		if end, err := time.Parse(time.RFC3339, event.End.DateTime); err == nil {
+			duration = int(end.Sub(start).Minutes())
+		}
+	}
+
+	changed := false
+	if !start.Equal(appt.Date) {
+		// El dueño movió el evento: se respeta aunque se empalme con otra cita
+		oldDate, err := RescheduleAppointment(&appt, RescheduleChange{
+			Start:   start,
+			Service: appt.Service,
+			Worker:  appt.Worker,
+			Force:   true,
+		})
+		if err != nil {
+			log.Printf("⚠️  [CalendarSync] Cita %d no se pudo mover a %s: %v", appt.ID, start.Format("02/01/2006 15:04"), err)
+			return false
+		}
+		if err := moveAppointmentInSheets(&appt, oldDate); err != nil {
+			log.Printf("⚠️  [CalendarSync] Sheets de la cita %d: %v", appt.ID, err)
+		}
+		changed = true
+	}
+
+	if duration > 0 && duration != appt.DurationMinutes {
+		config.DB.Model(&appt).Update("duration_minutes", duration)
+		changed = true
+	}
+	return changed
+}
+
+// ClearAppointmentFromSheets libera la celda de una cita cancelada
+func ClearAppointmentFromSheets(appt *models.Appointment) {
+	agent, err := sheetsAgentFor(appt)
+	if err != nil {
+		return
+	}
+	match := appt.ClientPhone
+	if match == "" {
+		match = appt.GetClientFullName()
+	}
+	if err := newIntegrationSheetsService().ClearAppointmentCell(context.Background(), agent.GoogleToken, agent.GoogleSheetID, appt.Date, match); err != nil {
+		log.Printf("⚠️  [CalendarSync] Sheets de la cita %d: %v", appt.ID, err)
+	}
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"attomos/models"
+)
+
+var (
+	// ErrInvalidItemOptions las opciones elegidas no corresponden al catálogo
+	ErrInvalidItemOptions = errors.New("opciones inválidas")
+	// ErrUnknownCatalogItem el producto no está en el catálogo de la sucursal
+	ErrUnknownCatalogItem = errors.New("producto fuera del catálogo")
+)
+
+// PriceOrderItems recalcula el precio unitario de cada producto del
+// catálogo (precio base + diferencias de sus opciones) sin confiar en el
+// precio que manda el bot o el navegador. Todas las líneas deben ser del
+// catálogo: el envío lo agrega el backend después de cotizar la zona.
+func PriceOrderItems(branch *models.MyBusinessInfo, items models.OrderItems) (models.OrderItems, error) {
+	priced := make(models.OrderItems, 0, len(items))
+	for _, item := range items {
+		svc, ok := branch.FindService(item.Name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCatalogItem, item.Name)
+		}
+		p, err := PriceCatalogItem(svc, item)
+		if err != nil {
+			return nil, err
+		}
+		priced = append(priced, p)
+	}
+	return priced, nil
+}
+
+// PriceCatalogItem valida las opciones del producto contra sus grupos de
+// modificadores y devuelve la línea con el nombre del catálogo, las
+// opciones en el orden de los grupos y el precio recalculado
+func PriceCatalogItem(svc models.BranchService, item models.OrderItem) (models.OrderItem, error) {
+	// Cada opción elegida debe existir; si no trae grupo se busca en todos
+	chosen := make(map[int][]models.OrderItemOption)
+	for _, opt := range item.Options {
+		groupIdx, found := -1, models.ModifierOption{}
+		for g, group := range svc.Modifiers {
+			if opt.Group != "" && !strings.EqualFold(strings.TrimSpace(group.Name), strings.TrimSpace(opt.Group)) {
+				continue
+			}
+			if o, ok := group.FindOption(opt.Name); ok {
+				groupIdx, found = g, o
+				break
+			}
+		}
+		if groupIdx < 0 {
+			return models.OrderItem{}, fmt.Errorf("%w: %s no tiene la opción %q", ErrInvalidItemOptions, svc.Title, opt.Name)
+		}
+		chosen[groupIdx] = append(chosen[groupIdx], models.OrderItemOption{
+			Group:      svc.Modifiers[groupIdx].Name,
+			Name:       found.Name,
+			PriceDelta: found.PriceDelta,
+		})
+	}
+
+	price := svc.EffectivePrice()
+	options := make([]models.OrderItemOption, 0, len(item.Options))
+	for g, group := range svc.Modifiers {
+		picked := dedupeOptions(chosen[g])
+		if group.Required && len(picked) == 0 {
+			return models.OrderItem{}, fmt.Errorf("%w: elige %s para %s", ErrInvalidItemOptions, strings.ToLower(group.Name), svc.Title)
+		}
+		if !group.Multiple && len(picked) > 1 {
+			return models.OrderItem{}, fmt.Errorf("%w: solo se puede elegir una opción de %s en %s", ErrInvalidItemOptions, strings.ToLower(group.Name), svc.Title)
+		}
+		for _, o := range picked {
+			price += o.PriceDelta
+		}
+		options = append(options, picked...)
+	}
+
+	quantity := item.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+	return models.OrderItem{
+		Name:     svc.Title,
+		Quantity: quantity,
+		Price:    math.Max(0, math.Round(price*100)/100),
+		Notes:    item.Notes,
+		Options:  options,
+	}, nil
+}
+
+// dedupeOptions quita opciones repetidas del mismo grupo
+func dedupeOptions(options []models.OrderItemOption) []models.OrderItemOption {
+	seen := make(map[string]bool, len(options))
+	out := make([]models.OrderItemOption, 0, len(options))
+	for _, o := range options {
+		key := strings.ToLower(o.Name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, o)
+	}
+	return out
+}
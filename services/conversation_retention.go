@@ -0,0 +1,86 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+
+	"gorm.io/gorm"
+)
+
+// retentionInterval cada cuánto se depuran las conversaciones vencidas
+const retentionInterval = 6 * time.Hour
+
+// defaultRetentionDays retención para usuarios sin suscripción
+const defaultRetentionDays = 7
+
+// StartConversationRetention borra periódicamente los mensajes más antiguos
+// que la retención del plan de cada usuario, y los hilos que quedan vacíos.
+// Bloquea: llamarlo con `go`.
+func StartConversationRetention() {
+	log.Printf("🧹 [Conversations] Depuración por retención iniciada (cada %v)", retentionInterval)
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeExpiredConversations()
+		<-ticker.C
+	}
+}
+
+func purgeExpiredConversations() {
+	var userIDs []uint
+	config.DB.Model(&models.Conversation{}).Distinct("user_id").Pluck("user_id", &userIDs)
+
+	for _, userID := range userIDs {
+		days := defaultRetentionDays
+		var sub models.Subscription
+		if config.DB.Where("user_id = ?", userID).First(&sub).Error == nil {
+			days = sub.TranscriptRetentionDays()
+		}
+		cutoff := time.Now().AddDate(0, 0, -days)
+
+		// Mensajes, contadores e hilos vacíos en una sola transacción para que
+		// message_count no se desfase de los mensajes que quedan
+		var deletedMsgs, deletedConvs int64
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			convQuery := tx.Model(&models.Conversation{}).Select("id").Where("user_id = ?", userID)
+
+			msgs := tx.Where("conversation_id IN (?) AND created_at < ?", convQuery, cutoff).
+				Delete(&models.Message{})
+			if msgs.Error != nil {
+				return msgs.Error
+			}
+			deletedMsgs = msgs.RowsAffected
+
+			if deletedMsgs > 0 {
+				count := tx.Model(&models.Message{}).Select("COUNT(*)").
+					Where("conversation_id = conversations.id")
+				if err := tx.Model(&models.Conversation{}).Where("user_id = ?", userID).
+					UpdateColumn("message_count", count).Error; err != nil {
+					return err
+				}
+			}
+
+			convs := tx.Where("user_id = ? AND last_message_at < ?", userID, cutoff).
+				Delete(&models.Conversation{})
+			if convs.Error != nil {
+				return convs.Error
+			}
+			deletedConvs = convs.RowsAffected
+			return nil
+		})
+		if err != nil {
+			log.Printf("⚠️  [Conversations] Error depurando mensajes del usuario %d: %v", userID, err)
+			continue
+		}
+
+		if deletedMsgs > 0 || deletedConvs > 0 {
+			log.Printf("🧹 [Conversations] Usuario %d (retención %d días): %d mensaje(s) y %d hilo(s) eliminados",
+				userID, days, deletedMsgs, deletedConvs)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"attomos/models"
+)
+
+var (
+	// ErrOutsideDeliveryZone la dirección no cae en ninguna zona de entrega
+	ErrOutsideDeliveryZone = errors.New("la dirección está fuera de nuestras zonas de entrega")
+	// ErrBelowMinimumOrder el pedido no llega al mínimo de la zona
+	ErrBelowMinimumOrder = errors.New("el pedido no alcanza el mínimo para envío a esa zona")
+)
+
+// DeliveryAddress dirección de entrega como la capturan los bots y Ninda:
+// texto libre y, si el cliente compartió su ubicación, coordenadas
+type DeliveryAddress struct {
+	Text       string
+	PostalCode string
+	Location   *models.GeoPoint
+}
+
+// DeliveryQuote zona que cubre la dirección y lo que cuesta enviar
+type DeliveryQuote struct {
+	Zone       string  `json:"zone"`
+	Fee        float64 `json:"fee"`
+	MinOrder   float64 `json:"minOrder"`
+	ETAMinutes int     `json:"etaMinutes"`
+}
+
+// DeliveryFeeItemName nombre de la línea de envío que se agrega al pedido
+const DeliveryFeeItemName = "Envío a domicilio"
+
+var (
+	postalCodePattern = regexp.MustCompile(`\b\d{5}\b`)
+	// "19.432608,-99.133209" suelto o dentro de un link de Google Maps (?q=)
+	coordsPattern = regexp.MustCompile(`(-?\d{1,2}\.\d+)\s*,\s*(-?\d{1,3}\.\d+)`)
+)
+
+// QuoteDelivery busca la primera zona de la sucursal (en el orden en que el
+// dueño las definió) que cubre la dirección y valida el pedido mínimo.
+// Si la sucursal no tiene zonas, cualquier dirección se acepta sin costo.
+func QuoteDelivery(branch *models.MyBusinessInfo, addr DeliveryAddress, subtotal float64) (*DeliveryQuote, error) {
+	if len(branch.DeliveryZones) == 0 {
+		return &DeliveryQuote{}, nil
+	}
+
+	addr = resolveDeliveryAddress(branch, addr)
+
+	for _, zone := range branch.DeliveryZones {
+		if !zoneCovers(branch, zone, addr) {
+			continue
+		}
+		quote := &DeliveryQuote{
+			Zone:       zone.Name,
+			Fee:        zone.Fee,
+			MinOrder:   zone.MinOrder,
+			ETAMinutes: zone.ETAMinutes,
+		}
+		if zone.MinOrder > 0 && subtotal < zone.MinOrder {
+			return quote, fmt.Errorf("%w (%s: $%.0f MXN)", ErrBelowMinimumOrder, zone.Name, zone.MinOrder)
+		}
+		return quote, nil
+	}
+	return nil, ErrOutsideDeliveryZone
+}
+
+// DeliveryFeeItem línea del pedido con el costo de envío
+func DeliveryFeeItem(quote *DeliveryQuote) models.OrderItem {
+	name := DeliveryFeeItemName
+	if quote.Zone != "" {
+		name += " (" + quote.Zone + ")"
+	}
+	return models.OrderItem{Name: name, Quantity: 1, Price: quote.Fee}
+}
+
+// ParseGeoPoint lee "lat,lng" (o un link de Google Maps con ellas)
+func ParseGeoPoint(text string) *models.GeoPoint {
+	m := coordsPattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil
+	}
+	lat, errLat := strconv.ParseFloat(m[1], 64)
+	lng, errLng := strconv.ParseFloat(m[2], 64)
+	if errLat != nil || errLng != nil || math.Abs(lat) > 90 || math.Abs(lng) > 180 {
+		return nil
+	}
+	return &models.GeoPoint{Lat: lat, Lng: lng}
+}
+
+// resolveDeliveryAddress completa el código postal y las coordenadas que
+// hagan falta para las zonas de la sucursal: primero del propio texto y, si
+// no alcanza, con la API de Geocoding de Google Maps (GOOGLE_MAPS_API_KEY)
+func resolveDeliveryAddress(branch *models.MyBusinessInfo, addr DeliveryAddress) DeliveryAddress {
+	if addr.PostalCode == "" {
+		addr.PostalCode = postalCodePattern.FindString(addr.Text)
+	}
+	if addr.Location == nil {
+		addr.Location = ParseGeoPoint(addr.Text)
+	}
+
+	needsPoint, needsPostal := false, false
+	for _, z := range branch.DeliveryZones {
+		switch z.Type {
+		case models.DeliveryZoneRadius, models.DeliveryZonePolygon:
+			needsPoint = needsPoint || addr.Location == nil
+		case models.DeliveryZonePostalCodes:
+			needsPostal = needsPostal || addr.PostalCode == ""
+		}
+	}
+	if (!needsPoint && !needsPostal) || strings.TrimSpace(addr.Text) == "" {
+		return addr
+	}
+
+	// Se agrega la ciudad de la sucursal para que "Calle 5 #12" no se
+	// geocodifique en otro estado
+	query := addr.Text
+	if city := strings.TrimSpace(branch.Location.City); city != "" && !strings.Contains(strings.ToLower(query), strings.ToLower(city)) {
+		query += ", " + city
+	}
+	point, postal, err := geocodeAddress(query)
+	if err != nil {
+		log.Printf("⚠️  [Delivery] No se pudo geocodificar %q: %v", query, err)
+		return addr
+	}
+	if addr.Location == nil {
+		addr.Location = point
+	}
+	if addr.PostalCode == "" {
+		addr.PostalCode = postal
+	}
+	return addr
+}
+
+func zoneCovers(branch *models.MyBusinessInfo, zone models.DeliveryZone, addr DeliveryAddress) bool {
+	switch zone.Type {
+	case models.DeliveryZonePostalCodes:
+		return zone.CoversPostalCode(addr.PostalCode)
+	case models.DeliveryZoneRadius:
+		if addr.Location == nil || !branch.Location.HasCoordinates() || zone.RadiusKm <= 0 {
+			return false
+		}
+		center := models.GeoPoint{Lat: branch.Location.Latitude, Lng: branch.Location.Longitude}
+		return distanceKm(center, *addr.Location) <= zone.RadiusKm
+	case models.DeliveryZonePolygon:
+		return addr.Location != nil && pointInPolygon(*addr.Location, zone.Polygon)
+	}
+	return false
+}
+
+// distanceKm distancia en línea recta (haversine)
+func distanceKm(a, b models.GeoPoint) float64 {
+	const earthRadiusKm = 6371.0
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(b.Lat - a.Lat)
+	dLng := rad(b.Lng - a.Lng)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(rad(a.Lat))*math.Cos(rad(b.Lat))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// pointInPolygon ray casting; suficiente para zonas del tamaño de una ciudad
+func pointInPolygon(p models.GeoPoint, polygon []models.GeoPoint) bool {
+	if len(polygon) < 3 {
+		return false
+	}
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > p.Lat) != (b.Lat > p.Lat) &&
+			p.Lng < (b.Lng-a.Lng)*(p.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+var geocodeHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// geocodeAddress coordenadas y código postal de una dirección en texto
+func geocodeAddress(address string) (*models.GeoPoint, string, error) {
+	apiKey := os.Getenv("GOOGLE_MAPS_API_KEY")
+	if apiKey == "" {
+		return nil, "", fmt.Errorf("GOOGLE_MAPS_API_KEY no está configurado")
+	}
+
+	query := url.Values{}
+	query.Set("address", address)
+	query.Set("region", "mx")
+	query.Set("language", "es")
+	query.Set("key", apiKey)
+
+	resp, err := geocodeHTTPClient.Get("https://maps.googleapis.com/maps/api/geocode/json?" + query.Encode())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status  string `json:"status"`
+		Results []struct {
+			AddressComponents []struct {
+				LongName string   `json:"long_name"`
+				Types    []string `json:"types"`
+			} `json:"address_components"`
+			Geometry struct {
+				Location struct {
+					Lat float64 `json:"lat"`
+					Lng float64 `json:"lng"`
+				} `json:"location"`
+			} `json:"geometry"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, "", fmt.Errorf("respuesta inválida: %w", err)
+	}
+	if body.Status != "OK" || len(body.Results) == 0 {
+		return nil, "", fmt.Errorf("geocoding retornó %s", body.Status)
+	}
+
+	result := body.Results[0]
+	postal := ""
+	for _, comp := range result.AddressComponents {
+		for _, t := range comp.Types {
+			if t == "postal_code" {
+				postal = comp.LongName
+			}
+		}
+	}
+	return &models.GeoPoint{Lat: result.Geometry.Location.Lat, Lng: result.Geometry.Location.Lng}, postal, nil
+}
@@ -3,14 +3,17 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
@@ -154,9 +157,6 @@ func (s *GoogleCalendarService) CreateEvent(ctx context.Context, tokenJSON, cale
 			DateTime: eventData.EndTime.Format(time.RFC3339),
 			TimeZone: "America/Mexico_City",
 		},
-		Attendees: []*calendar.EventAttendee{
-			{Email: eventData.ClientEmail},
-		},
 		Reminders: &calendar.EventReminders{
 			UseDefault: false,
 			Overrides: []*calendar.EventReminder{
@@ -166,10 +166,18 @@ func (s *GoogleCalendarService) CreateEvent(ctx context.Context, tokenJSON, cale
 		},
 	}
 
+	if eventData.ClientEmail != "" {
+		event.Attendees = []*calendar.EventAttendee{{Email: eventData.ClientEmail}}
+	}
+
 	if eventData.ClientPhone != "" {
 		event.Description += fmt.Sprintf("\n\nTeléfono: %s", eventData.ClientPhone)
 	}
 
+	if len(eventData.Recurrence) > 0 {
+		event.Recurrence = eventData.Recurrence
+	}
+
 	createdEvent, err := service.Events.Insert(calendarID, event).SendNotifications(true).Do()
 	if err != nil {
 		return "", fmt.Errorf("error creating event: %w", err)
@@ -239,6 +247,130 @@ func (s *GoogleCalendarService) GetEvents(ctx context.Context, tokenJSON, calend
 	return events.Items, nil
 }
 
+// ErrSyncTokenExpired Google invalidó el sync token (410 Gone): hay que
+// volver a hacer una sincronización completa
+var ErrSyncTokenExpired = errors.New("sync token expirado")
+
+// ListEventChanges eventos que cambiaron desde syncToken (incluye los
+// eliminados, con Status "cancelled"). Con syncToken vacío lista todos los
+// eventos para obtener el primer token. Devuelve el token para la siguiente
+// llamada.
+func (s *GoogleCalendarService) ListEventChanges(ctx context.Context, tokenJSON, calendarID, syncToken string) ([]*calendar.Event, string, error) {
+	service, err := s.CreateCalendarService(ctx, tokenJSON)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var events []*calendar.Event
+	pageToken := ""
+	for {
+		call := service.Events.List(calendarID).ShowDeleted(true).SingleEvents(true).MaxResults(250).Context(ctx)
+		if syncToken != "" {
+			call = call.SyncToken(syncToken)
+		}
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		page, err := call.Do()
+		if err != nil {
+			var apiErr *googleapi.Error
+			if errors.As(err, &apiErr) && apiErr.Code == http.StatusGone {
+				return nil, "", ErrSyncTokenExpired
+			}
+			return nil, "", fmt.Errorf("error listing event changes: %w", err)
+		}
+
+		events = append(events, page.Items...)
+		if page.NextPageToken == "" {
+			return events, page.NextSyncToken, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// WatchEvents abre un canal de notificaciones push para los eventos del
+// calendario. Google llamará a address cada vez que algo cambie.
+func (s *GoogleCalendarService) WatchEvents(ctx context.Context, tokenJSON, calendarID, channelID, channelToken, address string, ttl time.Duration) (*calendar.Channel, error) {
+	service, err := s.CreateCalendarService(ctx, tokenJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	channel := &calendar.Channel{
+		Id:      channelID,
+		Type:    "web_hook",
+		Address: address,
+		Token:   channelToken,
+		Params:  map[string]string{"ttl": strconv.Itoa(int(ttl.Seconds()))},
+	}
+
+	created, err := service.Events.Watch(calendarID, channel).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error watching calendar: %w", err)
+	}
+	return created, nil
+}
+
+// StopChannel cierra un canal de notificaciones
+func (s *GoogleCalendarService) StopChannel(ctx context.Context, tokenJSON, channelID, resourceID string) error {
+	service, err := s.CreateCalendarService(ctx, tokenJSON)
+	if err != nil {
+		return err
+	}
+
+	if err := service.Channels.Stop(&calendar.Channel{Id: channelID, ResourceId: resourceID}).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("error stopping channel: %w", err)
+	}
+	return nil
+}
+
+// SetEventRecurrence reemplaza las líneas RRULE/EXDATE de un evento recurrente
+func (s *GoogleCalendarService) SetEventRecurrence(ctx context.Context, tokenJSON, calendarID, eventID string, recurrence []string) error {
+	service, err := s.CreateCalendarService(ctx, tokenJSON)
+	if err != nil {
+		return err
+	}
+
+	if _, err := service.Events.Patch(calendarID, eventID, &calendar.Event{Recurrence: recurrence}).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("error updating recurrence: %w", err)
+	}
+	return nil
+}
+
+// ListEventInstances ocurrencias de un evento recurrente entre from y to.
+// Cada ocurrencia tiene su propio ID y OriginalStartTime.
+func (s *GoogleCalendarService) ListEventInstances(ctx context.Context, tokenJSON, calendarID, eventID string, from, to time.Time) ([]*calendar.Event, error) {
+	service, err := s.CreateCalendarService(ctx, tokenJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []*calendar.Event
+	pageToken := ""
+	for {
+		call := service.Events.Instances(calendarID, eventID).
+			TimeMin(from.Format(time.RFC3339)).
+			TimeMax(to.Format(time.RFC3339)).
+			MaxResults(250).
+			Context(ctx)
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		}
+
+		page, err := call.Do()
+		if err != nil {
+			return nil, fmt.Errorf("error listing instances: %w", err)
+		}
+
+		instances = append(instances, page.Items...)
+		if page.NextPageToken == "" {
+			return instances, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
 // EventData representa los datos necesarios para crear un evento
 type EventData struct {
 	Title       string
@@ -247,6 +379,7 @@ type EventData struct {
 	EndTime     time.Time
 	ClientEmail string
 	ClientPhone string
+	Recurrence  []string // Líneas RRULE/EXDATE para eventos recurrentes (vacío = evento único)
 }
 
 // RefreshToken refresca el token de acceso si ha expirado
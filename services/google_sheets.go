@@ -5,11 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
@@ -559,6 +562,75 @@ func (s *GoogleSheetsService) DeleteAppointment(ctx context.Context, tokenJSON,
 	return nil
 }
 
+// ClearAppointmentCell limpia la celda de la cuadrícula "Calendario" que
+// corresponde a la fecha y hora, solo si contiene match (teléfono o nombre
+// del cliente), para no borrar la cita de otra persona en la misma hora
+func (s *GoogleSheetsService) ClearAppointmentCell(ctx context.Context, tokenJSON, spreadsheetID string, date time.Time, match string) error {
+	service, err := s.CreateSheetsService(ctx, tokenJSON)
+	if err != nil {
+		return err
+	}
+
+	cell, err := CalendarGridCell(date)
+	if err != nil {
+		return err
+	}
+	cellRange := "Calendario!" + cell
+
+	resp, err := service.Spreadsheets.Values.Get(spreadsheetID, cellRange).Do()
+	if err != nil {
+		return fmt.Errorf("error leyendo celda: %w", err)
+	}
+	if len(resp.Values) == 0 || len(resp.Values[0]) == 0 {
+		return nil
+	}
+	if content := fmt.Sprintf("%v", resp.Values[0][0]); match == "" || !strings.Contains(content, match) {
+		return nil
+	}
+
+	_, err = service.Spreadsheets.Values.Update(
+		spreadsheetID,
+		cellRange,
+		&sheets.ValueRange{Values: [][]interface{}{{""}}},
+	).ValueInputOption("RAW").Do()
+	if err != nil {
+		return fmt.Errorf("error limpiando celda: %w", err)
+	}
+	return nil
+}
+
+// CalendarGridCell celda de la cuadrícula "Calendario" para una fecha y hora,
+// igual que AddAppointment: B=Lunes ... G=Sábado, H=Domingo; fila 2 = 9:00 AM
+func CalendarGridCell(date time.Time) (string, error) {
+	columnLetter := string(rune('A' + (int(date.Weekday())+6)%7 + 1))
+	row := date.Hour() - 9 + 2
+	if row < 2 || row > 12 {
+		return "", fmt.Errorf("hora fuera del rango del calendario (9:00 AM - 7:00 PM)")
+	}
+	return fmt.Sprintf("%s%d", columnLetter, row), nil
+}
+
+// SpreadsheetVersion versión del archivo en Drive. Cambia con cada edición,
+// así que sirve de cursor para saber si hay que volver a leer la hoja.
+func (s *GoogleSheetsService) SpreadsheetVersion(ctx context.Context, tokenJSON, spreadsheetID string) (string, error) {
+	var token oauth2.Token
+	if err := json.Unmarshal([]byte(tokenJSON), &token); err != nil {
+		return "", fmt.Errorf("error parsing token: %w", err)
+	}
+
+	client := s.GetOAuthConfig().Client(ctx, &token)
+	driveService, err := drive.NewService(ctx, option.WithHTTPClient(client))
+	if err != nil {
+		return "", fmt.Errorf("error creating drive service: %w", err)
+	}
+
+	file, err := driveService.Files.Get(spreadsheetID).Fields("version").Do()
+	if err != nil {
+		return "", fmt.Errorf("error reading file version: %w", err)
+	}
+	return strconv.FormatInt(file.Version, 10), nil
+}
+
 // GetAppointments obtiene todas las citas del calendario
 func (s *GoogleSheetsService) GetAppointments(ctx context.Context, tokenJSON, spreadsheetID string) ([]AppointmentData, error) {
 	service, err := s.CreateSheetsService(ctx, tokenJSON)
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+)
+
+const (
+	// icsFeedPast / icsFeedFuture ventana de citas que publica cada feed
+	icsFeedPast   = 30 * 24 * time.Hour
+	icsFeedFuture = 180 * 24 * time.Hour
+
+	icsTimeLayout = "20060102T150405Z"
+)
+
+// newICSToken token aleatorio de 32 bytes en hexadecimal
+func newICSToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func publicBaseURL() string {
+	return strings.TrimRight(os.Getenv("BASE_URL"), "/")
+}
+
+// ============================================
+// FEEDS POR SUCURSAL Y TRABAJADOR
+// ============================================
+
+// EnsureCalendarFeed feed de la sucursal (worker vacío) o de un trabajador;
+// lo crea la primera vez que se pide
+func EnsureCalendarFeed(userID, branchID uint, worker string) (*models.CalendarFeed, error) {
+	var feed models.CalendarFeed
+	err := config.DB.Where("branch_id = ? AND worker = ?", branchID, worker).First(&feed).Error
+	if err == nil {
+		return &feed, nil
+	}
+
+	token, err := newICSToken()
+	if err != nil {
+		return nil, err
+	}
+	feed = models.CalendarFeed{UserID: userID, BranchID: branchID, Worker: worker, Token: token}
+	if err := config.DB.Create(&feed).Error; err != nil {
+		return nil, err
+	}
+	return &feed, nil
+}
+
+// RotateCalendarFeed cambia el token: la URL anterior deja de funcionar
+func RotateCalendarFeed(feed *models.CalendarFeed) error {
+	token, err := newICSToken()
+	if err != nil {
+		return err
+	}
+	if err := config.DB.Model(feed).Update("token", token).Error; err != nil {
+		return err
+	}
+	feed.Token = token
+	return nil
+}
+
+// CalendarFeedURL URL de suscripción del feed
+func CalendarFeedURL(feed *models.CalendarFeed) string {
+	return fmt.Sprintf("%s/ics/feeds/%s.ics", publicBaseURL(), feed.Token)
+}
+
+// CalendarFeedICS calendario con las citas del feed
+func CalendarFeedICS(feed *models.CalendarFeed) (string, error) {
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, feed.BranchID).Error; err != nil {
+		return "", fmt.Errorf("sucursal no encontrada")
+	}
+
+	// Citas de la sucursal, incluidas las anteriores a BranchID que solo
+	// tienen el agente de la sucursal
+	var agentIDs []uint
+	config.DB.Model(&models.Agent{}).Where("branch_id = ?", branch.ID).Pluck("id", &agentIDs)
+
+	now := time.Now()
+	query := config.DB.
+		Where("user_id = ? AND date BETWEEN ? AND ?", branch.UserID, now.Add(-icsFeedPast), now.Add(icsFeedFuture)).
+		Where("status <> ?", models.AppointmentStatusCancelled)
+	if len(agentIDs) > 0 {
+		query = query.Where("(branch_id = ? OR (branch_id = 0 AND agent_id IN ?))", branch.ID, agentIDs)
+	} else {
+		query = query.Where("branch_id = ?", branch.ID)
+	}
+	if feed.Worker != "" {
+		query = query.Where("LOWER(worker) = ?", strings.ToLower(feed.Worker))
+	}
+
+	var appointments []models.Appointment
+	if err := query.Order("date ASC").Find(&appointments).Error; err != nil {
+		return "", err
+	}
+
+	active := appointments[:0]
+	for _, appt := range appointments {
+		if !appt.PaymentHoldExpired() {
+			active = append(active, appt)
+		}
+	}
+
+	name := branchDisplayName(&branch)
+	if feed.Worker != "" {
+		name = fmt.Sprintf("%s — %s", name, feed.Worker)
+	}
+	return buildICS(name, &branch, active, true), nil
+}
+
+// ============================================
+// INVITACIÓN POR CITA (para el cliente)
+// ============================================
+
+// AppointmentInviteURL enlace .ics de la cita para el cliente. Genera el
+// token la primera vez.
+func AppointmentInviteURL(appt *models.Appointment) (string, error) {
+	if publicBaseURL() == "" {
+		return "", fmt.Errorf("BASE_URL no configurado")
+	}
+	if appt.InviteToken == "" {
+		token, err := newICSToken()
+		if err != nil {
+			return "", err
+		}
+		if err := config.DB.Model(appt).UpdateColumn("invite_token", token).Error; err != nil {
+			return "", err
+		}
+		appt.InviteToken = token
+	}
+	return fmt.Sprintf("%s/ics/citas/%s.ics", publicBaseURL(), appt.InviteToken), nil
+}
+
+// AppointmentInviteICS calendario con la cita del token. Si la cita se
+// canceló, el evento sale como CANCELLED para que el calendario lo quite.
+func AppointmentInviteICS(token string) (string, error) {
+	var appt models.Appointment
+	if token == "" || config.DB.Where("invite_token = ?", token).First(&appt).Error != nil {
+		return "", fmt.Errorf("cita no encontrada")
+	}
+	branch := appointmentBranch(&appt)
+
+	name := "Cita"
+	if branch != nil {
+		name = branchDisplayName(branch)
+	}
+	return buildICS(name, branch, []models.Appointment{appt}, false), nil
+}
+
+// ============================================
+// FORMATO iCalendar (RFC 5545)
+// ============================================
+
+// buildICS arma el VCALENDAR. forStaff incluye los datos del cliente en el
+// evento; la invitación del cliente solo lleva servicio, trabajador y lugar.
+func buildICS(name string, branch *models.MyBusinessInfo, appointments []models.Appointment, forStaff bool) string {
+	var b strings.Builder
+	writeICSLine(&b, "BEGIN:VCALENDAR")
+	writeICSLine(&b, "VERSION:2.0")
+	writeICSLine(&b, "PRODID:-//Attomos//Citas//ES")
+	writeICSLine(&b, "CALSCALE:GREGORIAN")
+	writeICSLine(&b, "METHOD:PUBLISH")
+	writeICSLine(&b, "X-WR-CALNAME:"+escapeICSText(name))
+	writeICSLine(&b, "REFRESH-INTERVAL;VALUE=DURATION:PT15M")
+	writeICSLine(&b, "X-PUBLISHED-TTL:PT15M")
+
+	location := ""
+	if branch != nil {
+		location = branchAddress(branch)
+	}
+	stamp := time.Now().UTC().Format(icsTimeLayout)
+
+	for _, appt := range appointments {
+		duration := appt.DurationMinutes
+		if duration <= 0 {
+			duration = models.DefaultServiceDuration
+		}
+		end := appt.Date.Add(time.Duration(duration) * time.Minute)
+
+		summary := appt.Service
+		description := ""
+		if forStaff {
+			summary = fmt.Sprintf("%s — %s", appt.Service, strings.TrimSpace(appt.GetClientFullName()))
+			var lines []string
+			if appt.ClientPhone != "" {
+				lines = append(lines, "Teléfono: "+appt.ClientPhone)
+			}
+			if appt.Worker != "" {
+				lines = append(lines, "Con: "+appt.Worker)
+			}
+			if appt.Notes != "" {
+				lines = append(lines, appt.Notes)
+			}
+			description = strings.Join(lines, "\n")
+		} else {
+			if branch != nil {
+				summary = fmt.Sprintf("%s — %s", appt.Service, branchDisplayName(branch))
+			}
+			if appt.Worker != "" {
+				description = "Con: " + appt.Worker
+			}
+		}
+
+		status := "CONFIRMED"
+		switch {
+		case appt.IsCancelled():
+			status = "CANCELLED"
+		case appt.Status == models.AppointmentStatusPending:
+			status = "TENTATIVE"
+		}
+
+		writeICSLine(&b, "BEGIN:VEVENT")
+		writeICSLine(&b, fmt.Sprintf("UID:appointment-%d@attomos", appt.ID))
+		writeICSLine(&b, "DTSTAMP:"+stamp)
+		// SEQUENCE crece con cada cambio para que el calendario actualice el evento
+		writeICSLine(&b, fmt.Sprintf("SEQUENCE:%d", appt.UpdatedAt.Unix()-appt.CreatedAt.Unix()))
+		writeICSLine(&b, "LAST-MODIFIED:"+appt.UpdatedAt.UTC().Format(icsTimeLayout))
+		writeICSLine(&b, "DTSTART:"+appt.Date.UTC().Format(icsTimeLayout))
+		writeICSLine(&b, "DTEND:"+end.UTC().Format(icsTimeLayout))
+		writeICSLine(&b, "SUMMARY:"+escapeICSText(summary))
+		if description != "" {
+			writeICSLine(&b, "DESCRIPTION:"+escapeICSText(description))
+		}
+		if location != "" {
+			writeICSLine(&b, "LOCATION:"+escapeICSText(location))
+		}
+		writeICSLine(&b, "STATUS:"+status)
+		if !forStaff && !appt.IsCancelled() {
+			writeICSLine(&b, "BEGIN:VALARM")
+			writeICSLine(&b, "ACTION:DISPLAY")
+			writeICSLine(&b, "DESCRIPTION:"+escapeICSText(summary))
+			writeICSLine(&b, "TRIGGER:-PT1H")
+			writeICSLine(&b, "END:VALARM")
+		}
+		writeICSLine(&b, "END:VEVENT")
+	}
+
+	writeICSLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+// writeICSLine escribe la línea con CRLF, doblándola a 75 octetos sin
+// partir caracteres UTF-8
+func writeICSLine(b *strings.Builder, line string) {
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+}
+
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func branchDisplayName(branch *models.MyBusinessInfo) string {
+	if branch.BranchName != "" && branch.BranchName != branch.BusinessName {
+		return fmt.Sprintf("%s (%s)", branch.BusinessName, branch.BranchName)
+	}
+	return branch.BusinessName
+}
+
+func branchAddress(branch *models.MyBusinessInfo) string {
+	loc := branch.Location
+	street := strings.TrimSpace(strings.Join([]string{loc.Address, loc.Number}, " "))
+	var parts []string
+	for _, p := range []string{street, loc.Neighborhood, loc.City, loc.State, loc.PostalCode} {
+		if strings.TrimSpace(p) != "" {
+			parts = append(parts, strings.TrimSpace(p))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"attomos/config"
+	"attomos/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInsufficientStock no hay existencias para surtir el pedido
+var ErrInsufficientStock = errors.New("no hay existencias suficientes")
+
+// stockChange resultado de mover existencias; lo que hay que avisar se
+// hace después del commit para no retener el bloqueo de la sucursal
+type stockChange struct {
+	branch    *models.MyBusinessInfo
+	soldOut   []string               // productos que se agotaron
+	restocked []string               // productos que volvieron a estar disponibles
+	lowStock  []models.BranchService // productos que bajaron del umbral de aviso
+}
+
+// CheckStock valida que los productos del carrito estén disponibles y, si
+// la sucursal lleva inventario, que alcancen las existencias
+func CheckStock(branch *models.MyBusinessInfo, items models.OrderItems) error {
+	for i, qty := range orderedQuantities(branch, items, false) {
+		svc := branch.Services[i]
+		if !svc.InStock {
+			return fmt.Errorf("%w: %s está agotado", ErrInsufficientStock, svc.Title)
+		}
+		if svc.TrackStock && qty > svc.Stock {
+			return fmt.Errorf("%w: %s (quedan %d)", ErrInsufficientStock, svc.Title, max(svc.Stock, 0))
+		}
+	}
+	return nil
+}
+
+// ReserveCreatedOrderStock descuenta las existencias de un pedido que se
+// creó ya confirmado (p. ej. pagado en Ninda). El pago ya ocurrió, así que
+// no se rechaza aunque el inventario no alcance.
+func ReserveCreatedOrderStock(order *models.Order) {
+	if !order.Status.HoldsStock() {
+		return
+	}
+	var change *stockChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = applyOrderStock(tx, order, order.Status, false)
+		return err
+	})
+	if err != nil {
+		log.Printf("⚠️  [Stock] Pedido %d: no se pudieron descontar existencias: %v", order.ID, err)
+		return
+	}
+	afterStockChange(change)
+}
+
+// ReleaseOrderStock devuelve las existencias de un pedido que se elimina
+// sin haberse entregado
+func ReleaseOrderStock(order *models.Order) {
+	if order.StockBranchID == 0 || order.Status == models.OrderStatusDelivered {
+		return
+	}
+	var change *stockChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = restoreOrderStock(tx, order)
+		return err
+	})
+	if err != nil {
+		log.Printf("⚠️  [Stock] Pedido %d: no se pudieron devolver existencias: %v", order.ID, err)
+		return
+	}
+	afterStockChange(change)
+}
+
+// applyOrderStock descuenta existencias cuando el pedido pasa a un estado
+// confirmado y las devuelve si se cancela. Con strict rechaza el cambio si
+// no alcanzan.
+func applyOrderStock(tx *gorm.DB, order *models.Order, to models.OrderStatus, strict bool) (*stockChange, error) {
+	switch {
+	case to.HoldsStock() && order.StockBranchID == 0:
+		return deductOrderStock(tx, order, strict)
+	case !to.HoldsStock() && order.StockBranchID != 0:
+		return restoreOrderStock(tx, order)
+	}
+	return nil, nil
+}
+
+func deductOrderStock(tx *gorm.DB, order *models.Order, strict bool) (*stockChange, error) {
+	branchID := orderStockBranch(tx, order)
+	if branchID == 0 {
+		return nil, nil
+	}
+
+	var branch models.MyBusinessInfo
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&branch, branchID).Error; err != nil {
+		return nil, fmt.Errorf("error leyendo la sucursal %d: %w", branchID, err)
+	}
+
+	quantities := orderedQuantities(&branch, order.Items, true)
+	if len(quantities) == 0 {
+		return nil, nil
+	}
+
+	change := &stockChange{branch: &branch}
+	for i, qty := range quantities {
+		svc := &branch.Services[i]
+		if strict && qty > svc.Stock {
+			return nil, fmt.Errorf("%w: %s (quedan %d)", ErrInsufficientStock, svc.Title, max(svc.Stock, 0))
+		}
+		before := svc.Stock
+		svc.Stock -= qty
+		if svc.Stock <= 0 && svc.InStock {
+			svc.InStock = false
+			change.soldOut = append(change.soldOut, svc.Title)
+		}
+		if svc.IsLowStock() && before > svc.LowStockAlert {
+			change.lowStock = append(change.lowStock, *svc)
+		}
+	}
+	if len(change.soldOut) > 0 {
+		log.Printf("📦 [Stock] Sucursal %d: agotado %s (pedido %d)", branch.ID, strings.Join(change.soldOut, ", "), order.ID)
+	}
+
+	if err := tx.Model(&branch).Update("services", branch.Services).Error; err != nil {
+		return nil, fmt.Errorf("error guardando existencias: %w", err)
+	}
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("stock_branch_id", branch.ID).Error; err != nil {
+		return nil, fmt.Errorf("error marcando el pedido: %w", err)
+	}
+	order.StockBranchID = branch.ID
+	return change, nil
+}
+
+func restoreOrderStock(tx *gorm.DB, order *models.Order) (*stockChange, error) {
+	var branch models.MyBusinessInfo
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&branch, order.StockBranchID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error leyendo la sucursal %d: %w", order.StockBranchID, err)
+	}
+
+	var change *stockChange
+	if err == nil {
+		change = &stockChange{branch: &branch}
+		for i, qty := range orderedQuantities(&branch, order.Items, true) {
+			svc := &branch.Services[i]
+			before := svc.Stock
+			svc.Stock += qty
+			// Solo se reactiva lo que se agotó por inventario, no lo que el
+			// dueño apagó a mano teniendo existencias
+			if before <= 0 && svc.Stock > 0 && !svc.InStock {
+				svc.InStock = true
+				change.restocked = append(change.restocked, svc.Title)
+			}
+		}
+		if err := tx.Model(&branch).Update("services", branch.Services).Error; err != nil {
+			return nil, fmt.Errorf("error guardando existencias: %w", err)
+		}
+	}
+
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).Update("stock_branch_id", 0).Error; err != nil {
+		return nil, fmt.Errorf("error marcando el pedido: %w", err)
+	}
+	order.StockBranchID = 0
+	return change, nil
+}
+
+// orderStockBranch sucursal del pedido: la del agente que lo tomó o, en
+// pedidos manuales, la única sucursal del negocio
+func orderStockBranch(tx *gorm.DB, order *models.Order) uint {
+	if order.AgentID != nil {
+		var agent models.Agent
+		if tx.Select("id", "branch_id").First(&agent, *order.AgentID).Error == nil && agent.BranchID > 0 {
+			return agent.BranchID
+		}
+	}
+	var branchIDs []uint
+	tx.Model(&models.MyBusinessInfo{}).Where("user_id = ?", order.UserID).Limit(2).Pluck("id", &branchIDs)
+	if len(branchIDs) == 1 {
+		return branchIDs[0]
+	}
+	return 0
+}
+
+// orderedQuantities cantidad pedida por índice de servicio de la sucursal.
+// Las líneas que no son productos (p. ej. el envío) se ignoran.
+func orderedQuantities(branch *models.MyBusinessInfo, items models.OrderItems, trackedOnly bool) map[int]int {
+	quantities := make(map[int]int)
+	for _, item := range items {
+		name := strings.TrimSpace(item.Name)
+		for i, svc := range branch.Services {
+			if !strings.EqualFold(strings.TrimSpace(svc.Title), name) {
+				continue
+			}
+			if !trackedOnly || svc.TrackStock {
+				quantities[i] += max(item.Quantity, 1)
+			}
+			break
+		}
+	}
+	return quantities
+}
+
+// afterStockChange recarga los bots si cambió la disponibilidad y avisa al
+// dueño de lo que se está agotando
+func afterStockChange(change *stockChange) {
+	if change == nil {
+		return
+	}
+	if len(change.soldOut) > 0 || len(change.restocked) > 0 {
+		go ReloadBranchBotsConfig(change.branch)
+	}
+	if len(change.soldOut) > 0 || len(change.lowStock) > 0 {
+		go alertLowStock(change)
+	}
+}
+
+// ReloadBranchBotsConfig reescribe el business_config.json de los bots
+// (AtomicBot y OrbitalBot) de la sucursal para que dejen de ofrecer lo
+// agotado o vuelvan a ofrecerlo
+func ReloadBranchBotsConfig(branch *models.MyBusinessInfo) {
+	var agents []models.Agent
+	if err := config.DB.Where(
+		"branch_id = ? AND bot_type IN ? AND server_ip != '' AND is_active = ?",
+		branch.ID, []string{"atomic", "orbital"}, true,
+	).Find(&agents).Error; err != nil || len(agents) == 0 {
+		return
+	}
+
+	for _, agent := range agents {
+		var err error
+		switch agent.BotType {
+		case "atomic":
+			svc := NewAtomicBotDeployService(agent.ServerIP, agent.ServerPassword)
+			if err = svc.Connect(); err == nil {
+				err = svc.WriteBusinessConfig(&agent, branch)
+				svc.Close()
+			}
+		case "orbital":
+			svc := NewOrbitalBotDeployService(agent.ServerIP, agent.ServerPassword)
+			if err = svc.Connect(); err == nil {
+				err = svc.WriteBusinessConfig(&agent, branch)
+				svc.Close()
+			}
+		}
+		if err != nil {
+			log.Printf("⚠️  [Stock] No se pudo recargar la config del agente %d: %v", agent.ID, err)
+			continue
+		}
+		log.Printf("✅ [Stock] Agente %d recargará el catálogo de la sucursal %d", agent.ID, branch.ID)
+	}
+}
+
+// alertLowStock avisa por correo al dueño de la sucursal
+func alertLowStock(change *stockChange) {
+	var user models.User
+	if err := config.DB.Select("id", "email").First(&user, change.branch.UserID).Error; err != nil || user.Email == "" {
+		return
+	}
+
+	branchName := change.branch.BranchName
+	if branchName == "" {
+		branchName = change.branch.BusinessName
+	}
+
+	var body strings.Builder
+	body.WriteString("<h2>Inventario de " + html.EscapeString(branchName) + "</h2>")
+	if len(change.soldOut) > 0 {
+		body.WriteString("<p><strong>Se agotaron</strong> y los bots ya no los ofrecen:</p><ul>")
+		for _, title := range change.soldOut {
+			body.WriteString("<li>" + html.EscapeString(title) + "</li>")
+		}
+		body.WriteString("</ul>")
+	}
+	if len(change.lowStock) > 0 {
+		body.WriteString("<p><strong>Quedan pocas existencias:</strong></p><ul>")
+		for _, svc := range change.lowStock {
+			body.WriteString(fmt.Sprintf("<li>%s — quedan %d</li>", html.EscapeString(svc.Title), svc.Stock))
+		}
+		body.WriteString("</ul>")
+	}
+	body.WriteString("<p>Actualiza las existencias en Mi Negocio para volver a venderlos.</p>")
+
+	subject := "Existencias bajas - " + branchName
+	if err := NewMailSender().Send(user.Email, subject, body.String()); err != nil {
+		log.Printf("❌ [Stock] Sucursal %d: error enviando aviso de existencias: %v", change.branch.ID, err)
+		return
+	}
+	log.Printf("📧 [Stock] Sucursal %d: aviso de existencias enviado a %s", change.branch.ID, user.Email)
+}
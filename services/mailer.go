@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MailSender envía correos transaccionales (restablecer contraseña, etc.)
+type MailSender interface {
+	Send(to, subject, htmlBody string) error
+}
+
+// ErrMailNotConfigured no hay SMTP configurado ni modo de desarrollo activo
+var ErrMailNotConfigured = errors.New("SMTP_HOST no configurado")
+
+// NewMailSender retorna el SMTPMailSender si SMTP_HOST está configurado.
+// El LogMailSender solo se usa con MAIL_DEV_MODE=true (desarrollo local);
+// sin ninguno de los dos los envíos fallan en lugar de perderse en silencio.
+func NewMailSender() MailSender {
+	if os.Getenv("SMTP_HOST") != "" {
+		return NewSMTPMailSender()
+	}
+	if os.Getenv("MAIL_DEV_MODE") == "true" {
+		return &LogMailSender{OutboxDir: os.Getenv("MAIL_OUTBOX_DIR")}
+	}
+	return unconfiguredMailSender{}
+}
+
+// unconfiguredMailSender rechaza todos los envíos
+type unconfiguredMailSender struct{}
+
+func (unconfiguredMailSender) Send(to, subject, htmlBody string) error {
+	return ErrMailNotConfigured
+}
+
+// ============================================
+// SMTP
+// ============================================
+
+// SMTPMailSender envía correos por SMTP con autenticación PLAIN
+type SMTPMailSender struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+// NewSMTPMailSender crea el sender a partir de SMTP_HOST, SMTP_PORT,
+// SMTP_USER, SMTP_PASSWORD y SMTP_FROM
+func NewSMTPMailSender() *SMTPMailSender {
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+
+	return &SMTPMailSender{
+		host:     os.Getenv("SMTP_HOST"),
+		port:     port,
+		username: os.Getenv("SMTP_USER"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     from,
+	}
+}
+
+// Send envía un correo HTML
+func (s *SMTPMailSender) Send(to, subject, htmlBody string) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		auth = smtp.PlainAuth("", s.username, s.password, s.host)
+	}
+
+	var msg strings.Builder
+	msg.WriteString(fmt.Sprintf("From: %s\r\n", s.from))
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", to))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(htmlBody)
+
+	addr := s.host + ":" + s.port
+	if err := smtp.SendMail(addr, auth, s.from, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("error enviando correo por SMTP: %w", err)
+	}
+
+	log.Printf("📧 [Mail] Correo enviado a %s: %s", to, subject)
+	return nil
+}
+
+// ============================================
+// LOG / ARCHIVO (desarrollo local)
+// ============================================
+
+// LogMailSender registra destinatario y asunto en los logs y, si OutboxDir
+// está definido, guarda el correo en un archivo .html dentro de ese
+// directorio. El contenido nunca va a los logs: puede llevar tokens.
+type LogMailSender struct {
+	OutboxDir string
+}
+
+// Send registra el correo en lugar de enviarlo
+func (s *LogMailSender) Send(to, subject, htmlBody string) error {
+	log.Printf("📧 [Mail] (MAIL_DEV_MODE) Para: %s | Asunto: %s", to, subject)
+
+	if s.OutboxDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.OutboxDir, 0755); err != nil {
+		return fmt.Errorf("error creando directorio de correos: %w", err)
+	}
+
+	fileName := fmt.Sprintf("%s_%s.html", time.Now().Format("20060102_150405"), sanitizeMailFileName(to))
+	path := filepath.Join(s.OutboxDir, fileName)
+	if err := os.WriteFile(path, []byte(htmlBody), 0644); err != nil {
+		return fmt.Errorf("error guardando correo: %w", err)
+	}
+
+	log.Printf("📧 [Mail] Correo guardado en %s", path)
+	return nil
+}
+
+// sanitizeMailFileName convierte un email en un nombre de archivo seguro
+func sanitizeMailFileName(email string) string {
+	return strings.NewReplacer("@", "_at_", "/", "_", "\\", "_", " ", "_").Replace(email)
+}
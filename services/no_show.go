@@ -0,0 +1,151 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/utils"
+)
+
+const (
+	// noShowInterval cada cuánto se buscan citas a las que el cliente no llegó
+	noShowInterval = 5 * time.Minute
+
+	// noShowLookback solo se marcan citas recientes: las más viejas que
+	// siguen abiertas se dejan para que el negocio las revise a mano
+	noShowLookback = 7 * 24 * time.Hour
+)
+
+// StartNoShowScheduler marca como inasistencia las citas pendientes o
+// confirmadas que pasaron su hora de fin más la tolerancia de la sucursal,
+// en las sucursales que lo tienen activado.
+// Bloquea: llamarlo con `go`.
+func StartNoShowScheduler() {
+	log.Printf("🙅 [NoShow] Scheduler iniciado | Intervalo: %v", noShowInterval)
+
+	ticker := time.NewTicker(noShowInterval)
+	defer ticker.Stop()
+
+	for {
+		markNoShows()
+		<-ticker.C
+	}
+}
+
+func markNoShows() {
+	var policies []models.NoShowPolicy
+	if err := config.DB.Where("auto_mark = ?", true).Find(&policies).Error; err != nil {
+		log.Printf("❌ [NoShow] Error consultando políticas: %v", err)
+		return
+	}
+
+	for i := range policies {
+		markBranchNoShows(&policies[i])
+	}
+}
+
+// markBranchNoShows marca las citas vencidas de la sucursal de la política
+func markBranchNoShows(policy *models.NoShowPolicy) {
+	now := time.Now()
+	agentIDs := config.DB.Model(&models.Agent{}).Select("id").Where("branch_id = ?", policy.BranchID)
+
+	var appointments []models.Appointment
+	err := config.DB.
+		Where("user_id = ? AND date BETWEEN ? AND ?", policy.UserID, now.Add(-noShowLookback), now).
+		Where("status IN ?", []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}).
+		Where("(branch_id = ? OR (branch_id = 0 AND agent_id IN (?)))", policy.BranchID, agentIDs).
+		Find(&appointments).Error
+	if err != nil {
+		log.Printf("❌ [NoShow] Error consultando citas de la sucursal %d: %v", policy.BranchID, err)
+		return
+	}
+
+	for i := range appointments {
+		appt := &appointments[i]
+		// Una reserva de Ninda sin pagar nunca apartó el horario
+		if appt.PaymentHoldExpired() || now.Before(appt.EndTime().Add(policy.Grace())) {
+			continue
+		}
+
+		// Condicional: el negocio pudo completarla o cancelarla mientras tanto
+		result := config.DB.Model(&models.Appointment{}).
+			Where("id = ? AND status IN ?", appt.ID, []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}).
+			Update("status", models.AppointmentStatusNoShow)
+		if result.Error != nil {
+			log.Printf("⚠️  [NoShow] No se pudo marcar la cita %d: %v", appt.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("🙅 [NoShow] Cita %d (%s, %s) marcada como inasistencia",
+				appt.ID, appt.GetClientFullName(), appt.Date.Format("2006-01-02 15:04"))
+		}
+	}
+}
+
+// ============================================
+// CONTADORES Y ANTICIPO
+// ============================================
+
+// NoShowCountsByPhone inasistencias por cliente (utils.PhoneKey) en los
+// negocios del usuario
+func NoShowCountsByPhone(userID uint) map[string]int64 {
+	var phones []string
+	config.DB.Model(&models.Appointment{}).
+		Where("user_id = ? AND status = ? AND client_phone <> ''", userID, models.AppointmentStatusNoShow).
+		Pluck("client_phone", &phones)
+
+	counts := make(map[string]int64, len(phones))
+	for _, p := range phones {
+		if key := utils.PhoneKey(p); key != "" {
+			counts[key]++
+		}
+	}
+	return counts
+}
+
+// CountNoShows inasistencias del cliente en los negocios del usuario
+func CountNoShows(userID uint, phone string) int64 {
+	key := utils.PhoneKey(phone)
+	if key == "" {
+		return 0
+	}
+	return NoShowCountsByPhone(userID)[key]
+}
+
+// DepositRequirement anticipo que la política de la sucursal le exige al
+// cliente para agendar
+type DepositRequirement struct {
+	Required bool
+	Amount   float64
+	NoShows  int64
+}
+
+// DepositRequiredFor aplica la política de inasistencias de la sucursal al
+// cliente. Solo exige anticipo si la sucursal puede cobrarlo con Stripe
+// Connect; si no, la cita se agenda normal.
+func DepositRequiredFor(branch *models.MyBusinessInfo, phone string) DepositRequirement {
+	if branch == nil {
+		return DepositRequirement{}
+	}
+
+	var policy models.NoShowPolicy
+	if err := config.DB.Where("branch_id = ?", branch.ID).First(&policy).Error; err != nil || policy.DepositThreshold <= 0 {
+		return DepositRequirement{}
+	}
+
+	noShows := CountNoShows(branch.UserID, phone)
+	if !policy.RequiresDeposit(noShows) {
+		return DepositRequirement{NoShows: noShows}
+	}
+
+	var cfg models.PaymentConfig
+	err := config.DB.Where("branch_id = ? AND stripe_enabled = ?", branch.ID, true).First(&cfg).Error
+	if err != nil || cfg.StripeAccountID == "" || !cfg.StripeChargesEnabled {
+		log.Printf("⚠️  [NoShow] La sucursal %d exige anticipo pero no tiene Stripe Connect activo", branch.ID)
+		return DepositRequirement{NoShows: noShows}
+	}
+
+	return DepositRequirement{Required: true, Amount: policy.DepositAmount, NoShows: noShows}
+}
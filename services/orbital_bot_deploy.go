@@ -31,16 +31,19 @@ type OrbitalBusinessConfig struct {
 	BusinessHours              string           `json:"business_hours"`
 	GoogleMapsLink             string           `json:"google_maps_link"`
 	Services                   []OrbitalService `json:"services"`
+	MenuUrl                    string           `json:"menuUrl,omitempty"`
 	DefaultAppointmentDuration int              `json:"default_appointment_duration"`
 	WelcomeMessage             string           `json:"welcome_message"`
 	AutoResponseEnabled        bool             `json:"auto_response_enabled"`
 }
 
 type OrbitalService struct {
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Duration    int     `json:"duration"`
-	Price       float64 `json:"price"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Duration    int      `json:"duration"`
+	Price       float64  `json:"price"`
+	ImageUrls   []string `json:"imageUrls,omitempty"`
+	InStock     bool     `json:"inStock"`
 }
 
 // NewOrbitalBotDeployService crea instancia del servicio
@@ -89,7 +92,7 @@ func (s *OrbitalBotDeployService) Close() {
 }
 
 // DeployOrbitalBot despliega el bot de Go con Meta API en servidor INDIVIDUAL
-func (s *OrbitalBotDeployService) DeployOrbitalBot(agent *models.Agent, geminiAPIKey string, googleCredentials []byte) error {
+func (s *OrbitalBotDeployService) DeployOrbitalBot(agent *models.Agent, branch *models.MyBusinessInfo, geminiAPIKey string, googleCredentials []byte) error {
 	log.Printf("🚀 [Agent %d] Iniciando despliegue de OrbitalBot (Meta API - Servidor Individual)...", agent.ID)
 
 	botDir := fmt.Sprintf("/opt/orbital-bot-%d", agent.ID)
@@ -108,7 +111,7 @@ func (s *OrbitalBotDeployService) DeployOrbitalBot(agent *models.Agent, geminiAP
 
 	// PASO 3: Configurar entorno
 	log.Printf("⚙️  [Agent %d] PASO 3/6: Configurando entorno...", agent.ID)
-	if err := s.configureEnvironment(agent, botDir, geminiAPIKey, googleCredentials); err != nil {
+	if err := s.configureEnvironment(agent, branch, botDir, geminiAPIKey, googleCredentials); err != nil {
 		return fmt.Errorf("error configurando entorno: %w", err)
 	}
 
@@ -335,9 +338,9 @@ func (s *OrbitalBotDeployService) transferBotFiles(botDir string) error {
 }
 
 // configureEnvironment configura el entorno (.env y business_config.json)
-func (s *OrbitalBotDeployService) configureEnvironment(agent *models.Agent, botDir, geminiAPIKey string, googleCredentials []byte) error {
+func (s *OrbitalBotDeployService) configureEnvironment(agent *models.Agent, branch *models.MyBusinessInfo, botDir, geminiAPIKey string, googleCredentials []byte) error {
 	// Generar business_config.json
-	businessConfig := s.generateBusinessConfig(agent)
+	businessConfig := s.generateBusinessConfig(agent, branch)
 	businessJSON, err := json.MarshalIndent(businessConfig, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error serializando business_config: %w", err)
@@ -389,7 +392,7 @@ func (s *OrbitalBotDeployService) configureEnvironment(agent *models.Agent, botD
 }
 
 // generateBusinessConfig genera la configuración del negocio
-func (s *OrbitalBotDeployService) generateBusinessConfig(agent *models.Agent) *OrbitalBusinessConfig {
+func (s *OrbitalBotDeployService) generateBusinessConfig(agent *models.Agent, branch *models.MyBusinessInfo) *OrbitalBusinessConfig {
 	config := &OrbitalBusinessConfig{
 		AgentName:                  agent.Name,
 		BusinessType:               agent.BusinessType,
@@ -403,9 +406,21 @@ func (s *OrbitalBotDeployService) generateBusinessConfig(agent *models.Agent) *O
 		AutoResponseEnabled:        true,
 	}
 
+	// Si hay sucursal vinculada, usar MyBusinessInfo como fuente de verdad
+	// del catálogo (fotos, existencia) y del menú
+	if branch != nil {
+		if branch.BusinessName != "" {
+			config.AgentName = branch.BusinessName
+		}
+		config.MenuUrl = branch.MenuURL
+		if len(branch.Services) > 0 {
+			config.Services = convertBranchServicesToOrbital(branch.Services)
+		}
+	}
+
 	// Si WelcomeMessage está vacío, usar uno por defecto
 	if config.WelcomeMessage == "" {
-		config.WelcomeMessage = fmt.Sprintf("¡Bienvenido a %s! ¿En qué puedo ayudarte?", agent.Name)
+		config.WelcomeMessage = fmt.Sprintf("¡Bienvenido a %s! ¿En qué puedo ayudarte?", config.AgentName)
 	}
 
 	return config
@@ -443,9 +458,10 @@ func convertServicesToOrbital(services []models.Service) []OrbitalService {
 	result := make([]OrbitalService, len(services))
 	for i, s := range services {
 		service := OrbitalService{
-			Name:        s.Title,
+			Title:       s.Title,
 			Description: s.Description,
 			Duration:    30,
+			InStock:     true,
 		}
 
 		// Convertir precio
@@ -461,6 +477,30 @@ func convertServicesToOrbital(services []models.Service) []OrbitalService {
 	return result
 }
 
+// convertBranchServicesToOrbital convierte el catálogo de la sucursal
+func convertBranchServicesToOrbital(services models.BranchServices) []OrbitalService {
+	result := make([]OrbitalService, len(services))
+	for i, s := range services {
+		price := s.Price
+		if s.PriceType == "promotion" && s.PromoPrice > 0 {
+			price = s.PromoPrice
+		}
+		imageUrls := s.ImageUrls
+		if len(imageUrls) == 0 && s.ImageURL != "" {
+			imageUrls = []string{s.ImageURL}
+		}
+		result[i] = OrbitalService{
+			Title:       s.Title,
+			Description: s.Description,
+			Duration:    s.Duration(),
+			Price:       price,
+			ImageUrls:   imageUrls,
+			InStock:     s.InStock,
+		}
+	}
+	return result
+}
+
 // generateEnvFile genera el contenido del archivo .env para OrbitalBot
 func (s *OrbitalBotDeployService) generateEnvFile(agent *models.Agent, geminiAPIKey string) string {
 	var env strings.Builder
@@ -477,6 +517,7 @@ func (s *OrbitalBotDeployService) generateEnvFile(agent *models.Agent, geminiAPI
 	env.WriteString(fmt.Sprintf("META_PHONE_NUMBER_ID=%s\n", agent.MetaPhoneNumberID))
 	env.WriteString(fmt.Sprintf("META_WABA_ID=%s\n", agent.MetaWABAID))
 	env.WriteString(fmt.Sprintf("WEBHOOK_VERIFY_TOKEN=%s\n", generateWebhookToken(agent.ID)))
+	env.WriteString(fmt.Sprintf("META_APP_SECRET=%s\n", os.Getenv("META_APP_SECRET")))
 	env.WriteString(fmt.Sprintf("PORT=%d\n", agent.Port))
 	env.WriteString("\n")
 
@@ -784,6 +825,30 @@ func (s *OrbitalBotDeployService) uploadDirectory(localPath, remotePath string)
 	return nil
 }
 
+// WriteBusinessConfig reescribe el business_config.json con los datos
+// actuales de la sucursal; el watchdog del bot lo recarga sin reiniciar
+func (s *OrbitalBotDeployService) WriteBusinessConfig(agent *models.Agent, branch *models.MyBusinessInfo) error {
+	businessConfig := s.generateBusinessConfig(agent, branch)
+	businessJSON, err := json.MarshalIndent(businessConfig, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error serializando business_config: %w", err)
+	}
+
+	configPath := fmt.Sprintf("/opt/orbital-bot-%d/business_config.json", agent.ID)
+	configFile, err := s.sftpClient.Create(configPath)
+	if err != nil {
+		return fmt.Errorf("error creando business_config.json en servidor: %w", err)
+	}
+	defer configFile.Close()
+
+	if _, err := configFile.Write(businessJSON); err != nil {
+		return fmt.Errorf("error escribiendo business_config.json: %w", err)
+	}
+
+	log.Printf("   ✅ [Agent %d] business_config.json actualizado (%d bytes)", agent.ID, len(businessJSON))
+	return nil
+}
+
 // UpdateGeminiAPIKey actualiza o elimina la API key de Gemini en el .env del bot
 func (s *OrbitalBotDeployService) UpdateGeminiAPIKey(agent *models.Agent, apiKey string) error {
 	log.Printf("🔄 [Agent %d] Actualizando Gemini API key...", agent.ID)
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"sync"
+
+	"attomos/config"
+	"attomos/models"
+)
+
+// OrderFeedEventType qué le pasó al pedido
+type OrderFeedEventType string
+
+const (
+	OrderFeedCreated OrderFeedEventType = "created"
+	OrderFeedUpdated OrderFeedEventType = "updated"
+	OrderFeedDeleted OrderFeedEventType = "deleted"
+)
+
+// OrderFeedEvent cambio de un pedido que se transmite a los paneles abiertos
+// del dueño (lista de pedidos y pantalla de cocina)
+type OrderFeedEvent struct {
+	Type     OrderFeedEventType
+	Order    models.Order
+	BranchID uint // sucursal del agente del pedido (0 = sin agente)
+}
+
+// orderFeedBuffer eventos que puede acumular un suscriptor lento antes de
+// que se descarten
+const orderFeedBuffer = 32
+
+// orderFeed suscriptores por usuario. Vive en memoria: cada instancia del
+// backend avisa a los paneles conectados a ella.
+var orderFeed = struct {
+	sync.Mutex
+	subs map[uint]map[chan OrderFeedEvent]struct{}
+}{subs: map[uint]map[chan OrderFeedEvent]struct{}{}}
+
+// SubscribeOrders abre un canal con los cambios de pedidos del usuario.
+// Llamar a la función devuelta al desconectarse.
+func SubscribeOrders(userID uint) (<-chan OrderFeedEvent, func()) {
+	ch := make(chan OrderFeedEvent, orderFeedBuffer)
+
+	orderFeed.Lock()
+	if orderFeed.subs[userID] == nil {
+		orderFeed.subs[userID] = map[chan OrderFeedEvent]struct{}{}
+	}
+	orderFeed.subs[userID][ch] = struct{}{}
+	orderFeed.Unlock()
+
+	return ch, func() {
+		orderFeed.Lock()
+		delete(orderFeed.subs[userID], ch)
+		if len(orderFeed.subs[userID]) == 0 {
+			delete(orderFeed.subs, userID)
+		}
+		orderFeed.Unlock()
+	}
+}
+
+// PublishOrder avisa del cambio a los paneles abiertos del dueño del pedido.
+// No bloquea: si un panel no alcanza a leer, pierde el evento (la página
+// recarga la lista completa al reconectarse).
+func PublishOrder(order *models.Order, eventType OrderFeedEventType) {
+	orderFeed.Lock()
+	subs := make([]chan OrderFeedEvent, 0, len(orderFeed.subs[order.UserID]))
+	for ch := range orderFeed.subs[order.UserID] {
+		subs = append(subs, ch)
+	}
+	orderFeed.Unlock()
+
+	if len(subs) == 0 {
+		return
+	}
+
+	event := OrderFeedEvent{Type: eventType, Order: *order, BranchID: orderBranchID(order)}
+	for _, ch := range subs {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// orderBranchID sucursal del pedido según su agente
+func orderBranchID(order *models.Order) uint {
+	if order.AgentID == nil {
+		return 0
+	}
+	var agent models.Agent
+	if err := config.DB.Select("id", "branch_id").First(&agent, *order.AgentID).Error; err != nil {
+		return 0
+	}
+	return agent.BranchID
+}
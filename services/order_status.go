@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidOrderTransition el pedido no puede pasar a ese estado desde el actual
+var ErrInvalidOrderTransition = errors.New("cambio de estado no permitido")
+
+// ChangeOrderStatus mueve el pedido al nuevo estado si la transición es
+// válida, lo registra en el historial y avisa al cliente por WhatsApp a
+// través del agente del pedido (en segundo plano).
+func ChangeOrderStatus(order *models.Order, to models.OrderStatus, actor models.OrderEventActor) (*models.OrderEvent, error) {
+	from := order.Status
+	if !from.CanTransitionTo(to) {
+		return nil, fmt.Errorf("%w: %s → %s", ErrInvalidOrderTransition, from.Label(), to.Label())
+	}
+
+	// Condicionar al estado leído evita que dos cambios simultáneos se pisen;
+	// las existencias se mueven en la misma transacción
+	var stock *stockChange
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Order{}).
+			Where("id = ? AND status = ?", order.ID, from).
+			Update("status", to)
+		if result.Error != nil {
+			return fmt.Errorf("error actualizando el pedido: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: el pedido cambió de estado mientras tanto", ErrInvalidOrderTransition)
+		}
+		var err error
+		stock, err = applyOrderStock(tx, order, to, true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	order.Status = to
+	afterStockChange(stock)
+
+	event := models.OrderEvent{
+		OrderID:    order.ID,
+		UserID:     order.UserID,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+	}
+	if models.DefaultOrderNotificationTemplates[to] != "" {
+		event.NotifyStatus = models.OrderNotifyPending
+	}
+	if err := config.DB.Create(&event).Error; err != nil {
+		log.Printf("⚠️  [Orders] Pedido %d: no se pudo registrar el evento %s → %s: %v", order.ID, from, to, err)
+	}
+
+	PublishOrder(order, OrderFeedUpdated)
+
+	if event.NotifyStatus == models.OrderNotifyPending {
+		notified := *order
+		go notifyOrderStatus(&notified, &event)
+	}
+	return &event, nil
+}
+
+// RecordOrderCreated registra el alta del pedido como primer evento del
+// historial y la transmite a los paneles abiertos
+func RecordOrderCreated(order *models.Order, actor models.OrderEventActor) {
+	event := models.OrderEvent{
+		OrderID:  order.ID,
+		UserID:   order.UserID,
+		ToStatus: order.Status,
+		Actor:    actor,
+	}
+	if err := config.DB.Create(&event).Error; err != nil {
+		log.Printf("⚠️  [Orders] Pedido %d: no se pudo registrar el alta: %v", order.ID, err)
+	}
+	ReserveCreatedOrderStock(order)
+	PublishOrder(order, OrderFeedCreated)
+}
+
+// OrderNotifyConfigFor avisos de pedidos de la sucursal (valores por
+// defecto si no los ha configurado)
+func OrderNotifyConfigFor(branch *models.MyBusinessInfo) models.OrderNotifyConfig {
+	cfg := models.OrderNotifyConfig{UserID: branch.UserID, BranchID: branch.ID, Enabled: true}
+	config.DB.Where("branch_id = ?", branch.ID).First(&cfg)
+	return cfg
+}
+
+// notifyOrderStatus envía al cliente el aviso del nuevo estado con la
+// plantilla de la sucursal y guarda el resultado en el evento
+func notifyOrderStatus(order *models.Order, event *models.OrderEvent) {
+	if order.AgentID == nil || strings.TrimSpace(order.ClientPhone) == "" {
+		markOrderEvent(event, models.OrderNotifySkipped, "pedido sin agente o sin teléfono")
+		return
+	}
+
+	var agent models.Agent
+	if err := config.DB.First(&agent, *order.AgentID).Error; err != nil {
+		markOrderEvent(event, models.OrderNotifyFailed, "agente no encontrado")
+		return
+	}
+	if !agent.IsActive {
+		markOrderEvent(event, models.OrderNotifySkipped, "agente inactivo")
+		return
+	}
+
+	businessName := agent.Name
+	cfg := models.OrderNotifyConfig{Enabled: true}
+	var branch models.MyBusinessInfo
+	if agent.BranchID > 0 && config.DB.First(&branch, agent.BranchID).Error == nil {
+		if branch.BusinessName != "" {
+			businessName = branch.BusinessName
+		}
+		cfg = OrderNotifyConfigFor(&branch)
+	}
+	if !cfg.Enabled {
+		markOrderEvent(event, models.OrderNotifySkipped, "avisos de pedidos desactivados en la sucursal")
+		return
+	}
+
+	msg := BuildOrderStatusMessage(cfg.TemplateFor(event.ToStatus), order, businessName)
+	if err := SendWhatsAppViaAgent(&agent, order.ClientPhone, msg, models.TemplatePurposeOrderUpdate); err != nil {
+		log.Printf("❌ [Orders] Pedido %d (%s): %v", order.ID, event.ToStatus, err)
+		markOrderEvent(event, models.OrderNotifyFailed, err.Error())
+		return
+	}
+
+	markOrderEvent(event, models.OrderNotifySent, "")
+	log.Printf("📲 [Orders] Cliente avisado | Pedido %d → %s | Agente %d", order.ID, event.ToStatus, agent.ID)
+}
+
+// markOrderEvent guarda el resultado del aviso
+func markOrderEvent(event *models.OrderEvent, status models.OrderNotifyStatus, errMsg string) {
+	if event.ID == 0 {
+		return
+	}
+	updates := map[string]interface{}{
+		"notify_status": status,
+		"notify_error":  errMsg,
+	}
+	if status == models.OrderNotifySent {
+		now := time.Now()
+		updates["notified_at"] = &now
+	}
+	config.DB.Model(event).Updates(updates)
+}
+
+// BuildOrderStatusMessage reemplaza las variables de la plantilla con los
+// datos del pedido
+func BuildOrderStatusMessage(template string, order *models.Order, businessName string) string {
+	client := strings.TrimSpace(order.ClientName)
+	if client == "" {
+		client = "cliente"
+	}
+	return strings.NewReplacer(
+		"{cliente}", client,
+		"{pedido}", fmt.Sprintf("%d", order.ID),
+		"{negocio}", businessName,
+		"{total}", fmt.Sprintf("%.2f", order.Total),
+		"{minutos}", fmt.Sprintf("%d", order.EstimatedTime),
+		"{entrega}", orderDeliveryPhrase(order.OrderType),
+	).Replace(template)
+}
+
+// orderDeliveryPhrase cómo recibe el cliente su pedido, para {entrega}
+func orderDeliveryPhrase(orderType models.OrderType) string {
+	switch orderType {
+	case models.OrderTypeDelivery:
+		return "y va en camino a tu domicilio"
+	case models.OrderTypeDineIn:
+		return "y en un momento te lo llevamos a tu mesa"
+	}
+	return "para que pases a recogerlo"
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"attomos/config"
+	"attomos/models"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultReminderOffsets anticipación por defecto de los recordatorios.
+// Se puede cambiar con REMINDER_OFFSETS (ej. "24h,2h" o "48h,24h,1h").
+var defaultReminderOffsets = []time.Duration{2 * time.Hour, 24 * time.Hour}
+
+// reminderInterval cada cuánto se revisan las citas próximas
+const reminderInterval = time.Minute
+
+// StartReminderScheduler revisa periódicamente las citas próximas y pide al
+// agente dueño de cada cita que envíe el recordatorio por WhatsApp.
+// Bloquea: llamarlo con `go`.
+func StartReminderScheduler() {
+	offsets := getReminderOffsets()
+
+	labels := make([]string, len(offsets))
+	for i, o := range offsets {
+		labels[i] = o.String()
+	}
+	log.Printf("⏰ [Reminders] Scheduler iniciado | Offsets: %s", strings.Join(labels, ", "))
+
+	ticker := time.NewTicker(reminderInterval)
+	defer ticker.Stop()
+
+	for {
+		processDueReminders(offsets)
+		<-ticker.C
+	}
+}
+
+// getReminderOffsets lee REMINDER_OFFSETS y los ordena de menor a mayor
+func getReminderOffsets() []time.Duration {
+	raw := os.Getenv("REMINDER_OFFSETS")
+	if raw == "" {
+		return defaultReminderOffsets
+	}
+
+	var offsets []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			log.Printf("⚠️  [Reminders] Offset inválido en REMINDER_OFFSETS: %q", part)
+			continue
+		}
+		offsets = append(offsets, d)
+	}
+	if len(offsets) == 0 {
+		return defaultReminderOffsets
+	}
+
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// processDueReminders envía el recordatorio del tramo actual de cada cita.
+// offsets debe venir ordenado de menor a mayor.
+func processDueReminders(offsets []time.Duration) {
+	if len(offsets) == 0 {
+		return
+	}
+
+	now := time.Now()
+	maxOffset := offsets[len(offsets)-1]
+
+	var appointments []models.Appointment
+	if err := config.DB.
+		Where("date > ? AND date <= ?", now, now.Add(maxOffset)).
+		Where("status IN ?", []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}).
+		Where("agent_id > 0 AND client_phone <> ''").
+		Find(&appointments).Error; err != nil {
+		log.Printf("❌ [Reminders] Error consultando citas: %v", err)
+		return
+	}
+
+	for i := range appointments {
+		apt := &appointments[i]
+		remaining := apt.Date.Sub(now)
+
+		// Tramo actual: el offset más pequeño que ya se alcanzó
+		var offset time.Duration
+		for _, o := range offsets {
+			if remaining <= o {
+				offset = o
+				break
+			}
+		}
+		if offset == 0 {
+			continue
+		}
+
+		sendAppointmentReminder(apt, offset)
+	}
+}
+
+// sendAppointmentReminder reserva el registro (cita, offset) y envía el
+// recordatorio. Si el registro ya existe, no hace nada.
+func sendAppointmentReminder(apt *models.Appointment, offset time.Duration) {
+	reminder := models.AppointmentReminder{
+		AppointmentID: apt.ID,
+		OffsetMinutes: int(offset.Minutes()),
+		AgentID:       apt.AgentID,
+		ClientPhone:   apt.ClientPhone,
+		Status:        models.ReminderStatusPending,
+	}
+
+	// Citas agendadas dentro de la ventana: el cliente acaba de confirmar,
+	// no tiene sentido recordarle
+	if apt.CreatedAt.After(apt.Date.Add(-offset)) {
+		reminder.Status = models.ReminderStatusSkipped
+	}
+
+	// El índice único (appointment_id, offset_minutes) hace de candado:
+	// si ya existe, otro ciclo (o una instancia anterior) ya lo procesó
+	var existing models.AppointmentReminder
+	if config.DB.Where("appointment_id = ? AND offset_minutes = ?", apt.ID, reminder.OffsetMinutes).First(&existing).Error == nil {
+		return
+	}
+	if err := config.DB.Create(&reminder).Error; err != nil {
+		return
+	}
+	if reminder.Status == models.ReminderStatusSkipped {
+		return
+	}
+
+	var agent models.Agent
+	if err := config.DB.First(&agent, apt.AgentID).Error; err != nil {
+		markReminder(&reminder, models.ReminderStatusFailed, "agente no encontrado")
+		return
+	}
+	if !agent.IsActive {
+		markReminder(&reminder, models.ReminderStatusFailed, "agente inactivo")
+		return
+	}
+
+	businessName := agent.Name
+	var branch models.MyBusinessInfo
+	if agent.BranchID > 0 && config.DB.First(&branch, agent.BranchID).Error == nil && branch.BusinessName != "" {
+		businessName = branch.BusinessName
+	}
+
+	msg := BuildReminderMessage(apt, businessName)
+	if err := SendWhatsAppViaAgent(&agent, apt.ClientPhone, msg, models.TemplatePurposeReminder); err != nil {
+		log.Printf("❌ [Reminders] Cita %d (%s antes): %v", apt.ID, offset, err)
+		markReminder(&reminder, models.ReminderStatusFailed, err.Error())
+		return
+	}
+
+	markReminder(&reminder, models.ReminderStatusSent, "")
+	log.Printf("✅ [Reminders] Recordatorio enviado | Cita %d | %s antes | Agente %d", apt.ID, offset, agent.ID)
+}
+
+// markReminder actualiza el resultado del envío
+func markReminder(reminder *models.AppointmentReminder, status models.ReminderStatus, errMsg string) {
+	updates := map[string]interface{}{
+		"status": status,
+		"error":  errMsg,
+	}
+	if status == models.ReminderStatusSent {
+		now := time.Now()
+		updates["sent_at"] = &now
+	}
+	config.DB.Model(reminder).Updates(updates)
+}
+
+// BuildReminderMessage arma el texto del recordatorio para el cliente
+func BuildReminderMessage(apt *models.Appointment, businessName string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("⏰ *Recordatorio de tu cita en %s*\n\n", businessName))
+	sb.WriteString(fmt.Sprintf("👤 *Cliente:* %s\n", strings.TrimSpace(apt.GetClientFullName())))
+	if apt.Service != "" {
+		sb.WriteString(fmt.Sprintf("💼 *Servicio:* %s\n", apt.Service))
+	}
+	if apt.Worker != "" {
+		sb.WriteString(fmt.Sprintf("👨‍💼 *Con:* %s\n", apt.Worker))
+	}
+	sb.WriteString(fmt.Sprintf("📅 *Fecha:* %s\n", apt.Date.Format("02/01/2006")))
+	sb.WriteString(fmt.Sprintf("🕐 *Hora:* %s\n\n", apt.Date.Format("15:04")))
+	sb.WriteString("Responde *confirmar* para confirmar tu asistencia o *cancelar* si no podrás asistir.")
+	return sb.String()
+}
@@ -0,0 +1,542 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/utils"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// sheetsSyncTick cada cuánto revisa el worker qué hojas toca sincronizar
+	sheetsSyncTick = 30 * time.Second
+	// sheetsSyncInterval cada cuánto se revisa la hoja de un agente
+	sheetsSyncInterval = 5 * time.Minute
+	// sheetsSyncMinGap tiempo mínimo entre sincronizaciones pedidas desde el panel
+	sheetsSyncMinGap = time.Minute
+	// sheetsSyncMaxBackoff tope del reintento exponencial
+	sheetsSyncMaxBackoff = 2 * time.Hour
+	// sheetsSyncEditGrace margen entre UpdatedAt y LastSyncedAt: al marcar una
+	// cita como sincronizada GORM también actualiza UpdatedAt
+	sheetsSyncEditGrace = 5 * time.Second
+	// sheetsGridHorizon la cuadrícula "Calendario" solo muestra una semana
+	sheetsGridHorizon = 6 * 24 * time.Hour
+)
+
+// sheetsSyncWake despierta al worker cuando el panel pide sincronizar ya
+var sheetsSyncWake = make(chan struct{}, 1)
+
+// StartSheetsSync sincroniza en segundo plano la cuadrícula "Calendario" de
+// cada agente con la BD. Cada agente tiene su cursor (versión del archivo en
+// Drive): si la hoja no cambió no se vuelve a leer. Con errores de cuota de
+// Google el siguiente intento se difiere con backoff exponencial.
+// Bloquea: llamarlo con `go`.
+func StartSheetsSync() {
+	log.Printf("📊 [SheetsSync] Worker iniciado (cada %v por agente)", sheetsSyncInterval)
+
+	ticker := time.NewTicker(sheetsSyncTick)
+	defer ticker.Stop()
+
+	for {
+		runDueSheetSyncs()
+		select {
+		case <-ticker.C:
+		case <-sheetsSyncWake:
+		}
+	}
+}
+
+// RequestSheetsSync adelanta la sincronización de las hojas del usuario (al
+// abrir la página de citas). No salta el backoff de los agentes con errores.
+func RequestSheetsSync(userID uint) {
+	now := time.Now()
+	result := config.DB.Model(&models.SheetSyncState{}).
+		Where("user_id = ? AND failures = 0 AND next_sync_at > ?", userID, now).
+		Where("last_sync_at IS NULL OR last_sync_at < ?", now.Add(-sheetsSyncMinGap)).
+		Update("next_sync_at", now)
+
+	if result.RowsAffected > 0 {
+		select {
+		case sheetsSyncWake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// GetSheetSyncStates estado de sincronización de las hojas del usuario
+func GetSheetSyncStates(userID uint) []models.SheetSyncState {
+	var states []models.SheetSyncState
+	config.DB.Where("user_id = ?", userID).Order("agent_id ASC").Find(&states)
+	return states
+}
+
+// runDueSheetSyncs sincroniza las hojas cuyo NextSyncAt ya llegó
+func runDueSheetSyncs() {
+	var agents []models.Agent
+	if err := config.DB.
+		Where("google_connected = ? AND google_sheet_id <> ''", true).
+		Where("business_type <> ?", "pizzeria"). // hoja de pedidos, sin cuadrícula de citas
+		Find(&agents).Error; err != nil {
+		log.Printf("❌ [SheetsSync] Error consultando agentes: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range agents {
+		agent := &agents[i]
+
+		state := models.SheetSyncState{AgentID: agent.ID}
+		if err := config.DB.
+			Where(models.SheetSyncState{AgentID: agent.ID}).
+			Attrs(models.SheetSyncState{UserID: agent.UserID, Status: models.SheetSyncStatusPending, NextSyncAt: now}).
+			FirstOrCreate(&state).Error; err != nil {
+			log.Printf("⚠️  [SheetsSync] Agente %d: error leyendo estado: %v", agent.ID, err)
+			continue
+		}
+		if state.NextSyncAt.After(now) {
+			continue
+		}
+
+		syncAgentSheet(agent, &state)
+	}
+}
+
+// syncAgentSheet una pasada de sincronización de un agente
+func syncAgentSheet(agent *models.Agent, state *models.SheetSyncState) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	state.LastSyncAt = &now
+	config.DB.Model(state).Updates(map[string]interface{}{
+		"status":       models.SheetSyncStatusSyncing,
+		"last_sync_at": now,
+	})
+
+	svc := newIntegrationSheetsService()
+
+	// Cursor: si la versión del archivo no cambió, no hay nada que leer
+	version, err := svc.SpreadsheetVersion(ctx, agent.GoogleToken, agent.GoogleSheetID)
+	if err != nil {
+		if isGoogleQuotaError(err) {
+			failSheetSync(state, err)
+			return
+		}
+		// Conexiones antiguas sin permiso de Drive: se lee la hoja completa
+		version = ""
+	}
+	if version != "" && version == state.Cursor && state.LastSuccessAt != nil {
+		finishSheetSync(state, version, nil)
+		return
+	}
+
+	cells, err := readCalendarGrid(ctx, svc, agent.GoogleToken, agent.GoogleSheetID)
+	if err != nil {
+		failSheetSync(state, err)
+		return
+	}
+
+	result := importSheetAppointments(agent, cells)
+	finishSheetSync(state, version, &result)
+
+	if result.imported > 0 || result.updated > 0 || result.conflicts > 0 {
+		log.Printf("✅ [SheetsSync] Agente %d: %d nuevas, %d actualizadas, %d conflictos",
+			agent.ID, result.imported, result.updated, result.conflicts)
+	}
+}
+
+func finishSheetSync(state *models.SheetSyncState, cursor string, result *sheetImportResult) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":          models.SheetSyncStatusOK,
+		"cursor":          cursor,
+		"next_sync_at":    now.Add(sheetsSyncInterval),
+		"last_success_at": now,
+		"failures":        0,
+		"last_error":      "",
+	}
+	if result != nil {
+		updates["imported"] = result.imported
+		updates["updated"] = result.updated
+		updates["conflicts"] = result.conflicts
+	}
+	config.DB.Model(state).Updates(updates)
+}
+
+// failSheetSync difiere el siguiente intento: 5 min, 10, 20... hasta 2 horas
+func failSheetSync(state *models.SheetSyncState, err error) {
+	failures := state.Failures + 1
+	status := models.SheetSyncStatusError
+	if isGoogleQuotaError(err) {
+		status = models.SheetSyncStatusBackoff
+	}
+
+	delay := sheetsSyncInterval
+	for i := 1; i < failures && delay < sheetsSyncMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > sheetsSyncMaxBackoff {
+		delay = sheetsSyncMaxBackoff
+	}
+
+	log.Printf("⚠️  [SheetsSync] Agente %d: %v (intento %d, reintento en %v)", state.AgentID, err, failures, delay)
+
+	config.DB.Model(state).Updates(map[string]interface{}{
+		"status":       status,
+		"failures":     failures,
+		"last_error":   err.Error(),
+		"next_sync_at": time.Now().Add(delay),
+	})
+}
+
+// isGoogleQuotaError 429 o 403 por límite de cuota de la API de Google
+func isGoogleQuotaError(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	if apiErr.Code == http.StatusForbidden {
+		for _, item := range apiErr.Errors {
+			if strings.Contains(strings.ToLower(item.Reason), "ratelimitexceeded") || item.Reason == "quotaExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ============================================
+// LECTURA DE LA CUADRÍCULA
+// ============================================
+
+// sheetCellAppointment cita escrita en una celda de "Calendario"
+type sheetCellAppointment struct {
+	Cell    string // ej. "B5"
+	Client  string
+	Phone   string
+	Service string
+	Worker  string
+	Status  models.AppointmentStatus
+	Start   time.Time
+	Dated   bool // la celda trae la línea 📅 con la fecha exacta
+}
+
+// readCalendarGrid lee las citas de la cuadrícula B2:H12 (Lunes a Domingo, 9:00 a 19:00)
+func readCalendarGrid(ctx context.Context, svc *GoogleSheetsService, tokenJSON, sheetID string) ([]sheetCellAppointment, error) {
+	service, err := svc.CreateSheetsService(ctx, tokenJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error creando servicio: %w", err)
+	}
+
+	resp, err := service.Spreadsheets.Values.Get(sheetID, "Calendario!B2:H12").Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo sheet: %w", err)
+	}
+
+	columns := []string{"B", "C", "D", "E", "F", "G", "H"}
+	weekdays := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+	var cells []sheetCellAppointment
+	for rowIdx, row := range resp.Values {
+		hour := 9 + rowIdx
+		for colIdx, value := range row {
+			if colIdx >= len(columns) {
+				break
+			}
+			content := strings.TrimSpace(fmt.Sprintf("%v", value))
+			if content == "" {
+				continue
+			}
+			cell := fmt.Sprintf("%s%d", columns[colIdx], rowIdx+2)
+			if appt := parseCalendarCell(content, weekdays[colIdx], hour, cell); appt != nil {
+				cells = append(cells, *appt)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// parseCalendarCell interpreta el texto de una celda escrita por AddAppointment
+// o por los bots: 👤 cliente, 📞 teléfono, ✂️ servicio, 👨‍💼 trabajador, 📅 fecha
+func parseCalendarCell(content string, weekday time.Weekday, hour int, cell string) *sheetCellAppointment {
+	lines := strings.Split(content, "\n")
+	if len(lines) < 3 {
+		return nil
+	}
+
+	appt := &sheetCellAppointment{Cell: cell, Status: models.AppointmentStatusConfirmed}
+
+	contentLower := strings.ToLower(content)
+	if strings.Contains(content, "❌") ||
+		strings.Contains(contentLower, "cancelada") ||
+		strings.Contains(contentLower, "cancelado") {
+		appt.Status = models.AppointmentStatusCancelled
+	}
+
+	var day time.Time
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.Contains(line, "👤"):
+			appt.Client = strings.TrimSpace(strings.ReplaceAll(line, "👤", ""))
+		case strings.Contains(line, "📞"):
+			appt.Phone = strings.TrimSpace(strings.ReplaceAll(line, "📞", ""))
+		case strings.Contains(line, "✂"):
+			appt.Service = strings.TrimSpace(strings.NewReplacer("✂️", "", "✂", "").Replace(line))
+		case strings.Contains(line, "👨"):
+			worker := strings.NewReplacer("👨‍💼", "", "👨", "").Replace(line)
+			worker = strings.TrimPrefix(strings.TrimSpace(worker), "Barbero:")
+			appt.Worker = strings.TrimSpace(worker)
+		case strings.Contains(line, "📅"):
+			dateStr := strings.TrimSpace(strings.ReplaceAll(line, "📅", ""))
+			for _, layout := range []string{"02/01/2006", "2006-01-02"} {
+				if parsed, err := time.ParseInLocation(layout, dateStr, time.Local); err == nil {
+					day = parsed
+					appt.Dated = true
+					break
+				}
+			}
+		}
+	}
+
+	if appt.Client == "" || appt.Service == "" {
+		return nil
+	}
+
+	if !appt.Dated {
+		day = nextWeekday(weekday)
+	}
+	appt.Start = time.Date(day.Year(), day.Month(), day.Day(), hour, 0, 0, 0, time.Local)
+	return appt
+}
+
+// nextWeekday próxima fecha (a partir de mañana) que cae en ese día de la semana
+func nextWeekday(target time.Weekday) time.Time {
+	now := time.Now()
+	daysUntil := int(target - now.Weekday())
+	if daysUntil <= 0 {
+		daysUntil += 7
+	}
+	return now.AddDate(0, 0, daysUntil)
+}
+
+// ============================================
+// IMPORTACIÓN Y CONFLICTOS
+// ============================================
+
+type sheetImportResult struct {
+	imported  int
+	updated   int
+	conflicts int
+}
+
+// importSheetAppointments aplica las celdas leídas a la BD.
+//
+// Reglas de conflicto (una cita editada en ambos lados):
+//   - Si la cita cambió en el panel después de LastSyncedAt, gana el panel y
+//     el cambio de la hoja se ignora (cuenta como conflicto).
+//   - Si no, gana la hoja: estado, servicio, trabajador y teléfono.
+//   - Una celda que ya tiene otra fecha es otra cita: la anterior se desliga.
+//   - Una cita ligada de esta semana cuya celda se borró se cancela, salvo
+//     que el panel la haya editado.
+func importSheetAppointments(agent *models.Agent, cells []sheetCellAppointment) sheetImportResult {
+	var result sheetImportResult
+	seen := make(map[string]bool, len(cells))
+
+	for _, cell := range cells {
+		sheetRowID := fmt.Sprintf("agent_%d_%s", agent.ID, cell.Cell)
+		seen[sheetRowID] = true
+
+		// Unscoped: una cita borrada desde el panel no se vuelve a importar
+		var existing models.Appointment
+		found := config.DB.Unscoped().
+			Where("sheet_row_id = ? AND agent_id = ?", sheetRowID, agent.ID).
+			First(&existing).Error == nil
+
+		if found && cell.Dated && !sameDay(existing.Date, cell.Start) {
+			// La celda se reutilizó para otra semana: es otra cita
+			config.DB.Unscoped().Model(&existing).UpdateColumn("sheet_row_id", "")
+			found = false
+		}
+
+		if found && existing.DeletedAt.Valid {
+			continue
+		}
+		if found {
+			switch applySheetChanges(&existing, cell) {
+			case sheetChangeApplied:
+				result.updated++
+			case sheetChangeConflict:
+				result.conflicts++
+			}
+			continue
+		}
+
+		// Cita creada por el bot o el panel que también escribió la celda
+		if linkSheetCell(agent, cell, sheetRowID) {
+			result.updated++
+			continue
+		}
+
+		firstName, lastName := utils.SplitFullName(cell.Client)
+		now := time.Now()
+		appt := models.Appointment{
+			UserID:          agent.UserID,
+			AgentID:         agent.ID,
+			BranchID:        agent.BranchID,
+			ClientFirstName: firstName,
+			ClientLastName:  lastName,
+			ClientPhone:     cell.Phone,
+			Service:         cell.Service,
+			Worker:          cell.Worker,
+			Date:            cell.Start,
+			Status:          cell.Status,
+			Source:          models.AppointmentSourceSheets,
+			SheetRowID:      sheetRowID,
+			SheetID:         agent.GoogleSheetID,
+			LastSyncedAt:    &now,
+		}
+		if err := config.DB.Create(&appt).Error; err != nil {
+			log.Printf("⚠️  [SheetsSync] Agente %d: error guardando cita %s: %v", agent.ID, sheetRowID, err)
+			continue
+		}
+		result.imported++
+	}
+
+	result.updated += cancelRemovedSheetCells(agent, seen)
+	return result
+}
+
+type sheetChange int
+
+const (
+	sheetChangeNone sheetChange = iota
+	sheetChangeApplied
+	sheetChangeConflict
+)
+
+// applySheetChanges compara la celda con la cita y aplica la regla de conflicto
+func applySheetChanges(existing *models.Appointment, cell sheetCellAppointment) sheetChange {
+	updates := map[string]interface{}{}
+	// La hoja no distingue completadas ni inasistencias: esos estados solo
+	// cambian desde el panel
+	if existing.Status != cell.Status && !existing.IsCompleted() && !existing.IsNoShow() {
+		updates["status"] = cell.Status
+	}
+	if cell.Service != "" && existing.Service != cell.Service {
+		updates["service"] = cell.Service
+	}
+	if cell.Worker != "" && existing.Worker != cell.Worker {
+		updates["worker"] = cell.Worker
+	}
+	if cell.Phone != "" && utils.PhoneKey(existing.ClientPhone) != utils.PhoneKey(cell.Phone) {
+		updates["client_phone"] = cell.Phone
+	}
+
+	now := time.Now()
+	if len(updates) == 0 {
+		if existing.LastSyncedAt == nil {
+			config.DB.Model(existing).Update("last_synced_at", now)
+		}
+		return sheetChangeNone
+	}
+
+	if editedInPanel(existing) {
+		log.Printf("⚖️  [SheetsSync] Cita %d editada en ambos lados: se conserva la versión del panel", existing.ID)
+		return sheetChangeConflict
+	}
+
+	updates["last_synced_at"] = now
+	freed := cell.Status == models.AppointmentStatusCancelled && !existing.IsCancelled()
+	if err := config.DB.Model(existing).Updates(updates).Error; err != nil {
+		log.Printf("⚠️  [SheetsSync] Error actualizando cita %d: %v", existing.ID, err)
+		return sheetChangeNone
+	}
+	if freed {
+		OfferFreedSlot(existing)
+	}
+	return sheetChangeApplied
+}
+
+// editedInPanel la cita cambió en la BD después de la última sincronización
+func editedInPanel(appt *models.Appointment) bool {
+	if appt.LastSyncedAt == nil {
+		return true
+	}
+	return appt.UpdatedAt.After(appt.LastSyncedAt.Add(sheetsSyncEditGrace))
+}
+
+// linkSheetCell liga la celda a una cita ya existente en la BD (misma hora y
+// mismo cliente) en lugar de duplicarla
+func linkSheetCell(agent *models.Agent, cell sheetCellAppointment, sheetRowID string) bool {
+	var candidates []models.Appointment
+	config.DB.
+		Where("agent_id = ? AND (sheet_row_id = '' OR sheet_row_id IS NULL)", agent.ID).
+		Where("date >= ? AND date < ?", cell.Start, cell.Start.Add(time.Hour)).
+		Find(&candidates)
+
+	for i := range candidates {
+		appt := &candidates[i]
+		samePhone := cell.Phone != "" && utils.PhoneKey(appt.ClientPhone) == utils.PhoneKey(cell.Phone)
+		sameName := strings.EqualFold(strings.TrimSpace(appt.GetClientFullName()), cell.Client)
+		if !samePhone && !sameName {
+			continue
+		}
+
+		now := time.Now()
+		config.DB.Model(appt).Updates(map[string]interface{}{
+			"sheet_row_id":   sheetRowID,
+			"sheet_id":       agent.GoogleSheetID,
+			"last_synced_at": now,
+		})
+		return true
+	}
+	return false
+}
+
+// cancelRemovedSheetCells cancela las citas de esta semana cuya celda se
+// borró de la hoja. Devuelve cuántas canceló.
+func cancelRemovedSheetCells(agent *models.Agent, seen map[string]bool) int {
+	now := time.Now()
+
+	var linked []models.Appointment
+	config.DB.
+		Where("agent_id = ? AND sheet_row_id <> ''", agent.ID).
+		Where("date > ? AND date <= ?", now, now.Add(sheetsGridHorizon)).
+		Where("status IN ?", []models.AppointmentStatus{models.AppointmentStatusPending, models.AppointmentStatusConfirmed}).
+		Find(&linked)
+
+	cancelled := 0
+	for i := range linked {
+		appt := &linked[i]
+		if seen[appt.SheetRowID] || editedInPanel(appt) {
+			continue
+		}
+		config.DB.Model(appt).Updates(map[string]interface{}{
+			"status":         models.AppointmentStatusCancelled,
+			"last_synced_at": now,
+		})
+		log.Printf("🗑️  [SheetsSync] Cita %d cancelada: su celda se borró de la hoja", appt.ID)
+		OfferFreedSlot(appt)
+		cancelled++
+	}
+	return cancelled
+}
+
+func sameDay(a, b time.Time) bool {
+	y1, m1, d1 := a.Date()
+	y2, m2, d2 := b.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
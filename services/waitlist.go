@@ -0,0 +1,485 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/utils"
+)
+
+// defaultWaitlistHold cuánto tiempo se aparta un horario liberado para el
+// cliente al que se le ofreció. Se puede cambiar con WAITLIST_HOLD (ej. "10m").
+const defaultWaitlistHold = 15 * time.Minute
+
+// waitlistInterval cada cuánto se revisan los horarios apartados vencidos
+const waitlistInterval = time.Minute
+
+// StartWaitlistScheduler vence los horarios apartados sin respuesta (y los
+// ofrece al siguiente cliente) y saca de la lista a quienes ya pasó su
+// ventana de fechas.
+// Bloquea: llamarlo con `go`.
+func StartWaitlistScheduler() {
+	log.Printf("📋 [Waitlist] Scheduler iniciado | Apartado: %v", waitlistHold())
+
+	ticker := time.NewTicker(waitlistInterval)
+	defer ticker.Stop()
+
+	for {
+		expireWaitlistOffers()
+		expireWaitlistEntries()
+		<-ticker.C
+	}
+}
+
+// waitlistHold lee WAITLIST_HOLD
+func waitlistHold() time.Duration {
+	raw := os.Getenv("WAITLIST_HOLD")
+	if raw == "" {
+		return defaultWaitlistHold
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(raw))
+	if err != nil || d <= 0 {
+		log.Printf("⚠️  [Waitlist] WAITLIST_HOLD inválido: %q", raw)
+		return defaultWaitlistHold
+	}
+	return d
+}
+
+// ============================================
+// ALTA EN LA LISTA
+// ============================================
+
+// JoinWaitlist anota al cliente en la lista de espera de la sucursal. Si ya
+// estaba esperando el mismo servicio, amplía su ventana de fechas en lugar de
+// duplicarlo (conserva su lugar).
+func JoinWaitlist(entry *models.WaitlistEntry) error {
+	if entry.DateTo.Before(entry.DateFrom) {
+		return fmt.Errorf("la fecha final es anterior a la inicial")
+	}
+
+	phone := utils.PhoneKey(entry.ClientPhone)
+	var active []models.WaitlistEntry
+	config.DB.
+		Where("branch_id = ? AND status IN ?", entry.BranchID, []models.WaitlistStatus{models.WaitlistStatusWaiting, models.WaitlistStatusOffered}).
+		Where("LOWER(service) = ?", strings.ToLower(entry.Service)).
+		Find(&active)
+
+	for i := range active {
+		existing := &active[i]
+		if utils.PhoneKey(existing.ClientPhone) != phone {
+			continue
+		}
+		if entry.DateFrom.Before(existing.DateFrom) {
+			existing.DateFrom = entry.DateFrom
+		}
+		if entry.DateTo.After(existing.DateTo) {
+			existing.DateTo = entry.DateTo
+		}
+		existing.Worker = entry.Worker
+		if err := config.DB.Model(existing).Updates(map[string]interface{}{
+			"date_from": existing.DateFrom,
+			"date_to":   existing.DateTo,
+			"worker":    existing.Worker,
+		}).Error; err != nil {
+			return err
+		}
+		*entry = *existing
+		return nil
+	}
+
+	entry.Status = models.WaitlistStatusWaiting
+	if err := config.DB.Create(entry).Error; err != nil {
+		return err
+	}
+	log.Printf("📋 [Waitlist] Cliente %s en espera | Sucursal %d | %s | %s → %s",
+		entry.ClientPhone, entry.BranchID, entry.Service,
+		entry.DateFrom.Format("02/01/2006"), entry.DateTo.Format("02/01/2006"))
+	return nil
+}
+
+// ============================================
+// OFERTA DE HORARIOS LIBERADOS
+// ============================================
+
+// OfferFreedSlot ofrece a la lista de espera el horario de una cita que se
+// canceló o eliminó. Corre en segundo plano: quien cancela no espera el envío.
+func OfferFreedSlot(appt *models.Appointment) {
+	if appt == nil || appt.ID == 0 || !appt.Date.After(time.Now()) {
+		return
+	}
+	freed := *appt
+	go func() {
+		branch := appointmentBranch(&freed)
+		if branch == nil {
+			return
+		}
+		offerSlotToWaitlist(branch, freed.Date, freed.ID)
+	}()
+}
+
+// offerSlotToWaitlist aparta el horario para el primer cliente en espera (en
+// orden de llegada) al que le sirve y le escribe por WhatsApp. Se salta a
+// quienes ya se les ofreció este mismo horario.
+func offerSlotToWaitlist(branch *models.MyBusinessInfo, start time.Time, sourceID uint) {
+	hold := waitlistHold()
+	// Si el horario empieza antes de que venza el apartado no da tiempo de responder
+	if start.Before(time.Now().Add(hold)) {
+		return
+	}
+
+	var entries []models.WaitlistEntry
+	if err := config.DB.
+		Where("branch_id = ? AND status = ?", branch.ID, models.WaitlistStatusWaiting).
+		Order("created_at ASC, id ASC").
+		Find(&entries).Error; err != nil {
+		log.Printf("❌ [Waitlist] Error consultando la lista de la sucursal %d: %v", branch.ID, err)
+		return
+	}
+
+	var offered []uint
+	config.DB.Model(&models.WaitlistOffer{}).
+		Where("branch_id = ? AND slot_start = ?", branch.ID, start).
+		Pluck("entry_id", &offered)
+	skip := make(map[uint]bool, len(offered))
+	for _, id := range offered {
+		skip[id] = true
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if skip[entry.ID] || !entry.Covers(start) {
+			continue
+		}
+
+		offer, ok := reserveWaitlistOffer(branch, entry, start, sourceID, hold)
+		if !ok {
+			continue
+		}
+
+		if err := sendWaitlistOffer(branch, entry, offer); err != nil {
+			log.Printf("⚠️  [Waitlist] No se pudo ofrecer el horario a %s: %v", entry.ClientPhone, err)
+			closeWaitlistOffer(offer, models.WaitlistOfferExpired)
+			continue
+		}
+
+		log.Printf("✅ [Waitlist] Horario %s ofrecido a %s (entrada %d) hasta %s",
+			start.Format("02/01/2006 15:04"), entry.ClientPhone, entry.ID, offer.ExpiresAt.Format("15:04"))
+		return
+	}
+}
+
+// reserveWaitlistOffer valida que el horario le sirva al cliente (servicio y
+// trabajador) y lo aparta. ok=false si no le sirve.
+func reserveWaitlistOffer(branch *models.MyBusinessInfo, entry *models.WaitlistEntry, start time.Time, sourceID uint, hold time.Duration) (*models.WaitlistOffer, bool) {
+	unlock := LockBranch(branch.ID)
+	defer unlock()
+
+	slot, err := CheckSlot(branch, entry.Service, entry.Worker, start, 0)
+	if err != nil {
+		return nil, false
+	}
+
+	offer := models.WaitlistOffer{
+		EntryID:             entry.ID,
+		BranchID:            branch.ID,
+		SlotStart:           start,
+		SlotEnd:             start.Add(time.Duration(ServiceDuration(branch, entry.Service)) * time.Minute),
+		Worker:              slot.Worker,
+		Status:              models.WaitlistOfferPending,
+		ExpiresAt:           time.Now().Add(hold),
+		SourceAppointmentID: sourceID,
+	}
+
+	tx := config.DB.Begin()
+	if err := tx.Create(&offer).Error; err != nil {
+		tx.Rollback()
+		log.Printf("❌ [Waitlist] Error apartando horario: %v", err)
+		return nil, false
+	}
+	result := tx.Model(entry).Where("status = ?", models.WaitlistStatusWaiting).Update("status", models.WaitlistStatusOffered)
+	if result.Error != nil || result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil, false // otro proceso ya le ofreció un horario
+	}
+	tx.Commit()
+
+	return &offer, true
+}
+
+// sendWaitlistOffer escribe al cliente desde el agente por el que se anotó
+func sendWaitlistOffer(branch *models.MyBusinessInfo, entry *models.WaitlistEntry, offer *models.WaitlistOffer) error {
+	var agent models.Agent
+	if err := config.DB.First(&agent, entry.AgentID).Error; err != nil {
+		return fmt.Errorf("agente %d no encontrado", entry.AgentID)
+	}
+	if !agent.IsActive {
+		return fmt.Errorf("agente %d inactivo", agent.ID)
+	}
+	return SendWhatsAppViaAgent(&agent, entry.ClientPhone, BuildWaitlistOfferMessage(branch, entry, offer), models.TemplatePurposeAppointment)
+}
+
+// BuildWaitlistOfferMessage texto con el horario apartado para el cliente
+func BuildWaitlistOfferMessage(branch *models.MyBusinessInfo, entry *models.WaitlistEntry, offer *models.WaitlistOffer) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🎉 *¡Se liberó un horario en %s!*\n\n", branch.BusinessName))
+	if entry.Service != "" {
+		sb.WriteString(fmt.Sprintf("💼 *Servicio:* %s\n", entry.Service))
+	}
+	if offer.Worker != "" {
+		sb.WriteString(fmt.Sprintf("👨‍💼 *Con:* %s\n", offer.Worker))
+	}
+	sb.WriteString(fmt.Sprintf("📅 *Fecha:* %s\n", offer.SlotStart.Format("02/01/2006")))
+	sb.WriteString(fmt.Sprintf("🕐 *Hora:* %s\n\n", offer.SlotStart.Format("15:04")))
+	sb.WriteString(fmt.Sprintf("Te lo apartamos hasta las %s. Responde *sí* para reservarlo o *no* para dejarlo pasar.",
+		offer.ExpiresAt.Format("15:04")))
+	return sb.String()
+}
+
+// closeWaitlistOffer cierra la oferta pendiente y regresa al cliente a la
+// lista. Devuelve false si la oferta ya no estaba pendiente.
+func closeWaitlistOffer(offer *models.WaitlistOffer, status models.WaitlistOfferStatus) bool {
+	now := time.Now()
+	updates := map[string]interface{}{"status": status}
+	if status != models.WaitlistOfferExpired {
+		updates["responded_at"] = &now
+	}
+
+	result := config.DB.Model(offer).Where("status = ?", models.WaitlistOfferPending).Updates(updates)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	offer.Status = status
+
+	config.DB.Model(&models.WaitlistEntry{}).
+		Where("id = ? AND status = ?", offer.EntryID, models.WaitlistStatusOffered).
+		Update("status", models.WaitlistStatusWaiting)
+	return true
+}
+
+// expireWaitlistOffers vence los apartados sin respuesta y ofrece cada
+// horario al siguiente cliente
+func expireWaitlistOffers() {
+	var offers []models.WaitlistOffer
+	if err := config.DB.
+		Where("status = ? AND expires_at <= ?", models.WaitlistOfferPending, time.Now()).
+		Find(&offers).Error; err != nil {
+		log.Printf("❌ [Waitlist] Error consultando apartados: %v", err)
+		return
+	}
+
+	for i := range offers {
+		offer := &offers[i]
+		if !closeWaitlistOffer(offer, models.WaitlistOfferExpired) {
+			continue
+		}
+		log.Printf("⌛ [Waitlist] Apartado %d vencido sin respuesta (%s)", offer.ID, offer.SlotStart.Format("02/01/2006 15:04"))
+		offerNextInLine(offer)
+	}
+}
+
+// offerNextInLine ofrece el horario de una oferta cerrada al siguiente cliente
+func offerNextInLine(offer *models.WaitlistOffer) {
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, offer.BranchID).Error; err != nil {
+		return
+	}
+	offerSlotToWaitlist(&branch, offer.SlotStart, offer.SourceAppointmentID)
+}
+
+// expireWaitlistEntries saca de la lista a quienes ya pasó su ventana
+func expireWaitlistEntries() {
+	today := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, time.Local)
+	result := config.DB.Model(&models.WaitlistEntry{}).
+		Where("status = ? AND date_to < ?", models.WaitlistStatusWaiting, today).
+		Update("status", models.WaitlistStatusExpired)
+	if result.RowsAffected > 0 {
+		log.Printf("📋 [Waitlist] %d cliente(s) salieron de la lista: pasó su ventana de fechas", result.RowsAffected)
+	}
+}
+
+// ============================================
+// RESPUESTA DEL CLIENTE
+// ============================================
+
+// WaitlistReply resultado de la respuesta del cliente a un horario ofrecido
+type WaitlistReply struct {
+	Handled     bool
+	Message     string
+	Appointment *models.Appointment // cita agendada si aceptó
+}
+
+// ReplyWaitlistOffer aplica el "sí" / "no" del cliente al horario que se le
+// apartó. Handled=false si el teléfono no tiene un horario ofrecido.
+func ReplyWaitlistOffer(agentID uint, phone string, accept bool) (*WaitlistReply, error) {
+	offer := pendingOfferFor(agentID, utils.PhoneKey(phone))
+	if offer == nil {
+		return &WaitlistReply{Handled: false}, nil
+	}
+	entry := &offer.Entry
+
+	var branch models.MyBusinessInfo
+	if err := config.DB.First(&branch, offer.BranchID).Error; err != nil {
+		return nil, fmt.Errorf("sucursal no encontrada")
+	}
+
+	if !offer.IsHolding() {
+		if closeWaitlistOffer(offer, models.WaitlistOfferExpired) {
+			go offerNextInLine(offer)
+		}
+		return &WaitlistReply{
+			Handled: true,
+			Message: "⌛ El horario que te apartamos ya venció 😔 Sigues en la lista de espera y te avisamos si se libera otro.",
+		}, nil
+	}
+
+	if !accept {
+		if closeWaitlistOffer(offer, models.WaitlistOfferDeclined) {
+			log.Printf("📋 [Waitlist] %s dejó pasar el horario %s", entry.ClientPhone, offer.SlotStart.Format("02/01/2006 15:04"))
+			go offerNextInLine(offer)
+		}
+		return &WaitlistReply{
+			Handled: true,
+			Message: "👌 Entendido, dejamos pasar ese horario. Sigues en la lista de espera y te avisamos si se libera otro.",
+		}, nil
+	}
+
+	appt, err := bookWaitlistOffer(&branch, offer)
+	if err != nil {
+		log.Printf("⚠️  [Waitlist] No se pudo agendar el horario apartado %d: %v", offer.ID, err)
+		return &WaitlistReply{
+			Handled: true,
+			Message: "😔 Ese horario ya no está disponible. Sigues en la lista de espera y te avisamos si se libera otro.",
+		}, nil
+	}
+
+	go func() {
+		if err := CreateAppointmentCalendarEvent(appt, ""); err != nil {
+			log.Printf("⚠️  [Waitlist] Calendar de la cita %d: %v", appt.ID, err)
+		}
+		if err := addAppointmentToSheets(appt); err != nil {
+			log.Printf("⚠️  [Waitlist] Sheets de la cita %d: %v", appt.ID, err)
+		}
+	}()
+
+	return &WaitlistReply{
+		Handled:     true,
+		Message:     buildWaitlistBookedMessage(&branch, appt),
+		Appointment: appt,
+	}, nil
+}
+
+// pendingOfferFor oferta pendiente más reciente del teléfono en el agente
+func pendingOfferFor(agentID uint, phone string) *models.WaitlistOffer {
+	if phone == "" {
+		return nil
+	}
+
+	var offers []models.WaitlistOffer
+	config.DB.Preload("Entry").
+		Joins("JOIN waitlist_entries ON waitlist_entries.id = waitlist_offers.entry_id").
+		Where("waitlist_offers.status = ? AND waitlist_entries.agent_id = ?", models.WaitlistOfferPending, agentID).
+		Order("waitlist_offers.created_at DESC").
+		Limit(50).
+		Find(&offers)
+
+	for i := range offers {
+		if utils.PhoneKey(offers[i].Entry.ClientPhone) == phone {
+			return &offers[i]
+		}
+	}
+	return nil
+}
+
+// bookWaitlistOffer agenda la cita del horario apartado. La oferta deja de
+// apartar el horario antes de validarlo para no chocar consigo misma.
+func bookWaitlistOffer(branch *models.MyBusinessInfo, offer *models.WaitlistOffer) (*models.Appointment, error) {
+	entry := &offer.Entry
+
+	unlock := LockBranch(branch.ID)
+	defer unlock()
+
+	if !closeWaitlistOffer(offer, models.WaitlistOfferAccepted) {
+		return nil, fmt.Errorf("el horario ya no está apartado")
+	}
+
+	slot, err := CheckSlot(branch, entry.Service, offer.Worker, offer.SlotStart, 0)
+	if err != nil {
+		config.DB.Model(offer).Update("status", models.WaitlistOfferTaken)
+		return nil, err
+	}
+
+	firstName, lastName := utils.SplitFullName(entry.ClientName)
+	appt := models.Appointment{
+		UserID:          entry.UserID,
+		AgentID:         entry.AgentID,
+		BranchID:        branch.ID,
+		ClientFirstName: firstName,
+		ClientLastName:  lastName,
+		ClientPhone:     entry.ClientPhone,
+		Service:         entry.Service,
+		Worker:          slot.Worker,
+		Date:            offer.SlotStart,
+		DurationMinutes: ServiceDuration(branch, entry.Service),
+		Notes:           "Agendada desde la lista de espera",
+		Status:          models.AppointmentStatusConfirmed,
+		Source:          models.AppointmentSourceAgent,
+	}
+	appt.SetResources(slot.Resources)
+	if err := config.DB.Create(&appt).Error; err != nil {
+		return nil, fmt.Errorf("error guardando la cita: %w", err)
+	}
+
+	config.DB.Model(entry).Updates(map[string]interface{}{
+		"status":         models.WaitlistStatusBooked,
+		"appointment_id": appt.ID,
+	})
+
+	log.Printf("✅ [Waitlist] Cita %d agendada desde la lista de espera | %s | %s",
+		appt.ID, entry.ClientPhone, appt.Date.Format("02/01/2006 15:04"))
+	return &appt, nil
+}
+
+// buildWaitlistBookedMessage confirmación para el cliente con el enlace .ics
+func buildWaitlistBookedMessage(branch *models.MyBusinessInfo, appt *models.Appointment) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("✅ *¡Listo! Tu cita en %s quedó agendada*\n\n", branch.BusinessName))
+	if appt.Service != "" {
+		sb.WriteString(fmt.Sprintf("💼 *Servicio:* %s\n", appt.Service))
+	}
+	if appt.Worker != "" {
+		sb.WriteString(fmt.Sprintf("👨‍💼 *Con:* %s\n", appt.Worker))
+	}
+	sb.WriteString(fmt.Sprintf("📅 *Fecha:* %s\n", appt.Date.Format("02/01/2006")))
+	sb.WriteString(fmt.Sprintf("🕐 *Hora:* %s\n", appt.Date.Format("15:04")))
+	if icsURL, err := AppointmentInviteURL(appt); err == nil {
+		sb.WriteString(fmt.Sprintf("\n📆 Agrégala a tu calendario: %s\n", icsURL))
+	}
+	sb.WriteString("\n¡Te esperamos! 😊")
+	return sb.String()
+}
+
+// waitlistHolds horarios apartados vigentes de la sucursal en el rango; el
+// motor de disponibilidad los cuenta como ocupados
+func waitlistHolds(branch *models.MyBusinessInfo, from, to time.Time) []busyBlock {
+	var offers []models.WaitlistOffer
+	config.DB.Preload("Entry").
+		Where("branch_id = ? AND status = ? AND expires_at > ?", branch.ID, models.WaitlistOfferPending, time.Now()).
+		Where("slot_start < ? AND slot_end > ?", to, from).
+		Find(&offers)
+
+	blocks := make([]busyBlock, 0, len(offers))
+	for _, o := range offers {
+		blocks = append(blocks, busyBlock{
+			start:     o.SlotStart,
+			end:       o.SlotEnd,
+			worker:    strings.TrimSpace(o.Worker),
+			resources: ServiceResources(branch, o.Entry.Service),
+		})
+	}
+	return blocks
+}
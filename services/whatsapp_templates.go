@@ -0,0 +1,311 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"attomos/config"
+	"attomos/models"
+	"attomos/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const metaGraphURL = "https://graph.facebook.com/v22.0"
+
+// MetaTemplate plantilla tal como la devuelve /{waba-id}/message_templates
+type MetaTemplate struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Language   string            `json:"language"`
+	Category   string            `json:"category"`
+	Status     string            `json:"status"`
+	Components []json.RawMessage `json:"components"`
+}
+
+// templateParamRegex detecta variables {{1}}, {{2}}, ... en el cuerpo
+var templateParamRegex = regexp.MustCompile(`\{\{\s*(\d+)\s*\}\}`)
+
+var metaHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// FetchMetaTemplates lista todas las plantillas de la WABA del agente
+func FetchMetaTemplates(agent *models.Agent) ([]MetaTemplate, error) {
+	if agent.MetaAccessToken == "" || agent.MetaWABAID == "" {
+		return nil, fmt.Errorf("el agente no tiene WhatsApp Business conectado")
+	}
+
+	var all []MetaTemplate
+	next := fmt.Sprintf("%s/%s/message_templates?fields=id,name,language,category,status,components&limit=100",
+		metaGraphURL, agent.MetaWABAID)
+
+	for next != "" {
+		req, err := http.NewRequest("GET", next, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error creando request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+agent.MetaAccessToken)
+
+		resp, err := metaHTTPClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("error consultando plantillas: %w", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("Meta retornó %d: %s", resp.StatusCode, string(body))
+		}
+
+		var page struct {
+			Data   []MetaTemplate `json:"data"`
+			Paging struct {
+				Next string `json:"next"`
+			} `json:"paging"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("error parseando plantillas: %w", err)
+		}
+
+		all = append(all, page.Data...)
+		next = page.Paging.Next
+	}
+
+	return all, nil
+}
+
+// CreateMetaTemplate envía una plantilla nueva a revisión de Meta.
+// Retorna el ID y el estado inicial (normalmente PENDING).
+func CreateMetaTemplate(agent *models.Agent, name, language, category string, components []json.RawMessage) (string, string, error) {
+	if agent.MetaAccessToken == "" || agent.MetaWABAID == "" {
+		return "", "", fmt.Errorf("el agente no tiene WhatsApp Business conectado")
+	}
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"name":       name,
+		"language":   language,
+		"category":   category,
+		"components": components,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("error serializando plantilla: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s/message_templates", metaGraphURL, agent.MetaWABAID), bytes.NewBuffer(payload))
+	if err != nil {
+		return "", "", fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+agent.MetaAccessToken)
+
+	resp, err := metaHTTPClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("error creando plantilla: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("Meta retornó %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", "", fmt.Errorf("error parseando respuesta: %w", err)
+	}
+
+	return result.ID, result.Status, nil
+}
+
+// DeleteMetaTemplate elimina una plantilla (todas sus traducciones) de la WABA
+func DeleteMetaTemplate(agent *models.Agent, name string) error {
+	if agent.MetaAccessToken == "" || agent.MetaWABAID == "" {
+		return fmt.Errorf("el agente no tiene WhatsApp Business conectado")
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/message_templates?name=%s", metaGraphURL, agent.MetaWABAID, url.QueryEscape(name))
+	req, err := http.NewRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creando request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+agent.MetaAccessToken)
+
+	resp, err := metaHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error eliminando plantilla: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("Meta retornó %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// SyncWhatsAppTemplates trae las plantillas de Meta y actualiza la copia local.
+// Conserva el propósito asignado por el dueño y borra las que ya no existen.
+func SyncWhatsAppTemplates(agent *models.Agent) ([]models.WhatsAppTemplate, error) {
+	remote, err := FetchMetaTemplates(agent)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	keep := make([]uint, 0, len(remote))
+
+	for _, mt := range remote {
+		components, _ := json.Marshal(mt.Components)
+
+		var tmpl models.WhatsAppTemplate
+		err := config.DB.Where("agent_id = ? AND name = ? AND language = ?", agent.ID, mt.Name, mt.Language).
+			First(&tmpl).Error
+		if err != nil {
+			tmpl = models.WhatsAppTemplate{
+				UserID:   agent.UserID,
+				AgentID:  agent.ID,
+				Name:     mt.Name,
+				Language: mt.Language,
+				Purpose:  models.TemplatePurposeUnassigned,
+			}
+		}
+
+		tmpl.MetaTemplateID = mt.ID
+		tmpl.Category = mt.Category
+		tmpl.Status = mt.Status
+		tmpl.Components = string(components)
+		tmpl.BodyParams = CountTemplateBodyParams(mt.Components)
+		tmpl.LastSyncedAt = &now
+
+		if err := config.DB.Save(&tmpl).Error; err != nil {
+			log.Printf("⚠️  [Templates] Agente %d: error guardando %s/%s: %v", agent.ID, mt.Name, mt.Language, err)
+			continue
+		}
+		keep = append(keep, tmpl.ID)
+	}
+
+	deleteQuery := config.DB.Where("agent_id = ?", agent.ID)
+	if len(keep) > 0 {
+		deleteQuery = deleteQuery.Where("id NOT IN ?", keep)
+	}
+	deleteQuery.Delete(&models.WhatsAppTemplate{})
+
+	var templates []models.WhatsAppTemplate
+	config.DB.Where("agent_id = ?", agent.ID).Order("name ASC").Find(&templates)
+
+	log.Printf("✅ [Templates] Agente %d: %d plantilla(s) sincronizadas", agent.ID, len(templates))
+	return templates, nil
+}
+
+// CountTemplateBodyParams cuenta las variables {{n}} del componente BODY
+func CountTemplateBodyParams(components []json.RawMessage) int {
+	for _, raw := range components {
+		var comp struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if json.Unmarshal(raw, &comp) != nil || !strings.EqualFold(comp.Type, "BODY") {
+			continue
+		}
+		max := 0
+		for _, m := range templateParamRegex.FindAllStringSubmatch(comp.Text, -1) {
+			var n int
+			fmt.Sscanf(m[1], "%d", &n)
+			if n > max {
+				max = n
+			}
+		}
+		return max
+	}
+	return 0
+}
+
+// ============================================
+// VENTANA DE 24 HORAS
+// ============================================
+
+// RecordInboundMessages registra el último mensaje entrante de cada remitente
+// de un payload de webhook de Meta (se llama desde el proxy del webhook).
+func RecordInboundMessages(agentID uint, webhookBody []byte) {
+	var payload struct {
+		Entry []struct {
+			Changes []struct {
+				Value struct {
+					Messages []struct {
+						From string `json:"from"`
+					} `json:"messages"`
+				} `json:"value"`
+			} `json:"changes"`
+		} `json:"entry"`
+	}
+	if err := json.Unmarshal(webhookBody, &payload); err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, entry := range payload.Entry {
+		for _, change := range entry.Changes {
+			for _, msg := range change.Value.Messages {
+				key := utils.PhoneKey(msg.From)
+				if key == "" {
+					continue
+				}
+				contact := models.WhatsAppContact{
+					AgentID:       agentID,
+					PhoneKey:      key,
+					WaID:          msg.From,
+					LastInboundAt: now,
+				}
+				config.DB.Clauses(clause.OnConflict{
+					Columns:   []clause.Column{{Name: "agent_id"}, {Name: "phone_key"}},
+					DoUpdates: clause.AssignmentColumns([]string{"wa_id", "last_inbound_at", "updated_at"}),
+				}).Create(&contact)
+			}
+		}
+	}
+}
+
+// IsSessionOpen indica si el cliente escribió al agente en las últimas 24h
+func IsSessionOpen(agentID uint, phone string) bool {
+	var contact models.WhatsAppContact
+	if err := config.DB.Where("agent_id = ? AND phone_key = ?", agentID, utils.PhoneKey(phone)).
+		First(&contact).Error; err != nil {
+		return false
+	}
+	return contact.IsSessionOpen()
+}
+
+// ErrNoTemplateForPurpose el dueño no asignó ninguna plantilla aprobada al propósito
+var ErrNoTemplateForPurpose = errors.New("no hay plantilla aprobada asignada")
+
+// FindTemplateForPurpose busca la plantilla aprobada que el dueño asignó al
+// propósito. No hay respaldo: sin asignación explícita se devuelve
+// ErrNoTemplateForPurpose en vez de enviar una plantilla cualquiera. Solo
+// aplica a plantillas con a lo más una variable (el mensaje va en {{1}}).
+func FindTemplateForPurpose(agentID uint, purpose string) (*models.WhatsAppTemplate, error) {
+	if purpose == models.TemplatePurposeUnassigned {
+		return nil, fmt.Errorf("%w: propósito vacío", ErrNoTemplateForPurpose)
+	}
+	var tmpl models.WhatsAppTemplate
+	err := config.DB.Where("agent_id = ? AND purpose = ? AND status = ? AND body_params <= 1", agentID, purpose, models.TemplateStatusApproved).
+		Order("updated_at DESC").First(&tmpl).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w para '%s'", ErrNoTemplateForPurpose, purpose)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error buscando plantilla: %w", err)
+	}
+	return &tmpl, nil
+}
@@ -11,6 +11,10 @@ let currentFilters = {
     search: ''
 };
 let openDropdown = null;
+let lastSheetsSync = null;
+
+// Cada cuánto se consulta el estado de la sincronización con Sheets
+const SYNC_POLL_INTERVAL = 15000;
 
 // ==========================================
 // INICIALIZACIÓN
@@ -33,6 +37,7 @@ async function initializeAppointments() {
     await loadAppointments();
     updateStats();
     renderAppointments();
+    pollSyncStatus();
 }
 
 function setupEventListeners() {
@@ -142,6 +147,27 @@ function openAppointmentModal() {
                     <input type="hidden" id="appointmentTime" required>
                 </div>
 
+                <div class="form-group">
+                    <label class="form-label"><i class="lni lni-reload"></i> Repetir</label>
+                    <select class="form-input" id="repeatFrequency">
+                        <option value="">No se repite</option>
+                        <option value="weekly">Cada semana</option>
+                        <option value="biweekly">Cada dos semanas</option>
+                        <option value="monthly">Cada mes</option>
+                    </select>
+                </div>
+
+                <div class="form-group repeat-option" style="display:none">
+                    <label class="form-label"><i class="lni lni-list"></i> Número de citas</label>
+                    <input type="number" class="form-input" id="repeatCount" min="1" placeholder="Sin límite">
+                </div>
+
+                <div class="form-group repeat-option" style="display:none">
+                    <label class="form-label"><i class="lni lni-calendar"></i> Hasta</label>
+                    <input type="date" class="form-input" id="repeatUntil">
+                    <small class="form-help">Indica número de citas o fecha de fin; los días festivos se saltan</small>
+                </div>
+
                 <input type="hidden" id="appointmentStatus" value="confirmed">
             </div>
 
@@ -164,6 +190,12 @@ function openAppointmentModal() {
     dateInput.min = today;
     dateInput.value = today;
 
+    document.getElementById('repeatFrequency').addEventListener('change', e => {
+        document.querySelectorAll('.repeat-option').forEach(el => {
+            el.style.display = e.target.value ? '' : 'none';
+        });
+    });
+
     document.getElementById('createAppointmentForm').addEventListener('submit', handleCreateAppointment);
 
     modal.classList.add('active');
@@ -216,9 +248,20 @@ async function handleCreateAppointment(e) {
             status:          formData.status || 'confirmed'
         };
 
+        // Cita recurrente: el backend genera las ocurrencias de la serie
+        const frequency = document.getElementById('repeatFrequency').value;
+        if (frequency) {
+            body.frequency = frequency;
+            body.count = parseInt(document.getElementById('repeatCount').value) || 0;
+            body.until = document.getElementById('repeatUntil').value;
+            if (body.count && body.until) {
+                throw new Error('Indica el número de citas o la fecha de fin, no ambos');
+            }
+        }
+
         console.log('📤 Enviando cita:', body);
 
-        const response = await fetch('/api/appointments', {
+        const response = await fetch(frequency ? '/api/appointment-series' : '/api/appointments', {
             method: 'POST',
             credentials: 'include',
             headers: { 'Content-Type': 'application/json' },
@@ -234,7 +277,12 @@ async function handleCreateAppointment(e) {
         }
 
         closeAppointmentModal();
-        showNotification('✅ Cita creada exitosamente', 'success');
+        if (frequency) {
+            const data = await response.json().catch(() => ({}));
+            showNotification(seriesCreatedMessage(data), data.conflicts && data.conflicts.length ? 'warning' : 'success');
+        } else {
+            showNotification('✅ Cita creada exitosamente', 'success');
+        }
         await loadAppointments();
         updateStats();
         renderAppointments();
@@ -247,6 +295,17 @@ async function handleCreateAppointment(e) {
     }
 }
 
+// seriesCreatedMessage resumen de la serie creada (festivos saltados y empalmes)
+function seriesCreatedMessage(data) {
+    let msg = `✅ Serie creada: ${data.created || 0} cita(s) agendadas`;
+    if (data.holidays && data.holidays.length) msg += `, ${data.holidays.length} en día festivo se saltaron`;
+    if (data.conflicts && data.conflicts.length) {
+        msg += `. ⚠️ ${data.conflicts.length} se empalman con otra cita: ` +
+            data.conflicts.map(c => `${c.date} ${formatTime(c.time)}`).join(', ');
+    }
+    return msg;
+}
+
 // ==========================================
 // DROPDOWNS PERSONALIZADOS
 // ==========================================
@@ -420,6 +479,67 @@ async function loadAppointments() {
     }
 }
 
+// ==========================================
+// SINCRONIZACIÓN CON GOOGLE SHEETS
+// ==========================================
+
+// Las hojas se sincronizan en segundo plano; cuando termina una pasada
+// nueva se recargan las citas.
+async function pollSyncStatus() {
+    try {
+        const response = await fetch('/api/appointments/sync-status', { credentials: 'include' });
+        if (response.ok) {
+            const data = await response.json();
+            renderSyncStatus(data);
+
+            const success = data.lastSuccessAt || null;
+            if (lastSheetsSync !== null && success && success !== lastSheetsSync) {
+                const changed = (data.agents || []).some(a => a.imported > 0 || a.updated > 0);
+                if (changed) {
+                    await loadAppointments();
+                    updateStats();
+                    renderAppointments();
+                }
+            }
+            if (success) lastSheetsSync = success;
+            else if (lastSheetsSync === null) lastSheetsSync = '';
+        }
+    } catch (error) {
+        console.error('❌ Error consultando sincronización:', error);
+    }
+    setTimeout(pollSyncStatus, SYNC_POLL_INTERVAL);
+}
+
+function renderSyncStatus(data) {
+    const box = document.getElementById('syncStatus');
+    const text = document.getElementById('syncStatusText');
+    const agentsStatus = data.agents || [];
+    if (!box || !text || agentsStatus.length === 0) return;
+
+    box.style.display = 'flex';
+    box.classList.remove('syncing', 'error', 'backoff');
+
+    const failing = agentsStatus.find(a => a.status === 'error' || a.status === 'backoff');
+    if (data.syncing) {
+        box.classList.add('syncing');
+        text.textContent = 'Sincronizando con Google Sheets...';
+        box.title = '';
+    } else if (failing) {
+        box.classList.add(failing.status);
+        text.textContent = failing.status === 'backoff'
+            ? 'Google limitó las consultas, reintentando más tarde'
+            : 'Error al sincronizar con Google Sheets';
+        box.title = `${failing.agentName}: ${failing.lastError || ''}`;
+    } else if (data.lastSuccessAt) {
+        const time = new Date(data.lastSuccessAt).toLocaleTimeString('es-MX', { hour: '2-digit', minute: '2-digit' });
+        const conflicts = agentsStatus.reduce((sum, a) => sum + (a.conflicts || 0), 0);
+        text.textContent = `Sheets sincronizado ${time}`;
+        box.title = conflicts > 0
+            ? `${conflicts} cita(s) editadas en el panel y en la hoja: se conservó la versión del panel`
+            : '';
+    }
+}
+
 // ==========================================
 // RENDERIZADO
 // ==========================================
@@ -544,7 +664,7 @@ function createTableRow(appt) {
             <td>
                 <div class="table-phone">${appt.phone ? `<a href="tel:${appt.phone}">${escapeHtml(appt.phone)}</a>` : '-'}</div>
             </td>
-            <td><div class="table-service">${escapeHtml(appt.service)}</div></td>
+            <td><div class="table-service">${escapeHtml(appt.service)}${appt.seriesId ? ' <i class="lni lni-reload series-tag" title="Cita recurrente"></i>' : ''}</div></td>
             <td>
                 ${appt.worker ? `<div class="table-worker"><i class="lni lni-user"></i> ${escapeHtml(appt.worker)}</div>` : '-'}
             </td>
@@ -565,8 +685,11 @@ function createTableRow(appt) {
                     <div class="actions-menu" id="dropdown-${appt.id}">
                         ${appt.sheetUrl ? `<div class="action-item sheet" onclick="openGoogleSheet('${appt.sheetUrl}')"><i class="lni lni-text-format"></i> Ver Sheet</div>` : ''}
                         ${appt.phone ? `<div class="action-item whatsapp" onclick="sendWhatsApp('${appt.phone}', '${escapeHtml(appt.client)}')"><i class="lni lni-whatsapp"></i> WhatsApp</div>` : ''}
+                        ${appt.status === 'pending' || appt.status === 'confirmed' ? `<div class="action-item reschedule" onclick="openRescheduleModal(${appt.id})"><i class="lni lni-calendar"></i> Reprogramar</div>` : ''}
                         ${appt.status !== 'completed' ? `<div class="action-item complete" onclick="updateAppointmentStatus(${appt.id}, 'completed')"><i class="lni lni-checkmark-circle"></i> Marcar Completada</div>` : ''}
                         ${appt.status !== 'cancelled' ? `<div class="action-item cancel" onclick="updateAppointmentStatus(${appt.id}, 'cancelled')"><i class="lni lni-ban"></i> Marcar Cancelada</div>` : ''}
+                        ${appt.seriesId && (appt.status === 'pending' || appt.status === 'confirmed') ? `<div class="action-item cancel" onclick="updateAppointmentStatus(${appt.id}, 'cancelled', 'following')"><i class="lni lni-ban"></i> Cancelar esta y siguientes</div>` : ''}
+                        ${appt.status === 'pending' || appt.status === 'confirmed' ? `<div class="action-item no-show" onclick="updateAppointmentStatus(${appt.id}, 'no_show')"><i class="lni lni-user"></i> Marcar No asistió</div>` : ''}
                         <div class="action-item delete" onclick="deleteAppointment(${appt.id}, '${escapeHtml(appt.client)}')"><i class="lni lni-trash-can"></i> Eliminar</div>
                     </div>
                 </div>
@@ -690,8 +813,8 @@ function openGoogleSheet(url) {
 }
 
 
-async function updateAppointmentStatus(id, newStatus) {
-    const labels = { completed: 'completada', cancelled: 'cancelada' };
+async function updateAppointmentStatus(id, newStatus, scope = 'this') {
+    const labels = { completed: 'completada', cancelled: 'cancelada', no_show: 'inasistencia' };
     closeAllDropdowns();
     try {
         // Ruta correcta del backend: PATCH /api/appointments/:id/status
@@ -699,7 +822,7 @@ async function updateAppointmentStatus(id, newStatus) {
             method: 'PATCH',
             credentials: 'include',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ status: newStatus })
+            body: JSON.stringify({ status: newStatus, scope: scope })
         });
 
         if (!response.ok) {
@@ -710,7 +833,12 @@ async function updateAppointmentStatus(id, newStatus) {
             throw new Error(err.error || err.message || `Error ${response.status}`);
         }
 
-        showNotification(`Cita marcada como ${labels[newStatus]}`, 'success');
+        if (scope === 'following') {
+            const data = await response.json().catch(() => ({}));
+            showNotification(`${data.cancelled || 0} cita(s) de la serie canceladas`, 'success');
+        } else {
+            showNotification(`Cita marcada como ${labels[newStatus]}`, 'success');
+        }
         await loadAppointments();
         updateStats();
         renderAppointments();
@@ -720,6 +848,253 @@ async function updateAppointmentStatus(id, newStatus) {
     }
 }
 
+// ==========================================
+// REPROGRAMAR
+// ==========================================
+
+function openRescheduleModal(id) {
+    closeAllDropdowns();
+    const appt = appointments.find(a => String(a.id) === String(id));
+    if (!appt) return;
+
+    const modal = document.getElementById('appointmentModal');
+    document.getElementById('modalTitle').innerHTML = '<i class="lni lni-calendar" style="color: #06b6d4;"></i> Reprogramar Cita';
+
+    document.getElementById('modalBody').innerHTML = `
+        <form id="rescheduleForm" class="appointment-form">
+            <div class="form-grid">
+                <div class="form-group">
+                    <label class="form-label"><i class="lni lni-calendar"></i> Nueva fecha</label>
+                    <input type="date" class="form-input" id="appointmentDate" required>
+                </div>
+
+                <div class="form-group">
+                    <label class="form-label"><i class="lni lni-clock"></i> Nueva hora</label>
+                    <div class="custom-dropdown-wrapper" id="timeDropdownWrapper">
+                        <input type="text" class="form-input form-dropdown" id="timeSelectDisplay" readonly required>
+                        <i class="lni lni-chevron-down dropdown-arrow"></i>
+                        <div class="dropdown-menu">
+                            <div class="dropdown-options" id="timeOptions"></div>
+                        </div>
+                    </div>
+                    <input type="hidden" id="appointmentTime" required>
+                </div>
+
+                <div class="form-group">
+                    <label class="form-label"><i class="lni lni-briefcase"></i> Servicio</label>
+                    <input type="text" class="form-input" id="serviceName" value="${escapeHtml(appt.service)}">
+                </div>
+
+                <div class="form-group">
+                    <label class="form-label"><i class="lni lni-user"></i> Trabajador/Especialista</label>
+                    <input type="text" class="form-input" id="workerName" value="${escapeHtml(appt.worker)}" placeholder="Cualquiera disponible">
+                </div>
+            </div>
+
+            ${appt.seriesId ? `
+            <div class="form-group" style="margin-top:1rem">
+                <label class="form-label"><i class="lni lni-reload"></i> Cita recurrente</label>
+                <label style="display:flex;align-items:center;gap:.5rem;cursor:pointer">
+                    <input type="radio" name="rescheduleScope" value="this" checked> Solo esta cita
+                </label>
+                <label style="display:flex;align-items:center;gap:.5rem;cursor:pointer">
+                    <input type="radio" name="rescheduleScope" value="following"> Esta y las siguientes
+                </label>
+            </div>` : ''}
+
+            ${appt.phone ? `
+            <label class="form-label" style="display:flex;align-items:center;gap:.5rem;margin-top:1rem;cursor:pointer">
+                <input type="checkbox" id="notifyClient" checked> Avisar al cliente por WhatsApp
+            </label>` : ''}
+
+            <div class="form-actions">
+                <button type="button" class="btn-cancel" onclick="closeAppointmentModal()">
+                    <i class="lni lni-close"></i> <span>Cancelar</span>
+                </button>
+                <button type="submit" class="btn-submit">
+                    <i class="lni lni-checkmark"></i> <span>Reprogramar</span>
+                </button>
+            </div>
+        </form>
+    `;
+
+    initTimeDropdown();
+    document.getElementById('appointmentTime').value = appt.time;
+    document.getElementById('timeSelectDisplay').value = formatTime(appt.time);
+
+    const dateInput = document.getElementById('appointmentDate');
+    dateInput.min = new Date().toISOString().split('T')[0];
+    dateInput.value = appt.date;
+
+    document.getElementById('rescheduleForm').addEventListener('submit', e => handleReschedule(e, appt.id));
+
+    modal.classList.add('active');
+}
+
+// ==========================================
+// CALENDARIOS ICS (suscripción sin Google)
+// ==========================================
+
+async function openCalendarFeedsModal() {
+    const modal = document.getElementById('appointmentModal');
+    document.getElementById('modalTitle').innerHTML = '<i class="lni lni-link" style="color: #06b6d4;"></i> Calendarios ICS';
+    const body = document.getElementById('modalBody');
+    body.innerHTML = '<p class="feeds-hint">Cargando...</p>';
+    modal.classList.add('active');
+
+    try {
+        const response = await fetch('/api/calendar-feeds', { credentials: 'include' });
+        if (!response.ok) throw new Error('Error API calendarios');
+        const data = await response.json();
+        renderCalendarFeeds(data.branches || []);
+    } catch (error) {
+        console.error('❌ Error cargando calendarios ICS:', error);
+        body.innerHTML = '<p class="feeds-hint">No se pudieron cargar los calendarios.</p>';
+    }
+}
+
+function renderCalendarFeeds(branches) {
+    const body = document.getElementById('modalBody');
+    if (branches.length === 0) {
+        body.innerHTML = '<p class="feeds-hint">Registra una sucursal para obtener sus calendarios.</p>';
+        return;
+    }
+
+    body.innerHTML = `
+        <p class="feeds-hint">
+            Suscríbete desde Apple Calendar, Outlook o cualquier app de calendario con estas URLs.
+            Son privadas: cualquiera que tenga la URL puede ver las citas.
+        </p>
+        ${branches.map(branch => `
+            <div class="feeds-branch">
+                <h4>${escapeHtml(branch.branchName || 'Sucursal')}</h4>
+                ${branch.feeds.map(feed => `
+                    <div class="feed-row" data-feed-id="${feed.id}">
+                        <span class="feed-label">${feed.worker ? escapeHtml(feed.worker) : 'Toda la sucursal'}</span>
+                        <input type="text" class="form-input feed-url" value="${escapeHtml(absoluteURL(feed.url))}" readonly>
+                        <button type="button" class="btn-icon" title="Copiar" onclick="copyFeedURL(${feed.id})">
+                            <i class="lni lni-files"></i>
+                        </button>
+                        <button type="button" class="btn-icon" title="Generar nueva URL" onclick="rotateFeedURL(${feed.id})">
+                            <i class="lni lni-reload"></i>
+                        </button>
+                    </div>
+                `).join('')}
+            </div>
+        `).join('')}
+    `;
+}
+
+function absoluteURL(url) {
+    return url.startsWith('/') ? window.location.origin + url : url;
+}
+
+async function copyFeedURL(id) {
+    const input = document.querySelector(`.feed-row[data-feed-id="${id}"] .feed-url`);
+    if (!input) return;
+    try {
+        await navigator.clipboard.writeText(input.value);
+        showNotification('URL copiada', 'success');
+    } catch (error) {
+        input.select();
+    }
+}
+
+function rotateFeedURL(id) {
+    showConfirmModal({
+        type: 'warning',
+        icon: 'lni-reload',
+        title: '¿Generar nueva URL?',
+        message: 'La URL actual dejará de funcionar',
+        list: ['Quien esté suscrito tendrá que volver a suscribirse con la nueva'],
+        confirmText: 'Generar nueva URL',
+        confirmClass: 'warning',
+        onConfirm: async () => {
+            try {
+                const response = await fetch(`/api/calendar-feeds/${id}/rotate`, {
+                    method: 'POST',
+                    credentials: 'include'
+                });
+                const data = await response.json();
+                if (!response.ok) throw new Error(data.error || 'Error');
+                await openCalendarFeedsModal();
+                showNotification('Nueva URL generada', 'success');
+            } catch (error) {
+                showNotification(error.message, 'error');
+            }
+        }
+    });
+}
+
+async function handleReschedule(e, id, force = false) {
+    if (e) e.preventDefault();
+
+    const notify = document.getElementById('notifyClient');
+    const scope = document.querySelector('input[name="rescheduleScope"]:checked');
+    const body = {
+        date:         document.getElementById('appointmentDate').value,
+        time:         document.getElementById('appointmentTime').value,
+        service:      document.getElementById('serviceName').value.trim(),
+        worker:       document.getElementById('workerName').value.trim(),
+        notifyClient: notify ? notify.checked : false,
+        force:        force,
+        scope:        scope ? scope.value : 'this'
+    };
+
+    const submitBtn = document.querySelector('#rescheduleForm .btn-submit');
+    const originalHTML = submitBtn.innerHTML;
+    submitBtn.innerHTML = `<div class="loading-spinner-small"></div> <span>Guardando...</span>`;
+    submitBtn.disabled = true;
+
+    try {
+        const response = await fetch(`/api/appointments/${id}`, {
+            method: 'PATCH',
+            credentials: 'include',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
+        const data = await response.json().catch(() => ({}));
+
+        // Horario ocupado: el dueño puede sobreagendar, igual que al crear citas
+        if (response.status === 409) {
+            submitBtn.innerHTML = originalHTML;
+            submitBtn.disabled = false;
+            showConfirmModal({
+                type: 'warning',
+                icon: 'lni-warning',
+                title: 'Horario ocupado',
+                message: escapeHtml(data.error || 'El horario no está disponible'),
+                list: ['La cita se empalmará con otra ya agendada'],
+                confirmText: 'Reprogramar de todos modos',
+                confirmClass: 'warning',
+                onConfirm: () => handleReschedule(null, id, true)
+            });
+            return;
+        }
+        if (!response.ok) throw new Error(data.details || data.error || `Error ${response.status}`);
+
+        closeAppointmentModal();
+        if (body.scope === 'following') {
+            const conflicts = data.conflicts || [];
+            showNotification(
+                `${data.moved || 0} cita(s) de la serie reprogramadas` +
+                (conflicts.length ? `. ⚠️ ${conflicts.length} se empalman con otra cita` : ''),
+                conflicts.length ? 'warning' : 'success'
+            );
+        } else {
+            showNotification('Cita reprogramada', 'success');
+        }
+        await loadAppointments();
+        updateStats();
+        renderAppointments();
+    } catch (err) {
+        console.error('❌ Error reprogramando cita:', err);
+        showNotification(`Error al reprogramar: ${err.message}`, 'error');
+        submitBtn.innerHTML = originalHTML;
+        submitBtn.disabled = false;
+    }
+}
+
 function deleteAppointment(id, clientName) {
     closeAllDropdowns();
     showConfirmModal({
@@ -764,7 +1139,7 @@ function formatTime(t) {
 }
 
 function getStatusText(s) {
-    const map = { confirmed: 'Confirmada', pending: 'Pendiente', cancelled: 'Cancelada', completed: 'Completada' };
+    const map = { confirmed: 'Confirmada', pending: 'Pendiente', cancelled: 'Cancelada', completed: 'Completada', no_show: 'No asistió' };
     return map[s] || s;
 }
 
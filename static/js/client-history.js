@@ -97,6 +97,7 @@ function renderStats(stats) {
     document.getElementById('statClientes').textContent   = stats.totalClientes   ?? '—';
     document.getElementById('statMes').textContent        = stats.visitasMes      ?? '—';
     document.getElementById('statCanceladas').textContent = stats.totalCanceladas ?? '—';
+    document.getElementById('statInasistencias').textContent = stats.totalInasistencias ?? '—';
 }
 
 function renderTable() {
@@ -125,6 +126,8 @@ function renderTable() {
             ? `<span class="badge badge-visita"><i class="lni lni-checkmark-circle"></i> Visita</span>`
             : h.entryType === 'cancelada'
             ? `<span class="badge badge-cancelada"><i class="lni lni-close"></i> Cancelada</span>`
+            : h.entryType === 'inasistencia'
+            ? `<span class="badge badge-inasistencia"><i class="lni lni-ban"></i> No asistió</span>`
             : `<span class="badge badge-cita"><i class="lni lni-calendar"></i> Cita</span>`;
 
         const srcClass = h.source === 'sheets' ? 'sheets' : h.source === 'agent' ? 'agent' : 'manual';
@@ -142,6 +145,7 @@ function renderTable() {
                     <div class="client-info">
                         <div class="client-name">${escapeHtml(h.client)}</div>
                         <div class="client-phone">${escapeHtml(h.phone || '—')}</div>
+                        ${h.clientNoShows > 0 ? `<div class="client-noshows" title="Inasistencias del cliente"><i class="lni lni-ban"></i> ${h.clientNoShows} ${h.clientNoShows === 1 ? 'inasistencia' : 'inasistencias'}</div>` : ''}
                     </div>
                 </div>
             </td>
@@ -267,6 +271,7 @@ async function openClientPanel(phone, name) {
             <div style="display:flex;gap:.5rem;margin-bottom:1rem;">
                 <span class="badge badge-visita">${entries.filter(e=>e.entryType==='visita').length} visitas</span>
                 <span class="badge badge-cancelada">${entries.filter(e=>e.entryType==='cancelada').length} canceladas</span>
+                ${d.noShows > 0 ? `<span class="badge badge-inasistencia">${d.noShows} inasistencias</span>` : ''}
             </div>
             <div class="panel-section-title">Historial de Visitas</div>
             <div class="panel-timeline">${itemsHTML}</div>
@@ -295,7 +300,7 @@ function closePanelIfOutside(e) {
 // FILTROS
 // ═══════════════════════════════════════════════════
 function setupFilters() {
-    // Chips de tipo (Todos / Visitas / Canceladas)
+    // Chips de tipo (Todos / Visitas / Canceladas / Inasistencias)
     document.getElementById('typeFilters').addEventListener('click', e => {
         const chip = e.target.closest('.filter-chip');
         if (!chip) return;
@@ -394,7 +399,7 @@ function exportPDF() {
     const rows = historialData.map(h => [
         h.client    || '—', h.phone     || '—', h.service   || '—', h.worker    || '—',
         formatDate(h.date), formatTime(h.time), h.agentName || '—',
-        h.entryType === 'visita' ? 'Visita' : h.entryType === 'cancelada' ? 'Cancelada' : 'Cita',
+        h.entryType === 'visita' ? 'Visita' : h.entryType === 'cancelada' ? 'Cancelada' : h.entryType === 'inasistencia' ? 'No asistió' : 'Cita',
         h.source    === 'sheets' ? 'Sheets' : h.source    === 'agent'    ? 'Agente'    : 'Manual'
     ]);
 
@@ -415,6 +420,7 @@ function exportPDF() {
                 const v = data.cell.raw;
                 if (v === 'Visita')    data.cell.styles.textColor = [16, 185, 129];
                 if (v === 'Cancelada') data.cell.styles.textColor = [239, 68, 68];
+                if (v === 'No asistió') data.cell.styles.textColor = [245, 158, 11];
                 if (v === 'Cita')      data.cell.styles.textColor = [6, 182, 212];
             }
         },
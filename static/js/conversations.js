@@ -0,0 +1,249 @@
+// ═══════════════════════════════════════════════════
+// CONVERSATIONS — JavaScript
+// Attomos — Conversaciones entre agentes y clientes
+// ═══════════════════════════════════════════════════
+
+// ── Estado global ────────────────────────────────────
+let threads         = [];
+let currentPage     = 1;
+let totalThreads    = 0;
+let activeThreadId  = null;
+let messagesPage    = 1;
+let messages        = [];
+const LIMIT         = 20;
+const MSG_LIMIT     = 50;
+
+let filters = {
+    search:  '',
+    agentId: 'all'
+};
+
+// ═══════════════════════════════════════════════════
+// CARGA DE DATOS
+// ═══════════════════════════════════════════════════
+async function loadAgents() {
+    try {
+        const r = await fetch('/api/agents', { credentials: 'include' });
+        if (!r.ok) return;
+        const d = await r.json();
+        const select = document.getElementById('agentFilter');
+        (d.agents || []).forEach(ag => {
+            const opt = document.createElement('option');
+            opt.value       = ag.id;
+            opt.textContent = ag.name;
+            select.appendChild(opt);
+        });
+    } catch(e) {}
+}
+
+async function loadThreads() {
+    const params = new URLSearchParams({
+        page:    currentPage,
+        limit:   LIMIT,
+        search:  filters.search,
+        agentId: filters.agentId
+    });
+
+    try {
+        const r = await fetch(`/api/conversations?${params}`, { credentials: 'include' });
+        if (!r.ok) throw new Error('Error al cargar conversaciones');
+        const d = await r.json();
+
+        threads      = d.conversations || [];
+        totalThreads = d.total || 0;
+
+        if (d.retentionDays) {
+            document.getElementById('retentionNote').textContent =
+                `Lo que tus agentes han hablado con tus clientes · Se conservan los últimos ${d.retentionDays} días según tu plan`;
+        }
+
+        renderThreads();
+        renderPagination();
+    } catch(e) {
+        document.getElementById('threads').innerHTML =
+            `<div class="threads-empty">${escapeHtml(e.message)}</div>`;
+        showNotification(e.message, 'error');
+    }
+}
+
+async function loadMessages(threadId, page = 1) {
+    try {
+        const r = await fetch(`/api/conversations/${threadId}/messages?page=${page}&limit=${MSG_LIMIT}`,
+            { credentials: 'include' });
+        if (!r.ok) throw new Error('Error al cargar mensajes');
+        const d = await r.json();
+
+        // Las páginas siguientes son mensajes más antiguos
+        messages     = page === 1 ? (d.messages || []) : [...(d.messages || []), ...messages];
+        messagesPage = page;
+
+        renderThreadView(d.conversation, d.hasMore, page === 1);
+    } catch(e) {
+        showNotification(e.message, 'error');
+    }
+}
+
+// ═══════════════════════════════════════════════════
+// RENDER
+// ═══════════════════════════════════════════════════
+function renderThreads() {
+    const container = document.getElementById('threads');
+
+    if (!threads.length) {
+        container.innerHTML = `
+            <div class="threads-empty">
+                <p>Aún no hay conversaciones</p>
+            </div>`;
+        return;
+    }
+
+    container.innerHTML = threads.map(t => {
+        const name     = t.customerName || t.customerPhone;
+        const initials = name.split(' ').map(p => p[0] || '').join('').slice(0, 2).toUpperCase();
+        const prefix   = t.lastDirection === 'outbound' ? 'Agente: ' : '';
+
+        return `
+        <div class="thread-item ${t.id === activeThreadId ? 'active' : ''}" onclick="openThread(${t.id})">
+            <div class="thread-avatar">${escapeHtml(initials) || '?'}</div>
+            <div class="thread-body">
+                <div class="thread-top">
+                    <span class="thread-name">${escapeHtml(name)}</span>
+                    <span class="thread-time">${formatRelative(t.lastMessageAt)}</span>
+                </div>
+                <div class="thread-agent">${escapeHtml(t.agentName || '')}</div>
+                <div class="thread-preview">${escapeHtml(prefix + (t.lastMessagePreview || ''))}</div>
+            </div>
+        </div>`;
+    }).join('');
+}
+
+function renderPagination() {
+    const pages = Math.max(1, Math.ceil(totalThreads / LIMIT));
+    document.getElementById('paginationInfo').textContent =
+        totalThreads === 0 ? 'Sin resultados' : `Página ${currentPage} de ${pages}`;
+    document.getElementById('prevPage').disabled = currentPage <= 1;
+    document.getElementById('nextPage').disabled = currentPage >= pages;
+}
+
+function renderThreadView(conv, hasMore, scrollToBottom) {
+    const view  = document.getElementById('threadView');
+    const name  = conv.customerName || conv.customerPhone;
+    const phone = (conv.customerPhone || '').replace(/\D/g, '');
+
+    let lastDay = '';
+    const bubbles = messages.map(m => {
+        const date = new Date(m.createdAt);
+        const day  = date.toLocaleDateString('es-MX', { weekday: 'long', day: 'numeric', month: 'long' });
+        let divider = '';
+        if (day !== lastDay) {
+            divider = `<div class="day-divider">${escapeHtml(day)}</div>`;
+            lastDay = day;
+        }
+        const typeLabel = m.messageType && m.messageType !== 'text'
+            ? `<span class="bubble-type">${escapeHtml(m.messageType)}</span>` : '';
+        const time = date.toLocaleTimeString('es-MX', { hour: '2-digit', minute: '2-digit' });
+
+        return `${divider}
+        <div class="bubble ${m.direction}">
+            ${typeLabel}${escapeHtml(m.body)}
+            <span class="bubble-meta">${time}</span>
+        </div>`;
+    }).join('');
+
+    view.innerHTML = `
+        <div class="thread-view-header">
+            <div>
+                <h2>${escapeHtml(name)}</h2>
+                <span>${escapeHtml(conv.customerPhone || '')} · ${conv.messageCount} mensajes</span>
+            </div>
+            ${phone ? `<a class="whatsapp-btn" href="https://wa.me/${phone}" target="_blank" rel="noopener noreferrer">
+                <i class="lni lni-whatsapp"></i> WhatsApp
+            </a>` : ''}
+        </div>
+        <div class="messages" id="messages">
+            ${hasMore ? `<button class="load-more" onclick="loadOlder()">Cargar mensajes anteriores</button>` : ''}
+            ${bubbles}
+        </div>`;
+
+    if (scrollToBottom) {
+        const list = document.getElementById('messages');
+        list.scrollTop = list.scrollHeight;
+    }
+}
+
+// ═══════════════════════════════════════════════════
+// ACCIONES
+// ═══════════════════════════════════════════════════
+function openThread(id) {
+    activeThreadId = id;
+    document.querySelector('.inbox').classList.add('show-thread');
+    renderThreads();
+    loadMessages(id, 1);
+}
+
+function loadOlder() {
+    if (activeThreadId) loadMessages(activeThreadId, messagesPage + 1);
+}
+
+function setupFilters() {
+    let searchTimer;
+    document.getElementById('searchInput').addEventListener('input', e => {
+        clearTimeout(searchTimer);
+        searchTimer = setTimeout(() => {
+            filters.search = e.target.value.trim();
+            currentPage = 1;
+            loadThreads();
+        }, 350);
+    });
+
+    document.getElementById('agentFilter').addEventListener('change', e => {
+        filters.agentId = e.target.value;
+        currentPage = 1;
+        loadThreads();
+    });
+
+    document.getElementById('prevPage').addEventListener('click', () => {
+        if (currentPage > 1) { currentPage--; loadThreads(); }
+    });
+    document.getElementById('nextPage').addEventListener('click', () => {
+        currentPage++;
+        loadThreads();
+    });
+}
+
+// ═══════════════════════════════════════════════════
+// UTILIDADES
+// ═══════════════════════════════════════════════════
+function formatRelative(iso) {
+    if (!iso) return '';
+    const date = new Date(iso);
+    const now  = new Date();
+    if (date.toDateString() === now.toDateString()) {
+        return date.toLocaleTimeString('es-MX', { hour: '2-digit', minute: '2-digit' });
+    }
+    return date.toLocaleDateString('es-MX', { day: 'numeric', month: 'short' });
+}
+
+function escapeHtml(t) {
+    if (!t) return '';
+    return String(t).replace(/[&<>"']/g, m =>
+        ({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#039;'}[m]));
+}
+
+function showNotification(message, type = 'info') {
+    const titles = { success: 'Listo', error: 'Error', warning: 'Aviso', info: 'Info' };
+    if (typeof Sileo !== 'undefined' && Sileo[type]) {
+        Sileo[type]({ title: titles[type], description: message });
+    } else {
+        alert(message);
+    }
+}
+
+// ═══════════════════════════════════════════════════
+// INIT
+// ═══════════════════════════════════════════════════
+document.addEventListener('DOMContentLoaded', async () => {
+    await loadAgents();
+    setupFilters();
+    await loadThreads();
+});
@@ -160,7 +160,11 @@ async function selectAgent(option) {
 
     // Cargar config de pagos (disponible para todos los bots)
     const branchId = selectedAgent && selectedAgent.branchId ? selectedAgent.branchId : null;
-    if (branchId) await loadPaymentConfig(branchId);
+    if (branchId) {
+        await loadPaymentConfig(branchId);
+        await loadNoShowPolicy(branchId);
+        await loadOrderNotifyConfig(branchId);
+    }
     
     if (botType === 'atomic') {
         await loadGeminiStatus(selectedAgentId);
@@ -1229,6 +1233,14 @@ function initPaymentsIntegration() {
     if (btnConnectStripe) btnConnectStripe.addEventListener('click', connectStripe);
     if (btnDisconnectStripe) btnDisconnectStripe.addEventListener('click', disconnectStripe);
 
+    // Política de inasistencias
+    const btnSaveNoShowPolicy = document.getElementById('btnSaveNoShowPolicy');
+    if (btnSaveNoShowPolicy) btnSaveNoShowPolicy.addEventListener('click', saveNoShowPolicy);
+
+    // Avisos de pedidos
+    const btnSaveOrderNotify = document.getElementById('btnSaveOrderNotify');
+    if (btnSaveOrderNotify) btnSaveOrderNotify.addEventListener('click', saveOrderNotifyConfig);
+
     // Revisar si venimos de un redirect de Stripe
     checkStripeRedirect();
 }
@@ -1252,6 +1264,147 @@ async function loadPaymentConfig(branchId) {
     }
 }
 
+// ── Política de inasistencias ──────────────────────────────
+
+async function loadNoShowPolicy(branchId) {
+    if (!branchId) return;
+
+    try {
+        const res = await fetch(`/api/no-show-policy/${branchId}`, {
+            credentials: 'include'
+        });
+        if (!res.ok) throw new Error('Error cargando política de inasistencias');
+        const data = await res.json();
+
+        const fields = {
+            noShowAutoMark: el => { el.checked = !!data.autoMark; },
+            noShowGrace: el => { el.value = data.graceMinutes || 30; },
+            noShowThreshold: el => { el.value = data.depositThreshold || 0; },
+            noShowDeposit: el => { el.value = data.depositAmount || ''; }
+        };
+        Object.entries(fields).forEach(([id, fill]) => {
+            const el = document.getElementById(id);
+            if (!el) return;
+            fill(el);
+            el.disabled = false;
+        });
+
+        const btn = document.getElementById('btnSaveNoShowPolicy');
+        if (btn) btn.disabled = false;
+    } catch (err) {
+        console.error('Error cargando inasistencias:', err);
+    }
+}
+
+async function saveNoShowPolicy() {
+    if (!selectedAgentId) {
+        showNotification('Por favor selecciona un agente primero', 'error');
+        return;
+    }
+
+    const branchId = await getBranchIdForAgent(selectedAgentId);
+    if (!branchId) return;
+
+    const btn = document.getElementById('btnSaveNoShowPolicy');
+    const orig = btn.innerHTML;
+    btn.innerHTML = '<div class="loading-spinner"></div><span>Guardando...</span>';
+    btn.disabled = true;
+
+    try {
+        const res = await fetch(`/api/no-show-policy/${branchId}`, {
+            method: 'PUT',
+            credentials: 'include',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                autoMark: document.getElementById('noShowAutoMark').checked,
+                graceMinutes: parseInt(document.getElementById('noShowGrace').value, 10) || 0,
+                depositThreshold: parseInt(document.getElementById('noShowThreshold').value, 10) || 0,
+                depositAmount: parseFloat(document.getElementById('noShowDeposit').value) || 0
+            })
+        });
+        if (!res.ok) {
+            const err = await res.json();
+            throw new Error(err.error || 'Error al guardar');
+        }
+        showNotification('Política de inasistencias guardada', 'success');
+    } catch (err) {
+        showNotification(err.message, 'error');
+    } finally {
+        btn.innerHTML = orig;
+        btn.disabled = false;
+    }
+}
+
+// ── Avisos de pedidos ──────────────────────────────────────
+
+async function loadOrderNotifyConfig(branchId) {
+    if (!branchId) return;
+
+    try {
+        const res = await fetch(`/api/order-notifications/${branchId}`, {
+            credentials: 'include'
+        });
+        if (!res.ok) throw new Error('Error cargando avisos de pedidos');
+        const data = await res.json();
+
+        const enabled = document.getElementById('orderNotifyEnabled');
+        if (enabled) {
+            enabled.checked = !!data.enabled;
+            enabled.disabled = false;
+        }
+        document.querySelectorAll('.order-notify-text').forEach(el => {
+            const status = el.dataset.status;
+            el.value = data[status] || '';
+            el.placeholder = (data.defaults || {})[status] || '';
+            el.disabled = false;
+        });
+
+        const btn = document.getElementById('btnSaveOrderNotify');
+        if (btn) btn.disabled = false;
+    } catch (err) {
+        console.error('Error cargando avisos de pedidos:', err);
+    }
+}
+
+async function saveOrderNotifyConfig() {
+    if (!selectedAgentId) {
+        showNotification('Por favor selecciona un agente primero', 'error');
+        return;
+    }
+
+    const branchId = await getBranchIdForAgent(selectedAgentId);
+    if (!branchId) return;
+
+    const btn = document.getElementById('btnSaveOrderNotify');
+    const orig = btn.innerHTML;
+    btn.innerHTML = '<div class="loading-spinner"></div><span>Guardando...</span>';
+    btn.disabled = true;
+
+    const body = { enabled: document.getElementById('orderNotifyEnabled').checked };
+    document.querySelectorAll('.order-notify-text').forEach(el => {
+        body[el.dataset.status] = el.value.trim();
+    });
+
+    try {
+        const res = await fetch(`/api/order-notifications/${branchId}`, {
+            method: 'PUT',
+            credentials: 'include',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
+        if (!res.ok) {
+            const err = await res.json();
+            throw new Error(err.error || 'Error al guardar');
+        }
+        showNotification('Avisos de pedidos guardados', 'success');
+    } catch (err) {
+        showNotification(err.message, 'error');
+    } finally {
+        btn.innerHTML = orig;
+        btn.disabled = false;
+    }
+}
+
 function updatePaymentsUI(data) {
     // Habilitar botones ahora que hay un agente seleccionado
     const btnSaveSPEI = document.getElementById('btnSaveSPEI');
@@ -0,0 +1,281 @@
+// ==========================================
+// KITCHEN.JS — pantalla de cocina en tiempo real (SSE)
+// ==========================================
+
+let kitchenOrders = new Map();   // id → pedido
+let kitchenBranch = '';          // '' = todas las sucursales
+let kitchenStream = null;
+let soundEnabled  = localStorage.getItem('kitchenSound') === '1';
+let audioCtx      = null;
+
+// Siguiente estado con un toque (mismas transiciones que models.OrderStatus)
+const NEXT_STATUS = {
+    pending:   'preparing',
+    confirmed: 'preparing',
+    preparing: 'ready',
+    ready:     'delivered',
+};
+
+const NEXT_LABEL = {
+    preparing: 'Preparar',
+    ready:     'Listo',
+    delivered: 'Entregado',
+};
+
+// ==========================================
+// INIT
+// ==========================================
+document.addEventListener('DOMContentLoaded', async () => {
+    document.getElementById('btnKitchenSound')?.addEventListener('click', toggleSound);
+    updateSoundButton();
+
+    await loadBranches();
+    await loadKitchenOrders();
+    connectStream();
+
+    // Los tiempos transcurridos se refrescan cada minuto
+    setInterval(renderBoard, 60 * 1000);
+});
+
+async function loadBranches() {
+    try {
+        const res = await fetch('/api/my-business', { credentials: 'include' });
+        if (!res.ok) return;
+        const data = await res.json();
+        const branches = data.branches || [];
+        if (branches.length < 2) return;
+
+        const select = document.getElementById('kitchenBranch');
+        select.innerHTML = '<option value="">Todas las sucursales</option>' +
+            branches.map(b => `<option value="${b.id}">${escHtml(b.branchName || 'Sucursal ' + b.branchNumber)}</option>`).join('');
+        select.value = localStorage.getItem('kitchenBranch') || '';
+        kitchenBranch = select.value;
+        select.style.display = '';
+        select.addEventListener('change', async () => {
+            kitchenBranch = select.value;
+            localStorage.setItem('kitchenBranch', kitchenBranch);
+            await loadKitchenOrders();
+            connectStream();
+        });
+    } catch (e) {
+        console.error('Error cargando sucursales:', e);
+    }
+}
+
+// ==========================================
+// DATA
+// ==========================================
+
+async function loadKitchenOrders() {
+    try {
+        const query = kitchenBranch ? `?branch_id=${kitchenBranch}` : '';
+        const res = await fetch('/api/orders' + query, { credentials: 'include' });
+        if (!res.ok) throw new Error();
+        const data = await res.json();
+        kitchenOrders = new Map((data.orders || []).map(o => [String(o.id), o]));
+    } catch (e) {
+        console.error('Error cargando pedidos:', e);
+    }
+    renderBoard();
+}
+
+function connectStream() {
+    if (kitchenStream) kitchenStream.close();
+
+    const query = kitchenBranch ? `?branch_id=${kitchenBranch}` : '';
+    kitchenStream = new EventSource('/api/orders/stream' + query, { withCredentials: true });
+
+    kitchenStream.addEventListener('ready', () => setLive(true));
+    kitchenStream.addEventListener('order', e => {
+        const { type, order } = JSON.parse(e.data);
+        if (type === 'deleted') {
+            kitchenOrders.delete(String(order.id));
+        } else {
+            kitchenOrders.set(String(order.id), order);
+        }
+        if (type === 'created') {
+            playNewOrderAlert();
+            showNotification(`Nuevo pedido de ${order.clientName}`, 'info');
+        }
+        renderBoard();
+    });
+    kitchenStream.onerror = () => {
+        // EventSource reintenta solo; al volver se recarga la lista por si se perdió algo
+        setLive(false);
+        kitchenStream.addEventListener('ready', loadKitchenOrders, { once: true });
+    };
+}
+
+function setLive(connected) {
+    document.getElementById('kitchenLive')?.classList.toggle('connected', connected);
+    const text = document.getElementById('kitchenLiveText');
+    if (text) text.textContent = connected ? 'En vivo' : 'Reconectando...';
+}
+
+// ==========================================
+// RENDER
+// ==========================================
+
+function renderBoard() {
+    const today = localDate(new Date());
+    document.querySelectorAll('.kitchen-column').forEach(col => {
+        const status = col.dataset.status;
+        const done = status === 'delivered' || status === 'cancelled';
+        const list = [...kitchenOrders.values()]
+            .filter(o => o.status === status)
+            .filter(o => !done || (o.createdAt || '').startsWith(today))
+            // Los más antiguos primero: son los que llevan más tiempo esperando
+            .sort((a, b) => (a.createdAt || '').localeCompare(b.createdAt || ''));
+
+        col.querySelector('.column-count').textContent = list.length;
+        col.querySelector('.column-cards').innerHTML = list.map(renderCard).join('') ||
+            '<div class="column-empty">Sin pedidos</div>';
+    });
+}
+
+function renderCard(o) {
+    const next = NEXT_STATUS[o.status];
+    const canCancel = o.status !== 'delivered' && o.status !== 'cancelled';
+    const items = (o.items || []).map(i => `
+        <li><strong>${i.quantity}x</strong> ${escHtml(i.name)}${(i.options || []).length ? `<small>${escHtml(i.options.map(o => o.name).join(', '))}</small>` : ''}${i.notes ? `<em>${escHtml(i.notes)}</em>` : ''}</li>
+    `).join('');
+
+    return `
+        <div class="kitchen-card ${next ? 'tappable' : ''}" ${next ? `onclick="advanceOrder('${o.id}')"` : ''}>
+            <div class="card-top">
+                <span class="card-id">#${o.id}</span>
+                <span class="card-type">${typeLabel(o.orderType)}</span>
+                <span class="card-age">${elapsed(o.createdAt)}</span>
+            </div>
+            <div class="card-client">${escHtml(o.clientName)}</div>
+            <ul class="card-items">${items}</ul>
+            ${o.notes ? `<div class="card-notes"><i class="lni lni-comments"></i>${escHtml(o.notes)}</div>` : ''}
+            <div class="card-actions">
+                ${next ? `<span class="card-next">${NEXT_LABEL[next]} <i class="lni lni-arrow-right"></i></span>` : ''}
+                ${canCancel ? `<button class="card-cancel" onclick="event.stopPropagation(); cancelOrder('${o.id}')"><i class="lni lni-ban"></i></button>` : ''}
+            </div>
+        </div>
+    `;
+}
+
+// ==========================================
+// ACTIONS
+// ==========================================
+
+async function advanceOrder(id) {
+    const order = kitchenOrders.get(String(id));
+    if (!order || !NEXT_STATUS[order.status]) return;
+    await setStatus(order, NEXT_STATUS[order.status]);
+}
+
+async function cancelOrder(id) {
+    const order = kitchenOrders.get(String(id));
+    if (!order || !confirm(`¿Cancelar el pedido #${id} de ${order.clientName}?`)) return;
+    await setStatus(order, 'cancelled');
+}
+
+async function setStatus(order, status) {
+    const previous = order.status;
+    // Se mueve de inmediato; el evento SSE confirma (o la respuesta lo revierte)
+    order.status = status;
+    renderBoard();
+
+    try {
+        const res = await fetch(`/api/orders/${order.id}/status`, {
+            method: 'PATCH', credentials: 'include',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ status }),
+        });
+        if (!res.ok) {
+            const err = await res.json().catch(() => ({}));
+            throw new Error(err.error || 'Error actualizando');
+        }
+    } catch (err) {
+        order.status = previous;
+        renderBoard();
+        showNotification(err.message, 'error');
+    }
+}
+
+// ==========================================
+// SONIDO
+// ==========================================
+
+// Los navegadores solo permiten audio después de un gesto del usuario,
+// por eso el sonido se activa con el botón
+function toggleSound() {
+    soundEnabled = !soundEnabled;
+    localStorage.setItem('kitchenSound', soundEnabled ? '1' : '0');
+    updateSoundButton();
+    if (soundEnabled) playNewOrderAlert();
+}
+
+function updateSoundButton() {
+    const btn = document.getElementById('btnKitchenSound');
+    if (!btn) return;
+    btn.classList.toggle('active', soundEnabled);
+    btn.innerHTML = soundEnabled
+        ? '<i class="lni lni-volume-high"></i><span>Sonido activo</span>'
+        : '<i class="lni lni-volume-mute"></i><span>Activar sonido</span>';
+}
+
+function playNewOrderAlert() {
+    if (!soundEnabled) return;
+    try {
+        audioCtx = audioCtx || new (window.AudioContext || window.webkitAudioContext)();
+        if (audioCtx.state === 'suspended') audioCtx.resume();
+        // Dos tonos cortos tipo campana
+        [0, 0.25].forEach((offset, i) => {
+            const osc = audioCtx.createOscillator();
+            const gain = audioCtx.createGain();
+            osc.type = 'sine';
+            osc.frequency.value = i === 0 ? 880 : 1175;
+            const t = audioCtx.currentTime + offset;
+            gain.gain.setValueAtTime(0.0001, t);
+            gain.gain.exponentialRampToValueAtTime(0.4, t + 0.02);
+            gain.gain.exponentialRampToValueAtTime(0.0001, t + 0.22);
+            osc.connect(gain).connect(audioCtx.destination);
+            osc.start(t);
+            osc.stop(t + 0.25);
+        });
+    } catch (e) {
+        console.warn('No se pudo reproducir la alerta:', e);
+    }
+}
+
+// ==========================================
+// HELPERS
+// ==========================================
+
+function localDate(d) {
+    const pad = n => String(n).padStart(2, '0');
+    return `${d.getFullYear()}-${pad(d.getMonth() + 1)}-${pad(d.getDate())}`;
+}
+
+// createdAt llega como "2006-01-02 15:04" en hora del servidor
+function elapsed(createdAt) {
+    if (!createdAt) return '';
+    const created = new Date(createdAt.replace(' ', 'T'));
+    const minutes = Math.max(0, Math.floor((Date.now() - created.getTime()) / 60000));
+    if (minutes < 60) return `${minutes} min`;
+    return `${Math.floor(minutes / 60)} h ${minutes % 60} min`;
+}
+
+function typeLabel(t) {
+    return { delivery:'Domicilio', pickup:'Para llevar', dine_in:'En local', local_pickup:'Recoger' }[t] || t;
+}
+
+function escHtml(t) {
+    if (!t) return '';
+    return String(t).replace(/[&<>"']/g, m =>
+        ({ '&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#039;' }[m]));
+}
+
+function showNotification(message, type = 'info') {
+    const titles = { success:'Listo', error:'Error', warning:'Aviso', info:'Info' };
+    if (typeof Sileo !== 'undefined' && Sileo[type]) {
+        Sileo[type]({ title: titles[type], description: message });
+    } else {
+        console.log(`[${type}] ${message}`);
+    }
+}
@@ -16,6 +16,8 @@ document.addEventListener('DOMContentLoaded', function () {
     initHolidays();
     initServices();
     initWorkers();
+    initResources();
+    initDeliveryZones();
     initSaveButton();
     initBrandImages();
     initMenu();
@@ -238,6 +240,8 @@ function loadBranchData(branch) {
     setInputValue('neighborhoodInput', branch.location?.neighborhood);
     setInputValue('postalCodeInput', branch.location?.postalCode);
     setInputValue('betweenStreetsInput', branch.location?.betweenStreets);
+    setInputValue('latitudeInput', branch.location?.latitude || '');
+    setInputValue('longitudeInput', branch.location?.longitude || '');
 
     setLocationDropdown('countryInput', branch.location?.country);
     setLocationDropdown('stateInput', branch.location?.state);
@@ -269,9 +273,11 @@ function loadBranchData(branch) {
         if (branch.business?.menuUrl) renderMenuPreview(branch.business.menuUrl);
     }
 
-    // Servicios y trabajadores
+    // Servicios, trabajadores y recursos
     renderServices(branch.services || []);
     renderWorkers(branch.workers || []);
+    renderResources(branch.resources || []);
+    renderDeliveryZones(branch.deliveryZones || []);
 
     // Actualizar nombre si la dirección cambia
     document.getElementById('addressInput').addEventListener('input', function() {
@@ -1063,7 +1069,9 @@ async function saveProfile(opts = {}) {
             city: document.getElementById('cityInput').value,
             state: document.getElementById('stateInput').value,
             country: document.getElementById('countryInput').value,
-            postalCode: document.getElementById('postalCodeInput').value
+            postalCode: document.getElementById('postalCodeInput').value,
+            latitude: parseFloat(document.getElementById('latitudeInput')?.value) || 0,
+            longitude: parseFloat(document.getElementById('longitudeInput')?.value) || 0
         },
         social: {
             facebook: document.getElementById('facebookInput').value,
@@ -1072,7 +1080,9 @@ async function saveProfile(opts = {}) {
             linkedin: document.getElementById('linkedinInput').value
         },
         services: collectServicesData(),
-        workers: collectWorkersData()
+        workers: collectWorkersData(),
+        resources: collectResourcesData(),
+        deliveryZones: collectDeliveryZonesData()
     };
 
     try {
@@ -1086,6 +1096,8 @@ async function saveProfile(opts = {}) {
         if (!opts.silent) { saveBtn.innerHTML = originalText; saveBtn.disabled = false; }
 
         if (response.ok && result.success) {
+            syncStockFields(result.branch?.services || []);
+
             // Actualizar nombre en el dropdown si cambió
             if (result.branchName) {
                 document.getElementById('branchDropdownLabel').textContent = result.branchName;
@@ -1182,6 +1194,20 @@ function initServices() {
     document.getElementById('btnAddService')?.addEventListener('click', addServiceItem);
 }
 
+// syncStockFields muestra las existencias que quedaron guardadas (pudieron
+// bajar por pedidos mientras se editaba el formulario)
+function syncStockFields(services) {
+    document.querySelectorAll('.service-item').forEach(item => {
+        const stockEl = item.querySelector('.service-stock');
+        const title = (item.querySelector('.service-title')?.value || '').trim().toLowerCase();
+        const svc = services.find(s => (s.title || '').trim().toLowerCase() === title);
+        if (!stockEl || !svc) return;
+        const value = svc.trackStock ? String(svc.stock ?? 0) : '';
+        stockEl.value = value;
+        stockEl.dataset.loaded = value;
+    });
+}
+
 function renderServices(services = []) {
     const list = document.getElementById('servicesList');
     const hint = document.getElementById('servicesHint');
@@ -1207,6 +1233,8 @@ function addServiceItem(e, data = null) {
 
     const isPromo = data?.priceType === 'promo';
     const inStock = data?.inStock !== false; // true por defecto
+    const trackStock = data?.trackStock === true;
+    const lowStock = trackStock && data?.lowStockAlert > 0 && data?.stock > 0 && data?.stock <= data?.lowStockAlert;
 
     // Periodo de promoción
     const periodType = data?.promoPeriodType || 'days';
@@ -1248,6 +1276,18 @@ function addServiceItem(e, data = null) {
         </div>
         <div class="service-item-row">
             <input type="text" class="info-input service-desc" placeholder="Descripción (opcional)" value="${data?.description || ''}">
+            <input type="number" class="info-input service-duration" placeholder="Duración (min)" min="5" step="5" title="Duración en minutos (para citas)" value="${data?.durationMinutes || ''}">
+        </div>
+        <div class="service-item-row service-stock-row">
+            <label class="stock-track-toggle" title="Descontar existencias con cada pedido confirmado">
+                <input type="checkbox" class="service-track-stock" ${trackStock ? 'checked' : ''}>
+                <span>Llevar inventario</span>
+            </label>
+            <div class="stock-track-fields" style="display:${trackStock ? 'flex' : 'none'}">
+                <input type="number" class="info-input service-stock" placeholder="Existencias" min="0" step="1" title="Existencias actuales" value="${trackStock ? (data?.stock ?? 0) : ''}" data-loaded="${trackStock ? (data?.stock ?? 0) : ''}">
+                <input type="number" class="info-input service-low-stock" placeholder="Avisar al quedar" min="0" step="1" title="Te avisamos por correo al bajar a esta cantidad" value="${data?.lowStockAlert || ''}">
+                ${lowStock ? '<span class="low-stock-badge">Quedan pocas</span>' : ''}
+            </div>
         </div>
 
         <!-- FOTOS DEL SERVICIO (múltiples) -->
@@ -1311,6 +1351,20 @@ function addServiceItem(e, data = null) {
                 <input type="date" class="info-input promo-date-end" value="${promoEnd}">
             </div>
         </div>
+
+        <!-- VARIANTES Y EXTRAS -->
+        <div class="modifiers-block">
+            <div class="modifiers-header">
+                <i class="lni lni-layers"></i>
+                <span>Variantes y extras</span>
+                <button type="button" class="btn-add-modifier-group">
+                    <i class="lni lni-plus"></i> Agregar grupo
+                </button>
+            </div>
+            <div class="modifier-groups">
+                ${(data?.modifiers || []).map(modifierGroupHTML).join('')}
+            </div>
+        </div>
     `;
 
 
@@ -1326,6 +1380,14 @@ function addServiceItem(e, data = null) {
         });
     });
 
+    // Grupos de variantes y extras
+    div.querySelector('.btn-add-modifier-group').addEventListener('click', () => {
+        div.querySelector('.modifier-groups').insertAdjacentHTML('beforeend', modifierGroupHTML());
+    });
+    div.querySelector('.modifier-groups').addEventListener('click', (ev) => {
+        ev.target.closest('.btn-remove-modifier-group')?.closest('.modifier-group').remove();
+    });
+
     // Toggle Días / Rango en el periodo
     div.querySelectorAll('.period-tab-btn').forEach(btn => {
         btn.addEventListener('click', function() {
@@ -1446,6 +1508,25 @@ function addServiceItem(e, data = null) {
         });
     }
 
+    // Inventario — con existencias en cero el producto queda agotado y al
+    // reabastecer vuelve a estar en existencia
+    const trackCheckbox = div.querySelector('.service-track-stock');
+    const stockInput = div.querySelector('.service-stock');
+    const syncStockToggle = () => {
+        if (!trackCheckbox.checked || !stockCheckbox) return;
+        const available = (parseInt(stockInput.value) || 0) > 0;
+        if (stockCheckbox.checked !== available) {
+            stockCheckbox.checked = available;
+            stockCheckbox.dispatchEvent(new Event('change'));
+        }
+    };
+    trackCheckbox?.addEventListener('change', function() {
+        div.querySelector('.stock-track-fields').style.display = this.checked ? 'flex' : 'none';
+        if (this.checked && stockInput.value === '') stockInput.value = 0;
+        syncStockToggle();
+    });
+    stockInput?.addEventListener('input', syncStockToggle);
+
     list.appendChild(div);
 }
 
@@ -1477,10 +1558,18 @@ function collectServicesData() {
         }
 
         const inStockEl = item.querySelector('.service-in-stock');
+        const stockEl = item.querySelector('.service-stock');
         services.push({
             title,
             description:    item.querySelector('.service-desc')?.value || '',
             inStock:        inStockEl ? inStockEl.checked : true,
+            trackStock:     item.querySelector('.service-track-stock')?.checked || false,
+            stock:          parseInt(stockEl?.value) || 0,
+            // Lo que mostraba el formulario: si no cambió, el backend conserva
+            // las existencias vigentes (los pedidos descuentan mientras se edita)
+            stockLoaded:    stockEl?.dataset.loaded ? parseInt(stockEl.dataset.loaded) : null,
+            lowStockAlert:  parseInt(item.querySelector('.service-low-stock')?.value) || 0,
+            durationMinutes: parseInt(item.querySelector('.service-duration')?.value) || 0,
             imageUrls:      (item.querySelector('.service-image-urls')?.value || '').split(',').filter(Boolean),
             priceType:      isPromo ? 'promo' : 'normal',
             price:          parseFloat(item.querySelector('.service-price')?.value) || 0,
@@ -1490,11 +1579,60 @@ function collectServicesData() {
             promoDays:       isPromo && promoPeriodType === 'days' ? promoDays : [],
             promoDateStart:  isPromo && promoPeriodType === 'range' ? promoDateStart : '',
             promoDateEnd:    isPromo && promoPeriodType === 'range' ? promoDateEnd   : '',
+            modifiers:       collectModifierGroups(item),
         });
     });
     return services;
 }
 
+// ============================================
+// VARIANTES Y EXTRAS DEL SERVICIO
+// Cada opción va en una línea: "Grande | 40"
+// ============================================
+
+function modifierGroupHTML(group = null) {
+    const attr = (v) => String(v ?? '').replace(/&/g, '&amp;').replace(/"/g, '&quot;').replace(/</g, '&lt;');
+    const lines = (group?.options || []).map(o => o.priceDelta ? `${o.name} | ${o.priceDelta}` : o.name).join('\n');
+    return `
+        <div class="modifier-group">
+            <div class="modifier-group-row">
+                <input type="text" class="info-input modifier-group-name" placeholder="Grupo (ej. Tamaño, Extras)" value="${attr(group?.name)}">
+                <label class="modifier-flag" title="El cliente debe elegir una opción">
+                    <input type="checkbox" class="modifier-required" ${group?.required ? 'checked' : ''}>
+                    <span>Obligatorio</span>
+                </label>
+                <label class="modifier-flag" title="Se pueden elegir varias opciones">
+                    <input type="checkbox" class="modifier-multiple" ${group?.multiple ? 'checked' : ''}>
+                    <span>Varias</span>
+                </label>
+                <button type="button" class="btn-remove-item btn-remove-modifier-group" title="Quitar grupo">
+                    <i class="lni lni-trash-can"></i>
+                </button>
+            </div>
+            <textarea class="info-input modifier-options" rows="3" placeholder="Una opción por línea: Nombre | precio extra&#10;Chica&#10;Grande | 40">${attr(lines)}</textarea>
+        </div>
+    `;
+}
+
+function collectModifierGroups(item) {
+    const groups = [];
+    item.querySelectorAll('.modifier-group').forEach(el => {
+        const name = el.querySelector('.modifier-group-name')?.value.trim();
+        const options = (el.querySelector('.modifier-options')?.value || '').split('\n').map(line => {
+            const [optName, delta] = line.split('|');
+            return { name: (optName || '').trim(), priceDelta: parseFloat((delta || '').replace(/[$\s]/g, '')) || 0 };
+        }).filter(o => o.name);
+        if (!name || !options.length) return;
+        groups.push({
+            name,
+            required: el.querySelector('.modifier-required')?.checked || false,
+            multiple: el.querySelector('.modifier-multiple')?.checked || false,
+            options,
+        });
+    });
+    return groups;
+}
+
 // ============================================
 // WORKERS
 // ============================================
@@ -1547,6 +1685,9 @@ function addWorkerItem(e, data = null) {
             <input type="time" class="info-input worker-end" value="${data?.endTime || '18:00'}">
         </div>
         <div class="worker-days">${daysHTML}</div>
+        <div class="worker-item-row">
+            <input type="text" class="info-input worker-services" placeholder="Servicios que realiza, separados por coma (vacío = todos)" value="${(data?.services || []).join(', ')}">
+        </div>
     `;
 
     div.querySelectorAll('.day-chip').forEach(chip => {
@@ -1572,11 +1713,174 @@ function collectWorkersData() {
             startTime: item.querySelector('.worker-start')?.value || '09:00',
             endTime: item.querySelector('.worker-end')?.value || '18:00',
             days,
+            services: (item.querySelector('.worker-services')?.value || '')
+                .split(',').map(s => s.trim()).filter(Boolean),
         });
     });
     return workers;
 }
 
+// ============================================
+// RESOURCES (sillas, cabinas, canchas...)
+// ============================================
+
+function initResources() {
+    document.getElementById('btnAddResource')?.addEventListener('click', addResourceItem);
+}
+
+function renderResources(resources = []) {
+    const list = document.getElementById('resourcesList');
+    const hint = document.getElementById('resourcesHint');
+    if (!list) return;
+    list.innerHTML = '';
+    if (resources.length === 0) {
+        hint && (hint.style.display = 'flex');
+        return;
+    }
+    hint && (hint.style.display = 'none');
+    resources.forEach(r => addResourceItem(null, r));
+}
+
+function addResourceItem(e, data = null) {
+    const list = document.getElementById('resourcesList');
+    const hint = document.getElementById('resourcesHint');
+    hint && (hint.style.display = 'none');
+
+    const div = document.createElement('div');
+    div.className = 'resource-item';
+    div.innerHTML = `
+        <div class="resource-item-row">
+            <input type="text" class="info-input resource-name" placeholder="Nombre (p. ej. Silla, Cabina, Cancha)" value="${data?.name || ''}">
+            <input type="number" class="info-input resource-capacity" placeholder="Cantidad" min="1" step="1" title="Cuántas hay (citas al mismo tiempo)" value="${data?.capacity || 1}">
+            <button type="button" class="btn-remove-item" onclick="removeItem(this, 'resourcesList', 'resourcesHint')">
+                <i class="lni lni-trash-can"></i>
+            </button>
+        </div>
+        <div class="resource-item-row">
+            <input type="text" class="info-input resource-services" placeholder="Servicios que lo ocupan, separados por coma (vacío = todos)" value="${(data?.services || []).join(', ')}">
+        </div>
+    `;
+
+    list.appendChild(div);
+}
+
+function collectResourcesData() {
+    const resources = [];
+    document.querySelectorAll('.resource-item').forEach(item => {
+        const name = item.querySelector('.resource-name')?.value.trim();
+        if (!name) return;
+        resources.push({
+            name,
+            capacity: parseInt(item.querySelector('.resource-capacity')?.value) || 1,
+            services: (item.querySelector('.resource-services')?.value || '')
+                .split(',').map(s => s.trim()).filter(Boolean),
+        });
+    });
+    return resources;
+}
+
+// ============================================
+// DELIVERY ZONES (código postal, radio o polígono)
+// ============================================
+
+function initDeliveryZones() {
+    document.getElementById('btnAddDeliveryZone')?.addEventListener('click', addDeliveryZoneItem);
+}
+
+function renderDeliveryZones(zones = []) {
+    const list = document.getElementById('deliveryZonesList');
+    const hint = document.getElementById('deliveryZonesHint');
+    if (!list) return;
+    list.innerHTML = '';
+    if (zones.length === 0) {
+        hint && (hint.style.display = 'flex');
+        return;
+    }
+    hint && (hint.style.display = 'none');
+    zones.forEach(z => addDeliveryZoneItem(null, z));
+}
+
+function addDeliveryZoneItem(e, data = null) {
+    const list = document.getElementById('deliveryZonesList');
+    const hint = document.getElementById('deliveryZonesHint');
+    hint && (hint.style.display = 'none');
+
+    const type = data?.type || 'postal_codes';
+    const polygon = (data?.polygon || []).map(p => `${p.lat},${p.lng}`).join('\n');
+
+    const div = document.createElement('div');
+    div.className = 'delivery-zone-item';
+    div.innerHTML = `
+        <div class="delivery-zone-item-row">
+            <input type="text" class="info-input zone-name" placeholder="Nombre (p. ej. Centro)" value="${data?.name || ''}">
+            <select class="info-input zone-type">
+                <option value="postal_codes" ${type === 'postal_codes' ? 'selected' : ''}>Códigos postales</option>
+                <option value="radius" ${type === 'radius' ? 'selected' : ''}>Radio (km)</option>
+                <option value="polygon" ${type === 'polygon' ? 'selected' : ''}>Polígono</option>
+            </select>
+            <button type="button" class="btn-remove-item" onclick="removeItem(this, 'deliveryZonesList', 'deliveryZonesHint')">
+                <i class="lni lni-trash-can"></i>
+            </button>
+        </div>
+        <div class="delivery-zone-item-row zone-area" data-type="postal_codes">
+            <input type="text" class="info-input zone-postal-codes" placeholder="Códigos postales separados por coma (83000, 83010...)" value="${(data?.postalCodes || []).join(', ')}">
+        </div>
+        <div class="delivery-zone-item-row zone-area" data-type="radius">
+            <input type="number" class="info-input zone-radius" placeholder="Radio desde el local (km)" min="0" step="0.1" value="${data?.radiusKm || ''}">
+        </div>
+        <div class="delivery-zone-item-row zone-area" data-type="polygon">
+            <textarea class="info-input zone-polygon" rows="4" placeholder="Un vértice por línea: latitud,longitud">${polygon}</textarea>
+        </div>
+        <div class="delivery-zone-item-row">
+            <input type="number" class="info-input zone-fee" placeholder="Envío ($)" min="0" step="1" title="Costo de envío (MXN)" value="${data?.fee ?? ''}">
+            <input type="number" class="info-input zone-min-order" placeholder="Pedido mínimo ($)" min="0" step="1" title="Pedido mínimo sin envío (MXN)" value="${data?.minOrder || ''}">
+            <input type="number" class="info-input zone-eta" placeholder="Tiempo (min)" min="0" step="5" title="Tiempo estimado de entrega" value="${data?.etaMinutes || ''}">
+        </div>
+    `;
+
+    const typeSelect = div.querySelector('.zone-type');
+    const syncZoneType = () => {
+        div.querySelectorAll('.zone-area').forEach(area => {
+            area.style.display = area.dataset.type === typeSelect.value ? 'flex' : 'none';
+        });
+    };
+    typeSelect.addEventListener('change', syncZoneType);
+    syncZoneType();
+
+    list.appendChild(div);
+}
+
+function collectDeliveryZonesData() {
+    const zones = [];
+    document.querySelectorAll('.delivery-zone-item').forEach(item => {
+        const type = item.querySelector('.zone-type')?.value || 'postal_codes';
+        const zone = {
+            name: item.querySelector('.zone-name')?.value.trim() || '',
+            type,
+            fee: parseFloat(item.querySelector('.zone-fee')?.value) || 0,
+            minOrder: parseFloat(item.querySelector('.zone-min-order')?.value) || 0,
+            etaMinutes: parseInt(item.querySelector('.zone-eta')?.value) || 0,
+        };
+        if (type === 'postal_codes') {
+            zone.postalCodes = (item.querySelector('.zone-postal-codes')?.value || '')
+                .split(',').map(s => s.trim()).filter(Boolean);
+            if (zone.postalCodes.length === 0) return;
+        } else if (type === 'radius') {
+            zone.radiusKm = parseFloat(item.querySelector('.zone-radius')?.value) || 0;
+            if (zone.radiusKm <= 0) return;
+        } else {
+            zone.polygon = (item.querySelector('.zone-polygon')?.value || '')
+                .split('\n')
+                .map(line => line.split(',').map(n => parseFloat(n.trim())))
+                .filter(p => p.length === 2 && !isNaN(p[0]) && !isNaN(p[1]))
+                .map(([lat, lng]) => ({ lat, lng }));
+            if (zone.polygon.length < 3) return;
+        }
+        zones.push(zone);
+    });
+    return zones;
+}
+
 function removeItem(btn, listId, hintId) {
     btn.closest('[class$="-item"]').remove();
     const list = document.getElementById(listId);
@@ -25,6 +25,35 @@ async function initOrders() {
     await loadOrders();
     updateStats();
     renderOrders();
+    connectOrderStream();
+}
+
+// Pedidos nuevos y cambios de estado en tiempo real (SSE)
+function connectOrderStream() {
+    const stream = new EventSource('/api/orders/stream', { withCredentials: true });
+    stream.addEventListener('order', e => {
+        const { type, order } = JSON.parse(e.data);
+        const idx = orders.findIndex(o => String(o.id) === String(order.id));
+        if (type === 'deleted') {
+            if (idx >= 0) orders.splice(idx, 1);
+        } else if (idx >= 0) {
+            orders[idx] = order;
+        } else {
+            orders.unshift(order);
+        }
+        if (type === 'created') showNotification(`Nuevo pedido de ${order.clientName}`, 'info');
+
+        if (orders.length === 0) showEmptyState();
+        else hideEmptyState();
+        // No redibujar con un menú de acciones abierto: se cerraría bajo el cursor
+        if (!openDropdown) { updateStats(); renderOrders(); }
+    });
+    // Al reconectar se recarga la lista por si se perdió algún evento
+    stream.onerror = () => {
+        stream.addEventListener('ready', async () => {
+            await loadOrders(); updateStats(); renderOrders();
+        }, { once: true });
+    };
 }
 
 // ==========================================
@@ -211,11 +240,11 @@ function createRow(o) {
         <div class="actions-dropdown">
           <button class="actions-btn" onclick="toggleDropdown(event,${o.id},this)"><i class="lni lni-more-alt"></i></button>
           <div class="actions-menu" id="dropdown-${o.id}">
-            ${o.status!=='preparing'&&o.status!=='ready'&&o.status!=='delivered' ? `<div class="action-item preparing" onclick="updateStatus(${o.id},'preparing')"><i class="lni lni-alarm-clock"></i>En preparación</div>` : ''}
-            ${o.status!=='ready'&&o.status!=='delivered' ? `<div class="action-item ready" onclick="updateStatus(${o.id},'ready')"><i class="lni lni-checkmark-circle"></i>Listo</div>` : ''}
-            ${o.status==='ready'&&o.orderType==='delivery' ? `<div class="action-item delivered" onclick="updateStatus(${o.id},'delivered')"><i class="lni lni-delivery"></i>Entregado</div>` : ''}
+            ${canTransition(o.status,'preparing') ? `<div class="action-item preparing" onclick="updateStatus(${o.id},'preparing')"><i class="lni lni-alarm-clock"></i>En preparación</div>` : ''}
+            ${canTransition(o.status,'ready') ? `<div class="action-item ready" onclick="updateStatus(${o.id},'ready')"><i class="lni lni-checkmark-circle"></i>Listo</div>` : ''}
+            ${canTransition(o.status,'delivered') ? `<div class="action-item delivered" onclick="updateStatus(${o.id},'delivered')"><i class="lni lni-delivery"></i>Entregado</div>` : ''}
             ${o.clientPhone ? `<div class="action-item whatsapp" onclick="sendWhatsApp('${o.clientPhone}','${escHtml(o.clientName)}',${o.id})"><i class="lni lni-whatsapp"></i>WhatsApp</div>` : ''}
-            ${o.status!=='cancelled' ? `<div class="action-item cancel" onclick="updateStatus(${o.id},'cancelled')"><i class="lni lni-ban"></i>Cancelar</div>` : ''}
+            ${canTransition(o.status,'cancelled') ? `<div class="action-item cancel" onclick="updateStatus(${o.id},'cancelled')"><i class="lni lni-ban"></i>Cancelar</div>` : ''}
             <div class="action-item delete" onclick="deleteOrder(${o.id},'${escHtml(o.clientName)}')"><i class="lni lni-trash-can"></i>Eliminar</div>
           </div>
         </div>
@@ -406,6 +435,9 @@ function addItemRow(data = {}) {
 
     const row = document.createElement('div');
     row.className = 'item-row';
+    // Las variantes y extras del bot o de Ninda se conservan al editar
+    row._options = data.options || [];
+    row._optionsFor = data.name || '';
 
     // Construir opciones del dropdown
     const hasMenu = menuProducts.length > 0;
@@ -537,6 +569,7 @@ function collectItems() {
             quantity: parseInt(row.querySelector('.item-qty')?.value)    || 1,
             price:    parseFloat(row.querySelector('.item-price')?.value) || 0,
             notes:    row.querySelector('.item-notes')?.value.trim()      || '',
+            options:  name === row._optionsFor ? row._options : [],
         });
     });
     return items;
@@ -612,8 +645,12 @@ async function updateStatus(id, status) {
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify({ status }),
         });
-        if (!res.ok) throw new Error('Error actualizando');
-        showNotification(`Pedido → ${statusLabel(status)}`, 'success');
+        if (!res.ok) {
+            const err = await res.json().catch(() => ({}));
+            throw new Error(err.error || 'Error actualizando');
+        }
+        const data = await res.json();
+        showNotification(`Pedido → ${statusLabel(status)}${data.notify ? ' · avisando al cliente' : ''}`, 'success');
         await loadOrders(); updateStats(); renderOrders();
     } catch (err) {
         showNotification(err.message, 'error');
@@ -785,7 +822,25 @@ function closeConfirmModal() {
 
 function itemsToText(items) {
     if (!items || !items.length) return '—';
-    return items.map(i => `${i.quantity}x ${i.name}`).join(', ');
+    return items.map(i => `${i.quantity}x ${itemLabel(i)}`).join(', ');
+}
+
+// Nombre con variantes y extras: "Pizza Hawaiana (Grande, Extra queso)"
+function itemLabel(item) {
+    const opts = (item.options || []).map(o => o.name);
+    return opts.length ? `${item.name} (${opts.join(', ')})` : item.name;
+}
+
+// Mismas transiciones que models.OrderStatus.CanTransitionTo
+const ORDER_TRANSITIONS = {
+    pending:   ['confirmed', 'preparing', 'ready', 'cancelled'],
+    confirmed: ['preparing', 'ready', 'cancelled'],
+    preparing: ['ready', 'cancelled'],
+    ready:     ['delivered', 'cancelled'],
+};
+
+function canTransition(from, to) {
+    return (ORDER_TRANSITIONS[from] || []).includes(to);
 }
 
 function statusLabel(s) {
@@ -0,0 +1,88 @@
+// ============================================
+// Reset Password Page — JavaScript
+// ============================================
+
+const form          = document.getElementById('resetForm');
+const submitBtn     = document.getElementById('submitBtn');
+const btnIcon       = document.getElementById('btnIcon');
+const btnText       = document.getElementById('btnText');
+const errorMsg      = document.getElementById('errorMsg');
+const errorText     = document.getElementById('errorText');
+const passwordInput = document.getElementById('passwordInput');
+const confirmInput  = document.getElementById('confirmInput');
+
+const token = form.dataset.token || new URLSearchParams(window.location.search).get('token') || '';
+
+function showError(message) {
+    errorText.textContent  = message;
+    errorMsg.style.display = 'flex';
+}
+
+// ─── Sin token en la URL ─────────────────────
+if (!token) {
+    submitBtn.disabled = true;
+    showError('El enlace no es válido. Solicita uno nuevo.');
+}
+
+// ─── Submit ──────────────────────────────────
+form.addEventListener('submit', async (e) => {
+    e.preventDefault();
+
+    const password = passwordInput.value;
+    const confirm  = confirmInput.value;
+
+    // Reset estado
+    errorMsg.style.display = 'none';
+    passwordInput.classList.remove('error');
+    confirmInput.classList.remove('error');
+
+    if (password.length < 8) {
+        passwordInput.classList.add('error');
+        showError('La contraseña debe tener al menos 8 caracteres.');
+        return;
+    }
+
+    if (password !== confirm) {
+        confirmInput.classList.add('error');
+        showError('Las contraseñas no coinciden.');
+        return;
+    }
+
+    // Loading state
+    submitBtn.disabled  = true;
+    btnIcon.className   = 'lni lni-spinner spinning';
+    btnText.textContent = 'Guardando...';
+
+    try {
+        const response = await fetch('/api/user/password-reset/confirm', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            credentials: 'include',
+            body: JSON.stringify({ token, newPassword: password })
+        });
+
+        const data = await response.json();
+
+        if (response.ok) {
+            document.getElementById('formState').style.display    = 'none';
+            document.getElementById('successState').style.display = 'block';
+        } else {
+            showError(data.error || 'No pudimos actualizar tu contraseña. Inténtalo de nuevo.');
+        }
+    } catch (err) {
+        console.error('Error:', err);
+        showError('Error de conexión. Verifica tu internet e inténtalo de nuevo.');
+    } finally {
+        submitBtn.disabled  = false;
+        btnIcon.className   = 'lni lni-lock';
+        btnText.textContent = 'Guardar contraseña';
+    }
+});
+
+// ─── Limpiar error al escribir ───────────────
+[passwordInput, confirmInput].forEach((input) => {
+    input.addEventListener('input', () => {
+        input.classList.remove('error');
+        errorMsg.style.display = 'none';
+    });
+});
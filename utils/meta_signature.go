@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// VerifyMetaSignature valida el header X-Hub-Signature-256 que Meta envía en
+// cada webhook: "sha256=" + HMAC-SHA256(body, app secret) en hexadecimal.
+func VerifyMetaSignature(body []byte, signatureHeader, appSecret string) bool {
+	if appSecret == "" || !strings.HasPrefix(signatureHeader, "sha256=") {
+		return false
+	}
+
+	received, err := hex.DecodeString(strings.TrimPrefix(signatureHeader, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	return hmac.Equal(received, mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"testing"
+)
+
+const testAppSecret = "test-app-secret"
+
+func signMetaPayload(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyMetaSignature(t *testing.T) {
+	body, err := os.ReadFile("testdata/meta_message.json")
+	if err != nil {
+		t.Fatalf("leyendo fixture: %v", err)
+	}
+	valid := signMetaPayload(body, testAppSecret)
+	tampered := bytes.Replace(body, []byte("agendar una cita"), []byte("cancelar mi cita"), 1)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		secret    string
+		want      bool
+	}{
+		{"firma válida", body, valid, testAppSecret, true},
+		{"firma de otro secreto", body, signMetaPayload(body, "otro-secreto"), testAppSecret, false},
+		{"firma no hexadecimal", body, "sha256=zzzz", testAppSecret, false},
+		{"sin prefijo sha256", body, valid[len("sha256="):], testAppSecret, false},
+		{"sin header", body, "", testAppSecret, false},
+		{"body alterado", tampered, valid, testAppSecret, false},
+		{"sin app secret", body, signMetaPayload(body, ""), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyMetaSignature(tt.body, tt.signature, tt.secret); got != tt.want {
+				t.Errorf("VerifyMetaSignature() = %v, se esperaba %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package utils
+
+import "strings"
+
+// SplitFullName separa un nombre completo en nombre y apellido
+func SplitFullName(fullName string) (string, string) {
+	parts := strings.Fields(fullName)
+	if len(parts) == 0 {
+		return "", ""
+	}
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], strings.Join(parts[1:], " ")
+}
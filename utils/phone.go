@@ -0,0 +1,19 @@
+package utils
+
+import "strings"
+
+// PhoneKey normaliza un teléfono a sus últimos 10 dígitos para comparar
+// números mexicanos guardados con o sin 52/521, con espacios o con "+".
+func PhoneKey(phone string) string {
+	var sb strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	digits := sb.String()
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+	return digits
+}